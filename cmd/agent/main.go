@@ -5,7 +5,13 @@ import (
 	"context"
 	"devops-tpl/internal/agent"
 	"devops-tpl/internal/agent/config"
+	"devops-tpl/internal/configloader"
+	"devops-tpl/internal/logging"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"os/signal"
 	"syscall"
@@ -39,11 +45,37 @@ func main() {
 	ctx, ctxCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer ctxCancel()
 
+	config, loadResult, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if loadResult.PrintConfig {
+		err = configloader.Print(os.Stdout, config, loadResult)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	fmt.Printf("Build version: %s\n", buildVersion)
 	fmt.Printf("Build date: %s\n", buildDate)
 	fmt.Printf("Build commit: %s\n", buildCommit)
 
-	config := config.LoadConfig()
-	app := agent.NewHTTPClient(config)
+	var logWriter io.Writer = os.Stderr
+	if config.LogFile != "" {
+		logFile, err := logging.OpenRotatingFile(config.LogFile, int64(config.LogMaxSize)<<20, config.LogMaxBackups)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer logFile.Close()
+		logWriter = logFile
+	}
+	logging.Setup(logWriter, config.LogFormat, config.DebugMode)
+
+	app := agent.NewHTTPClient(config, buildVersion)
 	app.Run(ctx)
 }
@@ -0,0 +1,49 @@
+// Администрирование работающего сервера метрик по HTTP или gRPC
+package main
+
+import (
+	"context"
+	"devops-tpl/internal/configloader"
+	"devops-tpl/internal/metricsctl"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	ctx, ctxCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	defer ctxCancel()
+
+	log.SetFlags(0)
+
+	config, loadResult, err := metricsctl.LoadConfig(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if loadResult.PrintConfig {
+		err = configloader.Print(os.Stdout, config, loadResult)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	client, err := metricsctl.NewClient(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	err = metricsctl.Run(ctx, client, metricsctl.NewPrinter(os.Stdout, config.Output), config.Timeout, loadResult.Args)
+	if err != nil {
+		client.Close()
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"devops-tpl/internal/server/auth"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+const authKeyUsage = "usage: server auth-key -name name [-tenant tenant] [-scopes write,read,admin] [-subject common-name]"
+
+// runAuthKey - новый API ключ: токен для клиента и запись для файла ключей (flag: auth-keys), в файле хранится только хэш.
+// С -subject токен не создается: ключ выбирается по CommonName клиентского сертификата.
+func runAuthKey(args []string) error {
+	flagSet := flag.NewFlagSet("auth-key", flag.ContinueOnError)
+	name := flagSet.String("name", "", "key name for audit log")
+	tenantName := flagSet.String("tenant", "", "key tenant (default: default tenant)")
+	scopes := flagSet.String("scopes", auth.ScopeWrite, "comma separated scopes: write, read, admin")
+	subject := flagSet.String("subject", "", "client certificate CommonName instead of token")
+	err := flagSet.Parse(args)
+	if err != nil || flagSet.NArg() != 0 || *name == "" {
+		return errors.New(authKeyUsage)
+	}
+
+	key := auth.Key{
+		Name:    *name,
+		Subject: *subject,
+		Tenant:  *tenantName,
+		Scopes:  strings.Split(*scopes, ","),
+	}
+
+	var token string
+	if key.Subject == "" {
+		token, err = auth.GenerateToken()
+		if err != nil {
+			return err
+		}
+		key.Hash = auth.HashToken(token)
+	}
+
+	_, err = auth.NewKeySet([]auth.Key{key})
+	if err != nil {
+		return err
+	}
+
+	entry, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	if token != "" {
+		fmt.Printf("token: %s\n", token)
+	}
+	fmt.Printf("keys file entry: %s\n", entry)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	agentConfig "devops-tpl/internal/agent/config"
+	"devops-tpl/internal/agent/metricsuploader"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/federation"
+	"os"
+	"strings"
+)
+
+// newForwarder - пересылка на вышестоящие серверы через HTTP клиент агента (повторы, подпись, RSA).
+func newForwarder(forwardConfig config.ForwardConfig) (*federation.Forwarder, error) {
+	if forwardConfig.Origin == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		forwardConfig.Origin = hostname
+	}
+
+	var upstreams []federation.Upstream
+	for _, upstreamAddr := range forwardConfig.Upstreams {
+		upstreamAddr = strings.TrimSpace(upstreamAddr)
+		if upstreamAddr == "" {
+			continue
+		}
+
+		uploader := metricsuploader.NewMetricsUploader(agentConfig.HTTPClientConfig{
+			RetryCount:       forwardConfig.RetryCount,
+			RetryWaitTime:    forwardConfig.RetryWaitTime,
+			RetryMaxWaitTime: forwardConfig.RetryMaxWaitTime,
+			ServerAddr:       upstreamAddr,
+			Token:            forwardConfig.Token,
+		}, forwardConfig.SignKey, forwardConfig.PublicKeyRSA)
+
+		upstreams = append(upstreams, federation.Upstream{
+			Addr:     upstreamAddr,
+			Uploader: uploader,
+		})
+	}
+
+	return federation.NewForwarder(forwardConfig, upstreams)
+}
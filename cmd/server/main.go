@@ -3,10 +3,15 @@ package main
 
 import (
 	"context"
+	"devops-tpl/internal/configloader"
+	"devops-tpl/internal/logging"
 	"devops-tpl/internal/server/config"
 	"devops-tpl/internal/server/server"
 	"errors"
+	"flag"
 	"fmt"
+	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -20,9 +25,25 @@ var buildCommit = "N/A"
 func Profiling(addr string) {
 	err := http.ListenAndServe(addr, nil)
 	if errors.Is(err, http.ErrServerClosed) {
-		fmt.Printf("server closed\n")
+		slog.Info("Profiling server closed")
 	} else if err != nil {
-		fmt.Printf("error starting server: %s\n", err)
+		slog.Error("Profiling server error", logging.Err(err))
+	}
+}
+
+// runCommand - подкоманды сервера: migrate, export, import, auth-key.
+func runCommand(config config.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(config, args[1:])
+	case "export":
+		return runExport(config, args[1:])
+	case "import":
+		return runImport(config, args[1:])
+	case "auth-key":
+		return runAuthKey(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, expected migrate, export, import or auth-key", args[0])
 	}
 }
 
@@ -31,13 +52,46 @@ func main() {
 	ctx, ctxCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer ctxCancel()
 
+	config, loadResult, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if loadResult.PrintConfig {
+		err = configloader.Print(os.Stdout, config, loadResult)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Подкоманды выполняются до вывода версии: export пишет данные в stdout
+	if args := loadResult.Args; len(args) != 0 {
+		err := runCommand(config, args)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	fmt.Printf("Build version: %s\n", buildVersion)
 	fmt.Printf("Build date: %s\n", buildDate)
 	fmt.Printf("Build commit: %s\n", buildCommit)
 
-	config := config.LoadConfig()
+	logging.Setup(os.Stderr, config.LogFormat, config.DebugMode)
 	server := server.NewServer(config)
 
+	if len(config.Forward.Upstreams) != 0 {
+		forwarder, err := newForwarder(config.Forward)
+		if err != nil {
+			logging.Fatal("Forward config error", logging.Err(err))
+		}
+		server.SetForwarder(forwarder)
+	}
+
 	if server.Config().ProfilingAddr != "" {
 		go Profiling(server.Config().ProfilingAddr)
 	}
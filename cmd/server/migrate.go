@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: server [flags] migrate up|down [steps]|status"
+
+// runMigrate - режим управления миграциями БД: server -d <dsn> migrate up|down [steps]|status.
+func runMigrate(config config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if config.Store.DatabaseDSN == "" {
+		return errors.New("migrations require a Postgres or SQLite DSN (flag: d, env: DATABASE_DSN)")
+	}
+
+	db, migrator, err := storage.OpenMigrator(config.Store.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		versions, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied migrations: %v\n", versions)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return errors.New(migrateUsage)
+			}
+		}
+
+		versions, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted migrations: %v\n", versions)
+	case "status":
+		statusList, err := migrator.Status(ctx)
+		printMigrationStatus(statusList)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
+
+func printMigrationStatus(statusList []storage.MigrationStatus) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+	applied := 0
+	for _, status := range statusList {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+			applied++
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	writer.Flush()
+
+	if applied == 0 {
+		fmt.Println("No migrations applied")
+	}
+}
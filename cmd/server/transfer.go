@@ -0,0 +1,141 @@
+package main
+
+import (
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/transfer"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	exportUsage = "usage: server [flags] export [-format json|ndjson|csv] [-o file]"
+	importUsage = "usage: server [flags] import [-format json|ndjson|csv] [-mode overwrite|merge] [-dry-run] file|-"
+)
+
+// openStorage - хранилище по конфигурации сервера, хранилище в памяти читается из файла.
+// Периодическая выгрузка хранилища в памяти останавливается при закрытии хранилища (Close).
+func openStorage(storeConfig config.StoreConfig) (storage.MetricStorage, error) {
+	if storage.IsSQLiteDSN(storeConfig.DatabaseDSN) {
+		return storage.NewSQLiteRepo(storeConfig)
+	}
+
+	if storeConfig.DatabaseDSN != "" {
+		return storage.NewDBRepo(storeConfig)
+	}
+
+	if storeConfig.File == "" {
+		return nil, errors.New("memory storage requires a store file (flag: f, env: STORE_FILE)")
+	}
+	// Файл выгружается один раз после загрузки, а не на каждое обновление
+	storeConfig.Interval = time.Hour
+	repository := storage.NewMetricsMemoryRepo(storeConfig)
+	repository.InitFromFile()
+
+	return repository, nil
+}
+
+// runExport - выгрузка всех метрик хранилища: server [flags] export [-format csv] [-o file].
+func runExport(config config.Config, args []string) error {
+	flagSet := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flagSet.String("format", "", "output format: json, ndjson or csv (default: by file extension or json)")
+	output := flagSet.String("o", "", "output file (default: stdout)")
+	err := flagSet.Parse(args)
+	if err != nil || flagSet.NArg() != 0 {
+		return errors.New(exportUsage)
+	}
+
+	if *format == "" {
+		*format = transfer.FormatByPath(*output)
+	}
+
+	metricStorage, err := openStorage(config.Store)
+	if err != nil {
+		return err
+	}
+	defer metricStorage.Close()
+
+	var writer io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	metrics := transfer.Flatten(metricStorage.ReadAll())
+	err = transfer.Export(writer, *format, metrics)
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %d metrics", len(metrics))
+
+	return nil
+}
+
+// runImport - загрузка метрик в хранилище: server [flags] import [-mode merge] [-dry-run] file.
+func runImport(config config.Config, args []string) error {
+	flagSet := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flagSet.String("format", "", "input format: json, ndjson or csv (default: by file extension or json)")
+	mode := flagSet.String("mode", transfer.ModeOverwrite, "counters: overwrite replaces the stored value, merge adds to it")
+	dryRun := flagSet.Bool("dry-run", false, "print changes without writing")
+	err := flagSet.Parse(args)
+	if err != nil || flagSet.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+
+	input := flagSet.Arg(0)
+	if *format == "" {
+		*format = transfer.FormatByPath(input)
+	}
+
+	var reader io.Reader = os.Stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	metrics, err := transfer.Import(reader, *format)
+	if err != nil {
+		return err
+	}
+
+	metricStorage, err := openStorage(config.Store)
+	if err != nil {
+		return err
+	}
+	defer metricStorage.Close()
+
+	plan, err := transfer.NewPlan(metricStorage.ReadAll(), metrics, *mode)
+	if err != nil {
+		return err
+	}
+	plan.PrintDiff(os.Stdout)
+	if *dryRun {
+		return nil
+	}
+
+	err = plan.Apply(metricStorage)
+	if err != nil {
+		return err
+	}
+
+	err = metricStorage.Save()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d metrics\n", len(plan.Changes))
+
+	return nil
+}
@@ -4,12 +4,20 @@ import (
 	"context"
 	"devops-tpl/internal/agent/config"
 	"devops-tpl/internal/agent/metricsuploader"
+	"devops-tpl/internal/agent/pushreceiver"
+	"devops-tpl/internal/agent/selfmetrics"
 	"devops-tpl/internal/agent/statsreader"
-	"log"
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/reload"
+	"errors"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
-
-	"golang.org/x/sync/errgroup"
 )
 
 type MUploader interface {
@@ -28,48 +36,175 @@ type AppHTTP struct {
 		lastRefreshTime time.Time
 		lastUploadTime  time.Time
 	}
-	loader MetricUploader
-	config config.Config
+	loader  MetricUploader
+	scraper *statsreader.PrometheusScraper
+	// startConfig - конфигурация запуска, основа для перечитывания; localConfig - последняя локальная
+	// конфигурация; config - действующая конфигурация: локальная с настройками профиля сервера.
+	// localConfig и config меняются только в цикле Run
+	startConfig config.Config
+	localConfig config.Config
+	config      config.Config
+	// reloads - новая конфигурация для применения в цикле Run
+	reloads chan config.Config
+	// version - версия сборки агента, передается серверу при регистрации
+	version string
+	remote  remoteState
+	// stats - метрики работы агента, отправляются вместе с метриками и доступны на /status
+	stats *selfmetrics.Stats
 }
 
-func NewHTTPClient(config config.Config) *AppHTTP {
+func NewHTTPClient(appConfig config.Config, version string) *AppHTTP {
 	var app AppHTTP
-	app.config = config
+	app.version = version
+	app.startConfig = appConfig
+	app.localConfig = appConfig
+	app.config = appConfig
+	app.reloads = make(chan config.Config, 1)
+	app.remote = newRemoteState()
+	app.stats = selfmetrics.NewStats()
 	app.loader.metricsUplader = metricsuploader.NewMetricsUploader(app.config.HTTPClientConnection, app.config.SignKey, app.config.PublicKeyRSA)
 
-	if config.ServerGRPCAddr != "" {
+	if appConfig.ServerGRPCAddr != "" {
 		var err error
-		app.loader.metricsUploaderGRPC, err = metricsuploader.NewMetricsUploaderGRPC(app.config.ServerGRPCAddr)
+		app.loader.metricsUploaderGRPC, err = metricsuploader.NewMetricsUploaderGRPC(app.config.ServerGRPCAddr, app.config.HTTPClientConnection.Token)
 
 		if err != nil {
-			log.Fatal(err)
+			logging.Fatal("gRPC uploader error", logging.Err(err))
 		}
 	}
 
+	if len(appConfig.Scrape.Targets) != 0 {
+		app.scraper = statsreader.NewPrometheusScraper(appConfig.Scrape.Targets, appConfig.Scrape.Timeout)
+	}
+
 	return &app
 }
 
-func (m *MetricUploader) uploadMetrics(ctx context.Context, metricsDump *statsreader.MetricsDump, wgRefresh *sync.WaitGroup) {
+// takeUpload - метрики для отправки: прошедшие keep вместе с метриками агента stats. Приращения counter
+// переносятся в отправку, после неудачной отправки их возвращает RestoreCounters.
+func takeUpload(metricsDump *statsreader.MetricsDump, keep func(string) bool, stats *selfmetrics.Stats) *statsreader.MetricsDump {
+	filtered := metricsDump.Filter(keep)
+	metricsDump.SubtractCounters(filtered)
+	// Метрики агента добавляются после фильтра: они нужны для наблюдения за самим агентом
+	stats.WriteTo(filtered)
+
+	return filtered
+}
+
+// uploadMetrics - отправка метрик, прошедших keep, вместе с метриками агента stats после завершения сбора.
+func (m *MetricUploader) uploadMetrics(ctx context.Context, metricsDump *statsreader.MetricsDump, wgRefresh *sync.WaitGroup,
+	keep func(string) bool, stats *selfmetrics.Stats) {
 	wgRefresh.Wait()
+	filtered := takeUpload(metricsDump, keep, stats)
+	uploadDone := stats.StartUpload()
 	go func() {
+		var err error
 		if m.metricsUploaderGRPC != nil {
-			log.Println(m.metricsUploaderGRPC.Upload(ctx, *metricsDump))
-			return
+			err = m.metricsUploaderGRPC.Upload(ctx, *filtered)
+		} else {
+			err = m.metricsUplader.MetricsUploadBatch(*filtered)
 		}
-		err := m.metricsUplader.MetricsUploadBatch(*metricsDump)
+		uploadDone(err)
 		if err != nil {
-			log.Println(err)
+			metricsDump.RestoreCounters(filtered)
+			slog.Error("Cant upload metrics", logging.Err(err))
 		}
 	}()
 }
 
+// registerAgent - регистрация агента на сервере: по gRPC, если задан адрес gRPC сервера, иначе по HTTP.
+func (m MetricUploader) registerAgent(ctx context.Context, info agentapi.Info) {
+	var err error
+	if m.metricsUploaderGRPC != nil {
+		err = m.metricsUploaderGRPC.RegisterAgent(ctx, info)
+	} else {
+		err = m.metricsUplader.RegisterAgent(info)
+	}
+	if err != nil {
+		slog.Error("Agent registration error", logging.Err(err))
+	}
+}
+
+// heartbeat - отметка агента на сервере после отправки метрик. Сервер, не знающий агента (например, после
+// перезапуска), получает повторную регистрацию.
+func (m MetricUploader) heartbeat(ctx context.Context, info agentapi.Info) {
+	var err error
+	if m.metricsUploaderGRPC != nil {
+		err = m.metricsUploaderGRPC.Heartbeat(ctx, info.ID)
+	} else {
+		err = m.metricsUplader.Heartbeat(info.ID)
+	}
+	if errors.Is(err, metricsuploader.ErrAgentNotRegistered) {
+		slog.Info("Agent is not registered on the server, registering")
+		m.registerAgent(ctx, info)
+		return
+	}
+	if err != nil {
+		slog.Warn("Agent heartbeat error", logging.Err(err))
+	}
+}
+
+// agentInfo - сведения агента для регистрации: ID, метки и сводка действующей конфигурации с версией
+// конфигурации сервера.
+func (app *AppHTTP) agentInfo() agentapi.Info {
+	config := app.config
+	hostname, _ := os.Hostname()
+
+	transport := "http"
+	if config.ServerGRPCAddr != "" {
+		transport = "grpc"
+	}
+
+	summary := map[string]string{
+		"poll_interval":               config.PollInterval.String(),
+		agentapi.ConfigReportInterval: config.ReportInterval.String(),
+		"rate_limit":                  strconv.Itoa(config.RateLimit),
+		"transport":                   transport,
+	}
+	if len(config.Scrape.Targets) != 0 {
+		summary["scrape_targets"] = strings.Join(config.Scrape.Targets, ",")
+	}
+	if push := strings.Trim(config.Push.Addr+" "+config.Push.Socket, " "); push != "" {
+		summary["push"] = push
+	}
+	summary[agentapi.ConfigVersion] = app.remote.appliedVersion
+	if app.remote.rejectedVersion != "" {
+		summary[configRejected] = app.remote.rejectedVersion
+	}
+
+	return agentapi.Info{
+		ID:       config.AgentID,
+		Hostname: hostname,
+		Version:  app.version,
+		Config:   summary,
+		Labels:   config.Labels,
+	}
+}
+
 func (app *AppHTTP) Run(ctx context.Context) {
 	metricsDump, err := statsreader.NewMetricsDump()
 	if err != nil {
-		log.Println(err)
+		slog.Error("Metrics dump error", logging.Err(err))
 		return
 	}
 
+	if app.config.Push.Addr != "" || app.config.Push.Socket != "" {
+		receiver := pushreceiver.NewPushReceiver(app.config.Push, metricsDump)
+		err = receiver.Run(ctx)
+		if err != nil {
+			slog.Error("Push receiver error", logging.Err(err))
+			return
+		}
+	}
+
+	if app.config.StatusAddr != "" {
+		err = app.stats.ServeStatus(ctx, app.config.StatusAddr)
+		if err != nil {
+			slog.Error("Status endpoint error", logging.Err(err))
+			return
+		}
+	}
+
 	app.timeLog.startTime = time.Now()
 	app.isRun = true
 
@@ -77,53 +212,172 @@ func (app *AppHTTP) Run(ctx context.Context) {
 	tickerStatisticsUpload := time.NewTicker(app.config.ReportInterval)
 	wgRefresh := sync.WaitGroup{}
 
-	workers := app.config.RateLimit
+	go reload.Watch(ctx, app.config.ConfigPath, app.config.ReloadInterval, app.reloadConfig)
+	app.restartRemote(ctx)
 
-	errorGroup := new(errgroup.Group)
 	for app.isRun {
 		select {
+		case next := <-app.reloads:
+			app.localConfig = next
+			restartRequired := app.applyEffectiveConfig(ctx, tickerStatisticsRefresh, tickerStatisticsUpload)
+			if len(restartRequired) != 0 {
+				slog.Warn("Config reload: restart required", slog.String("fields", strings.Join(restartRequired, ", ")))
+			}
+		case assignment := <-app.remote.assignments:
+			if assignment.Version != app.remote.assignment.Version {
+				app.remote.assignment = assignment
+				app.applyEffectiveConfig(ctx, tickerStatisticsRefresh, tickerStatisticsUpload)
+			}
 		case timeTickerRefresh := <-tickerStatisticsRefresh.C:
 			app.timeLog.lastRefreshTime = timeTickerRefresh
-			wgRefresh.Add(2)
-
-			for i := 0; i < workers; i++ {
-				errorGroup.Go(func() error {
-					go func() {
-						defer wgRefresh.Done()
-						metricsDump.Refresh()
-					}()
-					go func() {
-						err = metricsDump.RefreshExtra()
-						if err != nil {
-							log.Println(err)
-						}
-
-						defer wgRefresh.Done()
-					}()
-					return nil
-				})
+
+			if scraper := app.scraper; scraper != nil && app.config.Collectors.Prometheus {
+				wgRefresh.Add(1)
+				go func() {
+					defer wgRefresh.Done()
+					start := time.Now()
+					err := scraper.Scrape(ctx, metricsDump)
+					app.stats.ObserveCollection(agentapi.CollectorPrometheus, time.Since(start), err)
+					if err != nil {
+						slog.Warn("Prometheus scrape error", logging.Err(err))
+					}
+				}()
+			}
+
+			if app.config.Collectors.Runtime {
+				wgRefresh.Add(1)
+				go func() {
+					defer wgRefresh.Done()
+					start := time.Now()
+					metricsDump.Refresh()
+					app.stats.ObserveCollection(agentapi.CollectorRuntime, time.Since(start), nil)
+				}()
 			}
-			errorGroup.Wait()
-		case timeTickerUpload := <-tickerStatisticsUpload.C:
-			app.timeLog.lastUploadTime = timeTickerUpload
-			wgRefresh.Wait()
 
-			for i := 0; i < workers; i++ {
+			if app.config.Collectors.System {
+				wgRefresh.Add(1)
 				go func() {
-					err = app.loader.metricsUplader.MetricsUploadBatch(*metricsDump)
+					defer wgRefresh.Done()
+					start := time.Now()
+					err := metricsDump.RefreshExtra()
+					app.stats.ObserveCollection(agentapi.CollectorSystem, time.Since(start), err)
 					if err != nil {
-						log.Println("cant upload metrics ", err)
+						slog.Warn("System metrics error", logging.Err(err))
 					}
 				}()
 			}
+		case timeTickerUpload := <-tickerStatisticsUpload.C:
+			app.timeLog.lastUploadTime = timeTickerUpload
+			wgRefresh.Wait()
+
+			filtered := takeUpload(metricsDump, app.config.Filter.Keep, app.stats)
+			go app.uploadShards(metricsDump, filtered)
+			go app.loader.heartbeat(ctx, app.agentInfo())
 		case <-ctx.Done():
-			app.loader.uploadMetrics(ctx, metricsDump, &wgRefresh)
+			app.loader.uploadMetrics(ctx, metricsDump, &wgRefresh, app.config.Filter.Keep, app.stats)
 			wgRefresh.Wait()
 			app.Stop()
 		}
 	}
 }
 
+// uploadShards - параллельная отправка filtered частями без повторов, не более RateLimit запросов.
+// Приращения counter возвращаются в metricsDump только из частей, которые не удалось отправить.
+func (app *AppHTTP) uploadShards(metricsDump *statsreader.MetricsDump, filtered *statsreader.MetricsDump) {
+	uploader := app.loader.metricsUplader
+	uploads := sync.WaitGroup{}
+	for _, shard := range filtered.Split(app.config.RateLimit) {
+		shard := shard
+		uploadDone := app.stats.StartUpload()
+		uploads.Add(1)
+		go func() {
+			defer uploads.Done()
+			err := uploader.MetricsUploadBatch(*shard)
+			uploadDone(err)
+			if err != nil {
+				metricsDump.RestoreCounters(shard)
+				slog.Error("Cant upload metrics", logging.Err(err))
+			}
+		}()
+	}
+	uploads.Wait()
+}
+
+// Reload - применение новой конфигурации в цикле Run. Конфигурация, еще не примененная циклом, заменяется новой.
+func (app *AppHTTP) Reload(next config.Config) {
+	for {
+		select {
+		case app.reloads <- next:
+			return
+		case <-app.reloads:
+		}
+	}
+}
+
+// reloadConfig - повторное чтение конфигурации запуска (файл и переменные окружения).
+func (app *AppHTTP) reloadConfig() {
+	next, err := app.startConfig.Reload()
+	if err != nil {
+		slog.Error("Config reload failed, keeping current config", logging.Err(err))
+		return
+	}
+
+	app.Reload(next)
+}
+
+// applyConfig - применение интервалов, числа воркеров, сборщиков и фильтров метрик, опроса Prometheus целей,
+// настроек отправки (адрес сервера, ключ подписи, RSA ключ), ID и меток агента, интервала запроса
+// конфигурации сервера и уровня журнала. Возвращает измененные поля, для применения которых нужен перезапуск.
+func (app *AppHTTP) applyConfig(next config.Config, tickerRefresh *time.Ticker, tickerUpload *time.Ticker) []string {
+	applied := app.config
+	applied.AgentID = next.AgentID
+	applied.Labels = next.Labels
+	applied.Collectors = next.Collectors
+	applied.Filter = next.Filter
+	applied.Remote = next.Remote
+	applied.PollInterval = next.PollInterval
+	applied.ReportInterval = next.ReportInterval
+	applied.RateLimit = next.RateLimit
+	applied.Scrape = next.Scrape
+	applied.SignKey = next.SignKey
+	applied.PublicKeyRSA = next.PublicKeyRSA
+	applied.HTTPClientConnection = next.HTTPClientConnection
+	applied.DebugMode = next.DebugMode
+
+	if app.config.PollInterval != applied.PollInterval {
+		tickerRefresh.Reset(applied.PollInterval)
+	}
+	if app.config.ReportInterval != applied.ReportInterval {
+		tickerUpload.Reset(applied.ReportInterval)
+	}
+
+	if !reflect.DeepEqual(app.config.Scrape, applied.Scrape) {
+		// Опрос продолжает тот же сборщик: приращения counter оставшихся целей не отправляются повторно
+		switch {
+		case len(applied.Scrape.Targets) == 0:
+			app.scraper = nil
+		case app.scraper == nil:
+			app.scraper = statsreader.NewPrometheusScraper(applied.Scrape.Targets, applied.Scrape.Timeout)
+		default:
+			app.scraper.SetTargets(applied.Scrape.Targets, applied.Scrape.Timeout)
+		}
+	}
+
+	if app.config.SignKey != applied.SignKey || app.config.PublicKeyRSA != applied.PublicKeyRSA ||
+		app.config.HTTPClientConnection != applied.HTTPClientConnection {
+		app.loader.metricsUplader = metricsuploader.NewMetricsUploader(applied.HTTPClientConnection, applied.SignKey, applied.PublicKeyRSA)
+	}
+
+	logging.SetDebug(applied.DebugMode)
+
+	if changed := reload.Changed(app.config, applied); len(changed) != 0 {
+		slog.Info("Config reloaded", slog.String("applied", strings.Join(changed, ", ")))
+	}
+	app.config = applied
+
+	return reload.Changed(applied, next)
+}
+
 func (app *AppHTTP) Stop() {
 	app.isRun = false
 }
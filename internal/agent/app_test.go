@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"devops-tpl/internal/agent/config"
+	"devops-tpl/internal/agent/statsreader"
+	"devops-tpl/internal/metrics"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppHTTP_UploadShards(t *testing.T) {
+	// Сервер суммирует приращения counter и отклоняет пакеты с метрикой Broken
+	var mutex sync.Mutex
+	received := map[string]int64{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		var batch []metrics.Metric
+		if err := json.NewDecoder(request.Body).Decode(&batch); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		for _, metric := range batch {
+			if metric.ID == "Broken" {
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		for _, metric := range batch {
+			if metric.MType == metrics.MeticTypeCounter {
+				received[metric.ID] += *metric.Delta
+			}
+		}
+	}))
+	defer server.Close()
+
+	agentConfig, _, err := config.Load(nil)
+	require.NoError(t, err)
+	agentConfig.HTTPClientConnection.ServerAddr = strings.TrimPrefix(server.URL, "http://")
+	agentConfig.HTTPClientConnection.RetryCount = 0
+	agentConfig.RateLimit = 4
+	app := NewHTTPClient(agentConfig, "test")
+
+	metricsDump, err := statsreader.NewMetricsDump()
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		metricsDump.AddCounter(fmt.Sprintf("Counter%d", i), int64(i+1))
+	}
+	metricsDump.AddCounter("Broken", 1)
+
+	filtered := takeUpload(metricsDump, agentConfig.Filter.Keep, app.stats)
+	app.uploadShards(metricsDump, filtered)
+
+	// Каждое приращение либо принято сервером один раз, либо возвращено для следующей отправки
+	require.Equal(t, agentConfig.RateLimit, requests)
+	for name, delta := range filtered.MetricsCounter {
+		restored := int64(metricsDump.MetricsCounter[name])
+		require.Equal(t, int64(delta), received[name]+restored, name)
+		require.True(t, received[name] == 0 || restored == 0, name)
+	}
+	require.EqualValues(t, 1, metricsDump.MetricsCounter["Broken"])
+	require.NotEmpty(t, received)
+}
@@ -1,13 +1,19 @@
 package config
 
 import (
-	"encoding/json"
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/configloader"
+	"devops-tpl/internal/logging"
+	handlerRSA "devops-tpl/internal/rsa"
 	"flag"
-	"log"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"sort"
+	"strings"
 	"time"
-
-	"github.com/caarlos0/env/v6"
 )
 
 // HTTPClientConfig используется для хранения конфигурации агента, связанной с настройкой http клиента.
@@ -20,10 +26,114 @@ type HTTPClientConfig struct {
 	RetryMaxWaitTime time.Duration `env:"RETRY_CONN_MAX_WAIT_TIME" json:"retry_max_wait_time,omitempty"`
 	// ServerAddr - адрес сервера (default: 127.0.0.1:8080)
 	ServerAddr string `env:"ADDRESS" json:"address,omitempty"`
+	// Token - API токен сервера, передается по HTTP и gRPC (flag: token)
+	Token string `env:"API_TOKEN" json:"token,omitempty" secret:"true"`
+}
+
+// ScrapeConfig используется для хранения конфигурации опроса Prometheus целей.
+type ScrapeConfig struct {
+	// Targets - список URL целей в формате Prometheus, опрашиваются каждый PollInterval (flag: scrape-targets)
+	Targets []string `env:"SCRAPE_TARGETS" envSeparator:"," json:"scrape_targets,omitempty"`
+	// Timeout - таймаут опроса одной цели (default: 5s)
+	Timeout time.Duration `env:"SCRAPE_TIMEOUT" json:"scrape_timeout,omitempty"`
+}
+
+// PushConfig используется для хранения конфигурации локального приемника метрик от приложений.
+type PushConfig struct {
+	// Addr - TCP адрес приемника, не запускается если пустое значение (flag: push-addr)
+	Addr string `env:"PUSH_ADDRESS" json:"push_address,omitempty"`
+	// Socket - путь до unix сокета приемника, не запускается если пустое значение (flag: push-socket)
+	Socket string `env:"PUSH_SOCKET" json:"push_socket,omitempty"`
+}
+
+// CollectorsConfig используется для хранения включенных сборщиков метрик агента.
+type CollectorsConfig struct {
+	// Runtime - runtime метрики Go (flag: collect-runtime; default: true)
+	Runtime bool `env:"COLLECT_RUNTIME" json:"collect_runtime"`
+	// System - память и загрузка CPU хоста (flag: collect-system; default: true)
+	System bool `env:"COLLECT_SYSTEM" json:"collect_system"`
+	// Prometheus - опрос целей Scrape.Targets (flag: collect-prometheus; default: true)
+	Prometheus bool `env:"COLLECT_PROMETHEUS" json:"collect_prometheus"`
+}
+
+// FilterConfig используется для хранения шаблонов ID отправляемых метрик в формате path.Match (CPU*).
+type FilterConfig struct {
+	// Include - отправляются только метрики, совпадающие с одним из шаблонов, пустой список - все (flag: include)
+	Include []string `env:"METRICS_INCLUDE" envSeparator:"," json:"metrics_include,omitempty"`
+	// Exclude - метрики, совпадающие с одним из шаблонов, не отправляются (flag: exclude)
+	Exclude []string `env:"METRICS_EXCLUDE" envSeparator:"," json:"metrics_exclude,omitempty"`
+}
+
+// Keep - метрика metricID отправляется на сервер.
+func (filter FilterConfig) Keep(metricID string) bool {
+	if len(filter.Include) != 0 && !matchAny(filter.Include, metricID) {
+		return false
+	}
+
+	return !matchAny(filter.Exclude, metricID)
+}
+
+func matchAny(patterns []string, metricID string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, metricID); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoteConfig используется для хранения настроек получения конфигурации с сервера.
+type RemoteConfig struct {
+	// Interval - интервал запроса конфигурации по HTTP и повторного подключения потока gRPC,
+	// 0 - только локальная конфигурация (flag: remote-config-interval; default: 1m)
+	Interval time.Duration `env:"REMOTE_CONFIG_INTERVAL" json:"remote_config_interval,omitempty"`
+}
+
+// Labels - метки агента, передаются серверу при регистрации. В переменной окружения и флаге задаются
+// списком через запятую: dc=eu-1,role=db.
+type Labels map[string]string
+
+// UnmarshalText - разбор списка меток из переменной окружения.
+func (labels *Labels) UnmarshalText(text []byte) error {
+	return labels.Set(string(text))
+}
+
+// Set - разбор списка меток из флага, метки заменяют прежние.
+func (labels *Labels) Set(value string) error {
+	parsed := Labels{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, labelValue, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("expected name=value, got %q", pair)
+		}
+		parsed[name] = strings.TrimSpace(labelValue)
+	}
+	*labels = parsed
+
+	return nil
+}
+
+func (labels Labels) String() string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
 }
 
 // Config используется для хранения конфигурации агента.
 type Config struct {
+	// AgentID - идентификатор агента на сервере (flag: id; default: имя хоста)
+	AgentID string `env:"AGENT_ID" json:"agent_id,omitempty"`
+	// Labels - метки агента, передаются серверу при регистрации (flag: labels)
+	Labels Labels `env:"AGENT_LABELS" json:"labels,omitempty"`
 	// PollInterval - интервал между считыванием метрик (flag: p; default: 2s)
 	PollInterval time.Duration `env:"POLL_INTERVAL" json:"poll_interval,omitempty"`
 	// ReportInterval - интервал между отправки метрик (flag: r; default: 2s)
@@ -31,22 +141,47 @@ type Config struct {
 	// PublicKeyRSA - публичный RSA ключ (flag: crypto-key)
 	PublicKeyRSA string `env:"CRYPTO_KEY" json:"crypto_key,omitempty"`
 	// SignKey - ключ для подписи сообщений (flag: k)
-	SignKey string `env:"KEY" json:"sign_key,omitempty"`
+	SignKey string `env:"KEY" json:"sign_key,omitempty" secret:"true"`
 	// RateLimit
 	RateLimit int `env:"RATE_LIMIT" json:"rate_limit,omitempty"`
-	// LogFile - лог файл (flag: l)
+	// LogFile - файл журнала с ротацией по размеру, пустое значение - stderr (flag: log-file)
 	LogFile string `env:"LOG_FILE" json:"log_file,omitempty"`
+	// LogMaxSize - размер файла журнала в мегабайтах, после которого он ротируется, 0 - без ротации
+	// (flag: log-max-size; default: 10)
+	LogMaxSize int `env:"LOG_MAX_SIZE" json:"log_max_size,omitempty"`
+	// LogMaxBackups - количество хранимых копий файла журнала после ротации (flag: log-max-backups; default: 3)
+	LogMaxBackups int `env:"LOG_MAX_BACKUPS" json:"log_max_backups,omitempty"`
+	// LogFormat - формат журнала: text или json (flag: log-format; default: text)
+	LogFormat string `env:"LOG_FORMAT" json:"log_format,omitempty"`
 	// ServerGRPCAddr - адрес gRPC сервера (если значение установлено, то вместо HTTP будет использоваться gRPC)
 	ServerGRPCAddr string `env:"ADDRESS_GRPC" json:"address_grpc,omitempty"`
-	// DebugMode - debug мод (flag: d)
-	DebugMode            bool `env:"DEBUG"  json:"debug,omitempty"`
+	// DebugMode - debug мод: журнал с уровнем debug, меняется без перезапуска (flag: d)
+	DebugMode bool `env:"DEBUG"  json:"debug,omitempty"`
+	// StatusAddr - адрес локального эндпоинта /status для проверок работоспособности, не запускается
+	// если пустое значение (flag: status-addr)
+	StatusAddr string `env:"STATUS_ADDRESS" json:"status_address,omitempty"`
+	// ConfigPath - путь до JSON файла конфигурации, перечитывается по SIGHUP и при изменении (flag: c, config; env: CONFIG)
+	ConfigPath string `json:"-"`
+	// args - аргументы командной строки, с которыми загружена конфигурация, для Reload
+	args []string
+	// ReloadInterval - интервал проверки изменения файла конфигурации, 0 - только по SIGHUP (flag: config-reload-interval; default: 5s)
+	ReloadInterval       time.Duration `env:"CONFIG_RELOAD_INTERVAL" json:"config_reload_interval,omitempty"`
 	HTTPClientConnection HTTPClientConfig
+	Scrape               ScrapeConfig
+	Push                 PushConfig
+	Collectors           CollectorsConfig
+	Filter               FilterConfig
+	Remote               RemoteConfig
 }
 
 // initDefaultValues - значения конфига по умолчанию.
 func (config *Config) initDefaultValues() {
 	config.PollInterval = time.Duration(2) * time.Second
 	config.ReportInterval = time.Duration(10) * time.Second
+	config.ReloadInterval = time.Duration(5) * time.Second
+	config.LogMaxSize = 10
+	config.LogMaxBackups = 3
+	config.LogFormat = logging.FormatText
 
 	config.HTTPClientConnection = HTTPClientConfig{
 		RetryCount:       2,
@@ -54,6 +189,20 @@ func (config *Config) initDefaultValues() {
 		RetryMaxWaitTime: time.Duration(90) * time.Second,
 		ServerAddr:       "127.0.0.1:8080",
 	}
+
+	config.Scrape = ScrapeConfig{
+		Timeout: time.Duration(5) * time.Second,
+	}
+
+	config.Collectors = CollectorsConfig{
+		Runtime:    true,
+		System:     true,
+		Prometheus: true,
+	}
+
+	config.Remote = RemoteConfig{
+		Interval: time.Minute,
+	}
 }
 
 func newConfig() *Config {
@@ -63,71 +212,178 @@ func newConfig() *Config {
 	return &config
 }
 
-func (config *Config) parseConfig(flagConfigPath, flagConfigPathAlias *string) {
-	var configPath string
-	if *flagConfigPath != "" {
-		configPath = *flagConfigPath
-	}
+func (config *Config) bindFlags(flagSet *flag.FlagSet) {
+	flagSet.DurationVar(&config.ReportInterval, "r", config.ReportInterval, "report interval (example: 10s)")
+	flagSet.DurationVar(&config.PollInterval, "p", config.PollInterval, "poll interval (example: 10s)")
+	flagSet.StringVar(&config.PublicKeyRSA, "crypto-key", config.PublicKeyRSA, "RSA public key")
+	flagSet.StringVar(&config.HTTPClientConnection.ServerAddr, "a", config.HTTPClientConnection.ServerAddr, "server address (host:port)")
+	flagSet.StringVar(&config.SignKey, "k", config.SignKey, "sign key")
+	flagSet.StringVar(&config.AgentID, "id", config.AgentID, "agent ID on the server (default: hostname)")
+	flagSet.Var(&config.Labels, "labels", "comma separated agent labels (example: dc=eu-1,role=db)")
+	flagSet.StringVar(&config.HTTPClientConnection.Token, "token", config.HTTPClientConnection.Token, "server API token")
+	flagSet.IntVar(&config.RateLimit, "l", config.RateLimit, "number of concurrent requests to the server")
+	flagSet.BoolVar(&config.DebugMode, "d", config.DebugMode, "debug mode")
+	flagSet.StringVar(&config.LogFile, "log-file", config.LogFile, "log file, empty - stderr")
+	flagSet.IntVar(&config.LogMaxSize, "log-max-size", config.LogMaxSize, "log file size in megabytes to rotate at, 0 - no rotation")
+	flagSet.IntVar(&config.LogMaxBackups, "log-max-backups", config.LogMaxBackups, "number of rotated log files to keep")
+	flagSet.StringVar(&config.LogFormat, "log-format", config.LogFormat, "log format: text or json")
+	flagSet.DurationVar(&config.ReloadInterval, "config-reload-interval", config.ReloadInterval, "config file change check interval, 0 - reload on SIGHUP only (example: 5s)")
+	flagSet.StringVar(&config.StatusAddr, "status-addr", config.StatusAddr, "local status endpoint address (host:port)")
+	flagSet.StringVar(&config.Push.Addr, "push-addr", config.Push.Addr, "local push receiver address (host:port)")
+	flagSet.StringVar(&config.Push.Socket, "push-socket", config.Push.Socket, "local push receiver unix socket path")
+	flagSet.BoolVar(&config.Collectors.Runtime, "collect-runtime", config.Collectors.Runtime, "collect go runtime metrics")
+	flagSet.BoolVar(&config.Collectors.System, "collect-system", config.Collectors.System, "collect host memory and CPU metrics")
+	flagSet.BoolVar(&config.Collectors.Prometheus, "collect-prometheus", config.Collectors.Prometheus, "scrape prometheus targets")
+	flagSet.Func("include", "comma separated patterns of metric IDs to send, empty - all (example: CPU*,Heap*)", func(patterns string) error {
+		config.Filter.Include = strings.Split(patterns, ",")
+		return nil
+	})
+	flagSet.Func("exclude", "comma separated patterns of metric IDs not to send (example: RandomValue)", func(patterns string) error {
+		config.Filter.Exclude = strings.Split(patterns, ",")
+		return nil
+	})
+	flagSet.DurationVar(&config.Remote.Interval, "remote-config-interval", config.Remote.Interval, "server config request interval, 0 - local config only (example: 1m)")
+	flagSet.Func("scrape-targets", "comma separated list of prometheus targets (example: http://127.0.0.1:9100/metrics)", func(targets string) error {
+		config.Scrape.Targets = strings.Split(targets, ",")
+		return nil
+	})
+}
 
-	if *flagConfigPathAlias != "" {
-		configPath = *flagConfigPathAlias
+// Load - загрузка конфигурации из аргументов командной строки args по слоям: значения по умолчанию,
+// файл JSON или YAML (flag: c, config; env: CONFIG), переменные окружения, флаги - с проверкой результата.
+func Load(args []string) (Config, configloader.Result, error) {
+	config := newConfig()
+	result, err := configloader.Load("agent", os.Stderr, config, (*Config).bindFlags, args)
+	if err != nil {
+		return *config, result, err
 	}
+	config.ConfigPath = result.Path
+	config.args = args
 
-	if path, ok := os.LookupEnv("CONFIG"); ok {
-		configPath = path
+	if config.RateLimit == 0 {
+		config.RateLimit = 1
 	}
-
-	if configPath == "" {
-		return
+	if config.AgentID == "" {
+		config.AgentID, _ = os.Hostname()
 	}
 
-	file, err := os.OpenFile(configPath, os.O_RDONLY|os.O_CREATE, 0777)
-	if err != nil {
-		log.Fatal(err)
+	return *config, result, config.Validate()
+}
+
+// Reload - повторная загрузка с аргументами командной строки конфигурации config.
+func (config Config) Reload() (Config, error) {
+	next, _, err := Load(config.args)
+	return next, err
+}
+
+// Validate - проверка значений, которые иначе приводят к ошибке при применении. Возвращает configloader.Errors
+// со всеми ошибками полей.
+func (config Config) Validate() error {
+	var errs configloader.Errors
+
+	errs.Check(config.PollInterval > 0, "PollInterval", "must be positive")
+	errs.Check(config.ReportInterval > 0, "ReportInterval", "must be positive")
+	errs.Check(config.RateLimit >= 0, "RateLimit", "must not be negative")
+	errs.Check(config.ReloadInterval >= 0, "ReloadInterval", "must not be negative")
+	errs.Check(config.LogMaxSize >= 0, "LogMaxSize", "must not be negative")
+	errs.Check(config.LogMaxBackups >= 0, "LogMaxBackups", "must not be negative")
+	errs.Check(logging.IsFormat(config.LogFormat), "LogFormat", "expected text or json")
+	errs.Check(isAddr(config.HTTPClientConnection.ServerAddr), "HTTPClientConnection.ServerAddr", "expected host:port")
+	errs.Check(config.HTTPClientConnection.RetryCount >= 0, "HTTPClientConnection.RetryCount", "must not be negative")
+	errs.Check(config.ServerGRPCAddr == "" || isAddr(config.ServerGRPCAddr), "ServerGRPCAddr", "expected host:port")
+	errs.Check(config.Push.Addr == "" || isAddr(config.Push.Addr), "Push.Addr", "expected host:port")
+	errs.Check(config.StatusAddr == "" || isAddr(config.StatusAddr), "StatusAddr", "expected host:port")
+
+	if config.PublicKeyRSA != "" {
+		_, err := handlerRSA.ParsePublicKeyRSA(config.PublicKeyRSA)
+		if err != nil {
+			errs.Add("PublicKeyRSA", err)
+		}
 	}
-	err = file.Close()
-	if err != nil {
-		log.Println(err)
+
+	errs.Check(config.Remote.Interval >= 0, "Remote.Interval", "must not be negative")
+	for _, pattern := range append(append([]string{}, config.Filter.Include...), config.Filter.Exclude...) {
+		_, err := path.Match(pattern, "")
+		errs.Check(err == nil, "Filter", fmt.Sprintf("invalid pattern %q", pattern))
 	}
 
-	err = json.NewDecoder(file).Decode(&config)
-	if err != nil {
-		log.Fatal(err)
+	if len(config.Scrape.Targets) != 0 {
+		errs.Check(config.Scrape.Timeout > 0, "Scrape.Timeout", "must be positive")
+		for _, target := range config.Scrape.Targets {
+			targetURL, err := url.Parse(target)
+			errs.Check(err == nil && targetURL.Scheme != "" && targetURL.Host != "", "Scrape.Targets", fmt.Sprintf("expected URL, got %q", target))
+		}
 	}
-}
 
-func (config *Config) parseEnv() error {
-	return env.Parse(config)
+	return errs.Err()
 }
 
-func (config *Config) parseFlags() {
-	flag.DurationVar(&config.ReportInterval, "r", config.ReportInterval, "report interval (example: 10s)")
-	flag.DurationVar(&config.PollInterval, "p", config.PollInterval, "poll interval (example: 10s)")
-	flag.StringVar(&config.PublicKeyRSA, "crypto-key", config.PublicKeyRSA, "RSA public key")
-	flag.StringVar(&config.HTTPClientConnection.ServerAddr, "a", config.HTTPClientConnection.ServerAddr, "server address (host:port)")
-	flag.StringVar(&config.SignKey, "k", config.SignKey, "sign key")
-	flag.IntVar(&config.RateLimit, "l", config.RateLimit, "number of concurrent requests to the server")
-	flag.BoolVar(&config.DebugMode, "d", config.DebugMode, "debug mode")
-	flag.Parse()
+// isAddr - адрес в формате host:port.
+func isAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port != ""
 }
 
-func LoadConfig() Config {
-	config := newConfig()
+// WithRemote - конфигурация с настройками профиля сервера remote поверх локальной, метки профиля
+// добавляются к локальным. Возвращает ошибку, если профиль не применим к агенту или результат не проходит Validate.
+func (config Config) WithRemote(remote agentapi.RemoteConfig) (Config, error) {
+	var errs configloader.Errors
+
+	if remote.PollInterval != "" {
+		pollInterval, err := time.ParseDuration(remote.PollInterval)
+		if err != nil {
+			errs.Add("PollInterval", err)
+		}
+		config.PollInterval = pollInterval
+	}
+	if remote.ReportInterval != "" {
+		reportInterval, err := time.ParseDuration(remote.ReportInterval)
+		if err != nil {
+			errs.Add("ReportInterval", err)
+		}
+		config.ReportInterval = reportInterval
+	}
+	if remote.RateLimit != 0 {
+		config.RateLimit = remote.RateLimit
+	}
 
-	flagConfigPath := flag.String("c", "", "path to json config")
-	flagConfigPathAlias := flag.String("config", "", "path to json config")
+	if len(remote.Collectors) != 0 {
+		config.Collectors = CollectorsConfig{}
+		for _, collector := range remote.Collectors {
+			switch collector {
+			case agentapi.CollectorRuntime:
+				config.Collectors.Runtime = true
+			case agentapi.CollectorSystem:
+				config.Collectors.System = true
+			case agentapi.CollectorPrometheus:
+				config.Collectors.Prometheus = true
+			default:
+				errs.Add("Collectors", fmt.Errorf("unknown collector %q", collector))
+			}
+		}
+	}
 
-	config.parseFlags()
-	config.parseConfig(flagConfigPath, flagConfigPathAlias)
-	err := config.parseEnv()
+	if len(remote.Include) != 0 {
+		config.Filter.Include = remote.Include
+	}
+	if len(remote.Exclude) != 0 {
+		config.Filter.Exclude = remote.Exclude
+	}
 
-	if config.RateLimit == 0 {
-		config.RateLimit = 1
+	if len(remote.Labels) != 0 {
+		labels := make(Labels, len(config.Labels)+len(remote.Labels))
+		for name, value := range config.Labels {
+			labels[name] = value
+		}
+		for name, value := range remote.Labels {
+			labels[name] = value
+		}
+		config.Labels = labels
 	}
 
-	if err != nil {
-		log.Fatal(err)
+	if err := errs.Err(); err != nil {
+		return config, err
 	}
 
-	return *config
+	return config, config.Validate()
 }
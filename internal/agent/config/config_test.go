@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"devops-tpl/internal/agentapi"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_WithRemote(t *testing.T) {
+	local := newConfig()
+	local.Labels = Labels{"role": "db", "team": "core"}
+	local.Filter.Exclude = []string{"Random*"}
+
+	config, err := local.WithRemote(agentapi.RemoteConfig{
+		PollInterval: "5s",
+		RateLimit:    4,
+		Collectors:   []string{agentapi.CollectorRuntime},
+		Include:      []string{"CPU*", "Alloc"},
+		Labels:       map[string]string{"team": "storage"},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, 5*time.Second, config.PollInterval)
+	require.Equal(t, local.ReportInterval, config.ReportInterval)
+	require.Equal(t, 4, config.RateLimit)
+	require.Equal(t, CollectorsConfig{Runtime: true}, config.Collectors)
+	require.Equal(t, FilterConfig{Include: []string{"CPU*", "Alloc"}, Exclude: []string{"Random*"}}, config.Filter)
+	require.Equal(t, Labels{"role": "db", "team": "storage"}, config.Labels)
+	// Локальная конфигурация не меняется
+	require.Equal(t, Labels{"role": "db", "team": "core"}, local.Labels)
+
+	_, err = local.WithRemote(agentapi.RemoteConfig{PollInterval: "often"})
+	require.ErrorContains(t, err, "PollInterval")
+	_, err = local.WithRemote(agentapi.RemoteConfig{ReportInterval: "-1s"})
+	require.ErrorContains(t, err, "ReportInterval")
+	_, err = local.WithRemote(agentapi.RemoteConfig{Collectors: []string{"disk"}})
+	require.ErrorContains(t, err, "Collectors")
+}
+
+func TestFilterConfig_Keep(t *testing.T) {
+	require.True(t, FilterConfig{}.Keep("Alloc"))
+
+	filter := FilterConfig{Include: []string{"CPU*", "Alloc"}, Exclude: []string{"CPUutilization2"}}
+	require.True(t, filter.Keep("Alloc"))
+	require.True(t, filter.Keep("CPUutilization1"))
+	require.False(t, filter.Keep("CPUutilization2"))
+	require.False(t, filter.Keep("PollCount"))
+}
+
+func TestLabels_Set(t *testing.T) {
+	labels := Labels{"old": "1"}
+	require.NoError(t, labels.Set("dc=eu-1, role = db,"))
+	require.Equal(t, Labels{"dc": "eu-1", "role": "db"}, labels)
+	require.Equal(t, "dc=eu-1,role=db", labels.String())
+
+	require.Error(t, labels.Set("role"))
+	require.Error(t, labels.Set("=db"))
+}
@@ -2,12 +2,16 @@ package metricsuploader
 
 import (
 	"context"
-	"log"
+	"log/slog"
 
 	"devops-tpl/internal/agent/statsreader"
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/logging"
 	pb "devops-tpl/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 type MetricsUploaderGRPC struct {
@@ -15,8 +19,14 @@ type MetricsUploaderGRPC struct {
 	client     pb.MetricsClient
 }
 
-func NewMetricsUploaderGRPC(addr string) (*MetricsUploaderGRPC, error) {
-	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// NewMetricsUploaderGRPC - клиент gRPC сервера addr, непустой token передается в каждом вызове.
+func NewMetricsUploaderGRPC(addr string, token string) (*MetricsUploaderGRPC, error) {
+	options := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if token != "" {
+		options = append(options, grpc.WithPerRPCCredentials(agentapi.TokenCredentials(token)))
+	}
+
+	conn, err := grpc.Dial(addr, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -28,6 +38,8 @@ func NewMetricsUploaderGRPC(addr string) (*MetricsUploaderGRPC, error) {
 }
 
 func (m *MetricsUploaderGRPC) Upload(ctx context.Context, metricsDump statsreader.MetricsDump) (err error) {
+	metricsDump.RLock()
+	defer metricsDump.RUnlock()
 	updateMetricsRequest := pb.UpdateMetricsRequest{}
 
 	for metricID, metricValue := range metricsDump.MetricsGauge {
@@ -54,8 +66,65 @@ func (m *MetricsUploaderGRPC) Upload(ctx context.Context, metricsDump statsreade
 
 	_, err = m.client.UpdateMetrics(ctx, &updateMetricsRequest)
 	if err != nil {
-		log.Println("GRPC UpdateMetrics error : ", err)
+		slog.Warn("gRPC UpdateMetrics error", logging.Err(err))
 	}
 
 	return
 }
+
+// RegisterAgent - регистрация агента на сервере со сведениями info.
+func (m *MetricsUploaderGRPC) RegisterAgent(ctx context.Context, info agentapi.Info) error {
+	_, err := m.client.RegisterAgent(ctx, &pb.AgentInfo{
+		Id:       info.ID,
+		Hostname: info.Hostname,
+		Version:  info.Version,
+		Config:   info.Config,
+		Labels:   info.Labels,
+	})
+
+	return err
+}
+
+// Heartbeat - отметка агента id на сервере, ErrAgentNotRegistered - агент должен зарегистрироваться заново.
+func (m *MetricsUploaderGRPC) Heartbeat(ctx context.Context, id string) error {
+	_, err := m.client.AgentHeartbeat(ctx, &pb.AgentHeartbeatRequest{Id: id})
+	if status.Code(err) == codes.NotFound {
+		return ErrAgentNotRegistered
+	}
+
+	return err
+}
+
+// WatchAgentConfig - передача конфигураций агента id с сервера в handler до отмены ctx или разрыва потока.
+// Текущая конфигурация передается, только если ее версия отличается от version.
+func (m *MetricsUploaderGRPC) WatchAgentConfig(ctx context.Context, id string, version string, handler func(agentapi.Assignment)) error {
+	stream, err := m.client.WatchAgentConfig(ctx, &pb.AgentConfigRequest{Id: id, Version: version})
+	if err != nil {
+		return err
+	}
+
+	for {
+		assignment, err := stream.Recv()
+		if status.Code(err) == codes.NotFound {
+			return ErrAgentNotRegistered
+		}
+		if err != nil {
+			return err
+		}
+
+		remote := assignment.GetConfig()
+		handler(agentapi.Assignment{
+			Profile: assignment.Profile,
+			Version: assignment.Version,
+			Config: agentapi.RemoteConfig{
+				PollInterval:   remote.GetPollInterval(),
+				ReportInterval: remote.GetReportInterval(),
+				RateLimit:      int(remote.GetRateLimit()),
+				Collectors:     remote.GetCollectors(),
+				Include:        remote.GetInclude(),
+				Exclude:        remote.GetExclude(),
+				Labels:         remote.GetLabels(),
+			},
+		})
+	}
+}
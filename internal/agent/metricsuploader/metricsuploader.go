@@ -5,23 +5,30 @@ import (
 	"crypto/rsa"
 	"devops-tpl/internal/agent/config"
 	"devops-tpl/internal/agent/statsreader"
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
 	handlerRSA "devops-tpl/internal/rsa"
-	"devops-tpl/internal/server/storage"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/go-resty/resty/v2"
 	"golang.org/x/sync/errgroup"
 )
 
-var ErrCurrentIPNotFound = errors.New("current IP addr not found")
+var (
+	ErrCurrentIPNotFound = errors.New("current IP addr not found")
+	// ErrAgentNotRegistered - сервер не знает агента (например, после перезапуска), нужна повторная регистрация
+	ErrAgentNotRegistered = errors.New("agent is not registered")
+)
 
 type MetricsUplader struct {
 	client       *resty.Client
@@ -30,18 +37,33 @@ type MetricsUplader struct {
 	signKey      string
 }
 
-func newMetricValue(mtype string, value string) (storage.MetricValue, error) {
-	mValue := storage.MetricValue{
+// restyLogger - сообщения resty (неудачные попытки отправки) в журнале по умолчанию.
+type restyLogger struct{}
+
+func (restyLogger) Errorf(format string, v ...any) {
+	slog.Warn(strings.TrimSpace(fmt.Sprintf(format, v...)), slog.String("source", "resty"))
+}
+
+func (restyLogger) Warnf(format string, v ...any) {
+	slog.Warn(strings.TrimSpace(fmt.Sprintf(format, v...)), slog.String("source", "resty"))
+}
+
+func (restyLogger) Debugf(format string, v ...any) {
+	slog.Debug(strings.TrimSpace(fmt.Sprintf(format, v...)), slog.String("source", "resty"))
+}
+
+func newMetricValue(mtype string, value string) (metrics.MetricValue, error) {
+	mValue := metrics.MetricValue{
 		MType: mtype,
 	}
 
 	var err error
 	switch mtype {
-	case storage.MeticTypeCounter:
+	case metrics.MeticTypeCounter:
 		var metricValue int64
 		metricValue, err = strconv.ParseInt(value, 10, 64)
 		mValue.Delta = &metricValue
-	case storage.MeticTypeGauge:
+	case metrics.MeticTypeGauge:
 		var metricValue float64
 		metricValue, err = strconv.ParseFloat(value, 64)
 		mValue.Value = &metricValue
@@ -59,7 +81,7 @@ func NewMetricsUploader(config config.HTTPClientConfig, signKey, publicKeyRSA st
 	var metricsUplader MetricsUplader
 	metricsUplader.config = config
 	metricsUplader.signKey = signKey
-	client := resty.New()
+	client := resty.New().SetLogger(restyLogger{})
 
 	client.
 		SetRetryCount(metricsUplader.config.RetryCount).
@@ -69,16 +91,19 @@ func NewMetricsUploader(config config.HTTPClientConfig, signKey, publicKeyRSA st
 
 	currentIP, err := metricsUplader.IP()
 	if err != nil {
-		log.Println("metricsUplader IP error : ", err)
+		slog.Warn("Agent IP error", logging.Err(err))
 		currentIP = ""
 	}
 	client.Header.Add("X-Real-IP", currentIP)
+	if config.Token != "" {
+		client.SetAuthToken(config.Token)
+	}
 
 	if publicKeyRSA != "" {
 		var err error
 		metricsUplader.publicKeyRSA, err = handlerRSA.ParsePublicKeyRSA(publicKeyRSA)
 		if err != nil {
-			log.Fatal("Parsing public key failed, RSA disabled ", err)
+			logging.Fatal("Parsing public key failed", logging.Err(err))
 		}
 	}
 	return &metricsUplader
@@ -136,10 +161,10 @@ func (metricsUplader *MetricsUplader) oneStatUploadJSON(mType string, name strin
 	}
 
 	OneMetrics := struct {
-		storage.Metric
+		metrics.Metric
 		Hash string `json:"hash"`
 	}{
-		Metric: storage.Metric{
+		Metric: metrics.Metric{
 			ID:          name,
 			MetricValue: metricValue,
 		},
@@ -233,7 +258,7 @@ func (metricsUplader *MetricsUplader) MetricsUploadAsync(metricsDump statsreader
 func (metricsUplader *MetricsUplader) MetricsUploadBatch(metricsDump statsreader.MetricsDump) error {
 	metricsDump.RLock()
 	defer metricsDump.RUnlock()
-	var MetricValueBatch []storage.Metric
+	var MetricValueBatch []metrics.Metric
 
 	for metricName, metricRawValue := range metricsDump.MetricsGauge {
 		metricValue := fmt.Sprintf("%v", metricRawValue)
@@ -243,7 +268,7 @@ func (metricsUplader *MetricsUplader) MetricsUploadBatch(metricsDump statsreader
 			return err
 		}
 
-		MetricValueBatch = append(MetricValueBatch, storage.Metric{
+		MetricValueBatch = append(MetricValueBatch, metrics.Metric{
 			ID:          metricName,
 			MetricValue: mValue,
 		})
@@ -257,15 +282,32 @@ func (metricsUplader *MetricsUplader) MetricsUploadBatch(metricsDump statsreader
 			return err
 		}
 
-		MetricValueBatch = append(MetricValueBatch, storage.Metric{
+		MetricValueBatch = append(MetricValueBatch, metrics.Metric{
 			ID:          metricName,
 			MetricValue: mValue,
 		})
 	}
 
-	fmt.Println(MetricValueBatch)
+	return metricsUplader.UploadMetrics(MetricValueBatch)
+}
+
+// UploadMetrics - отправка метрик 1 запросом в формате JSON с подписью каждой метрики и шифрованием RSA.
+func (metricsUplader *MetricsUplader) UploadMetrics(batch []metrics.Metric) error {
+	type signedMetric struct {
+		metrics.Metric
+		Hash string `json:"hash,omitempty"`
+	}
+
+	signedMetrics := make([]signedMetric, 0, len(batch))
+	for _, metric := range batch {
+		oneMetric := signedMetric{Metric: metric}
+		if metricsUplader.signKey != "" {
+			oneMetric.Hash = hex.EncodeToString(metric.GetHash(metric.ID, metricsUplader.signKey))
+		}
+		signedMetrics = append(signedMetrics, oneMetric)
+	}
 
-	statJSON, err := json.Marshal(MetricValueBatch)
+	statJSON, err := json.Marshal(signedMetrics)
 	if err != nil {
 		return err
 	}
@@ -281,8 +323,34 @@ func (metricsUplader *MetricsUplader) MetricsUploadBatch(metricsDump statsreader
 			"addr": metricsUplader.config.ServerAddr,
 		}).
 		Post("http://{addr}/updates/")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("HTTP Status: %v (not 200)", resp.StatusCode())
+	}
+
+	return nil
+}
+
+// RegisterAgent - регистрация агента на сервере со сведениями info, тело шифруется RSA.
+func (metricsUplader *MetricsUplader) RegisterAgent(info agentapi.Info) error {
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	if metricsUplader.publicKeyRSA != nil {
+		infoJSON = handlerRSA.EncryptWithPublicKey(infoJSON, metricsUplader.publicKeyRSA)
+	}
 
-	fmt.Println(err)
+	resp, err := metricsUplader.client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(string(infoJSON)).
+		SetPathParams(map[string]string{
+			"addr": metricsUplader.config.ServerAddr,
+		}).
+		Post("http://{addr}/api/agents")
 	if err != nil {
 		return err
 	}
@@ -292,3 +360,51 @@ func (metricsUplader *MetricsUplader) MetricsUploadBatch(metricsDump statsreader
 
 	return nil
 }
+
+// Heartbeat - отметка агента id на сервере, ErrAgentNotRegistered - агент должен зарегистрироваться заново.
+func (metricsUplader *MetricsUplader) Heartbeat(id string) error {
+	resp, err := metricsUplader.client.R().
+		SetPathParams(map[string]string{
+			"addr": metricsUplader.config.ServerAddr,
+			"id":   id,
+		}).
+		Post("http://{addr}/api/agents/{id}/heartbeat")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return ErrAgentNotRegistered
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("HTTP Status: %v (not 200)", resp.StatusCode())
+	}
+
+	return nil
+}
+
+// AgentConfig - конфигурация агента id с сервера, nil - версия конфигурации на сервере совпадает с version.
+func (metricsUplader *MetricsUplader) AgentConfig(id string, version string) (*agentapi.Assignment, error) {
+	assignment := &agentapi.Assignment{}
+	resp, err := metricsUplader.client.R().
+		SetPathParams(map[string]string{
+			"addr": metricsUplader.config.ServerAddr,
+			"id":   id,
+		}).
+		SetQueryParam("version", version).
+		SetResult(assignment).
+		Get("http://{addr}/api/agents/{id}/config")
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		return assignment, nil
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusNotFound:
+		return nil, ErrAgentNotRegistered
+	default:
+		return nil, fmt.Errorf("HTTP Status: %v (not 200)", resp.StatusCode())
+	}
+}
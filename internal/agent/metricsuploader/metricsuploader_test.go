@@ -4,9 +4,10 @@ import (
 	"context"
 	"devops-tpl/internal/agent/config"
 	"devops-tpl/internal/agent/statsreader"
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/metrics"
 	serverCfg "devops-tpl/internal/server/config"
 	"devops-tpl/internal/server/server"
-	"devops-tpl/internal/server/storage"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -31,14 +32,15 @@ func (suite *UploaderTestingSuite) SetupSuite() {
 
 	go serverAPI.Run(context.Background())
 
-	agentConfig := config.LoadConfig()
+	agentConfig, _, err := config.Load(nil)
+	suite.NoError(err)
 	suite.metricsUploader = NewMetricsUploader(agentConfig.HTTPClientConnection, "", "")
 
 	clientIP, err := suite.metricsUploader.IP()
 	suite.NoError(err)
 	suite.NotEmpty(clientIP)
 
-	suite.metricsUploaderGRPC, err = NewMetricsUploaderGRPC(ServerGRPCAddr)
+	suite.metricsUploaderGRPC, err = NewMetricsUploaderGRPC(ServerGRPCAddr, "")
 	suite.NoError(err)
 }
 
@@ -56,10 +58,10 @@ func (suite *UploaderTestingSuite) TestUploadGRPC() {
 }
 
 func (suite *UploaderTestingSuite) TestUploadOne() {
-	err := suite.metricsUploader.oneStatUpload(storage.MeticTypeCounter, "Counter1", "27")
+	err := suite.metricsUploader.oneStatUpload(metrics.MeticTypeCounter, "Counter1", "27")
 	suite.NoError(err)
 
-	err = suite.metricsUploader.oneStatUpload(storage.MeticTypeGauge, "Gauge1", "29.1")
+	err = suite.metricsUploader.oneStatUpload(metrics.MeticTypeGauge, "Gauge1", "29.1")
 	suite.NoError(err)
 }
 
@@ -93,6 +95,45 @@ func (suite *UploaderTestingSuite) TestUploadSync() {
 	suite.NoError(err)
 }
 
+func (suite *UploaderTestingSuite) TestAgentRegistration() {
+	suite.ErrorIs(suite.metricsUploader.Heartbeat("agent-http"), ErrAgentNotRegistered)
+	suite.NoError(suite.metricsUploader.RegisterAgent(agentapi.Info{ID: "agent-http", Labels: map[string]string{"dc": "eu-1"}}))
+	suite.NoError(suite.metricsUploader.Heartbeat("agent-http"))
+	suite.Error(suite.metricsUploader.RegisterAgent(agentapi.Info{ID: "agent http"}))
+
+	ctx := context.Background()
+	suite.ErrorIs(suite.metricsUploaderGRPC.Heartbeat(ctx, "agent-grpc"), ErrAgentNotRegistered)
+	suite.NoError(suite.metricsUploaderGRPC.RegisterAgent(ctx, agentapi.Info{ID: "agent-grpc"}))
+	suite.NoError(suite.metricsUploaderGRPC.Heartbeat(ctx, "agent-grpc"))
+}
+
+func (suite *UploaderTestingSuite) TestAgentConfig() {
+	_, err := suite.metricsUploader.AgentConfig("agent-config", "")
+	suite.ErrorIs(err, ErrAgentNotRegistered)
+	suite.NoError(suite.metricsUploader.RegisterAgent(agentapi.Info{ID: "agent-config"}))
+
+	// Без профилей на сервере действует локальная конфигурация агента
+	assignment, err := suite.metricsUploader.AgentConfig("agent-config", "")
+	suite.NoError(err)
+	suite.Equal(agentapi.LocalVersion, assignment.Version)
+	assignment, err = suite.metricsUploader.AgentConfig("agent-config", agentapi.LocalVersion)
+	suite.NoError(err)
+	suite.Nil(assignment)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	suite.ErrorIs(suite.metricsUploaderGRPC.WatchAgentConfig(ctx, "agent-grpc-config", "", func(agentapi.Assignment) {}), ErrAgentNotRegistered)
+	suite.NoError(suite.metricsUploaderGRPC.RegisterAgent(ctx, agentapi.Info{ID: "agent-grpc-config"}))
+
+	var versions []string
+	err = suite.metricsUploaderGRPC.WatchAgentConfig(ctx, "agent-grpc-config", "", func(assignment agentapi.Assignment) {
+		versions = append(versions, assignment.Version)
+		cancel()
+	})
+	suite.Error(err)
+	suite.Equal([]string{agentapi.LocalVersion}, versions)
+}
+
 func TestUploaderSuite(t *testing.T) {
 	suite.Run(t, new(UploaderTestingSuite))
 }
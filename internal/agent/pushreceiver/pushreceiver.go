@@ -0,0 +1,179 @@
+// Package pushreceiver - локальный HTTP приемник метрик от приложений на хосте агента.
+//
+// Принимает тот же JSON, что и эндпоинты сервера /update/ и /updates/,
+// метрики попадают в MetricsDump и отправляются на сервер вместе с остальными. Приращения counter
+// суммируются до ближайшей отправки и передаются на сервер один раз.
+package pushreceiver
+
+import (
+	"context"
+	"devops-tpl/internal/agent/config"
+	"devops-tpl/internal/agent/statsreader"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/asaskevich/govalidator"
+)
+
+// PushReceiver - HTTP сервер для приема метрик по TCP адресу и/или unix сокету.
+type PushReceiver struct {
+	metricsDump *statsreader.MetricsDump
+	config      config.PushConfig
+	servers     []*http.Server
+}
+
+func NewPushReceiver(config config.PushConfig, metricsDump *statsreader.MetricsDump) *PushReceiver {
+	return &PushReceiver{
+		metricsDump: metricsDump,
+		config:      config,
+	}
+}
+
+// Handler - обработчики приемника.
+func (receiver *PushReceiver) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/update/", receiver.UpdateMetricPostJSON)
+	mux.HandleFunc("/updates/", receiver.UpdateMetricBatchJSON)
+
+	return mux
+}
+
+// Run - запуск приемника, завершается вместе с ctx.
+func (receiver *PushReceiver) Run(ctx context.Context) error {
+	var listeners []net.Listener
+
+	if receiver.config.Addr != "" {
+		lis, err := net.Listen("tcp", receiver.config.Addr)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, lis)
+	}
+
+	if receiver.config.Socket != "" {
+		// Сокет мог остаться от предыдущего запуска
+		err := os.Remove(receiver.config.Socket)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		lis, err := net.Listen("unix", receiver.config.Socket)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, lis)
+	}
+
+	for _, lis := range listeners {
+		serverHTTP := &http.Server{
+			Handler: receiver.Handler(),
+		}
+		receiver.servers = append(receiver.servers, serverHTTP)
+
+		go func(lis net.Listener) {
+			err := serverHTTP.Serve(lis)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Push receiver serve error", logging.Err(err))
+			}
+		}(lis)
+	}
+
+	go func() {
+		<-ctx.Done()
+		for _, serverHTTP := range receiver.servers {
+			if err := serverHTTP.Shutdown(context.Background()); err != nil {
+				slog.Error("Push receiver shutdown error", logging.Err(err))
+			}
+		}
+	}()
+
+	return nil
+}
+
+// UpdateMetricPostJSON - прием одной метрики.
+func (receiver *PushReceiver) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := metrics.NewUpdateMetricResponse()
+
+	if request.Method != http.MethodPost {
+		http.Error(rw, response.SetStatusError(errors.New("method not allowed")).GetJSONString(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var metric metrics.Metric
+	err := json.NewDecoder(request.Body).Decode(&metric)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	err = receiver.merge([]metrics.Metric{metric})
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(response.GetJSONBytes())
+}
+
+// UpdateMetricBatchJSON - прием списка метрик.
+func (receiver *PushReceiver) UpdateMetricBatchJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := metrics.NewUpdateMetricResponse()
+
+	if request.Method != http.MethodPost {
+		http.Error(rw, response.SetStatusError(errors.New("method not allowed")).GetJSONString(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var batch []metrics.Metric
+	err := json.NewDecoder(request.Body).Decode(&batch)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	err = receiver.merge(batch)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(response.GetJSONBytes())
+}
+
+// merge - проверка всех метрик и запись в MetricsDump, при ошибке ничего не записывается.
+func (receiver *PushReceiver) merge(batch []metrics.Metric) error {
+	for _, metric := range batch {
+		_, err := govalidator.ValidateStruct(metric)
+		if err != nil {
+			return err
+		}
+
+		if metric.MType == metrics.MeticTypeGauge && metric.Value == nil {
+			return errors.New("metric Value is empty")
+		}
+		if metric.MType == metrics.MeticTypeCounter && metric.Delta == nil {
+			return errors.New("metric Delta is empty")
+		}
+	}
+
+	for _, metric := range batch {
+		switch metric.MType {
+		case metrics.MeticTypeGauge:
+			receiver.metricsDump.UpdateGauge(metric.ID, *metric.Value)
+		case metrics.MeticTypeCounter:
+			receiver.metricsDump.AddCounter(metric.ID, *metric.Delta)
+		}
+	}
+
+	return nil
+}
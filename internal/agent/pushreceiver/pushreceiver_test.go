@@ -0,0 +1,105 @@
+package pushreceiver
+
+import (
+	"context"
+	"devops-tpl/internal/agent/config"
+	"devops-tpl/internal/agent/statsreader"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReceiver(t *testing.T) (*PushReceiver, *statsreader.MetricsDump) {
+	metricsDump, err := statsreader.NewMetricsDump()
+	require.NoError(t, err)
+
+	return NewPushReceiver(config.PushConfig{}, metricsDump), metricsDump
+}
+
+func TestPushReceiverUpdate(t *testing.T) {
+	receiver, metricsDump := newTestReceiver(t)
+	handler := receiver.Handler()
+
+	for _, body := range []string{
+		`{"id":"Requests","type":"counter","delta":5}`,
+		`{"id":"Requests","type":"counter","delta":7}`,
+		`{"id":"Temperature","type":"gauge","value":21.5}`,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/update/", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	require.EqualValues(t, 12, metricsDump.MetricsCounter["Requests"])
+	require.EqualValues(t, 21.5, metricsDump.MetricsGauge["Temperature"])
+}
+
+func TestPushReceiverUpdateBatch(t *testing.T) {
+	receiver, metricsDump := newTestReceiver(t)
+	handler := receiver.Handler()
+
+	recorder := httptest.NewRecorder()
+	body := `[{"id":"Requests","type":"counter","delta":3},{"id":"Temperature","type":"gauge","value":19}]`
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	require.EqualValues(t, 3, metricsDump.MetricsCounter["Requests"])
+	require.EqualValues(t, 19, metricsDump.MetricsGauge["Temperature"])
+}
+
+func TestPushReceiverUpdateInvalid(t *testing.T) {
+	receiver, metricsDump := newTestReceiver(t)
+	handler := receiver.Handler()
+
+	for _, testCase := range []struct {
+		path string
+		body string
+	}{
+		{"/update/", `{"id":"Requests","type":"counter"}`},
+		{"/update/", `{"id":"Requests","type":"histogram","value":1}`},
+		{"/update/", `not json`},
+		{"/updates/", `[{"id":"Good","type":"gauge","value":1},{"id":"","type":"gauge","value":1}]`},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, testCase.path, strings.NewReader(testCase.body)))
+		require.Equal(t, http.StatusBadRequest, recorder.Code, testCase.body)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/update/", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	require.Empty(t, metricsDump.MetricsCounter)
+	require.Empty(t, metricsDump.MetricsGauge)
+}
+
+func TestPushReceiverUnixSocket(t *testing.T) {
+	metricsDump, err := statsreader.NewMetricsDump()
+	require.NoError(t, err)
+
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	receiver := NewPushReceiver(config.PushConfig{Socket: socketPath}, metricsDump)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, receiver.Run(ctx))
+
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+	response, err := client.Post("http://agent/update/", "application/json", strings.NewReader(`{"id":"Jobs","type":"counter","delta":1}`))
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	require.EqualValues(t, 1, metricsDump.MetricsCounter["Jobs"])
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"context"
+	"devops-tpl/internal/agent/metricsuploader"
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/logging"
+	"errors"
+	"log/slog"
+	"reflect"
+	"time"
+)
+
+// configRejected - ключ версии отклоненной конфигурации сервера в сводке конфигурации агента.
+const configRejected = "config_rejected"
+
+// remoteState - конфигурация агента с сервера (профиль, выбранный по меткам агента).
+type remoteState struct {
+	// assignment - последняя полученная конфигурация; appliedVersion - версия действующей, LocalVersion -
+	// действует локальная; rejectedVersion - версия конфигурации, не прошедшей проверку
+	assignment      agentapi.Assignment
+	appliedVersion  string
+	rejectedVersion string
+	// assignments - новая конфигурация сервера для применения в цикле Run
+	assignments chan agentapi.Assignment
+	// stop - остановка регистрации и получения конфигурации с прежними сведениями агента
+	stop context.CancelFunc
+}
+
+func newRemoteState() remoteState {
+	return remoteState{
+		assignment:     agentapi.Assignment{Version: agentapi.LocalVersion},
+		appliedVersion: agentapi.LocalVersion,
+		assignments:    make(chan agentapi.Assignment, 1),
+		stop:           func() {},
+	}
+}
+
+// applyEffectiveConfig - применение локальной конфигурации с настройками профиля сервера. Конфигурация сервера,
+// не прошедшая проверку, отклоняется - действует локальная конфигурация, версия отклоненной передается серверу.
+// При изменении сведений агента или настроек отправки агент регистрируется заново. Возвращает измененные поля,
+// для применения которых нужен перезапуск.
+func (app *AppHTTP) applyEffectiveConfig(ctx context.Context, tickerRefresh *time.Ticker, tickerUpload *time.Ticker) []string {
+	effective := app.localConfig
+	appliedVersion, rejectedVersion := agentapi.LocalVersion, ""
+	if assignment := app.remote.assignment; assignment.Version != agentapi.LocalVersion {
+		remoteConfig, err := app.localConfig.WithRemote(assignment.Config)
+		if err != nil {
+			rejectedVersion = assignment.Version
+			if rejectedVersion != app.remote.rejectedVersion {
+				slog.Warn("Remote config rejected, using local config", slog.String("version", assignment.Version), logging.Err(err))
+			}
+		} else {
+			effective = remoteConfig
+			appliedVersion = assignment.Version
+		}
+	}
+	if appliedVersion != app.remote.appliedVersion {
+		slog.Info("Remote config applied", slog.String("version", appliedVersion))
+	}
+
+	infoBefore := app.agentInfo()
+	uploaderBefore := app.loader.metricsUplader
+	intervalBefore := app.config.Remote.Interval
+
+	app.remote.appliedVersion = appliedVersion
+	app.remote.rejectedVersion = rejectedVersion
+	restartRequired := app.applyConfig(effective, tickerRefresh, tickerUpload)
+
+	if !reflect.DeepEqual(infoBefore, app.agentInfo()) || uploaderBefore != app.loader.metricsUplader ||
+		intervalBefore != app.config.Remote.Interval {
+		app.restartRemote(ctx)
+	}
+
+	return restartRequired
+}
+
+// restartRemote - регистрация агента с действующими сведениями и получение конфигурации сервера
+// (при Remote.Interval > 0) взамен прежних.
+func (app *AppHTTP) restartRemote(ctx context.Context) {
+	app.remote.stop()
+	remoteCtx, stop := context.WithCancel(ctx)
+	app.remote.stop = stop
+
+	loader := app.loader
+	info := app.agentInfo()
+	version := app.remote.assignment.Version
+	interval := app.config.Remote.Interval
+	assignments := app.remote.assignments
+
+	go func() {
+		loader.registerAgent(remoteCtx, info)
+		if interval <= 0 {
+			return
+		}
+
+		loader.watchConfig(remoteCtx, info, version, interval, func(assignment agentapi.Assignment) {
+			// Конфигурация, еще не примененная циклом Run, заменяется новой
+			for {
+				select {
+				case <-remoteCtx.Done():
+					return
+				case assignments <- assignment:
+					return
+				case <-assignments:
+				}
+			}
+		})
+	}()
+}
+
+// watchConfig - получение конфигурации агента с сервера до отмены ctx: поток gRPC, если задан адрес gRPC
+// сервера, иначе запрос по HTTP каждый interval. Новые версии передаются в handler. Незарегистрированный
+// агент регистрируется заново, разорванный поток подключается снова через interval.
+func (m MetricUploader) watchConfig(ctx context.Context, info agentapi.Info, version string, interval time.Duration, handler func(agentapi.Assignment)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		if m.metricsUploaderGRPC != nil {
+			err = m.metricsUploaderGRPC.WatchAgentConfig(ctx, info.ID, version, func(assignment agentapi.Assignment) {
+				version = assignment.Version
+				handler(assignment)
+			})
+		} else {
+			var assignment *agentapi.Assignment
+			assignment, err = m.metricsUplader.AgentConfig(info.ID, version)
+			if assignment != nil {
+				version = assignment.Version
+				handler(*assignment)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, metricsuploader.ErrAgentNotRegistered) {
+			slog.Info("Agent is not registered on the server, registering")
+			m.registerAgent(ctx, info)
+		} else if err != nil {
+			slog.Warn("Remote config error", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
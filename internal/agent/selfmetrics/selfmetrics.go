@@ -0,0 +1,228 @@
+// Package selfmetrics - метрики работы самого агента: сбор метрик по сборщикам, результаты и длительность
+// отправки, отправки в процессе и последняя ошибка. Метрики отправляются на сервер вместе с остальными
+// как agent_* gauge и доступны на локальном эндпоинте /status (config.StatusAddr).
+package selfmetrics
+
+import (
+	"context"
+	"devops-tpl/internal/agent/statsreader"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Метрики агента. Накопленные с запуска значения отправляются как gauge: агент передает их целиком,
+// а сервер суммирует значения counter.
+const (
+	Collections         = "agent_collections_total"
+	CollectErrors       = "agent_collect_errors_total"
+	CollectDuration     = "agent_collect_duration_seconds"
+	Uploads             = "agent_uploads_total"
+	UploadDuration      = "agent_upload_duration_seconds"
+	UploadsInFlight     = "agent_uploads_in_flight"
+	UploadFailuresInRow = "agent_upload_consecutive_failures"
+	LastErrorTime       = "agent_last_error_timestamp_seconds"
+)
+
+// unhealthyUploadFailures - число неудачных отправок подряд, после которого /status отвечает 503.
+const unhealthyUploadFailures = 3
+
+// sourceUpload - источник ошибки отправки в LastError.
+const sourceUpload = "upload"
+
+// CollectorStatus - сбор метрик одним сборщиком.
+type CollectorStatus struct {
+	Collections         int64   `json:"collections"`
+	Errors              int64   `json:"errors"`
+	LastDurationSeconds float64 `json:"last_duration_seconds"`
+}
+
+// UploadStatus - отправка метрик на сервер.
+type UploadStatus struct {
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+	// InFlight - начатые и еще не завершенные отправки
+	InFlight            int64      `json:"in_flight"`
+	ConsecutiveFailures int64      `json:"consecutive_failures"`
+	LastDurationSeconds float64    `json:"last_duration_seconds"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+}
+
+// ErrorStatus - последняя ошибка сбора или отправки.
+type ErrorStatus struct {
+	Time time.Time `json:"time"`
+	// Source - сборщик или upload
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
+
+// Status - состояние агента для /status.
+type Status struct {
+	// Healthy - последние отправки на сервер не завершились ошибкой unhealthyUploadFailures раз подряд
+	Healthy       bool                       `json:"healthy"`
+	UptimeSeconds float64                    `json:"uptime_seconds"`
+	Collectors    map[string]CollectorStatus `json:"collectors"`
+	Uploads       UploadStatus               `json:"uploads"`
+	LastError     *ErrorStatus               `json:"last_error,omitempty"`
+}
+
+// Stats - потокобезопасный учет работы агента.
+type Stats struct {
+	mutex      *sync.Mutex
+	startTime  time.Time
+	collectors map[string]CollectorStatus
+	uploads    UploadStatus
+	lastError  *ErrorStatus
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		mutex:      &sync.Mutex{},
+		startTime:  time.Now(),
+		collectors: map[string]CollectorStatus{},
+	}
+}
+
+// ObserveCollection - учет сбора метрик сборщиком collector длительностью duration.
+func (stats *Stats) ObserveCollection(collector string, duration time.Duration, err error) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	collectorStatus := stats.collectors[collector]
+	collectorStatus.Collections++
+	collectorStatus.LastDurationSeconds = duration.Seconds()
+	if err != nil {
+		collectorStatus.Errors++
+		stats.setLastError(collector, err)
+	}
+	stats.collectors[collector] = collectorStatus
+}
+
+// StartUpload - начало отправки метрик на сервер. Возвращает функцию завершения отправки с ее результатом.
+func (stats *Stats) StartUpload() func(err error) {
+	start := time.Now()
+
+	stats.mutex.Lock()
+	stats.uploads.InFlight++
+	stats.mutex.Unlock()
+
+	return func(err error) {
+		stats.mutex.Lock()
+		defer stats.mutex.Unlock()
+
+		stats.uploads.InFlight--
+		stats.uploads.LastDurationSeconds = time.Since(start).Seconds()
+		if err != nil {
+			stats.uploads.Failed++
+			stats.uploads.ConsecutiveFailures++
+			stats.setLastError(sourceUpload, err)
+			return
+		}
+
+		now := time.Now()
+		stats.uploads.Succeeded++
+		stats.uploads.ConsecutiveFailures = 0
+		stats.uploads.LastSuccess = &now
+	}
+}
+
+func (stats *Stats) setLastError(source string, err error) {
+	stats.lastError = &ErrorStatus{Time: time.Now(), Source: source, Message: err.Error()}
+}
+
+// Status - текущее состояние агента.
+func (stats *Stats) Status() Status {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	collectors := make(map[string]CollectorStatus, len(stats.collectors))
+	for collector, collectorStatus := range stats.collectors {
+		collectors[collector] = collectorStatus
+	}
+
+	status := Status{
+		Healthy:       stats.uploads.ConsecutiveFailures < unhealthyUploadFailures,
+		UptimeSeconds: time.Since(stats.startTime).Seconds(),
+		Collectors:    collectors,
+		Uploads:       stats.uploads,
+	}
+	if stats.lastError != nil {
+		lastError := *stats.lastError
+		status.LastError = &lastError
+	}
+
+	return status
+}
+
+// WriteTo - запись метрик агента в metricsDump перед отправкой на сервер.
+func (stats *Stats) WriteTo(metricsDump *statsreader.MetricsDump) {
+	status := stats.Status()
+
+	for collector, collectorStatus := range status.Collectors {
+		labels := map[string]string{"collector": collector}
+		metricsDump.UpdateGauge(metrics.MetricIDWithLabels(Collections, labels), float64(collectorStatus.Collections))
+		metricsDump.UpdateGauge(metrics.MetricIDWithLabels(CollectErrors, labels), float64(collectorStatus.Errors))
+		metricsDump.UpdateGauge(metrics.MetricIDWithLabels(CollectDuration, labels), collectorStatus.LastDurationSeconds)
+	}
+
+	metricsDump.UpdateGauge(metrics.MetricIDWithLabels(Uploads, map[string]string{"result": "ok"}), float64(status.Uploads.Succeeded))
+	metricsDump.UpdateGauge(metrics.MetricIDWithLabels(Uploads, map[string]string{"result": "error"}), float64(status.Uploads.Failed))
+	metricsDump.UpdateGauge(UploadDuration, status.Uploads.LastDurationSeconds)
+	metricsDump.UpdateGauge(UploadsInFlight, float64(status.Uploads.InFlight))
+	metricsDump.UpdateGauge(UploadFailuresInRow, float64(status.Uploads.ConsecutiveFailures))
+	if status.LastError != nil {
+		metricsDump.UpdateGauge(LastErrorTime, float64(status.LastError.Time.Unix()))
+	}
+}
+
+// Handler - GET /status: состояние агента в JSON, 503 - агент не может отправить метрики на сервер.
+func (stats *Stats) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, request *http.Request) {
+		status := stats.Status()
+
+		rw.Header().Set("Content-Type", "application/json")
+		if status.Healthy {
+			rw.WriteHeader(http.StatusOK)
+		} else {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(rw).Encode(status)
+	})
+
+	return mux
+}
+
+// ServeStatus - запуск эндпоинта /status по TCP адресу addr, завершается вместе с ctx.
+func (stats *Stats) ServeStatus(ctx context.Context, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	serverHTTP := &http.Server{
+		Handler: stats.Handler(),
+	}
+
+	go func() {
+		err := serverHTTP.Serve(lis)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Status serve error", logging.Err(err))
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		if err := serverHTTP.Shutdown(context.Background()); err != nil {
+			slog.Error("Status shutdown error", logging.Err(err))
+		}
+	}()
+
+	return nil
+}
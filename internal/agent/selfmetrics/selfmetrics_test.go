@@ -0,0 +1,83 @@
+package selfmetrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"devops-tpl/internal/agent/statsreader"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats_Status(t *testing.T) {
+	stats := NewStats()
+	stats.ObserveCollection("runtime", 2*time.Millisecond, nil)
+	stats.ObserveCollection("system", time.Millisecond, errors.New("cpu unavailable"))
+
+	uploadDone := stats.StartUpload()
+	require.EqualValues(t, 1, stats.Status().Uploads.InFlight)
+	uploadDone(nil)
+
+	status := stats.Status()
+	require.True(t, status.Healthy)
+	require.Equal(t, CollectorStatus{Collections: 1, LastDurationSeconds: 0.002}, status.Collectors["runtime"])
+	require.EqualValues(t, 1, status.Collectors["system"].Errors)
+	require.Equal(t, "system", status.LastError.Source)
+	require.EqualValues(t, 1, status.Uploads.Succeeded)
+	require.EqualValues(t, 0, status.Uploads.InFlight)
+	require.NotNil(t, status.Uploads.LastSuccess)
+
+	// Агент неработоспособен после unhealthyUploadFailures неудачных отправок подряд
+	for i := 0; i < unhealthyUploadFailures; i++ {
+		stats.StartUpload()(errors.New("connection refused"))
+	}
+	status = stats.Status()
+	require.False(t, status.Healthy)
+	require.Equal(t, ErrorStatus{Time: status.LastError.Time, Source: sourceUpload, Message: "connection refused"}, *status.LastError)
+
+	stats.StartUpload()(nil)
+	require.True(t, stats.Status().Healthy)
+}
+
+func TestStats_WriteTo(t *testing.T) {
+	stats := NewStats()
+	stats.ObserveCollection("runtime", time.Second, nil)
+	stats.StartUpload()(errors.New("timeout"))
+	stats.StartUpload()
+
+	metricsDump, err := statsreader.NewMetricsDump()
+	require.NoError(t, err)
+	stats.WriteTo(metricsDump)
+
+	require.EqualValues(t, 1, metricsDump.MetricsGauge[`agent_collections_total{collector="runtime"}`])
+	require.EqualValues(t, 1, metricsDump.MetricsGauge[`agent_collect_duration_seconds{collector="runtime"}`])
+	require.EqualValues(t, 0, metricsDump.MetricsGauge[`agent_uploads_total{result="ok"}`])
+	require.EqualValues(t, 1, metricsDump.MetricsGauge[`agent_uploads_total{result="error"}`])
+	require.EqualValues(t, 1, metricsDump.MetricsGauge[UploadsInFlight])
+	require.Contains(t, metricsDump.MetricsGauge, LastErrorTime)
+	require.Empty(t, metricsDump.MetricsCounter)
+}
+
+func TestStats_Handler(t *testing.T) {
+	stats := NewStats()
+	handler := stats.Handler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var status Status
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&status))
+	require.True(t, status.Healthy)
+
+	for i := 0; i < unhealthyUploadFailures; i++ {
+		stats.StartUpload()(errors.New("connection refused"))
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
@@ -0,0 +1,338 @@
+package statsreader
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-tpl/internal/metrics"
+)
+
+const (
+	promTypeCounter = "counter"
+	promTypeGauge   = "gauge"
+
+	// PromScrapeDurationMetric - длительность опроса цели в секундах.
+	PromScrapeDurationMetric = "scrape_duration_seconds"
+	// PromScrapeSuccessMetric - результат опроса цели (1 - успешно, 0 - ошибка).
+	PromScrapeSuccessMetric = "up"
+)
+
+var ErrPromInvalidLine = errors.New("invalid exposition line")
+
+// promSample - одно значение из Prometheus text exposition format.
+type promSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	Type   string
+}
+
+// promCounter - последнее значение counter цели и его часть, уже переданная в MetricsDump.
+type promCounter struct {
+	last      float64
+	accounted float64
+}
+
+// promBaseline - первое наблюдение counter: значение, накопленное до начала опроса, не отправляется.
+func promBaseline(value float64) promCounter {
+	return promCounter{last: value, accounted: value}
+}
+
+// increase - целое приращение counter со значением value. Дробная часть остается до следующих опросов,
+// уменьшение значения - сброс counter (перезапуск цели), приращением считается все значение.
+func (previous promCounter) increase(value float64) (int64, promCounter) {
+	accounted := previous.accounted
+	if value < previous.last {
+		accounted = 0
+	}
+	increase := math.Floor(value - accounted)
+
+	return int64(increase), promCounter{last: value, accounted: accounted + increase}
+}
+
+// PrometheusScraper - сборщик метрик с локальных HTTP целей в формате Prometheus.
+type PrometheusScraper struct {
+	client  *http.Client
+	targets []string
+	// mutex - опросы и смена целей выполняются по очереди: counter сравнивается с предыдущим опросом
+	mutex *sync.Mutex
+	// counters - counter метрики по цели и ID метрики из последнего успешного опроса цели
+	counters map[string]map[string]promCounter
+}
+
+func NewPrometheusScraper(targets []string, timeout time.Duration) *PrometheusScraper {
+	return &PrometheusScraper{
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		targets:  targets,
+		mutex:    &sync.Mutex{},
+		counters: map[string]map[string]promCounter{},
+	}
+}
+
+// SetTargets - замена целей и таймаута опроса. Значения counter сохраняются для целей, оставшихся в списке,
+// чтобы их приращения продолжали считаться от предыдущего опроса.
+func (scraper *PrometheusScraper) SetTargets(targets []string, timeout time.Duration) {
+	scraper.mutex.Lock()
+	defer scraper.mutex.Unlock()
+
+	counters := map[string]map[string]promCounter{}
+	for _, target := range targets {
+		if targetCounters, ok := scraper.counters[target]; ok {
+			counters[target] = targetCounters
+		}
+	}
+
+	scraper.client = &http.Client{Timeout: timeout}
+	scraper.targets = targets
+	scraper.counters = counters
+}
+
+// Scrape - опрос всех целей и запись значений в MetricsDump.
+// Counter цели накопительные, в MetricsDump добавляется их приращение с предыдущего опроса: сервер суммирует
+// полученные значения. Первое наблюдение counter - базовое, значение, накопленное до него, не отправляется.
+// Метка instance сэмпла заменяется адресом цели, исходное значение сохраняется в exported_instance.
+// Для каждой цели дополнительно записываются gauge метрики up и scrape_duration_seconds.
+func (scraper *PrometheusScraper) Scrape(ctx context.Context, metricsDump *MetricsDump) error {
+	scraper.mutex.Lock()
+	defer scraper.mutex.Unlock()
+
+	var scrapeErr error
+
+	for _, target := range scraper.targets {
+		instance := promInstance(target)
+		startTime := time.Now()
+
+		samples, err := scraper.scrapeTarget(ctx, target)
+		scrapeDuration := time.Since(startTime)
+
+		previousCounters := scraper.counters[target]
+		counters := map[string]promCounter{}
+
+		metricsDump.Lock()
+		for _, sample := range samples {
+			// NaN и Inf не кодируются в JSON, такие значения пропускаются
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+
+			if exported, ok := sample.Labels["instance"]; ok {
+				sample.Labels["exported_instance"] = exported
+			}
+			sample.Labels["instance"] = instance
+			metricID := metrics.MetricIDWithLabels(sample.Name, sample.Labels)
+
+			if sample.Type == promTypeCounter {
+				previous, ok := previousCounters[metricID]
+				if !ok {
+					counters[metricID] = promBaseline(sample.Value)
+					continue
+				}
+				var increase int64
+				increase, counters[metricID] = previous.increase(sample.Value)
+				metricsDump.MetricsCounter[metricID] += counter(increase)
+				continue
+			}
+			metricsDump.MetricsGauge[metricID] = gauge(sample.Value)
+		}
+		// После ошибки опроса значения сохраняются, чтобы не отправить counter цели повторно целиком
+		if err == nil {
+			scraper.counters[target] = counters
+		}
+
+		targetLabels := map[string]string{"instance": instance}
+		metricsDump.MetricsGauge[metrics.MetricIDWithLabels(PromScrapeDurationMetric, targetLabels)] = gauge(scrapeDuration.Seconds())
+		if err != nil {
+			metricsDump.MetricsGauge[metrics.MetricIDWithLabels(PromScrapeSuccessMetric, targetLabels)] = 0
+		} else {
+			metricsDump.MetricsGauge[metrics.MetricIDWithLabels(PromScrapeSuccessMetric, targetLabels)] = 1
+		}
+		metricsDump.Unlock()
+
+		if err != nil {
+			scrapeErr = fmt.Errorf("scrape %s error : %w", target, err)
+		}
+	}
+
+	return scrapeErr
+}
+
+func (scraper *PrometheusScraper) scrapeTarget(ctx context.Context, target string) ([]promSample, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	response, err := scraper.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP Status: %v (not 200)", response.StatusCode)
+	}
+
+	return parsePromText(response.Body)
+}
+
+// promInstance - значение метки instance для цели (host:port из URL).
+func promInstance(target string) string {
+	targetURL, err := url.Parse(target)
+	if err != nil || targetURL.Host == "" {
+		return target
+	}
+
+	return targetURL.Host
+}
+
+// parsePromText - разбор Prometheus text exposition format (version 0.0.4).
+// Сэмплы counter метрик получают тип counter, все остальные (gauge, untyped, summary, histogram) - gauge.
+func parsePromText(reader io.Reader) ([]promSample, error) {
+	var samples []promSample
+	metricTypes := map[string]string{}
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				metricTypes[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		sample, err := parsePromSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		sample.Type = promTypeGauge
+		if metricTypes[sample.Name] == promTypeCounter {
+			sample.Type = promTypeCounter
+		}
+		samples = append(samples, sample)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+func parsePromSample(line string) (promSample, error) {
+	sample := promSample{
+		Labels: map[string]string{},
+	}
+
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return sample, ErrPromInvalidLine
+	}
+	sample.Name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	if rest[0] == '{' {
+		var err error
+		rest, err = parsePromLabels(rest[1:], sample.Labels)
+		if err != nil {
+			return sample, err
+		}
+	}
+
+	// Значение и необязательная временная метка, которая игнорируется
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, ErrPromInvalidLine
+	}
+
+	value, err := parsePromValue(fields[0])
+	if err != nil {
+		return sample, err
+	}
+	sample.Value = value
+
+	return sample, nil
+}
+
+// parsePromLabels - разбор набора меток после открывающей скобки, возвращает остаток строки после '}'.
+func parsePromLabels(line string, labels map[string]string) (string, error) {
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return "", ErrPromInvalidLine
+		}
+		if line[0] == '}' {
+			return line[1:], nil
+		}
+
+		nameEnd := strings.IndexByte(line, '=')
+		if nameEnd <= 0 {
+			return "", ErrPromInvalidLine
+		}
+		labelName := strings.TrimSpace(line[:nameEnd])
+		line = strings.TrimLeft(line[nameEnd+1:], " \t")
+		if line == "" || line[0] != '"' {
+			return "", ErrPromInvalidLine
+		}
+
+		var labelValue strings.Builder
+		i := 1
+		for ; i < len(line) && line[i] != '"'; i++ {
+			if line[i] != '\\' || i+1 == len(line) {
+				labelValue.WriteByte(line[i])
+				continue
+			}
+
+			i++
+			switch line[i] {
+			case 'n':
+				labelValue.WriteByte('\n')
+			default:
+				labelValue.WriteByte(line[i])
+			}
+		}
+		if i == len(line) {
+			return "", ErrPromInvalidLine
+		}
+		labels[labelName] = labelValue.String()
+
+		line = strings.TrimLeft(line[i+1:], " \t")
+		if strings.HasPrefix(line, ",") {
+			line = line[1:]
+		}
+	}
+}
+
+func parsePromValue(value string) (float64, error) {
+	switch value {
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+
+	return strconv.ParseFloat(value, 64)
+}
@@ -0,0 +1,177 @@
+package statsreader
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const promTestExposition = `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# TYPE temperature gauge
+temperature 21.5
+escaped{path="C:\\dir\\file \"name\""} 1
+# A histogram, which has a pretty complex representation in the text format:
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="+Inf"} 144320
+untyped_value NaN
+`
+
+func TestParsePromText(t *testing.T) {
+	samples, err := parsePromText(strings.NewReader(promTestExposition))
+	require.NoError(t, err)
+	require.Len(t, samples, 6)
+
+	assert.Equal(t, "http_requests_total", samples[0].Name)
+	assert.Equal(t, map[string]string{"method": "post", "code": "200"}, samples[0].Labels)
+	assert.Equal(t, 1027.0, samples[0].Value)
+	assert.Equal(t, promTypeCounter, samples[0].Type)
+
+	assert.Equal(t, 3.0, samples[1].Value)
+
+	assert.Equal(t, "temperature", samples[2].Name)
+	assert.Equal(t, 21.5, samples[2].Value)
+	assert.Equal(t, promTypeGauge, samples[2].Type)
+
+	assert.Equal(t, `C:\dir\file "name"`, samples[3].Labels["path"])
+
+	assert.Equal(t, "http_request_duration_seconds_bucket", samples[4].Name)
+	assert.Equal(t, promTypeGauge, samples[4].Type)
+
+	assert.True(t, math.IsNaN(samples[5].Value))
+}
+
+func TestParsePromTextInvalid(t *testing.T) {
+	for _, line := range []string{
+		`metric_without_value`,
+		`metric{label="value" 1`,
+		`metric{label=value} 1`,
+		`metric 1 2 3`,
+		`metric abc`,
+	} {
+		_, err := parsePromText(strings.NewReader(line))
+		assert.Error(t, err, line)
+	}
+}
+
+func TestPrometheusScraperScrape(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, promTestExposition)
+	}))
+	defer target.Close()
+
+	brokenTarget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer brokenTarget.Close()
+
+	metricsDump, err := NewMetricsDump()
+	require.NoError(t, err)
+
+	scraper := NewPrometheusScraper([]string{target.URL + "/metrics", brokenTarget.URL + "/metrics"}, time.Second)
+	err = scraper.Scrape(context.Background(), metricsDump)
+	assert.Error(t, err)
+
+	instance := promInstance(target.URL)
+	brokenInstance := promInstance(brokenTarget.URL)
+
+	// Первый опрос counter - базовый, накопленное до него значение не отправляется
+	requestsID := fmt.Sprintf(`http_requests_total{code="200",instance=%q,method="post"}`, instance)
+	assert.NotContains(t, metricsDump.MetricsCounter, requestsID)
+
+	temperatureID := fmt.Sprintf(`temperature{instance=%q}`, instance)
+	assert.EqualValues(t, 21.5, metricsDump.MetricsGauge[temperatureID])
+
+	_, ok := metricsDump.MetricsGauge[fmt.Sprintf(`untyped_value{instance=%q}`, instance)]
+	assert.False(t, ok)
+
+	assert.EqualValues(t, 1, metricsDump.MetricsGauge[fmt.Sprintf(`up{instance=%q}`, instance)])
+	assert.EqualValues(t, 0, metricsDump.MetricsGauge[fmt.Sprintf(`up{instance=%q}`, brokenInstance)])
+
+	_, ok = metricsDump.MetricsGauge[fmt.Sprintf(`scrape_duration_seconds{instance=%q}`, brokenInstance)]
+	assert.True(t, ok)
+}
+
+func TestPrometheusScraperCounterIncrease(t *testing.T) {
+	// Значения counter цели в последовательных опросах, пустая строка - ошибка опроса
+	values := []string{"10", "12.5", "", "13.25", "14", "2"}
+	scrapes := 0
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := values[scrapes]
+		scrapes++
+		if value == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "# TYPE jobs_total counter\njobs_total %s\n", value)
+	}))
+	defer target.Close()
+
+	metricsDump, err := NewMetricsDump()
+	require.NoError(t, err)
+	scraper := NewPrometheusScraper([]string{target.URL}, time.Second)
+	jobsID := fmt.Sprintf(`jobs_total{instance=%q}`, promInstance(target.URL))
+
+	var increases []int64
+	for range values {
+		scraper.Scrape(context.Background(), metricsDump)
+		increases = append(increases, int64(metricsDump.MetricsCounter[jobsID]))
+		// Приращения передаются на отправку после каждого опроса
+		metricsDump.SubtractCounters(metricsDump.Filter(func(string) bool { return true }))
+	}
+
+	// Первый опрос - базовый, дробная часть накапливается, уменьшение значения - сброс counter цели
+	require.Equal(t, []int64{0, 2, 0, 1, 1, 2}, increases)
+}
+
+func TestPrometheusScraperSetTargets(t *testing.T) {
+	value := &atomic.Int64{}
+	value.Store(10)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "# TYPE jobs_total counter\njobs_total %d\n", value.Load())
+	}))
+	defer target.Close()
+	otherTarget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# TYPE jobs_total counter\njobs_total 100\n")
+	}))
+	defer otherTarget.Close()
+
+	metricsDump, err := NewMetricsDump()
+	require.NoError(t, err)
+	scraper := NewPrometheusScraper([]string{target.URL}, time.Second)
+	require.NoError(t, scraper.Scrape(context.Background(), metricsDump))
+
+	// Цель, оставшаяся после смены списка, продолжает считать приращения от предыдущего опроса
+	value.Store(15)
+	scraper.SetTargets([]string{target.URL, otherTarget.URL}, time.Second)
+	require.NoError(t, scraper.Scrape(context.Background(), metricsDump))
+	assert.EqualValues(t, 5, metricsDump.MetricsCounter[fmt.Sprintf(`jobs_total{instance=%q}`, promInstance(target.URL))])
+	assert.NotContains(t, metricsDump.MetricsCounter, fmt.Sprintf(`jobs_total{instance=%q}`, promInstance(otherTarget.URL)))
+}
+
+func TestPrometheusScraperExportedInstance(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "app_info{instance=\"app-1\"} 1\n")
+	}))
+	defer target.Close()
+
+	metricsDump, err := NewMetricsDump()
+	require.NoError(t, err)
+	scraper := NewPrometheusScraper([]string{target.URL}, time.Second)
+	require.NoError(t, scraper.Scrape(context.Background(), metricsDump))
+
+	appInfoID := fmt.Sprintf(`app_info{exported_instance="app-1",instance=%q}`, promInstance(target.URL))
+	assert.EqualValues(t, 1, metricsDump.MetricsGauge[appInfoID])
+}
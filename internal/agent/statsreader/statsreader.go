@@ -17,7 +17,8 @@ type counter int64
 // MetricsDump - потокобезопасное хранилище метрик.
 type MetricsDump struct {
 	*sync.RWMutex
-	MetricsGauge   map[string]gauge
+	MetricsGauge map[string]gauge
+	// MetricsCounter - приращения counter метрик, еще не переданные на отправку (SubtractCounters)
 	MetricsCounter map[string]counter
 }
 
@@ -99,3 +100,97 @@ func (metricsDump *MetricsDump) RefreshExtra() error {
 
 	return nil
 }
+
+// UpdateGauge - запись значения gauge метрики.
+func (metricsDump *MetricsDump) UpdateGauge(name string, value float64) {
+	metricsDump.Lock()
+	defer metricsDump.Unlock()
+
+	metricsDump.MetricsGauge[name] = gauge(value)
+}
+
+// AddCounter - увеличение counter метрики на delta.
+func (metricsDump *MetricsDump) AddCounter(name string, delta int64) {
+	metricsDump.Lock()
+	defer metricsDump.Unlock()
+
+	metricsDump.MetricsCounter[name] += counter(delta)
+}
+
+// SubtractCounters - вычитание значений counter метрик sent, переданных на отправку: сервер суммирует
+// полученные приращения, поэтому в MetricsDump остаются только накопленные позже. Обнулившиеся метрики удаляются.
+func (metricsDump *MetricsDump) SubtractCounters(sent *MetricsDump) {
+	metricsDump.addCounters(sent, -1)
+}
+
+// RestoreCounters - возврат значений counter метрик unsent, которые не удалось отправить (SubtractCounters).
+func (metricsDump *MetricsDump) RestoreCounters(unsent *MetricsDump) {
+	metricsDump.addCounters(unsent, 1)
+}
+
+func (metricsDump *MetricsDump) addCounters(source *MetricsDump, sign counter) {
+	source.RLock()
+	defer source.RUnlock()
+	metricsDump.Lock()
+	defer metricsDump.Unlock()
+
+	for name, value := range source.MetricsCounter {
+		result := metricsDump.MetricsCounter[name] + sign*value
+		if result == 0 {
+			delete(metricsDump.MetricsCounter, name)
+			continue
+		}
+		metricsDump.MetricsCounter[name] = result
+	}
+}
+
+// Split - разбиение метрик на не более чем parts непустых частей без повторов: части отправляются
+// параллельно, и каждое приращение counter попадает на сервер один раз.
+func (metricsDump *MetricsDump) Split(parts int) []*MetricsDump {
+	metricsDump.RLock()
+	defer metricsDump.RUnlock()
+
+	total := len(metricsDump.MetricsGauge) + len(metricsDump.MetricsCounter)
+	if parts > total {
+		parts = total
+	}
+	if parts < 1 {
+		parts = 1
+	}
+
+	shards := make([]*MetricsDump, parts)
+	for i := range shards {
+		shards[i], _ = NewMetricsDump()
+	}
+	i := 0
+	for name, value := range metricsDump.MetricsGauge {
+		shards[i%parts].MetricsGauge[name] = value
+		i++
+	}
+	for name, value := range metricsDump.MetricsCounter {
+		shards[i%parts].MetricsCounter[name] = value
+		i++
+	}
+
+	return shards
+}
+
+// Filter - копия метрик, ID которых проходят проверку keep.
+func (metricsDump *MetricsDump) Filter(keep func(metricID string) bool) *MetricsDump {
+	metricsDump.RLock()
+	defer metricsDump.RUnlock()
+
+	filtered, _ := NewMetricsDump()
+	for name, value := range metricsDump.MetricsGauge {
+		if keep(name) {
+			filtered.MetricsGauge[name] = value
+		}
+	}
+	for name, value := range metricsDump.MetricsCounter {
+		if keep(name) {
+			filtered.MetricsCounter[name] = value
+		}
+	}
+
+	return filtered
+}
@@ -44,3 +44,63 @@ func TestRefreshExtra(t *testing.T) {
 	_, ok = metricsDump.MetricsGauge["FreeMemory"]
 	assert.True(t, ok)
 }
+
+func TestMetricsDump_SubtractCounters(t *testing.T) {
+	metricsDump, err := NewMetricsDump()
+	assert.NoError(t, err)
+	keepAll := func(string) bool { return true }
+
+	// Первая отправка: переданные приращения не отправляются повторно
+	metricsDump.AddCounter("Requests", 5)
+	sent := metricsDump.Filter(keepAll)
+	metricsDump.SubtractCounters(sent)
+	metricsDump.AddCounter("Requests", 2)
+	assert.EqualValues(t, 5, sent.MetricsCounter["Requests"])
+	assert.EqualValues(t, 2, metricsDump.MetricsCounter["Requests"])
+
+	// Вторая отправка не удалась: приращения возвращаются к накопленным после нее
+	sent = metricsDump.Filter(keepAll)
+	metricsDump.SubtractCounters(sent)
+	metricsDump.AddCounter("Requests", 1)
+	metricsDump.RestoreCounters(sent)
+	assert.EqualValues(t, 3, metricsDump.MetricsCounter["Requests"])
+
+	// Третья отправка передает все неотправленное, метрика без приращений удаляется
+	sent = metricsDump.Filter(keepAll)
+	metricsDump.SubtractCounters(sent)
+	assert.EqualValues(t, 3, sent.MetricsCounter["Requests"])
+	assert.NotContains(t, metricsDump.MetricsCounter, "Requests")
+}
+
+func TestMetricsDump_Split(t *testing.T) {
+	metricsDump, err := NewMetricsDump()
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		metricsDump.UpdateGauge(fmt.Sprintf("Gauge%d", i), float64(i))
+		metricsDump.AddCounter(fmt.Sprintf("Counter%d", i), int64(i+1))
+	}
+
+	// Каждая метрика попадает ровно в одну часть
+	shards := metricsDump.Split(3)
+	assert.Len(t, shards, 3)
+	gauges, counters := map[string]gauge{}, map[string]counter{}
+	for _, shard := range shards {
+		assert.NotZero(t, len(shard.MetricsGauge)+len(shard.MetricsCounter))
+		for name, value := range shard.MetricsGauge {
+			assert.NotContains(t, gauges, name)
+			gauges[name] = value
+		}
+		for name, value := range shard.MetricsCounter {
+			assert.NotContains(t, counters, name)
+			counters[name] = value
+		}
+	}
+	assert.Equal(t, metricsDump.MetricsGauge, gauges)
+	assert.Equal(t, metricsDump.MetricsCounter, counters)
+
+	// Частей не больше, чем метрик
+	assert.Len(t, metricsDump.Split(100), 10)
+	empty, err := NewMetricsDump()
+	assert.NoError(t, err)
+	assert.Len(t, empty.Split(4), 1)
+}
@@ -0,0 +1,81 @@
+// Package agentapi - обмен агента с сервером, общий для агента и сервера: сведения агента при регистрации,
+// конфигурация агента из профиля сервера и токен клиента gRPC.
+package agentapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Сборщики метрик агента, включаемые профилем.
+const (
+	CollectorRuntime    = "runtime"
+	CollectorSystem     = "system"
+	CollectorPrometheus = "prometheus"
+)
+
+// Ключи сводки конфигурации агента (Info.Config).
+const (
+	// ConfigReportInterval - интервал отправки метрик
+	ConfigReportInterval = "report_interval"
+	// ConfigVersion - версия примененной удаленной конфигурации
+	ConfigVersion = "config_version"
+)
+
+// LocalVersion - версия конфигурации агента без профиля: действует локальная конфигурация.
+const LocalVersion = "local"
+
+// maxIDLength - ограничение длины ID агента.
+const maxIDLength = 128
+
+var ErrInvalidAgent = errors.New("invalid agent")
+
+// Info - сведения агента при регистрации.
+type Info struct {
+	// ID - идентификатор агента, по умолчанию имя хоста
+	ID       string `json:"id"`
+	Hostname string `json:"hostname"`
+	Version  string `json:"version"`
+	// Config - сводка конфигурации агента (интервалы, транспорт, источники метрик)
+	Config map[string]string `json:"config,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Validate - проверка ID агента: латинские буквы, цифры, ".", "-" и "_", не длиннее 128 символов.
+func (info Info) Validate() error {
+	if info.ID == "" || len(info.ID) > maxIDLength {
+		return fmt.Errorf("%w: id must be 1 to %d characters long", ErrInvalidAgent, maxIDLength)
+	}
+
+	for _, symbol := range info.ID {
+		isLetter := (symbol >= 'a' && symbol <= 'z') || (symbol >= 'A' && symbol <= 'Z')
+		isDigit := symbol >= '0' && symbol <= '9'
+		if !isLetter && !isDigit && symbol != '-' && symbol != '_' && symbol != '.' {
+			return fmt.Errorf("%w: id %q must contain only letters, digits, \".\", \"-\" and \"_\"", ErrInvalidAgent, info.ID)
+		}
+	}
+
+	return nil
+}
+
+// RemoteConfig - настройки агента из профиля, заменяющие локальные. Пустые значения не меняют локальные настройки.
+type RemoteConfig struct {
+	// PollInterval, ReportInterval - интервалы в формате time.ParseDuration (10s)
+	PollInterval   string `json:"poll_interval,omitempty"`
+	ReportInterval string `json:"report_interval,omitempty"`
+	RateLimit      int    `json:"rate_limit,omitempty"`
+	// Collectors - включенные сборщики (runtime, system, prometheus), остальные выключаются
+	Collectors []string `json:"collectors,omitempty"`
+	// Include, Exclude - шаблоны ID отправляемых метрик (path.Match: CPU*)
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// Labels - метки, добавляемые к меткам агента
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Assignment - конфигурация агента: профиль, версия и настройки. Без профиля версия - LocalVersion.
+type Assignment struct {
+	Profile string       `json:"profile,omitempty"`
+	Version string       `json:"version"`
+	Config  RemoteConfig `json:"config"`
+}
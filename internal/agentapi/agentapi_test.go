@@ -0,0 +1,18 @@
+package agentapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfo_Validate(t *testing.T) {
+	for _, id := range []string{"agent", "host-1.example.com", "agent_2"} {
+		require.NoError(t, Info{ID: id}.Validate(), id)
+	}
+
+	for _, id := range []string{"", "agent 1", "agent/1", "агент", strings.Repeat("a", maxIDLength+1)} {
+		require.ErrorIs(t, Info{ID: id}.Validate(), ErrInvalidAgent, id)
+	}
+}
@@ -0,0 +1,16 @@
+package agentapi
+
+import "context"
+
+// TokenCredentials - токен клиента gRPC, передается в метаданных authorization каждого вызова
+// (grpc.WithPerRPCCredentials).
+type TokenCredentials string
+
+func (token TokenCredentials) GetRequestMetadata(_ context.Context, _ ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(token)}, nil
+}
+
+// RequireTransportSecurity - токен передается и без TLS, как и остальные данные gRPC клиента.
+func (token TokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
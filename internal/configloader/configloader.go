@@ -0,0 +1,176 @@
+// Package configloader - загрузка конфигурации агента и сервера по слоям с документированным приоритетом.
+//
+// Слои в порядке возрастания приоритета:
+//  1. значения по умолчанию (значения структуры до загрузки);
+//  2. файл JSON или YAML (расширение .yaml, .yml) из флага -c (-config), иначе из переменной окружения CONFIG;
+//  3. переменные окружения (тег env);
+//  4. флаги командной строки.
+//
+// Ключи файла - теги json полей, вложенные структуры без тега - по имени поля (Store, HTTPClientConnection).
+// Длительности в файле задаются строкой (10s) или числом наносекунд.
+package configloader
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/caarlos0/env/v6"
+)
+
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Result - результат загрузки помимо самой конфигурации.
+type Result struct {
+	// Path - файл конфигурации, пустая строка - без файла
+	Path string
+	// PrintConfig - задан флаг print-config: вывести действующую конфигурацию (Print) и завершиться
+	PrintConfig bool
+	// Sources - слой, из которого получено значение поля, по пути поля (Store.Interval)
+	Sources map[string]string
+	// Args - аргументы после флагов
+	Args []string
+}
+
+// loaderFlags - флаги самого загрузчика.
+type loaderFlags struct {
+	configPath  string
+	printConfig bool
+}
+
+func newFlagSet[T any](name string, output io.Writer, config *T, bindFlags func(config *T, flagSet *flag.FlagSet)) (*flag.FlagSet, *loaderFlags) {
+	var flags loaderFlags
+
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.SetOutput(output)
+	flagSet.StringVar(&flags.configPath, "c", "", "path to config file (json or yaml)")
+	flagSet.StringVar(&flags.configPath, "config", "", "path to config file (json or yaml)")
+	flagSet.BoolVar(&flags.printConfig, "print-config", false, "print effective config with value sources and exit")
+	bindFlags(config, flagSet)
+
+	return flagSet, &flags
+}
+
+// Load - загрузка конфигурации в config по слоям, config до вызова содержит значения по умолчанию.
+// bindFlags связывает флаги с полями переданной конфигурации. Ошибки значений в файле возвращаются как Errors.
+func Load[T any](name string, output io.Writer, config *T, bindFlags func(config *T, flagSet *flag.FlagSet), args []string) (Result, error) {
+	result := Result{Sources: map[string]string{}}
+	walkFields(reflect.ValueOf(config).Elem(), "", func(path string, _ reflect.StructField, _ reflect.Value) {
+		result.Sources[path] = SourceDefault
+	})
+
+	// Первый разбор - путь до файла конфигурации и проверка флагов, значения применяются последним слоем
+	probe := *config
+	flagSet, flags := newFlagSet(name, output, &probe, bindFlags)
+	err := flagSet.Parse(args)
+	if err != nil {
+		return result, err
+	}
+	result.PrintConfig = flags.printConfig
+
+	result.Path = flags.configPath
+	if path, ok := os.LookupEnv("CONFIG"); ok && result.Path == "" {
+		result.Path = path
+	}
+	if result.Path != "" {
+		err = applyFile(config, result.Path, result.Sources)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	err = env.Parse(config)
+	if err != nil {
+		return result, fmt.Errorf("config env: %w", err)
+	}
+	walkFields(reflect.ValueOf(config).Elem(), "", func(path string, field reflect.StructField, _ reflect.Value) {
+		if name, ok := envName(field); ok {
+			// Пустое значение переменной не заменяет значение поля
+			if value, ok := os.LookupEnv(name); ok && value != "" {
+				result.Sources[path] = SourceEnv
+			}
+		}
+	})
+
+	beforeFlags := *config
+	flagSet, _ = newFlagSet(name, io.Discard, config, bindFlags)
+	err = flagSet.Parse(args)
+	if err != nil {
+		return result, err
+	}
+	markFlagSources(flagSet, &beforeFlags, config, result.Sources)
+	result.Args = flagSet.Args()
+
+	return result, nil
+}
+
+// markFlagSources - источник flag для полей, заданных флагами: по адресу значения флага,
+// а для флагов с функцией разбора (flag.Func) - по изменению значения.
+func markFlagSources[T any](flagSet *flag.FlagSet, before *T, config *T, sources map[string]string) {
+	paths := map[uintptr]string{}
+	walkFields(reflect.ValueOf(config).Elem(), "", func(path string, _ reflect.StructField, value reflect.Value) {
+		paths[value.Addr().Pointer()] = path
+	})
+
+	flagSet.Visit(func(setFlag *flag.Flag) {
+		value := reflect.ValueOf(setFlag.Value)
+		if value.Kind() != reflect.Pointer {
+			return
+		}
+		if path, ok := paths[value.Pointer()]; ok {
+			sources[path] = SourceFlag
+		}
+	})
+
+	beforeValues := map[string]reflect.Value{}
+	walkFields(reflect.ValueOf(before).Elem(), "", func(path string, _ reflect.StructField, value reflect.Value) {
+		beforeValues[path] = value
+	})
+	walkFields(reflect.ValueOf(config).Elem(), "", func(path string, _ reflect.StructField, value reflect.Value) {
+		if !reflect.DeepEqual(beforeValues[path].Interface(), value.Interface()) {
+			sources[path] = SourceFlag
+		}
+	})
+}
+
+// walkFields - обход экспортируемых полей-значений структуры; вложенные структуры обходятся по полям с путем
+// через точку, поля встроенных структур - без имени встроенной структуры.
+func walkFields(value reflect.Value, prefix string, handler func(path string, field reflect.StructField, value reflect.Value)) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if field.Anonymous {
+				walkFields(fieldValue, prefix, handler)
+			} else {
+				walkFields(fieldValue, prefix+field.Name+".", handler)
+			}
+			continue
+		}
+
+		handler(prefix+field.Name, field, fieldValue)
+	}
+}
+
+// envName - имя переменной окружения поля без опций тега.
+func envName(field reflect.StructField) (string, bool) {
+	name, ok := field.Tag.Lookup("env")
+	if !ok {
+		return "", false
+	}
+
+	name, _, _ = strings.Cut(name, ",")
+	return name, name != ""
+}
@@ -0,0 +1,175 @@
+package configloader
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type storeConfig struct {
+	Interval time.Duration `env:"TEST_STORE_INTERVAL" json:"store_interval,omitempty"`
+	File     string        `env:"TEST_STORE_FILE" json:"store_file,omitempty"`
+}
+
+type testConfig struct {
+	Addr       string            `env:"TEST_ADDRESS" json:"address,omitempty"`
+	SignKey    string            `env:"TEST_KEY" json:"sign_key,omitempty" secret:"true"`
+	Restore    bool              `env:"TEST_RESTORE" json:"restore,omitempty"`
+	RateLimit  int               `env:"TEST_RATE_LIMIT" json:"rate_limit,omitempty"`
+	Ratio      float64           `json:"ratio,omitempty"`
+	Targets    []string          `env:"TEST_TARGETS" envSeparator:"," json:"targets,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	ConfigPath string            `json:"-"`
+	Store      storeConfig
+}
+
+func (config *testConfig) bindFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&config.Addr, "a", config.Addr, "address")
+	flagSet.DurationVar(&config.Store.Interval, "i", config.Store.Interval, "store interval")
+	flagSet.Func("targets", "comma separated targets", func(value string) error {
+		config.Targets = strings.Split(value, ",")
+		return nil
+	})
+}
+
+func newTestConfig() *testConfig {
+	return &testConfig{
+		Addr:      "127.0.0.1:8080",
+		RateLimit: 1,
+		Store:     storeConfig{Interval: time.Minute, File: "/tmp/metrics.json"},
+	}
+}
+
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfig(t, "config.json", `{
+		"address": "127.0.0.1:9090",
+		"sign_key": "file",
+		"restore": true,
+		"rate_limit": 4,
+		"ratio": 2.5,
+		"Store": {"store_interval": "5s", "store_file": "/tmp/file.json"}
+	}`)
+	t.Setenv("TEST_KEY", "env")
+	t.Setenv("TEST_STORE_INTERVAL", "10s")
+
+	config := newTestConfig()
+	result, err := Load("test", &bytes.Buffer{}, config, (*testConfig).bindFlags, []string{"-c", path, "-i", "15s", "-targets", "a,b", "list"})
+	require.NoError(t, err)
+
+	require.Equal(t, path, result.Path)
+	require.Equal(t, []string{"list"}, result.Args)
+	require.False(t, result.PrintConfig)
+
+	require.Equal(t, "127.0.0.1:9090", config.Addr)
+	require.Equal(t, "env", config.SignKey)
+	require.True(t, config.Restore)
+	require.Equal(t, 4, config.RateLimit)
+	require.Equal(t, 2.5, config.Ratio)
+	require.Equal(t, 15*time.Second, config.Store.Interval)
+	require.Equal(t, "/tmp/file.json", config.Store.File)
+	require.Equal(t, []string{"a", "b"}, config.Targets)
+
+	require.Equal(t, map[string]string{
+		"Addr":           SourceFile,
+		"SignKey":        SourceEnv,
+		"Restore":        SourceFile,
+		"RateLimit":      SourceFile,
+		"Ratio":          SourceFile,
+		"Targets":        SourceFlag,
+		"Labels":         SourceDefault,
+		"ConfigPath":     SourceDefault,
+		"Store.Interval": SourceFlag,
+		"Store.File":     SourceFile,
+	}, result.Sources)
+}
+
+func TestLoad_YAML(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+address: 127.0.0.1:9090
+sign_key: 12345
+ratio: 3
+targets:
+  - http://127.0.0.1:9100/metrics
+labels:
+  dc: eu-1
+  rack: 42
+Store:
+  store_interval: 1m30s
+`)
+	t.Setenv("CONFIG", path)
+
+	config := newTestConfig()
+	result, err := Load("test", &bytes.Buffer{}, config, (*testConfig).bindFlags, nil)
+	require.NoError(t, err)
+	require.Equal(t, path, result.Path)
+	require.Equal(t, "12345", config.SignKey)
+	require.Equal(t, 3.0, config.Ratio)
+	require.Equal(t, []string{"http://127.0.0.1:9100/metrics"}, config.Targets)
+	require.Equal(t, map[string]string{"dc": "eu-1", "rack": "42"}, config.Labels)
+	require.Equal(t, 90*time.Second, config.Store.Interval)
+}
+
+func TestLoad_FieldErrors(t *testing.T) {
+	path := writeConfig(t, "config.json", `{
+		"adress": "127.0.0.1:9090",
+		"restore": "yes",
+		"rate_limit": 1.5,
+		"Store": {"store_interval": "5 minutes"}
+	}`)
+
+	config := newTestConfig()
+	_, err := Load("test", &bytes.Buffer{}, config, (*testConfig).bindFlags, []string{"-config", path})
+
+	var errs Errors
+	require.True(t, errors.As(err, &errs))
+	fields := map[string]bool{}
+	for _, fieldError := range errs {
+		fields[fieldError.Field] = true
+	}
+	require.Equal(t, map[string]bool{"adress": true, "Restore": true, "RateLimit": true, "Store.Interval": true}, fields)
+
+	_, err = Load("test", &bytes.Buffer{}, newTestConfig(), (*testConfig).bindFlags, []string{"-c", filepath.Join(t.TempDir(), "missing.json")})
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	output := &bytes.Buffer{}
+	_, err = Load("test", output, newTestConfig(), (*testConfig).bindFlags, []string{"-unknown"})
+	require.Error(t, err)
+	require.Contains(t, output.String(), "flag provided but not defined")
+}
+
+func TestPrint(t *testing.T) {
+	config := newTestConfig()
+	result, err := Load("test", &bytes.Buffer{}, config, (*testConfig).bindFlags, []string{"-print-config", "-a", ":8080"})
+	require.NoError(t, err)
+	require.True(t, result.PrintConfig)
+
+	config.SignKey = "secret"
+	config.Labels = map[string]string{"rack": "42", "dc": "eu-1"}
+	output := &bytes.Buffer{}
+	require.NoError(t, Print(output, config, result))
+	require.Equal(t, `# config file: -
+FIELD           VALUE                SOURCE
+Addr            ":8080"              flag
+SignKey         ******               default
+Restore         false                default
+RateLimit       1                    default
+Ratio           0                    default
+Targets         []                   default
+Labels          {dc=eu-1, rack=42}   default
+Store.Interval  1m0s                 default
+Store.File      "/tmp/metrics.json"  default
+`, output.String())
+}
@@ -0,0 +1,55 @@
+package configloader
+
+import (
+	"errors"
+	"strings"
+)
+
+// FieldError - ошибка значения поля конфигурации, Field - путь поля (Store.Interval).
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (fieldError FieldError) Error() string {
+	return fieldError.Field + ": " + fieldError.Err.Error()
+}
+
+func (fieldError FieldError) Unwrap() error {
+	return fieldError.Err
+}
+
+// Errors - ошибки полей конфигурации, выводятся все сразу.
+type Errors []FieldError
+
+// Add - ошибка поля field.
+func (errs *Errors) Add(field string, err error) {
+	*errs = append(*errs, FieldError{Field: field, Err: err})
+}
+
+// Check - ошибка поля field с текстом message, если условие ok не выполнено.
+func (errs *Errors) Check(ok bool, field string, message string) {
+	if !ok {
+		errs.Add(field, errors.New(message))
+	}
+}
+
+// Err - nil без ошибок, иначе Errors.
+func (errs Errors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func (errs Errors) Error() string {
+	var builder strings.Builder
+	builder.WriteString("invalid config:")
+	for _, fieldError := range errs {
+		builder.WriteString("\n  ")
+		builder.WriteString(fieldError.Error())
+	}
+
+	return builder.String()
+}
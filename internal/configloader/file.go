@@ -0,0 +1,243 @@
+package configloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// readFile - значения файла конфигурации: YAML для расширений .yaml и .yml, иначе JSON.
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// applyFile - значения файла path поверх config. Ошибки значений собираются по всем полям.
+func applyFile(config any, path string, sources map[string]string) error {
+	values, err := readFile(path)
+	if err != nil {
+		return err
+	}
+
+	var errs Errors
+	applyValues(reflect.ValueOf(config).Elem(), values, "", sources, &errs)
+
+	return errs.Err()
+}
+
+// fileField - поле, значение которого задается ключом файла.
+type fileField struct {
+	path  string
+	value reflect.Value
+}
+
+// fileFields - поля структуры по ключу файла (без учета регистра, как в encoding/json).
+func fileFields(value reflect.Value, prefix string, fields map[string]fileField) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fileFields(value.Field(i), prefix, fields)
+			continue
+		}
+
+		key := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				key = tagName
+			}
+		}
+		fields[strings.ToLower(key)] = fileField{path: prefix + field.Name, value: value.Field(i)}
+	}
+}
+
+func applyValues(value reflect.Value, values map[string]any, prefix string, sources map[string]string, errs *Errors) {
+	fields := map[string]fileField{}
+	fileFields(value, prefix, fields)
+
+	for key, raw := range values {
+		field, ok := fields[strings.ToLower(key)]
+		if !ok {
+			errs.Add(prefix+key, errors.New("unknown field"))
+			continue
+		}
+
+		if field.value.Kind() == reflect.Struct {
+			nested, ok := raw.(map[string]any)
+			if !ok {
+				errs.Add(field.path, fmt.Errorf("expected object, got %v", raw))
+				continue
+			}
+			applyValues(field.value, nested, field.path+".", sources, errs)
+			continue
+		}
+
+		err := setValue(field.value, raw)
+		if err != nil {
+			errs.Add(field.path, err)
+			continue
+		}
+		sources[field.path] = SourceFile
+	}
+}
+
+// setValue - значение из JSON или YAML в поле: строки, логические, целые и дробные числа, длительности,
+// списки строк и объекты со строковыми значениями.
+func setValue(value reflect.Value, raw any) error {
+	if value.Type() == durationType {
+		switch rawValue := raw.(type) {
+		case string:
+			duration, err := time.ParseDuration(rawValue)
+			if err != nil {
+				return err
+			}
+			value.SetInt(int64(duration))
+			return nil
+		default:
+			nanoseconds, ok := toInt(raw)
+			if !ok {
+				return fmt.Errorf("expected duration (example: 10s), got %v", raw)
+			}
+			value.SetInt(nanoseconds)
+			return nil
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		stringValue, ok := toString(raw)
+		if !ok {
+			return fmt.Errorf("expected string, got %v", raw)
+		}
+		value.SetString(stringValue)
+	case reflect.Bool:
+		boolValue, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("expected boolean, got %v", raw)
+		}
+		value.SetBool(boolValue)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		intValue, ok := toInt(raw)
+		if !ok || value.OverflowInt(intValue) {
+			return fmt.Errorf("expected integer, got %v", raw)
+		}
+		value.SetInt(intValue)
+	case reflect.Float32, reflect.Float64:
+		floatValue, ok := toFloat(raw)
+		if !ok {
+			return fmt.Errorf("expected number, got %v", raw)
+		}
+		value.SetFloat(floatValue)
+	case reflect.Slice:
+		items, ok := raw.([]any)
+		if !ok || value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("expected list of strings, got %v", raw)
+		}
+		list := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			stringValue, ok := toString(item)
+			if !ok {
+				return fmt.Errorf("expected list of strings, got %v", raw)
+			}
+			list.Index(i).SetString(stringValue)
+		}
+		value.Set(list)
+	case reflect.Map:
+		items, ok := raw.(map[string]any)
+		if !ok || value.Type().Key().Kind() != reflect.String || value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("expected object with string values, got %v", raw)
+		}
+		object := reflect.MakeMapWithSize(value.Type(), len(items))
+		for key, item := range items {
+			stringValue, ok := toString(item)
+			if !ok {
+				return fmt.Errorf("expected object with string values, got %v", raw)
+			}
+			object.SetMapIndex(reflect.ValueOf(key).Convert(value.Type().Key()), reflect.ValueOf(stringValue).Convert(value.Type().Elem()))
+		}
+		value.Set(object)
+	default:
+		return fmt.Errorf("unsupported field type %s", value.Type())
+	}
+
+	return nil
+}
+
+// toString - скалярное значение строкой: YAML разбирает числа без кавычек как числа.
+func toString(raw any) (string, bool) {
+	switch rawValue := raw.(type) {
+	case string:
+		return rawValue, true
+	case json.Number, int, int64, float64, bool:
+		return fmt.Sprint(rawValue), true
+	default:
+		return "", false
+	}
+}
+
+func toInt(raw any) (int64, bool) {
+	switch rawValue := raw.(type) {
+	case json.Number:
+		intValue, err := rawValue.Int64()
+		return intValue, err == nil
+	case int:
+		return int64(rawValue), true
+	case int64:
+		return rawValue, true
+	case float64:
+		return int64(rawValue), rawValue == math.Trunc(rawValue) && math.Abs(rawValue) < math.MaxInt64
+	default:
+		return 0, false
+	}
+}
+
+func toFloat(raw any) (float64, bool) {
+	switch rawValue := raw.(type) {
+	case json.Number:
+		floatValue, err := rawValue.Float64()
+		return floatValue, err == nil
+	case int:
+		return float64(rawValue), true
+	case int64:
+		return float64(rawValue), true
+	case float64:
+		return rawValue, true
+	default:
+		return 0, false
+	}
+}
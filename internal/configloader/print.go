@@ -0,0 +1,68 @@
+package configloader
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// redacted - значение секретного поля (тег secret:"true") при выводе.
+const redacted = "******"
+
+// Print - вывод действующей конфигурации: поле, значение и источник значения. Значения секретных полей скрыты.
+func Print(writer io.Writer, config any, result Result) error {
+	configPath := result.Path
+	if configPath == "" {
+		configPath = "-"
+	}
+	fmt.Fprintf(writer, "# config file: %s\n", configPath)
+
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "FIELD\tVALUE\tSOURCE")
+	walkFields(reflect.Indirect(reflect.ValueOf(config)), "", func(path string, field reflect.StructField, value reflect.Value) {
+		if tag, ok := field.Tag.Lookup("json"); ok && strings.HasPrefix(tag, "-") {
+			return
+		}
+
+		source := result.Sources[path]
+		if source == "" {
+			source = SourceDefault
+		}
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\n", path, formatValue(field, value), source)
+	})
+
+	return tabWriter.Flush()
+}
+
+func formatValue(field reflect.StructField, value reflect.Value) string {
+	if field.Tag.Get("secret") == "true" && !value.IsZero() {
+		return redacted
+	}
+
+	switch {
+	case value.Type() == durationType:
+		return time.Duration(value.Int()).String()
+	case value.Kind() == reflect.String:
+		return fmt.Sprintf("%q", value.String())
+	case value.Kind() == reflect.Slice:
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(value.Index(i).Interface())
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case value.Kind() == reflect.Map:
+		items := make([]string, 0, value.Len())
+		iterator := value.MapRange()
+		for iterator.Next() {
+			items = append(items, fmt.Sprintf("%v=%v", iterator.Key().Interface(), iterator.Value().Interface()))
+		}
+		sort.Strings(items)
+		return "{" + strings.Join(items, ", ") + "}"
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
@@ -0,0 +1,79 @@
+// Package logging - структурированный журнал агента и сервера на log/slog: текстовый или JSON формат,
+// уровень debug по DebugMode и журнал запроса с его идентификатором в контексте.
+//
+// Setup заменяет журнал по умолчанию: записи стандартного пакета log попадают в тот же журнал с уровнем info.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Форматы журнала.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// RequestIDKey - ключ идентификатора запроса в записях журнала.
+const RequestIDKey = "request_id"
+
+// level - уровень журнала по умолчанию, меняется без перезапуска (SetDebug).
+var level = &slog.LevelVar{}
+
+// Setup - журнал по умолчанию (slog.Default и стандартный log) в writer в формате format, при debug - с уровнем debug.
+func Setup(writer io.Writer, format string, debug bool) {
+	SetDebug(debug)
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(writer, options)
+	if format == FormatJSON {
+		handler = slog.NewJSONHandler(writer, options)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+// SetDebug - уровень журнала по умолчанию: debug или info.
+func SetDebug(debug bool) {
+	if debug {
+		level.Set(slog.LevelDebug)
+		return
+	}
+
+	level.Set(slog.LevelInfo)
+}
+
+// IsFormat - format является форматом журнала.
+func IsFormat(format string) bool {
+	return format == FormatText || format == FormatJSON
+}
+
+// Err - атрибут ошибки записи журнала.
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+// Fatal - запись ошибки и завершение процесса.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type contextKey struct{}
+
+// WithLogger - контекст с журналом запроса logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext - журнал запроса, журнал по умолчанию, если не задан.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetup(t *testing.T) {
+	defaultLogger := slog.Default()
+	defer slog.SetDefault(defaultLogger)
+
+	var output bytes.Buffer
+	Setup(&output, FormatJSON, false)
+
+	slog.Debug("hidden")
+	log.Println("from std log")
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(output.Bytes(), &record))
+	require.Equal(t, "from std log", record["msg"])
+	require.Equal(t, "INFO", record["level"])
+
+	// Уровень debug включается без повторной настройки
+	output.Reset()
+	SetDebug(true)
+	FromContext(WithLogger(context.Background(), slog.Default().With(RequestIDKey, "req-1"))).Debug("visible")
+	require.NoError(t, json.Unmarshal(output.Bytes(), &record))
+	require.Equal(t, "visible", record["msg"])
+	require.Equal(t, "req-1", record[RequestIDKey])
+	SetDebug(false)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	rotatingFile, err := OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = rotatingFile.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, rotatingFile.Close())
+
+	// Хранится не более двух копий, самая старая запись удалена
+	for file, content := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+	require.NoFileExists(t, path+".3")
+
+	// Дописывание в существующий файл учитывает его размер
+	rotatingFile, err = OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	_, err = rotatingFile.Write([]byte("fifth\n"))
+	require.NoError(t, err)
+	require.NoError(t, rotatingFile.Close())
+	data, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	require.Equal(t, "fourth\n", string(data))
+}
+
+func TestRotatingFileRenameError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	rotatingFile, err := OpenRotatingFile(path, 10, 1)
+	require.NoError(t, err)
+	defer rotatingFile.Close()
+
+	_, err = rotatingFile.Write([]byte("first\n"))
+	require.NoError(t, err)
+
+	// Непустой каталог на месте копии: переименование не удается, запись остается в прежнем файле
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0755))
+	n, err := rotatingFile.Write([]byte("second\n"))
+	require.Error(t, err)
+	require.Equal(t, len("second\n"), n)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\n", string(data))
+
+	// Ротация повторяется при следующей записи
+	require.NoError(t, os.RemoveAll(path+".1"))
+	_, err = rotatingFile.Write([]byte("third\n"))
+	require.NoError(t, err)
+
+	for file, content := range map[string]string{path: "third\n", path + ".1": "first\nsecond\n"} {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+}
+
+func TestRotatingFileOpenError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	rotatingFile, err := OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer rotatingFile.Close()
+
+	_, err = rotatingFile.Write([]byte("first\n"))
+	require.NoError(t, err)
+
+	// Новый файл не открывается: запись не выполняется, копии сдвигаются только один раз
+	openErr := errors.New("too many open files")
+	rotatingFile.openFile = func(string, int, os.FileMode) (*os.File, error) { return nil, openErr }
+	for _, line := range []string{"second\n", "third\n"} {
+		n, err := rotatingFile.Write([]byte(line))
+		require.ErrorIs(t, err, openErr)
+		require.Zero(t, n)
+	}
+	require.NoFileExists(t, path)
+	require.NoFileExists(t, path+".2")
+
+	// Файл открывается заново при следующей записи
+	rotatingFile.openFile = os.OpenFile
+	_, err = rotatingFile.Write([]byte("fourth\n"))
+	require.NoError(t, err)
+
+	for file, content := range map[string]string{path: "fourth\n", path + ".1": "first\n"} {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+}
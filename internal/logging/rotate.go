@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile - файл журнала с ротацией по размеру: файл, превысивший maxSize, переименовывается в path.1,
+// прежние копии сдвигаются (path.1 в path.2 и т.д.), хранится не более maxBackups копий.
+type RotatingFile struct {
+	mutex      *sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	// file - открытый файл path, nil после неудачного открытия при ротации
+	file *os.File
+	size int64
+	// openFile - открытие файла (os.OpenFile), заменяется в тестах
+	openFile func(name string, flag int, perm os.FileMode) (*os.File, error)
+}
+
+// OpenRotatingFile - открытие файла журнала path для дописывания, maxSize 0 - без ротации.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rotatingFile := &RotatingFile{
+		mutex:      &sync.Mutex{},
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		openFile:   os.OpenFile,
+	}
+
+	err := rotatingFile.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return rotatingFile, nil
+}
+
+func (rotatingFile *RotatingFile) open() error {
+	file, err := rotatingFile.openFile(rotatingFile.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rotatingFile.file = file
+	rotatingFile.size = info.Size()
+
+	return nil
+}
+
+// Write - запись в файл, перед записью, которая превысит maxSize, файл ротируется. Запись не разделяется
+// между файлами. При ошибке ротации запись дописывается в прежний файл, ошибка возвращается вместе с результатом
+// записи, а ротация повторяется при следующей записи. Если новый файл не открылся, запись не выполняется,
+// а файл открывается заново при следующей записи.
+func (rotatingFile *RotatingFile) Write(p []byte) (int, error) {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+
+	var rotateErr error
+	switch {
+	case rotatingFile.file == nil:
+		rotateErr = rotatingFile.open()
+	case rotatingFile.maxSize > 0 && rotatingFile.size > 0 && rotatingFile.size+int64(len(p)) > rotatingFile.maxSize:
+		rotateErr = rotatingFile.rotate()
+	}
+	if rotatingFile.file == nil {
+		return 0, rotateErr
+	}
+
+	n, err := rotatingFile.file.Write(p)
+	rotatingFile.size += int64(n)
+
+	return n, errors.Join(rotateErr, err)
+}
+
+// rotate - сдвиг копий, переименование текущего файла в path.1 и открытие нового. Файл path открывается заново
+// и при ошибке переименования, иначе журнал остается закрытым. Если path уже нет (файл переименован,
+// а новый не открылся), копии не сдвигаются повторно.
+func (rotatingFile *RotatingFile) rotate() error {
+	closeErr := rotatingFile.file.Close()
+
+	var renameErr error
+	if _, err := os.Stat(rotatingFile.path); err == nil {
+		renameErr = rotatingFile.shiftBackups()
+	}
+
+	openErr := rotatingFile.open()
+	if openErr != nil {
+		rotatingFile.file = nil
+		rotatingFile.size = 0
+	}
+
+	return errors.Join(closeErr, renameErr, openErr)
+}
+
+// shiftBackups - сдвиг копий и переименование текущего файла в path.1, без копий файл удаляется.
+func (rotatingFile *RotatingFile) shiftBackups() error {
+	if rotatingFile.maxBackups <= 0 {
+		return os.Remove(rotatingFile.path)
+	}
+
+	for generation := rotatingFile.maxBackups - 1; generation >= 1; generation-- {
+		err := os.Rename(rotatingFile.backupPath(generation), rotatingFile.backupPath(generation+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(rotatingFile.path, rotatingFile.backupPath(1))
+}
+
+func (rotatingFile *RotatingFile) backupPath(generation int) string {
+	return fmt.Sprintf("%s.%d", rotatingFile.path, generation)
+}
+
+func (rotatingFile *RotatingFile) Close() error {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+
+	if rotatingFile.file == nil {
+		return nil
+	}
+
+	return rotatingFile.file.Close()
+}
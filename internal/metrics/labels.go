@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricIDWithLabels - ID метрики с метками в виде name{label="value",...}, метки отсортированы по имени.
+func MetricIDWithLabels(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+
+	var builder strings.Builder
+	builder.WriteString(name)
+	builder.WriteByte('{')
+	for i, labelName := range labelNames {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(labelName)
+		builder.WriteByte('=')
+		builder.WriteString(strconv.Quote(labels[labelName]))
+	}
+	builder.WriteByte('}')
+
+	return builder.String()
+}
+
+var ErrInvalidMetricID = errors.New("invalid metric id labels")
+
+// ParseMetricID - разбор ID вида name{label="value",...} на имя и метки. ID без меток возвращается как имя.
+func ParseMetricID(metricID string) (string, map[string]string, error) {
+	name, rawLabels, found := strings.Cut(metricID, "{")
+	if !found {
+		return metricID, nil, nil
+	}
+	if !strings.HasSuffix(rawLabels, "}") {
+		return "", nil, ErrInvalidMetricID
+	}
+	rawLabels = strings.TrimSuffix(rawLabels, "}")
+
+	labels := map[string]string{}
+	for rawLabels != "" {
+		labelName, rest, found := strings.Cut(rawLabels, "=")
+		if !found || labelName == "" {
+			return "", nil, ErrInvalidMetricID
+		}
+
+		quotedValue, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return "", nil, ErrInvalidMetricID
+		}
+		labelValue, err := strconv.Unquote(quotedValue)
+		if err != nil {
+			return "", nil, ErrInvalidMetricID
+		}
+		labels[labelName] = labelValue
+
+		rawLabels = strings.TrimPrefix(rest[len(quotedValue):], ",")
+	}
+
+	return name, labels, nil
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricIDWithLabels(t *testing.T) {
+	require.Equal(t, "up", MetricIDWithLabels("up", nil))
+	require.Equal(t, `up{b="2",instance="localhost:9100"}`, MetricIDWithLabels("up", map[string]string{
+		"instance": "localhost:9100",
+		"b":        "2",
+	}))
+	require.Equal(t, `up{path="say \"hi\""}`, MetricIDWithLabels("up", map[string]string{"path": `say "hi"`}))
+}
+
+func TestParseMetricID(t *testing.T) {
+	labels := map[string]string{"instance": "localhost:9100", "path": `say "hi", {ok}`}
+	name, parsedLabels, err := ParseMetricID(MetricIDWithLabels("up", labels))
+	require.NoError(t, err)
+	require.Equal(t, "up", name)
+	require.Equal(t, labels, parsedLabels)
+
+	name, parsedLabels, err = ParseMetricID("Alloc")
+	require.NoError(t, err)
+	require.Equal(t, "Alloc", name)
+	require.Empty(t, parsedLabels)
+
+	_, _, err = ParseMetricID(`up{instance=localhost}`)
+	require.ErrorIs(t, err, ErrInvalidMetricID)
+	_, _, err = ParseMetricID(`up{instance="a"`)
+	require.ErrorIs(t, err, ErrInvalidMetricID)
+}
@@ -0,0 +1,56 @@
+// Package metrics - метрики в формате API сервера, общие для сервера, агента и клиентов: значения gauge
+// и counter, подпись значений, ID метрик с метками и ответы на запись метрик.
+package metrics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	MeticTypeGauge   = "gauge"
+	MeticTypeCounter = "counter"
+)
+
+type MetricValue struct {
+	MType string   `json:"type" valid:"required,in(counter|gauge)"`
+	Delta *int64   `json:"delta,omitempty"`
+	Value *float64 `json:"value,omitempty"`
+}
+
+type Metric struct {
+	ID string `json:"id" valid:"required"`
+	MetricValue
+}
+
+func (metric MetricValue) GetStringValue() string {
+	switch metric.MType {
+	case MeticTypeGauge:
+		return fmt.Sprintf("%v", *metric.Value)
+	case MeticTypeCounter:
+		return fmt.Sprintf("%v", *metric.Delta)
+	default:
+		return ""
+	}
+}
+
+func (metric MetricValue) GetHash(id, signKey string) []byte {
+	if signKey == "" {
+		return nil
+	}
+
+	var metricLabel string
+	switch metric.MType {
+	case MeticTypeGauge:
+		metricLabel = fmt.Sprintf("%s:gauge:%f", id, *metric.Value)
+	case MeticTypeCounter:
+		metricLabel = fmt.Sprintf("%s:counter:%d", id, *metric.Delta)
+	default:
+		return nil
+	}
+
+	signerHMAC := hmac.New(sha256.New, []byte(signKey))
+	signerHMAC.Write([]byte(metricLabel))
+	return signerHMAC.Sum(nil)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import "encoding/json"
+
+// Статусы ответа на запись метрик.
+const (
+	StatusOk    = "ok"
+	StatusError = "error"
+)
+
+// DefaultResponse - ответ сервера в формате JSON: статус и ошибка.
+type DefaultResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func NewDefaultResponse() DefaultResponse {
+	response := DefaultResponse{}
+	response.Status = StatusOk
+
+	return response
+}
+
+func (response *DefaultResponse) SetStatus(newStatus string) *DefaultResponse {
+	response.Status = newStatus
+	return response
+}
+
+func (response *DefaultResponse) SetStatusError(responseError error) *DefaultResponse {
+	response.Status = StatusError
+	response.Error = responseError.Error()
+	return response
+}
+
+func (response DefaultResponse) GetJSONBytes() []byte {
+	jsonBytes, _ := json.Marshal(response)
+	return jsonBytes
+}
+
+func (response DefaultResponse) GetJSONString() string {
+	return string(response.GetJSONBytes())
+}
+
+// UpdateMetricResponse - ответ на запись метрики с подписью значения.
+type UpdateMetricResponse struct {
+	DefaultResponse
+	Hash string `json:"hash,omitempty"`
+}
+
+func NewUpdateMetricResponse() UpdateMetricResponse {
+	response := UpdateMetricResponse{}
+	response.Status = StatusOk
+
+	return response
+}
+
+func (response *UpdateMetricResponse) SetHash(hash string) *UpdateMetricResponse {
+	if hash == "" {
+		return response
+	}
+
+	response.Hash = hash
+	return response
+}
+
+func (response UpdateMetricResponse) GetJSONBytes() []byte {
+	jsonBytes, _ := json.Marshal(response)
+	return jsonBytes
+}
@@ -0,0 +1,49 @@
+// Package metricsctl - клиент администрирования работающего сервера по HTTP или gRPC:
+// просмотр и поиск метрик, чтение, запись и удаление значений, поток обновлений и проверка состояния.
+package metricsctl
+
+import (
+	"context"
+	"devops-tpl/internal/metrics"
+	"errors"
+)
+
+var (
+	ErrNotFound    = errors.New("metric not found")
+	ErrInvalidHash = errors.New("invalid metric hash")
+)
+
+// Client - операции над сервером, реализуются для HTTP и gRPC.
+type Client interface {
+	// List - метрики с ID, содержащим search, упорядоченные по типу и ID
+	List(ctx context.Context, search string) ([]metrics.Metric, error)
+	Get(ctx context.Context, metricType string, id string) (metrics.Metric, error)
+	// Update - обновление метрики, для counter - приращение
+	Update(ctx context.Context, metric metrics.Metric) error
+	Delete(ctx context.Context, metricType string, id string) error
+	// Watch - передача принятых сервером обновлений в handler до отмены ctx или разрыва соединения
+	Watch(ctx context.Context, search string, handler func(metrics.Metric)) error
+	Health(ctx context.Context) error
+	Close() error
+}
+
+// Set - запись значения: для gauge - как есть, для counter - разница с текущим значением.
+func Set(ctx context.Context, client Client, metric metrics.Metric) error {
+	if metric.MType != metrics.MeticTypeCounter {
+		return client.Update(ctx, metric)
+	}
+
+	current, err := client.Get(ctx, metric.MType, metric.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err == nil {
+		delta := *metric.Delta - *current.Delta
+		if delta == 0 {
+			return nil
+		}
+		metric.Delta = &delta
+	}
+
+	return client.Update(ctx, metric)
+}
@@ -0,0 +1,111 @@
+package metricsctl
+
+import (
+	"context"
+	"devops-tpl/internal/metrics"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Usage - описание команд.
+const Usage = `usage: metricsctl [flags] <command> [args]
+
+commands:
+  list [search]              metrics with ID containing search
+  get <type> <id>            metric value
+  set <type> <id> <value>    set metric value (counter: the difference with the current value is sent)
+  delete <type> <id>         delete metric
+  tail [search]              accepted updates in real time (counter: delta)
+  health                     server and storage health`
+
+var ErrUsage = errors.New(Usage)
+
+// Run - выполнение команды args[0]. Все команды, кроме tail, ограничены таймаутом timeout.
+func Run(ctx context.Context, client Client, printer *Printer, timeout time.Duration, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	command, args := args[0], args[1:]
+
+	if command == "tail" {
+		if len(args) > 1 {
+			return ErrUsage
+		}
+		return client.Watch(ctx, optionalArg(args), printer.Update)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch {
+	case command == "list" && len(args) <= 1:
+		metrics, err := client.List(ctx, optionalArg(args))
+		if err != nil {
+			return err
+		}
+		return printer.Metrics(metrics)
+	case command == "get" && len(args) == 2:
+		metric, err := client.Get(ctx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		return printer.Metrics([]metrics.Metric{metric})
+	case command == "set" && len(args) == 3:
+		metric, err := parseMetric(args[0], args[1], args[2])
+		if err != nil {
+			return err
+		}
+		err = Set(ctx, client, metric)
+		if err != nil {
+			return err
+		}
+		return printer.Status("ok")
+	case command == "delete" && len(args) == 2:
+		err := client.Delete(ctx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		return printer.Status("ok")
+	case command == "health" && len(args) == 0:
+		err := client.Health(ctx)
+		if err != nil {
+			return err
+		}
+		return printer.Status("ok")
+	default:
+		return ErrUsage
+	}
+}
+
+func optionalArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	return args[0]
+}
+
+func parseMetric(metricType string, id string, value string) (metrics.Metric, error) {
+	metric := metrics.Metric{ID: id, MetricValue: metrics.MetricValue{MType: metricType}}
+
+	switch metricType {
+	case metrics.MeticTypeGauge:
+		metricValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return metric, fmt.Errorf("invalid gauge value: %w", err)
+		}
+		metric.Value = &metricValue
+	case metrics.MeticTypeCounter:
+		metricValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return metric, fmt.Errorf("invalid counter value: %w", err)
+		}
+		metric.Delta = &metricValue
+	default:
+		return metric, fmt.Errorf("unknown metric type %q, expected gauge or counter", metricType)
+	}
+
+	return metric, nil
+}
@@ -0,0 +1,91 @@
+package metricsctl
+
+import (
+	agentConfig "devops-tpl/internal/agent/config"
+	"devops-tpl/internal/configloader"
+	"devops-tpl/internal/server/auth"
+	"errors"
+	"flag"
+	"io"
+	"time"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// Config - конфигурация metricsctl. Файл конфигурации и переменные окружения общие с агентом:
+// адрес сервера, адрес gRPC (если задан - используется gRPC), API токен, ключ подписи и публичный RSA ключ.
+type Config struct {
+	agentConfig.Config
+	// Output - формат вывода: table или json (flag: o; default: table)
+	Output string
+	// Timeout - таймаут команды, кроме tail (flag: timeout; default: 10s)
+	Timeout time.Duration
+	// Tenant - арендатор запросов, "*" - все арендаторы; выбор другого арендатора требует ключа admin (flag: tenant)
+	Tenant string
+}
+
+func newConfig() Config {
+	var config Config
+	config.Output = OutputTable
+	config.Timeout = 10 * time.Second
+	config.HTTPClientConnection = agentConfig.HTTPClientConfig{
+		RetryCount:       1,
+		RetryWaitTime:    time.Second,
+		RetryMaxWaitTime: 5 * time.Second,
+		ServerAddr:       "127.0.0.1:8080",
+	}
+
+	return config
+}
+
+func (config *Config) bindFlags(flagSet *flag.FlagSet) {
+	flagSet.Usage = func() {
+		io.WriteString(flagSet.Output(), Usage+"\n\nflags:\n")
+		flagSet.PrintDefaults()
+	}
+
+	flagSet.StringVar(&config.HTTPClientConnection.ServerAddr, "a", config.HTTPClientConnection.ServerAddr, "server address (host:port)")
+	flagSet.StringVar(&config.ServerGRPCAddr, "grpc", config.ServerGRPCAddr, "server gRPC address (host:port), used instead of HTTP if set")
+	flagSet.StringVar(&config.SignKey, "k", config.SignKey, "sign key")
+	flagSet.StringVar(&config.HTTPClientConnection.Token, "token", config.HTTPClientConnection.Token, "server API token")
+	flagSet.StringVar(&config.PublicKeyRSA, "crypto-key", config.PublicKeyRSA, "RSA public key")
+	flagSet.StringVar(&config.Output, "o", config.Output, "output format: table or json")
+	flagSet.DurationVar(&config.Timeout, "timeout", config.Timeout, "command timeout (example: 5s)")
+	flagSet.StringVar(&config.Tenant, "tenant", config.Tenant, "tenant, * - all tenants (requires admin key)")
+}
+
+// LoadConfig - загрузка конфигурации по слоям (configloader): значения по умолчанию, файл (flag: c; env: CONFIG),
+// переменные окружения и флаги. Возвращает аргументы после флагов: команду и ее аргументы.
+func LoadConfig(args []string, output io.Writer) (Config, configloader.Result, error) {
+	config := newConfig()
+	result, err := configloader.Load("metricsctl", output, &config, (*Config).bindFlags, args)
+	if err != nil {
+		return config, result, err
+	}
+
+	if config.Output != OutputTable && config.Output != OutputJSON {
+		return config, result, configloader.Errors{{Field: "Output", Err: errors.New("expected table or json")}}
+	}
+
+	return config, result, nil
+}
+
+// NewClient - клиент gRPC, если задан адрес gRPC, иначе HTTP.
+func NewClient(config Config) (Client, error) {
+	if config.ServerGRPCAddr != "" {
+		return NewGRPCClient(config.ServerGRPCAddr, config.HTTPClientConnection.Token, config.Tenant)
+	}
+
+	client, err := NewHTTPClient(config.HTTPClientConnection, config.SignKey, config.PublicKeyRSA)
+	if err != nil {
+		return nil, err
+	}
+	if config.Tenant != "" {
+		client.client.SetHeader(auth.TenantHeader, config.Tenant)
+	}
+
+	return client, nil
+}
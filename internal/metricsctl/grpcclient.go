@@ -0,0 +1,160 @@
+package metricsctl
+
+import (
+	"context"
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/auth"
+	pb "devops-tpl/proto"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCClient - клиент gRPC сервиса metrics.Metrics.
+type GRPCClient struct {
+	clientConn *grpc.ClientConn
+	client     pb.MetricsClient
+}
+
+// NewGRPCClient - клиент сервера addr с API токеном token и арендатором tenantName (пустые значения не передаются).
+func NewGRPCClient(addr string, token string, tenantName string) (*GRPCClient, error) {
+	options := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if token != "" {
+		options = append(options, grpc.WithPerRPCCredentials(agentapi.TokenCredentials(token)))
+	}
+	if tenantName != "" {
+		options = append(options, grpc.WithPerRPCCredentials(tenantCredentials(tenantName)))
+	}
+
+	conn, err := grpc.Dial(addr, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GRPCClient{
+		clientConn: conn,
+		client:     pb.NewMetricsClient(conn),
+	}, nil
+}
+
+// tenantCredentials - выбор арендатора в метаданных каждого вызова.
+type tenantCredentials string
+
+func (tenantName tenantCredentials) GetRequestMetadata(_ context.Context, _ ...string) (map[string]string, error) {
+	return map[string]string{strings.ToLower(auth.TenantHeader): string(tenantName)}, nil
+}
+
+func (tenantName tenantCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+func fromProtoMetric(metric *pb.Metric) (metrics.Metric, error) {
+	switch metricOne := metric.Metric.(type) {
+	case *pb.Metric_Gauge:
+		value := metricOne.Gauge.Value
+		return metrics.Metric{
+			ID:          metricOne.Gauge.Id,
+			MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value},
+		}, nil
+	case *pb.Metric_Counter:
+		delta := metricOne.Counter.Delta
+		return metrics.Metric{
+			ID:          metricOne.Counter.Id,
+			MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta},
+		}, nil
+	default:
+		return metrics.Metric{}, errors.New("unknown metric type")
+	}
+}
+
+func toProtoMetric(metric metrics.Metric) *pb.Metric {
+	if metric.MType == metrics.MeticTypeCounter {
+		return &pb.Metric{Metric: &pb.Metric_Counter{Counter: &pb.MetricCounter{Id: metric.ID, Delta: *metric.Delta}}}
+	}
+
+	return &pb.Metric{Metric: &pb.Metric_Gauge{Gauge: &pb.MetricGauge{Id: metric.ID, Value: *metric.Value}}}
+}
+
+func grpcError(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (grpcClient *GRPCClient) List(ctx context.Context, search string) ([]metrics.Metric, error) {
+	response, err := grpcClient.client.ListMetrics(ctx, &pb.ListMetricsRequest{Search: search})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]metrics.Metric, 0, len(response.Metrics))
+	for _, protoMetric := range response.Metrics {
+		metric, err := fromProtoMetric(protoMetric)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+func (grpcClient *GRPCClient) Get(ctx context.Context, metricType string, id string) (metrics.Metric, error) {
+	response, err := grpcClient.client.GetMetric(ctx, &pb.MetricRequest{Id: id, Type: metricType})
+	if err != nil {
+		return metrics.Metric{}, grpcError(err)
+	}
+
+	return fromProtoMetric(response)
+}
+
+func (grpcClient *GRPCClient) Update(ctx context.Context, metric metrics.Metric) error {
+	_, err := grpcClient.client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{toProtoMetric(metric)}})
+	return err
+}
+
+func (grpcClient *GRPCClient) Delete(ctx context.Context, metricType string, id string) error {
+	_, err := grpcClient.client.DeleteMetric(ctx, &pb.MetricRequest{Id: id, Type: metricType})
+	return grpcError(err)
+}
+
+func (grpcClient *GRPCClient) Watch(ctx context.Context, search string, handler func(metrics.Metric)) error {
+	stream, err := grpcClient.client.WatchMetrics(ctx, &pb.ListMetricsRequest{Search: search})
+	if err != nil {
+		return err
+	}
+
+	for {
+		protoMetric, err := stream.Recv()
+		if errors.Is(err, io.EOF) || status.Code(err) == codes.Canceled {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		metric, err := fromProtoMetric(protoMetric)
+		if err != nil {
+			return fmt.Errorf("watch: %w", err)
+		}
+		handler(metric)
+	}
+}
+
+func (grpcClient *GRPCClient) Health(ctx context.Context) error {
+	_, err := grpcClient.client.Ping(ctx, &pb.Empty{})
+	return err
+}
+
+func (grpcClient *GRPCClient) Close() error {
+	return grpcClient.clientConn.Close()
+}
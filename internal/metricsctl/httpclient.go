@@ -0,0 +1,285 @@
+package metricsctl
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rsa"
+	agentConfig "devops-tpl/internal/agent/config"
+	"devops-tpl/internal/metrics"
+	handlerRSA "devops-tpl/internal/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// signedMetric - метрика с подписью в формате JSON API сервера.
+type signedMetric struct {
+	metrics.Metric
+	Hash string `json:"hash,omitempty"`
+}
+
+// HTTPClient - клиент JSON API сервера с подписью метрик ключом и шифрованием тела запроса публичным RSA ключом.
+type HTTPClient struct {
+	client       *resty.Client
+	baseURL      string
+	signKey      string
+	publicKeyRSA *rsa.PublicKey
+}
+
+func NewHTTPClient(config agentConfig.HTTPClientConfig, signKey string, publicKeyRSA string) (*HTTPClient, error) {
+	httpClient := &HTTPClient{
+		baseURL: "http://" + config.ServerAddr,
+		signKey: signKey,
+	}
+
+	if publicKeyRSA != "" {
+		var err error
+		httpClient.publicKeyRSA, err = handlerRSA.ParsePublicKeyRSA(publicKeyRSA)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key failed: %w", err)
+		}
+	}
+
+	httpClient.client = resty.New().
+		SetBaseURL(httpClient.baseURL).
+		SetRetryCount(config.RetryCount).
+		SetRetryWaitTime(config.RetryWaitTime).
+		SetRetryMaxWaitTime(config.RetryMaxWaitTime).
+		// Сервер с доверенной подсетью проверяет адрес клиента по заголовку
+		SetHeader("X-Real-IP", localIP())
+	if config.Token != "" {
+		httpClient.client.SetAuthToken(config.Token)
+	}
+
+	return httpClient, nil
+}
+
+func localIP() string {
+	hostName, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+
+	addrList, err := net.LookupHost(hostName)
+	if err != nil || len(addrList) == 0 {
+		return ""
+	}
+
+	return addrList[0]
+}
+
+func (httpClient *HTTPClient) sign(metric metrics.Metric) signedMetric {
+	answer := signedMetric{Metric: metric}
+	if httpClient.signKey != "" {
+		answer.Hash = hex.EncodeToString(metric.GetHash(metric.ID, httpClient.signKey))
+	}
+
+	return answer
+}
+
+// verify - проверка подписи ответа сервера, если задан ключ.
+func (httpClient *HTTPClient) verify(metric signedMetric) error {
+	if httpClient.signKey == "" {
+		return nil
+	}
+
+	hash, err := hex.DecodeString(metric.Hash)
+	if err != nil || !hmac.Equal(hash, metric.GetHash(metric.ID, httpClient.signKey)) {
+		return fmt.Errorf("%w: %s", ErrInvalidHash, metric.ID)
+	}
+
+	return nil
+}
+
+// encode - JSON тело запроса, зашифрованное при заданном ключе.
+func (httpClient *HTTPClient) encode(value any) ([]byte, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if httpClient.publicKeyRSA != nil {
+		body = handlerRSA.EncryptWithPublicKey(body, httpClient.publicKeyRSA)
+	}
+
+	return body, nil
+}
+
+func responseError(response *resty.Response) error {
+	if response.StatusCode() == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	return fmt.Errorf("HTTP Status: %v: %s", response.StatusCode(), strings.TrimSpace(response.String()))
+}
+
+func (httpClient *HTTPClient) List(ctx context.Context, search string) ([]metrics.Metric, error) {
+	var answer []signedMetric
+	response, err := httpClient.client.R().
+		SetContext(ctx).
+		SetQueryParam("search", search).
+		SetResult(&answer).
+		Get("/api/metrics")
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, responseError(response)
+	}
+
+	metrics := make([]metrics.Metric, 0, len(answer))
+	for _, metric := range answer {
+		err = httpClient.verify(metric)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric.Metric)
+	}
+
+	return metrics, nil
+}
+
+func (httpClient *HTTPClient) Get(ctx context.Context, metricType string, id string) (metrics.Metric, error) {
+	body, err := httpClient.encode(struct {
+		ID    string `json:"id"`
+		MType string `json:"type"`
+	}{id, metricType})
+	if err != nil {
+		return metrics.Metric{}, err
+	}
+
+	var answer signedMetric
+	response, err := httpClient.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		SetResult(&answer).
+		Post("/value/")
+	if err != nil {
+		return metrics.Metric{}, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return metrics.Metric{}, responseError(response)
+	}
+
+	err = httpClient.verify(answer)
+	if err != nil {
+		return metrics.Metric{}, err
+	}
+
+	return answer.Metric, nil
+}
+
+func (httpClient *HTTPClient) Update(ctx context.Context, metric metrics.Metric) error {
+	body, err := httpClient.encode(httpClient.sign(metric))
+	if err != nil {
+		return err
+	}
+
+	response, err := httpClient.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post("/update/")
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return responseError(response)
+	}
+
+	return nil
+}
+
+func (httpClient *HTTPClient) Delete(ctx context.Context, metricType string, id string) error {
+	response, err := httpClient.client.R().
+		SetContext(ctx).
+		SetPathParams(map[string]string{
+			"type": metricType,
+			"name": id,
+		}).
+		Delete("/api/metrics/{type}/{name}")
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return responseError(response)
+	}
+
+	return nil
+}
+
+// Watch - чтение потока Server-Sent Events /api/metrics/stream.
+func (httpClient *HTTPClient) Watch(ctx context.Context, search string, handler func(metrics.Metric)) error {
+	response, err := httpClient.client.R().
+		SetContext(ctx).
+		SetQueryParam("search", search).
+		SetHeader("Accept", "text/event-stream").
+		SetDoNotParseResponse(true).
+		Get("/api/metrics/stream")
+	if err != nil {
+		return err
+	}
+	body := response.RawBody()
+	defer body.Close()
+
+	if response.StatusCode() != http.StatusOK {
+		return fmt.Errorf("HTTP Status: %v", response.StatusCode())
+	}
+
+	var event string
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			event = ""
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "dropped":
+			log.Printf("server dropped %s updates, the client is too slow", strings.TrimPrefix(line, "data: "))
+		case strings.HasPrefix(line, "data: "):
+			var metric signedMetric
+			err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &metric)
+			if err != nil {
+				return err
+			}
+			err = httpClient.verify(metric)
+			if err != nil {
+				return err
+			}
+			handler(metric.Metric)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return scanner.Err()
+}
+
+func (httpClient *HTTPClient) Health(ctx context.Context) error {
+	response, err := httpClient.client.R().
+		SetContext(ctx).
+		Get("/ping")
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return responseError(response)
+	}
+
+	return nil
+}
+
+func (httpClient *HTTPClient) Close() error {
+	return nil
+}
@@ -0,0 +1,185 @@
+package metricsctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	agentConfig "devops-tpl/internal/agent/config"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// storageClient - клиент поверх хранилища в памяти.
+type storageClient struct {
+	storage storage.MetricStorage
+	updates []metrics.Metric
+}
+
+func newStorageClient() *storageClient {
+	return &storageClient{storage: storage.NewMetricsMemoryRepo(config.StoreConfig{})}
+}
+
+func (client *storageClient) List(ctx context.Context, search string) ([]metrics.Metric, error) {
+	return storage.SortedMetrics(client.storage.ReadAll(), search), nil
+}
+
+func (client *storageClient) Get(ctx context.Context, metricType string, id string) (metrics.Metric, error) {
+	metricValue, err := client.storage.Read(id, metricType)
+	if err != nil {
+		return metrics.Metric{}, ErrNotFound
+	}
+
+	return metrics.Metric{ID: id, MetricValue: metricValue}, nil
+}
+
+func (client *storageClient) Update(ctx context.Context, metric metrics.Metric) error {
+	client.updates = append(client.updates, metric)
+	return client.storage.Update(metric.ID, metric.MetricValue)
+}
+
+func (client *storageClient) Delete(ctx context.Context, metricType string, id string) error {
+	return client.storage.Delete(id, metricType)
+}
+
+func (client *storageClient) Watch(ctx context.Context, search string, handler func(metrics.Metric)) error {
+	return nil
+}
+
+func (client *storageClient) Health(ctx context.Context) error {
+	return client.storage.Ping()
+}
+
+func (client *storageClient) Close() error {
+	return client.storage.Close()
+}
+
+func runCommand(t *testing.T, client Client, format string, args ...string) (string, error) {
+	output := &bytes.Buffer{}
+	err := Run(context.Background(), client, NewPrinter(output, format), time.Second, args)
+	return output.String(), err
+}
+
+func TestRun(t *testing.T) {
+	client := newStorageClient()
+
+	_, err := runCommand(t, client, OutputTable, "set", "counter", "PollCount", "10")
+	require.NoError(t, err)
+	_, err = runCommand(t, client, OutputTable, "set", "counter", "PollCount", "4")
+	require.NoError(t, err)
+	_, err = runCommand(t, client, OutputTable, "set", "counter", "PollCount", "4")
+	require.NoError(t, err)
+	_, err = runCommand(t, client, OutputTable, "set", "gauge", "Alloc", "1.5")
+	require.NoError(t, err)
+
+	// counter: отправляется разница с текущим значением, без изменения запрос не отправляется
+	require.Len(t, client.updates, 3)
+	require.EqualValues(t, -6, *client.updates[1].Delta)
+
+	output, err := runCommand(t, client, OutputTable, "list")
+	require.NoError(t, err)
+	require.Equal(t, "TYPE     ID         VALUE\ncounter  PollCount  4\ngauge    Alloc      1.5\n", output)
+
+	output, err = runCommand(t, client, OutputJSON, "get", "gauge", "Alloc")
+	require.NoError(t, err)
+	var metrics []metrics.Metric
+	require.NoError(t, json.Unmarshal([]byte(output), &metrics))
+	require.EqualValues(t, 1.5, *metrics[0].Value)
+
+	_, err = runCommand(t, client, OutputTable, "delete", "gauge", "Alloc")
+	require.NoError(t, err)
+	_, err = runCommand(t, client, OutputTable, "get", "gauge", "Alloc")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	output, err = runCommand(t, client, OutputJSON, "health")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"status":"ok"}`, output)
+
+	_, err = runCommand(t, client, OutputTable, "set", "counter", "PollCount", "1.5")
+	require.Error(t, err)
+	_, err = runCommand(t, client, OutputTable, "get", "gauge")
+	require.ErrorIs(t, err, ErrUsage)
+	_, err = runCommand(t, client, OutputTable)
+	require.ErrorIs(t, err, ErrUsage)
+}
+
+func TestHTTPClient_Sign(t *testing.T) {
+	const signKey = "secret"
+	var value = 2.5
+	serverMetric := metrics.Metric{ID: "Alloc", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}}
+	serverHash := hex.EncodeToString(serverMetric.GetHash(serverMetric.ID, signKey))
+
+	var received signedMetric
+	mux := http.NewServeMux()
+	mux.HandleFunc("/update/", func(rw http.ResponseWriter, request *http.Request) {
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&received))
+	})
+	mux.HandleFunc("/value/", func(rw http.ResponseWriter, request *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(signedMetric{Metric: serverMetric, Hash: serverHash})
+	})
+	mux.HandleFunc("/api/metrics/stream", func(rw http.ResponseWriter, request *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		data, _ := json.Marshal(signedMetric{Metric: serverMetric, Hash: serverHash})
+		fmt.Fprintf(rw, ": keep-alive\n\nevent: dropped\ndata: 3\n\ndata: %s\n\n", data)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	clientConfig := agentConfig.HTTPClientConfig{ServerAddr: strings.TrimPrefix(server.URL, "http://")}
+	client, err := NewHTTPClient(clientConfig, signKey, "")
+	require.NoError(t, err)
+
+	var delta int64 = 3
+	require.NoError(t, client.Update(context.Background(), metrics.Metric{ID: "PollCount", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}}))
+	require.Equal(t, hex.EncodeToString(received.GetHash("PollCount", signKey)), received.Hash)
+
+	metric, err := client.Get(context.Background(), metrics.MeticTypeGauge, "Alloc")
+	require.NoError(t, err)
+	require.EqualValues(t, value, *metric.Value)
+
+	var watched []metrics.Metric
+	require.NoError(t, client.Watch(context.Background(), "", func(metric metrics.Metric) {
+		watched = append(watched, metric)
+	}))
+	require.Len(t, watched, 1)
+
+	// Ответ, подписанный другим ключом, отклоняется
+	otherClient, err := NewHTTPClient(clientConfig, "other", "")
+	require.NoError(t, err)
+	_, err = otherClient.Get(context.Background(), metrics.MeticTypeGauge, "Alloc")
+	require.ErrorIs(t, err, ErrInvalidHash)
+}
+
+func TestLoadConfig(t *testing.T) {
+	configPath := t.TempDir() + "/agent.json"
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"address_grpc":"127.0.0.1:3200","sign_key":"file","HTTPClientConnection":{"address":"10.0.0.1:8080"}}`), 0600))
+	t.Setenv("KEY", "env")
+
+	loaded, result, err := LoadConfig([]string{"-c", configPath, "-o", "json", "list", "Poll"}, &bytes.Buffer{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"list", "Poll"}, result.Args)
+	require.Equal(t, "10.0.0.1:8080", loaded.HTTPClientConnection.ServerAddr)
+	require.Equal(t, "127.0.0.1:3200", loaded.ServerGRPCAddr)
+	require.Equal(t, "env", loaded.SignKey)
+	require.Equal(t, OutputJSON, loaded.Output)
+
+	// Флаг важнее переменной окружения
+	loaded, _, err = LoadConfig([]string{"-c", configPath, "-k", "flag", "health"}, &bytes.Buffer{})
+	require.NoError(t, err)
+	require.Equal(t, "flag", loaded.SignKey)
+
+	_, _, err = LoadConfig([]string{"-o", "yaml", "health"}, &bytes.Buffer{})
+	require.Error(t, err)
+}
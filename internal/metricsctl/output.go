@@ -0,0 +1,90 @@
+package metricsctl
+
+import (
+	"devops-tpl/internal/metrics"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Printer - вывод результатов таблицей или JSON.
+type Printer struct {
+	mutex  *sync.Mutex
+	writer io.Writer
+	format string
+}
+
+func NewPrinter(writer io.Writer, format string) *Printer {
+	return &Printer{
+		mutex:  &sync.Mutex{},
+		writer: writer,
+		format: format,
+	}
+}
+
+func formatValue(metric metrics.Metric) string {
+	if metric.MType == metrics.MeticTypeCounter {
+		return strconv.FormatInt(*metric.Delta, 10)
+	}
+
+	return strconv.FormatFloat(*metric.Value, 'g', -1, 64)
+}
+
+// Metrics - список метрик.
+func (printer *Printer) Metrics(batch []metrics.Metric) error {
+	printer.mutex.Lock()
+	defer printer.mutex.Unlock()
+
+	if printer.format == OutputJSON {
+		if batch == nil {
+			batch = []metrics.Metric{}
+		}
+		encoder := json.NewEncoder(printer.writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(batch)
+	}
+
+	writer := tabwriter.NewWriter(printer.writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TYPE\tID\tVALUE")
+	for _, metric := range batch {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", metric.MType, metric.ID, formatValue(metric))
+	}
+
+	return writer.Flush()
+}
+
+// Update - обновление из потока: строка таблицы со временем получения или JSON строка.
+func (printer *Printer) Update(metric metrics.Metric) {
+	printer.mutex.Lock()
+	defer printer.mutex.Unlock()
+
+	if printer.format == OutputJSON {
+		json.NewEncoder(printer.writer).Encode(metric)
+		return
+	}
+
+	value := formatValue(metric)
+	if metric.MType == metrics.MeticTypeCounter {
+		value = "+" + value
+	}
+	fmt.Fprintf(printer.writer, "%s  %-7s  %s  %s\n", time.Now().Format("15:04:05.000"), metric.MType, metric.ID, value)
+}
+
+// Status - результат команды без данных.
+func (printer *Printer) Status(status string) error {
+	printer.mutex.Lock()
+	defer printer.mutex.Unlock()
+
+	if printer.format == OutputJSON {
+		return json.NewEncoder(printer.writer).Encode(struct {
+			Status string `json:"status"`
+		}{status})
+	}
+
+	_, err := fmt.Fprintln(printer.writer, status)
+	return err
+}
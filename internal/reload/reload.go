@@ -0,0 +1,92 @@
+// Package reload - перечитывание конфигурации без перезапуска: по сигналу SIGHUP и при изменении файла конфигурации.
+package reload
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// Watch - вызов reload при получении SIGHUP и при изменении файла path (время изменения или размер),
+// файл проверяется каждые interval. Пустой path - только по сигналу. Завершается с отменой ctx.
+func Watch(ctx context.Context, path string, interval time.Duration, reload func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	var fileChanges <-chan time.Time
+	lastInfo := fileInfo(path)
+	if path != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		fileChanges = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			lastInfo = fileInfo(path)
+			reload()
+		case <-fileChanges:
+			info := fileInfo(path)
+			if info == lastInfo {
+				continue
+			}
+			lastInfo = info
+			reload()
+		}
+	}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileInfo(path string) fileState {
+	if path == "" {
+		return fileState{}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
+
+// Changed - пути полей (Store.Interval), значения которых отличаются в old и new. Вложенные структуры
+// сравниваются по полям, остальные значения целиком.
+func Changed(old, new any) []string {
+	return changedFields(reflect.ValueOf(old), reflect.ValueOf(new), "")
+}
+
+func changedFields(old, new reflect.Value, prefix string) []string {
+	var changed []string
+
+	for i := 0; i < old.NumField(); i++ {
+		field := old.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := prefix + field.Name
+		oldField, newField := old.Field(i), new.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			changed = append(changed, changedFields(oldField, newField, name+".")...)
+			continue
+		}
+
+		if !reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
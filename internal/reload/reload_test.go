@@ -0,0 +1,91 @@
+package reload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type nestedConfig struct {
+	Interval time.Duration
+	Targets  []string
+}
+
+type testConfig struct {
+	Addr    string
+	Nested  nestedConfig
+	private string
+}
+
+func TestChanged(t *testing.T) {
+	old := testConfig{Addr: "127.0.0.1:8080", Nested: nestedConfig{Interval: time.Second, Targets: []string{"a"}}, private: "a"}
+
+	require.Empty(t, Changed(old, old))
+
+	next := old
+	next.private = "b"
+	next.Nested.Targets = []string{"a", "b"}
+	require.Equal(t, []string{"Nested.Targets"}, Changed(old, next))
+
+	next.Addr = "127.0.0.1:9090"
+	next.Nested.Interval = time.Minute
+	require.Equal(t, []string{"Addr", "Nested.Interval", "Nested.Targets"}, Changed(old, next))
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{}`), 0600))
+
+	reloads := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		Watch(ctx, path, 10*time.Millisecond, func() {
+			reloads <- struct{}{}
+		})
+	}()
+
+	waitReload := func() {
+		select {
+		case <-reloads:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload")
+		}
+	}
+
+	// Изменение размера файла; первые изменения могут быть учтены как исходное состояние до начала наблюдения
+	content := []byte(`{}`)
+	require.Eventually(t, func() bool {
+		content = append(content, ' ')
+		require.NoError(t, os.WriteFile(path, content, 0600))
+		select {
+		case <-reloads:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+
+	// Время изменения при том же размере
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)))
+	waitReload()
+
+	// Сигнал без изменения файла, подписка на сигнал уже установлена
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	waitReload()
+
+	cancel()
+	<-stopped
+
+	select {
+	case <-reloads:
+		t.Fatal("unexpected reload")
+	default:
+	}
+}
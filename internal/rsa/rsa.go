@@ -6,6 +6,7 @@ import (
 	"crypto/sha512"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"log"
 	"os"
 )
@@ -18,7 +19,7 @@ func ParsePublicKeyRSA(path string) (*rsa.PublicKey, error) {
 
 	block, _ := pem.Decode(bytes)
 	if block == nil || block.Type != "PUBLIC KEY" {
-		log.Fatal("failed to decode PEM block containing public key")
+		return nil, errors.New("failed to decode PEM block containing public key")
 	}
 	pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
 	if err != nil {
@@ -36,7 +37,7 @@ func ParsePrivateKeyRSA(path string) (*rsa.PrivateKey, error) {
 
 	block, _ := pem.Decode(bytes)
 	if block == nil || block.Type != "PRIVATE KEY" {
-		log.Fatal("failed to decode PEM block containing private key")
+		return nil, errors.New("failed to decode PEM block containing private key")
 	}
 	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
@@ -0,0 +1,202 @@
+// Package agents - реестр агентов: регистрация со сведениями об агенте, heartbeat при каждой отправке метрик
+// и статус по времени последнего heartbeat: up, late (опаздывает) или down. Профили (Profiles) задают
+// агентам конфигурацию по их меткам.
+//
+// Реестр хранится в памяти экземпляра сервера: после перезапуска агенты регистрируются заново,
+// получив ErrUnknownAgent на heartbeat.
+package agents
+
+import (
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/tenant"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Статусы агента.
+const (
+	StatusUp   = "up"
+	StatusLate = "late"
+	StatusDown = "down"
+)
+
+// defaultReportInterval - интервал отправки агента, не указавшего его в сводке конфигурации.
+const defaultReportInterval = 10 * time.Second
+
+var (
+	ErrUnknownAgent = errors.New("unknown agent")
+)
+
+// reportInterval - интервал отправки метрик из сводки конфигурации.
+func reportInterval(info agentapi.Info) time.Duration {
+	interval, err := time.ParseDuration(info.Config[agentapi.ConfigReportInterval])
+	if err != nil || interval <= 0 {
+		return defaultReportInterval
+	}
+
+	return interval
+}
+
+// Agent - агент в реестре.
+type Agent struct {
+	agentapi.Info
+	Tenant string `json:"tenant,omitempty"`
+	// Address - адрес последнего запроса агента
+	Address      string    `json:"address"`
+	RegisteredAt time.Time `json:"registered_at"`
+	LastSeen     time.Time `json:"last_seen"`
+	Status       string    `json:"status"`
+}
+
+// Registry - реестр агентов, настройки статуса читаются при каждом обращении и меняются без перезапуска.
+// Реестр хранится в памяти экземпляра сервера и не разделяется между экземплярами кластера.
+type Registry struct {
+	config func() config.AgentsConfig
+	now    func() time.Time
+
+	mutex  *sync.Mutex
+	agents map[string]*Agent
+	// done - закрывается при остановке сервера, завершает потоки конфигурации агентов
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+func NewRegistry(config func() config.AgentsConfig) *Registry {
+	return &Registry{
+		config:    config,
+		now:       time.Now,
+		mutex:     &sync.Mutex{},
+		agents:    map[string]*Agent{},
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+}
+
+// Close - остановка сервера: потоки конфигурации агентов (Done) завершаются.
+func (registry *Registry) Close() {
+	registry.closeOnce.Do(func() {
+		close(registry.done)
+	})
+}
+
+// Done - канал, закрываемый при остановке сервера.
+func (registry *Registry) Done() <-chan struct{} {
+	return registry.done
+}
+
+// Register - регистрация агента арендатора tenantName или обновление сведений зарегистрированного.
+func (registry *Registry) Register(tenantName string, info agentapi.Info, address string) error {
+	err := info.Validate()
+	if err != nil {
+		return err
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	now := registry.now()
+	registry.agents[tenant.Key(tenantName, info.ID)] = &Agent{
+		Info:         info,
+		Tenant:       tenantName,
+		Address:      address,
+		RegisteredAt: now,
+		LastSeen:     now,
+	}
+
+	return nil
+}
+
+// Heartbeat - отметка агента id арендатора tenantName, ErrUnknownAgent - агент должен зарегистрироваться.
+func (registry *Registry) Heartbeat(tenantName string, id string, address string) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	agent, ok := registry.agents[tenant.Key(tenantName, id)]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownAgent, id)
+	}
+	agent.LastSeen = registry.now()
+	agent.Address = address
+
+	return nil
+}
+
+// Get - агент id арендатора tenantName, ErrUnknownAgent - агент должен зарегистрироваться.
+func (registry *Registry) Get(tenantName string, id string) (Agent, error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	agent, ok := registry.agents[tenant.Key(tenantName, id)]
+	if !ok {
+		return Agent{}, fmt.Errorf("%w %q", ErrUnknownAgent, id)
+	}
+
+	return *agent, nil
+}
+
+// List - агенты арендатора tenantName (tenant.All - всех арендаторов) со статусом, по ID.
+// Агенты без heartbeat дольше AgentsConfig.Expire удаляются из реестра.
+func (registry *Registry) List(tenantName string) []Agent {
+	agentsConfig := registry.config()
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	now := registry.now()
+	list := []Agent{}
+	for key, agent := range registry.agents {
+		if agentsConfig.Expire > 0 && now.Sub(agent.LastSeen) > agentsConfig.Expire {
+			delete(registry.agents, key)
+			continue
+		}
+		if tenantName != tenant.All && agent.Tenant != tenantName {
+			continue
+		}
+
+		listed := *agent
+		listed.Status = status(agentsConfig, agent, now)
+		list = append(list, listed)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Tenant != list[j].Tenant {
+			return list[i].Tenant < list[j].Tenant
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// Up - количество агентов со статусом up по арендаторам, у которых есть агенты в реестре.
+func (registry *Registry) Up() map[string]int {
+	up := map[string]int{}
+	for _, agent := range registry.List(tenant.All) {
+		count := up[agent.Tenant]
+		if agent.Status == StatusUp {
+			count++
+		}
+		up[agent.Tenant] = count
+	}
+
+	return up
+}
+
+// status - статус агента: late после LateAfter интервалов отправки без heartbeat, down - после DownAfter.
+func status(agentsConfig config.AgentsConfig, agent *Agent, now time.Time) string {
+	silence := now.Sub(agent.LastSeen)
+	interval := float64(reportInterval(agent.Info))
+
+	switch {
+	case silence > time.Duration(agentsConfig.DownAfter*interval):
+		return StatusDown
+	case silence > time.Duration(agentsConfig.LateAfter*interval):
+		return StatusLate
+	default:
+		return StatusUp
+	}
+}
@@ -0,0 +1,96 @@
+package agents
+
+import (
+	"testing"
+	"time"
+
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/tenant"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRegistry - реестр с управляемым временем.
+func newTestRegistry(agentsConfig config.AgentsConfig) (*Registry, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	registry := NewRegistry(func() config.AgentsConfig { return agentsConfig })
+	registry.now = func() time.Time { return now }
+
+	return registry, &now
+}
+
+func agentInfo(id string, reportInterval string) agentapi.Info {
+	return agentapi.Info{ID: id, Hostname: "host-" + id, Version: "1.0", Config: map[string]string{agentapi.ConfigReportInterval: reportInterval}}
+}
+
+func TestRegistry_Status(t *testing.T) {
+	registry, now := newTestRegistry(config.AgentsConfig{LateAfter: 2, DownAfter: 5, Expire: time.Hour})
+	require.NoError(t, registry.Register("", agentInfo("agent", "10s"), "10.0.0.1:5000"))
+
+	statusAfter := func(silence time.Duration) string {
+		*now = registry.agents[tenant.Key("", "agent")].LastSeen.Add(silence)
+		list := registry.List("")
+		require.Len(t, list, 1)
+		return list[0].Status
+	}
+
+	require.Equal(t, StatusUp, statusAfter(20*time.Second))
+	require.Equal(t, StatusLate, statusAfter(21*time.Second))
+	require.Equal(t, StatusLate, statusAfter(50*time.Second))
+	require.Equal(t, StatusDown, statusAfter(51*time.Second))
+
+	// Heartbeat возвращает агента в up и обновляет адрес
+	require.NoError(t, registry.Heartbeat("", "agent", "10.0.0.2:5000"))
+	list := registry.List("")
+	require.Equal(t, StatusUp, list[0].Status)
+	require.Equal(t, "10.0.0.2:5000", list[0].Address)
+	require.Equal(t, *now, list[0].LastSeen)
+}
+
+func TestRegistry_DefaultReportInterval(t *testing.T) {
+	registry, now := newTestRegistry(config.AgentsConfig{LateAfter: 2, DownAfter: 5})
+	require.NoError(t, registry.Register("", agentInfo("agent", "invalid"), ""))
+
+	*now = now.Add(2*defaultReportInterval + time.Second)
+	require.Equal(t, StatusLate, registry.List("")[0].Status)
+}
+
+func TestRegistry_Heartbeat(t *testing.T) {
+	registry, _ := newTestRegistry(config.AgentsConfig{LateAfter: 2, DownAfter: 5})
+	require.NoError(t, registry.Register("team-a", agentInfo("agent", "10s"), ""))
+
+	require.ErrorIs(t, registry.Heartbeat("team-a", "other", ""), ErrUnknownAgent)
+	// Агенты арендаторов не пересекаются
+	require.ErrorIs(t, registry.Heartbeat("", "agent", ""), ErrUnknownAgent)
+	require.NoError(t, registry.Heartbeat("team-a", "agent", ""))
+}
+
+func TestRegistry_ListAndUp(t *testing.T) {
+	registry, now := newTestRegistry(config.AgentsConfig{LateAfter: 2, DownAfter: 5, Expire: time.Hour})
+	require.NoError(t, registry.Register("team-b", agentInfo("b", "1m"), ""))
+	require.NoError(t, registry.Register("team-a", agentInfo("z", "10s"), ""))
+	require.NoError(t, registry.Register("team-a", agentInfo("a", "1m"), ""))
+
+	*now = now.Add(time.Minute)
+
+	list := registry.List("team-a")
+	require.Len(t, list, 2)
+	require.Equal(t, "a", list[0].ID)
+	require.Equal(t, StatusUp, list[0].Status)
+	require.Equal(t, "z", list[1].ID)
+	require.Equal(t, StatusDown, list[1].Status)
+
+	all := registry.List(tenant.All)
+	require.Len(t, all, 3)
+	require.Equal(t, "team-b", all[2].Tenant)
+
+	require.Equal(t, map[string]int{"team-a": 1, "team-b": 1}, registry.Up())
+
+	// Агенты без heartbeat дольше Expire удаляются, арендатор без агентов не попадает в Up
+	*now = now.Add(time.Hour)
+	require.NoError(t, registry.Register("team-a", agentInfo("a", "1m"), ""))
+	require.Equal(t, map[string]int{"team-a": 1}, registry.Up())
+	require.ErrorIs(t, registry.Heartbeat("team-b", "b", ""), ErrUnknownAgent)
+}
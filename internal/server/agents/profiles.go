@@ -0,0 +1,147 @@
+package agents
+
+import (
+	"crypto/sha256"
+	"devops-tpl/internal/agentapi"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// versionHashLength - длина хэша содержимого профиля в версии.
+const versionHashLength = 12
+
+// Profile - профиль конфигурации агентов, метки которых содержат все метки Selector.
+type Profile struct {
+	Name string `json:"name"`
+	// Selector - метки выбора агентов, пустой выбирает всех
+	Selector map[string]string     `json:"selector,omitempty"`
+	Config   agentapi.RemoteConfig `json:"config"`
+}
+
+// Profiles - профили конфигурации агентов в порядке выбора.
+type Profiles struct {
+	profiles []Profile
+	versions []string
+}
+
+// NewProfiles - проверка профилей и вычисление их версий.
+func NewProfiles(profiles []Profile) (*Profiles, error) {
+	selectorLabels := map[string]bool{}
+	for _, profile := range profiles {
+		for name := range profile.Selector {
+			selectorLabels[name] = true
+		}
+	}
+
+	names := map[string]bool{}
+	versions := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		if profile.Name == "" || names[profile.Name] {
+			return nil, fmt.Errorf("profile %q: name must be unique and not empty", profile.Name)
+		}
+		names[profile.Name] = true
+
+		err := validateRemoteConfig(profile.Config, selectorLabels)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q: %w", profile.Name, err)
+		}
+
+		content, err := json.Marshal(profile.Config)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(content)
+		versions = append(versions, profile.Name+"-"+hex.EncodeToString(hash[:])[:versionHashLength])
+	}
+
+	return &Profiles{profiles: profiles, versions: versions}, nil
+}
+
+// LoadProfiles - профили из JSON файла: массив объектов {"name", "selector", "config"}.
+func LoadProfiles(path string) (*Profiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []Profile
+	err = json.Unmarshal(data, &profiles)
+	if err != nil {
+		return nil, fmt.Errorf("profiles file %s: %w", path, err)
+	}
+
+	result, err := NewProfiles(profiles)
+	if err != nil {
+		return nil, fmt.Errorf("profiles file %s: %w", path, err)
+	}
+
+	return result, nil
+}
+
+// Select - конфигурация агента с метками labels: первый профиль, селектор которого совпадает с метками.
+// Без подходящего профиля (и без профилей, nil) - локальная конфигурация агента.
+func (profiles *Profiles) Select(labels map[string]string) agentapi.Assignment {
+	if profiles == nil {
+		return agentapi.Assignment{Version: agentapi.LocalVersion}
+	}
+
+	for i, profile := range profiles.profiles {
+		if matches(profile.Selector, labels) {
+			return agentapi.Assignment{Profile: profile.Name, Version: profiles.versions[i], Config: profile.Config}
+		}
+	}
+
+	return agentapi.Assignment{Version: agentapi.LocalVersion}
+}
+
+func matches(selector map[string]string, labels map[string]string) bool {
+	for name, value := range selector {
+		if labelValue, ok := labels[name]; !ok || labelValue != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateRemoteConfig - проверка значений профиля. Метки профиля не могут задавать метки селекторов, иначе
+// выбор профиля зависел бы от него самого.
+func validateRemoteConfig(config agentapi.RemoteConfig, selectorLabels map[string]bool) error {
+	for field, interval := range map[string]string{"poll_interval": config.PollInterval, "report_interval": config.ReportInterval} {
+		if interval == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(interval)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("%s: expected positive duration (example: 10s), got %q", field, interval)
+		}
+	}
+
+	if config.RateLimit < 0 {
+		return fmt.Errorf("rate_limit: must not be negative")
+	}
+
+	for _, collector := range config.Collectors {
+		if collector != agentapi.CollectorRuntime && collector != agentapi.CollectorSystem && collector != agentapi.CollectorPrometheus {
+			return fmt.Errorf("collectors: unknown collector %q", collector)
+		}
+	}
+
+	for _, pattern := range append(append([]string{}, config.Include...), config.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("include, exclude: invalid pattern %q", pattern)
+		}
+	}
+
+	for name := range config.Labels {
+		if selectorLabels[name] {
+			return fmt.Errorf("labels: label %q is used in selectors", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package agents
+
+import (
+	"devops-tpl/internal/agentapi"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testProfiles(t *testing.T) *Profiles {
+	profiles, err := NewProfiles([]Profile{
+		{Name: "db-eu", Selector: map[string]string{"role": "db", "dc": "eu-1"}, Config: agentapi.RemoteConfig{ReportInterval: "30s"}},
+		{Name: "db", Selector: map[string]string{"role": "db"}, Config: agentapi.RemoteConfig{
+			PollInterval: "5s",
+			Collectors:   []string{agentapi.CollectorRuntime},
+			Labels:       map[string]string{"team": "storage"},
+		}},
+		{Name: "default", Config: agentapi.RemoteConfig{Exclude: []string{"RandomValue"}}},
+	})
+	require.NoError(t, err)
+
+	return profiles
+}
+
+func TestProfiles_Select(t *testing.T) {
+	profiles := testProfiles(t)
+
+	require.Equal(t, "db-eu", profiles.Select(map[string]string{"role": "db", "dc": "eu-1", "host": "a"}).Profile)
+	require.Equal(t, "db", profiles.Select(map[string]string{"role": "db", "dc": "us-1"}).Profile)
+
+	assignment := profiles.Select(nil)
+	require.Equal(t, "default", assignment.Profile)
+	require.Equal(t, []string{"RandomValue"}, assignment.Config.Exclude)
+
+	var noProfiles *Profiles
+	require.Equal(t, agentapi.Assignment{Version: agentapi.LocalVersion}, noProfiles.Select(map[string]string{"role": "db"}))
+
+	profiles, err := NewProfiles([]Profile{{Name: "db", Selector: map[string]string{"role": "db"}}})
+	require.NoError(t, err)
+	require.Equal(t, agentapi.LocalVersion, profiles.Select(map[string]string{"role": "web"}).Version)
+}
+
+func TestProfiles_Version(t *testing.T) {
+	version := testProfiles(t).Select(map[string]string{"role": "db"}).Version
+	require.Regexp(t, `^db-[0-9a-f]{12}$`, version)
+
+	// Версия зависит только от содержимого профиля
+	require.Equal(t, version, testProfiles(t).Select(map[string]string{"role": "db"}).Version)
+
+	changed, err := NewProfiles([]Profile{{Name: "db", Config: agentapi.RemoteConfig{PollInterval: "10s"}}})
+	require.NoError(t, err)
+	require.NotEqual(t, version, changed.Select(nil).Version)
+}
+
+func TestNewProfiles_Invalid(t *testing.T) {
+	invalid := map[string][]Profile{
+		"empty name":       {{Config: agentapi.RemoteConfig{}}},
+		"duplicate name":   {{Name: "a"}, {Name: "a"}},
+		"interval":         {{Name: "a", Config: agentapi.RemoteConfig{PollInterval: "often"}}},
+		"negative":         {{Name: "a", Config: agentapi.RemoteConfig{ReportInterval: "-1s"}}},
+		"rate limit":       {{Name: "a", Config: agentapi.RemoteConfig{RateLimit: -1}}},
+		"collector":        {{Name: "a", Config: agentapi.RemoteConfig{Collectors: []string{"disk"}}}},
+		"pattern":          {{Name: "a", Config: agentapi.RemoteConfig{Include: []string{"CPU["}}}},
+		"selector label":   {{Name: "a", Config: agentapi.RemoteConfig{Labels: map[string]string{"role": "web"}}}, {Name: "b", Selector: map[string]string{"role": "db"}}},
+		"own label in use": {{Name: "a", Selector: map[string]string{"dc": "eu-1"}, Config: agentapi.RemoteConfig{Labels: map[string]string{"dc": "us-1"}}}},
+	}
+
+	for name, profiles := range invalid {
+		_, err := NewProfiles(profiles)
+		require.Error(t, err, name)
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"name": "db", "selector": {"role": "db"}, "config": {"poll_interval": "5s", "collectors": ["runtime", "system"]}}
+	]`), 0600))
+
+	profiles, err := LoadProfiles(path)
+	require.NoError(t, err)
+	assignment := profiles.Select(map[string]string{"role": "db"})
+	require.Equal(t, "5s", assignment.Config.PollInterval)
+	require.Equal(t, []string{agentapi.CollectorRuntime, agentapi.CollectorSystem}, assignment.Config.Collectors)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name": "db", "config": {"poll_interval": "never"}}]`), 0600))
+	_, err = LoadProfiles(path)
+	require.ErrorContains(t, err, "poll_interval")
+}
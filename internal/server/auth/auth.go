@@ -0,0 +1,265 @@
+// Package auth - аутентификация клиентов по API ключам (bearer токенам) с областями доступа.
+//
+// Ключи хранятся только в виде SHA-256 хэша токена: файл ключей не позволяет восстановить токены.
+// Токен передается в заголовке "Authorization: Bearer <token>" (HTTP) или в метаданных authorization (gRPC).
+// Клиент HTTPS может вместо токена предъявить сертификат, подписанный доверенным CA: ключ выбирается по CommonName.
+//
+// Каждый ключ относится к арендатору (tenant): запросы ключа видят и изменяют только метрики арендатора.
+// Ключ с областью admin может выбрать другого арендатора или всех (tenant.All) заголовком X-Tenant.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/server/tenant"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Области доступа. ScopeAdmin включает все остальные.
+const (
+	ScopeWrite = "write"
+	ScopeRead  = "read"
+	ScopeAdmin = "admin"
+)
+
+var (
+	ErrMissingToken  = errors.New("missing API token")
+	ErrInvalidToken  = errors.New("invalid API token")
+	ErrForbidden     = errors.New("API key scope does not allow this request")
+	ErrInvalidTenant = errors.New("invalid tenant name")
+)
+
+// TenantHeader - заголовок HTTP (и ключ метаданных gRPC в нижнем регистре), которым ключ с областью admin
+// выбирает арендатора запроса.
+const TenantHeader = "X-Tenant"
+
+// Anonymous - ключ запросов при выключенной аутентификации: доступно все, как и без ключей.
+var Anonymous = Key{Name: "anonymous", Scopes: []string{ScopeAdmin}}
+
+// Key - API ключ: имя для аудита, хэш токена (HashToken) или CommonName клиентского сертификата,
+// арендатор и области доступа.
+type Key struct {
+	Name string `json:"name"`
+	Hash string `json:"hash,omitempty"`
+	// Subject - CommonName клиентского сертификата, подписанного доверенным CA (flag: auth-client-ca)
+	Subject string `json:"subject,omitempty"`
+	// Tenant - арендатор ключа, пустая строка - арендатор по умолчанию
+	Tenant string   `json:"tenant,omitempty"`
+	Scopes []string `json:"scopes"`
+}
+
+// Allows - доступна ли ключу область scope.
+func (key Key) Allows(scope string) bool {
+	for _, keyScope := range key.Scopes {
+		if keyScope == scope || keyScope == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KeySet - набор API ключей по хэшу токена и по CommonName клиентского сертификата.
+type KeySet struct {
+	keys     map[string]Key
+	subjects map[string]Key
+}
+
+func NewKeySet(keys []Key) (*KeySet, error) {
+	keySet := &KeySet{
+		keys:     make(map[string]Key, len(keys)),
+		subjects: map[string]Key{},
+	}
+
+	for i, key := range keys {
+		if key.Name == "" {
+			return nil, fmt.Errorf("key %d: empty name", i)
+		}
+
+		if key.Tenant != "" && !tenant.IsValid(key.Tenant) {
+			return nil, fmt.Errorf("key %q: %w %q", key.Name, ErrInvalidTenant, key.Tenant)
+		}
+
+		if len(key.Scopes) == 0 {
+			return nil, fmt.Errorf("key %q: no scopes", key.Name)
+		}
+		for _, scope := range key.Scopes {
+			if scope != ScopeWrite && scope != ScopeRead && scope != ScopeAdmin {
+				return nil, fmt.Errorf("key %q: unknown scope %q, expected write, read or admin", key.Name, scope)
+			}
+		}
+
+		if (key.Hash == "") == (key.Subject == "") {
+			return nil, fmt.Errorf("key %q: exactly one of hash and subject must be set", key.Name)
+		}
+		if key.Subject != "" {
+			if _, ok := keySet.subjects[key.Subject]; ok {
+				return nil, fmt.Errorf("key %q: duplicate subject", key.Name)
+			}
+			keySet.subjects[key.Subject] = key
+			continue
+		}
+
+		hash, err := hex.DecodeString(key.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("key %q: hash must be hex SHA-256 of token", key.Name)
+		}
+		key.Hash = strings.ToLower(key.Hash)
+		if _, ok := keySet.keys[key.Hash]; ok {
+			return nil, fmt.Errorf("key %q: duplicate hash", key.Name)
+		}
+		keySet.keys[key.Hash] = key
+	}
+
+	return keySet, nil
+}
+
+// LoadKeySet - ключи из JSON файла: массив объектов {"name", "hash" или "subject", "tenant", "scopes"}.
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []Key
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("keys file %s: %w", path, err)
+	}
+
+	return NewKeySet(keys)
+}
+
+// HashToken - хэш токена для файла ключей.
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateToken - новый случайный токен.
+func GenerateToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+// Check - ключ токена token, если ему доступна область scope.
+func (keySet *KeySet) Check(token string, scope string) (Key, error) {
+	if token == "" {
+		return Key{}, ErrMissingToken
+	}
+
+	key, ok := keySet.keys[HashToken(token)]
+	if !ok {
+		return Key{}, ErrInvalidToken
+	}
+
+	return checkScope(key, scope)
+}
+
+// CheckSubject - ключ клиентского сертификата с CommonName subject, если ему доступна область scope.
+func (keySet *KeySet) CheckSubject(subject string, scope string) (Key, error) {
+	key, ok := keySet.subjects[subject]
+	if !ok {
+		return Key{}, ErrInvalidToken
+	}
+
+	return checkScope(key, scope)
+}
+
+func checkScope(key Key, scope string) (Key, error) {
+	if !key.Allows(scope) {
+		return key, ErrForbidden
+	}
+
+	return key, nil
+}
+
+// RequestTenant - арендатор запроса ключа key: requested (заголовок X-Tenant), если задан, иначе арендатор ключа.
+// Выбрать не своего арендатора, в том числе всех (tenant.All), может только ключ с областью admin.
+func RequestTenant(key Key, requested string) (string, error) {
+	if requested == "" || requested == key.Tenant {
+		return key.Tenant, nil
+	}
+
+	if requested != tenant.All && !tenant.IsValid(requested) {
+		return "", fmt.Errorf("%w %q", ErrInvalidTenant, requested)
+	}
+	if !key.Allows(ScopeAdmin) {
+		return "", fmt.Errorf("%w: tenant %q", ErrForbidden, requested)
+	}
+
+	return requested, nil
+}
+
+type keyContextKey struct{}
+
+// WithKey - контекст запроса, аутентифицированного ключом key.
+func WithKey(ctx context.Context, key Key) context.Context {
+	return context.WithValue(ctx, keyContextKey{}, key)
+}
+
+// KeyFromContext - ключ запроса, Anonymous, если не задан.
+func KeyFromContext(ctx context.Context) Key {
+	key, ok := ctx.Value(keyContextKey{}).(Key)
+	if !ok {
+		return Anonymous
+	}
+
+	return key
+}
+
+// BearerToken - токен из значения заголовка "Bearer <token>", пустая строка при другой схеме.
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// Rejection - отклоненный запрос для аудита.
+type Rejection struct {
+	// Protocol - http или grpc
+	Protocol string
+	// Method - метод и путь HTTP запроса или полное имя метода gRPC
+	Method string
+	Remote string
+	// Tenant - запрошенный арендатор (заголовок X-Tenant)
+	Tenant string
+	// Key - имя ключа, если токен известен, но области недостаточно
+	Key   string
+	Scope string
+	Err   error
+}
+
+// Audit - запись отклоненного запроса в журнал запроса ctx (logging.FromContext).
+func Audit(ctx context.Context, rejection Rejection) {
+	keyName := rejection.Key
+	if keyName == "" {
+		keyName = "-"
+	}
+
+	logging.FromContext(ctx).Warn("Auth rejected",
+		slog.String("protocol", rejection.Protocol),
+		slog.String("method", rejection.Method),
+		slog.String("remote", rejection.Remote),
+		slog.String("key", keyName),
+		slog.String("tenant", rejection.Tenant),
+		slog.String("scope", rejection.Scope),
+		logging.Err(rejection.Err),
+	)
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySet_Check(t *testing.T) {
+	keySet, err := NewKeySet([]Key{
+		{Name: "agent", Hash: HashToken("agent-token"), Scopes: []string{ScopeWrite}},
+		{Name: "dashboard", Hash: HashToken("read-token"), Scopes: []string{ScopeRead}},
+		{Name: "ops", Hash: HashToken("admin-token"), Scopes: []string{ScopeAdmin}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		token   string
+		scope   string
+		keyName string
+		err     error
+	}{
+		{name: "write allowed", token: "agent-token", scope: ScopeWrite, keyName: "agent"},
+		{name: "read forbidden for write key", token: "agent-token", scope: ScopeRead, keyName: "agent", err: ErrForbidden},
+		{name: "read allowed", token: "read-token", scope: ScopeRead, keyName: "dashboard"},
+		{name: "admin covers all", token: "admin-token", scope: ScopeWrite, keyName: "ops"},
+		{name: "missing token", token: "", scope: ScopeRead, err: ErrMissingToken},
+		{name: "unknown token", token: "other", scope: ScopeRead, err: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := keySet.Check(tt.token, tt.scope)
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.keyName, key.Name)
+		})
+	}
+}
+
+func TestNewKeySet_Invalid(t *testing.T) {
+	hash := HashToken("token")
+
+	invalid := [][]Key{
+		{{Hash: hash, Scopes: []string{ScopeRead}}},
+		{{Name: "plain", Hash: "token", Scopes: []string{ScopeRead}}},
+		{{Name: "noscope", Hash: hash}},
+		{{Name: "unknown", Hash: hash, Scopes: []string{"delete"}}},
+		{{Name: "a", Hash: hash, Scopes: []string{ScopeRead}}, {Name: "b", Hash: hash, Scopes: []string{ScopeWrite}}},
+		{{Name: "nohash", Scopes: []string{ScopeRead}}},
+		{{Name: "both", Hash: hash, Subject: "agent-1", Scopes: []string{ScopeRead}}},
+		{{Name: "tenant", Hash: hash, Tenant: "team.a", Scopes: []string{ScopeRead}}},
+		{{Name: "a", Subject: "agent-1", Scopes: []string{ScopeRead}}, {Name: "b", Subject: "agent-1", Scopes: []string{ScopeRead}}},
+	}
+	for _, keys := range invalid {
+		_, err := NewKeySet(keys)
+		require.Error(t, err, keys)
+	}
+}
+
+func TestKeySet_CheckSubject(t *testing.T) {
+	keySet, err := NewKeySet([]Key{
+		{Name: "agent", Subject: "agent-1", Tenant: "team-a", Scopes: []string{ScopeWrite}},
+	})
+	require.NoError(t, err)
+
+	key, err := keySet.CheckSubject("agent-1", ScopeWrite)
+	require.NoError(t, err)
+	require.Equal(t, "team-a", key.Tenant)
+
+	_, err = keySet.CheckSubject("agent-1", ScopeRead)
+	require.ErrorIs(t, err, ErrForbidden)
+	_, err = keySet.CheckSubject("agent-2", ScopeWrite)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	// Ключ сертификата не принимается как токен
+	_, err = keySet.Check("agent-1", ScopeWrite)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRequestTenant(t *testing.T) {
+	agent := Key{Name: "agent", Tenant: "team-a", Scopes: []string{ScopeWrite, ScopeRead}}
+	ops := Key{Name: "ops", Scopes: []string{ScopeAdmin}}
+
+	tests := []struct {
+		name      string
+		key       Key
+		requested string
+		tenant    string
+		err       error
+	}{
+		{name: "key tenant", key: agent, tenant: "team-a"},
+		{name: "same tenant", key: agent, requested: "team-a", tenant: "team-a"},
+		{name: "other tenant forbidden", key: agent, requested: "team-b", err: ErrForbidden},
+		{name: "all tenants forbidden", key: agent, requested: "*", err: ErrForbidden},
+		{name: "admin default tenant", key: ops, tenant: ""},
+		{name: "admin other tenant", key: ops, requested: "team-b", tenant: "team-b"},
+		{name: "admin all tenants", key: ops, requested: "*", tenant: "*"},
+		{name: "invalid tenant", key: ops, requested: "team.b", err: ErrInvalidTenant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantName, err := RequestTenant(tt.key, tt.requested)
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.tenant, tenantName)
+		})
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	token, err := GenerateToken()
+	require.NoError(t, err)
+	require.Len(t, token, 64)
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name": "agent", "hash": "`+HashToken(token)+`", "scopes": ["write"]}]`), 0600))
+
+	keySet, err := LoadKeySet(path)
+	require.NoError(t, err)
+	_, err = keySet.Check(token, ScopeWrite)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"name": "agent"}`), 0600))
+	_, err = LoadKeySet(path)
+	require.Error(t, err)
+}
+
+func TestBearerToken(t *testing.T) {
+	require.Equal(t, "abc", BearerToken("Bearer abc"))
+	require.Equal(t, "abc", BearerToken("bearer  abc"))
+	require.Equal(t, "", BearerToken("Basic abc"))
+	require.Equal(t, "", BearerToken("abc"))
+	require.Equal(t, "", BearerToken(""))
+}
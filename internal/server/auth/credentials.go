@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// LoadCertPool - сертификаты CA из PEM файла для проверки клиентских сертификатов.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+
+	return certPool, nil
+}
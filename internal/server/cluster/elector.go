@@ -0,0 +1,115 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"devops-tpl/internal/logging"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LeaderLockKey - ключ advisory блокировки ведущего экземпляра.
+const LeaderLockKey int64 = 7_305_150_513
+
+// Job - единичная фоновая задача, выполняется только на ведущем экземпляре до отмены ctx.
+type Job func(ctx context.Context)
+
+// Elector - выбор ведущего экземпляра сессионной advisory блокировкой Postgres.
+// Блокировка держится, пока живо соединение, при разрыве задачи останавливаются
+// и ведущим становится другой экземпляр.
+type Elector struct {
+	db       *sql.DB
+	key      int64
+	interval time.Duration
+	leader   *atomic.Bool
+}
+
+func NewElector(db *sql.DB, key int64, interval time.Duration) *Elector {
+	return &Elector{
+		db:       db,
+		key:      key,
+		interval: interval,
+		leader:   &atomic.Bool{},
+	}
+}
+
+// IsLeader - текущий экземпляр ведущий.
+func (elector *Elector) IsLeader() bool {
+	return elector.leader.Load()
+}
+
+// Run - попытки стать ведущим каждые interval до отмены ctx, на время лидерства запускаются jobs.
+func (elector *Elector) Run(ctx context.Context, jobs ...Job) {
+	ticker := time.NewTicker(elector.interval)
+	defer ticker.Stop()
+
+	for {
+		err := elector.lead(ctx, ticker, jobs)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Cluster leadership error", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead - захват блокировки и выполнение задач, пока соединение с блокировкой отвечает.
+func (elector *Elector) lead(ctx context.Context, ticker *time.Ticker, jobs []Job) error {
+	conn, err := elector.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", elector.key).Scan(&acquired)
+	if err != nil || !acquired {
+		return err
+	}
+
+	slog.Info("Cluster: became leader")
+	elector.leader.Store(true)
+
+	jobsCtx, cancelJobs := context.WithCancel(ctx)
+	jobsWG := sync.WaitGroup{}
+	for _, job := range jobs {
+		jobsWG.Add(1)
+		go func(job Job) {
+			defer jobsWG.Done()
+			job(jobsCtx)
+		}(job)
+	}
+
+	defer func() {
+		elector.leader.Store(false)
+		cancelJobs()
+		jobsWG.Wait()
+
+		unlockCtx, cancel := context.WithTimeout(context.Background(), elector.interval)
+		defer cancel()
+		// Соединение возвращается в пул, блокировка не должна на нем оставаться
+		_, unlockErr := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1)", elector.key)
+		if unlockErr != nil {
+			slog.Error("Cluster unlock error", logging.Err(unlockErr))
+		}
+		slog.Info("Cluster: leadership released")
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err = conn.PingContext(ctx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
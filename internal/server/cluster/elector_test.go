@@ -0,0 +1,57 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"modernc.org/sqlite"
+)
+
+// lockAvailable - ответ pg_try_advisory_lock в тестовой БД: блокировку держит другой экземпляр, если false.
+var lockAvailable = &atomic.Bool{}
+
+func init() {
+	// Функции advisory блокировок Postgres для SQLite, чтобы проверить Elector без Postgres
+	sqlite.MustRegisterScalarFunction("pg_try_advisory_lock", 1, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return lockAvailable.Load(), nil
+	})
+	sqlite.MustRegisterScalarFunction("pg_advisory_unlock", 1, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return true, nil
+	})
+}
+
+// runElector - запуск Elector с задачей на время duration, возвращает число запусков задачи.
+func runElector(t *testing.T, duration time.Duration) int64 {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	elector := NewElector(db, LeaderLockKey, 10*time.Millisecond)
+	var jobRuns atomic.Int64
+	job := func(ctx context.Context) {
+		jobRuns.Add(1)
+		<-ctx.Done()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	elector.Run(ctx, job)
+	require.False(t, elector.IsLeader())
+
+	return jobRuns.Load()
+}
+
+func TestElectorFollowerDoesNotRunJobs(t *testing.T) {
+	lockAvailable.Store(false)
+	require.Zero(t, runElector(t, 100*time.Millisecond))
+}
+
+func TestElectorLeaderRunsJobs(t *testing.T) {
+	lockAvailable.Store(true)
+	require.EqualValues(t, 1, runElector(t, 100*time.Millisecond))
+}
@@ -0,0 +1,208 @@
+// Package cluster - согласование нескольких экземпляров сервера над одной БД Postgres:
+// рассылка изменений метрик через LISTEN/NOTIFY и выбор ведущего экземпляра для единичных фоновых задач
+// через advisory блокировки.
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"devops-tpl/internal/logging"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// maxPayloadSize - ограничение размера сообщения NOTIFY (в Postgres - меньше 8000 байт).
+const maxPayloadSize = 7900
+
+const listenRetryInterval = time.Second
+
+// Change - измененная метрика. Delta и Value - принятое обновление (для counter - приращение),
+// у удаления метрики не заданы.
+type Change struct {
+	ID    string   `json:"id"`
+	MType string   `json:"type"`
+	Delta *int64   `json:"delta,omitempty"`
+	Value *float64 `json:"value,omitempty"`
+}
+
+// Notification - уведомление об изменениях от экземпляра Origin.
+// Resync означает, что часть уведомлений могла быть пропущена и локальное состояние нужно перечитать целиком.
+type Notification struct {
+	Origin  string   `json:"origin"`
+	Changes []Change `json:"changes,omitempty"`
+	Resync  bool     `json:"resync,omitempty"`
+}
+
+// Notifier - рассылка и прием уведомлений об изменениях через канал Postgres.
+type Notifier struct {
+	db         *sql.DB
+	channel    string
+	instanceID string
+}
+
+func NewNotifier(db *sql.DB, channel string, instanceID string) *Notifier {
+	return &Notifier{
+		db:         db,
+		channel:    channel,
+		instanceID: instanceID,
+	}
+}
+
+// DefaultInstanceID - идентификатор экземпляра сервера по имени хоста и PID.
+func DefaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func (notifier *Notifier) InstanceID() string {
+	return notifier.instanceID
+}
+
+// Publish - рассылка изменений. Большие пакеты разбиваются на несколько сообщений.
+func (notifier *Notifier) Publish(ctx context.Context, changes []Change) error {
+	payloads, err := encodePayloads(notifier.instanceID, changes)
+	if err != nil {
+		return err
+	}
+
+	for _, payload := range payloads {
+		_, err = notifier.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", notifier.channel, payload)
+		if err != nil {
+			return fmt.Errorf("notify error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// encodePayloads - JSON сообщения не больше maxPayloadSize. Изменение, не помещающееся в одно сообщение,
+// заменяется запросом полной синхронизации.
+func encodePayloads(origin string, changes []Change) ([]string, error) {
+	var payloads []string
+	notification := Notification{Origin: origin}
+
+	flush := func() error {
+		if len(notification.Changes) == 0 && !notification.Resync {
+			return nil
+		}
+		payload, err := json.Marshal(notification)
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, string(payload))
+		notification = Notification{Origin: origin}
+		return nil
+	}
+
+	for _, change := range changes {
+		notification.Changes = append(notification.Changes, change)
+		payload, err := json.Marshal(notification)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) <= maxPayloadSize {
+			continue
+		}
+
+		notification.Changes = notification.Changes[:len(notification.Changes)-1]
+		err = flush()
+		if err != nil {
+			return nil, err
+		}
+
+		notification.Changes = []Change{change}
+		payload, err = json.Marshal(notification)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) > maxPayloadSize {
+			notification.Changes = nil
+			notification.Resync = true
+		}
+	}
+
+	err := flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return payloads, nil
+}
+
+// Listen - прием уведомлений других экземпляров до отмены ctx. Собственные уведомления пропускаются.
+// После переподключения вызывается handler с Resync: уведомления за время разрыва потеряны.
+func (notifier *Notifier) Listen(ctx context.Context, handler func(Notification)) {
+	connected := false
+	for {
+		err := notifier.listen(ctx, func(notification Notification) {
+			if notification.Origin != notifier.instanceID {
+				handler(notification)
+			}
+		}, func() {
+			if connected {
+				handler(Notification{Resync: true})
+			}
+			connected = true
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Cluster listener error, reconnecting", logging.Err(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+func (notifier *Notifier) listen(ctx context.Context, handler func(Notification), onListen func()) error {
+	conn, err := notifier.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		pgxConn := stdlibConn.Conn()
+
+		_, err := pgxConn.Exec(ctx, "LISTEN "+pgx.Identifier{notifier.channel}.Sanitize())
+		if err != nil {
+			return err
+		}
+		// Соединение возвращается в пул, подписка не должна на нем оставаться
+		defer pgxConn.Exec(context.Background(), "UNLISTEN *")
+
+		onListen()
+
+		for {
+			pgNotification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+
+			var notification Notification
+			err = json.Unmarshal([]byte(pgNotification.Payload), &notification)
+			if err != nil {
+				slog.Warn("Cluster notification decode error", logging.Err(err))
+				continue
+			}
+			handler(notification)
+		}
+	})
+}
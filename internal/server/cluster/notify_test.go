@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"devops-tpl/internal/metrics"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodePayloads(t *testing.T) {
+	var changes []Change
+	for i := 0; i < 500; i++ {
+		changes = append(changes, Change{ID: fmt.Sprintf("metric_with_long_name_%d", i), MType: "gauge"})
+	}
+
+	payloads, err := encodePayloads("server-1", changes)
+	require.NoError(t, err)
+	require.Greater(t, len(payloads), 1)
+
+	var decodedChanges []Change
+	for _, payload := range payloads {
+		require.LessOrEqual(t, len(payload), maxPayloadSize)
+
+		var notification Notification
+		require.NoError(t, json.Unmarshal([]byte(payload), &notification))
+		require.Equal(t, "server-1", notification.Origin)
+		require.False(t, notification.Resync)
+		decodedChanges = append(decodedChanges, notification.Changes...)
+	}
+	require.Equal(t, changes, decodedChanges)
+}
+
+func TestEncodePayloadsResync(t *testing.T) {
+	payloads, err := encodePayloads("server-1", []Change{
+		{ID: "small", MType: "gauge"},
+		{ID: strings.Repeat("x", maxPayloadSize), MType: "gauge"},
+	})
+	require.NoError(t, err)
+	require.Len(t, payloads, 2)
+
+	var notification Notification
+	require.NoError(t, json.Unmarshal([]byte(payloads[1]), &notification))
+	require.True(t, notification.Resync)
+	require.Empty(t, notification.Changes)
+
+	payloads, err = encodePayloads("server-1", nil)
+	require.NoError(t, err)
+	require.Empty(t, payloads)
+}
+
+type invalidatorMock struct {
+	invalidated []Change
+	all         int
+}
+
+func (mock *invalidatorMock) Invalidate(metricType string, key string) {
+	mock.invalidated = append(mock.invalidated, Change{ID: key, MType: metricType})
+}
+
+func (mock *invalidatorMock) InvalidateAll() {
+	mock.all++
+}
+
+func TestInvalidateHandler(t *testing.T) {
+	mock := &invalidatorMock{}
+	handler := InvalidateHandler(mock)
+
+	handler(Notification{Origin: "server-2", Changes: []Change{{ID: "Alloc", MType: "gauge"}}})
+	handler(Notification{Resync: true})
+
+	require.Equal(t, []Change{{ID: "Alloc", MType: "gauge"}}, mock.invalidated)
+	require.Equal(t, 1, mock.all)
+}
+
+type publisherMock struct {
+	published []metrics.Metric
+}
+
+func (mock *publisherMock) Publish(batch []metrics.Metric) {
+	mock.published = append(mock.published, batch...)
+}
+
+func TestPublishHandler(t *testing.T) {
+	invalidator := &invalidatorMock{}
+	publisher := &publisherMock{}
+	handler := Handlers(InvalidateHandler(invalidator), PublishHandler(publisher))
+
+	delta := int64(3)
+	handler(Notification{Origin: "server-2", Changes: []Change{
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "Deleted", MType: "gauge"},
+	}})
+	handler(Notification{Resync: true})
+
+	// Кэш сбрасывается для всех изменений, подписчикам рассылаются только обновления со значением
+	require.Len(t, invalidator.invalidated, 2)
+	require.Equal(t, 1, invalidator.all)
+	require.Len(t, publisher.published, 1)
+	require.Equal(t, "PollCount", publisher.published[0].ID)
+	require.EqualValues(t, 3, *publisher.published[0].Delta)
+}
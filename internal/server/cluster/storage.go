@@ -0,0 +1,162 @@
+package cluster
+
+import (
+	"context"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/storage"
+	"log/slog"
+	"time"
+)
+
+const publishTimeout = 5 * time.Second
+
+// NotifyingStorage - хранилище, рассылающее изменения метрик другим экземплярам сервера после успешной записи.
+type NotifyingStorage struct {
+	storage.MetricStorage
+	notifier *Notifier
+}
+
+func NewNotifyingStorage(metricStorage storage.MetricStorage, notifier *Notifier) NotifyingStorage {
+	return NotifyingStorage{
+		MetricStorage: metricStorage,
+		notifier:      notifier,
+	}
+}
+
+// publish - ошибка рассылки не отменяет уже выполненную запись, другие экземпляры увидят изменения
+// по окну устаревания кэша.
+// Повторы метрики в пакете объединяются: приращения counter суммируются, у gauge остается последнее значение.
+func (notifyingStorage NotifyingStorage) publish(batch []metrics.Metric) {
+	index := make(map[Change]int, len(batch))
+	changes := make([]Change, 0, len(batch))
+	for _, metric := range batch {
+		key := Change{ID: metric.ID, MType: metric.MType}
+		i, seen := index[key]
+		if !seen {
+			i = len(changes)
+			index[key] = i
+			changes = append(changes, key)
+		}
+
+		change := &changes[i]
+		switch {
+		case metric.Delta != nil:
+			delta := *metric.Delta
+			if change.Delta != nil {
+				delta += *change.Delta
+			}
+			change.Delta = &delta
+		case metric.Value != nil:
+			value := *metric.Value
+			change.Value = &value
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	err := notifyingStorage.notifier.Publish(ctx, changes)
+	if err != nil {
+		slog.Warn("Cluster notification publish error", logging.Err(err))
+	}
+}
+
+func (notifyingStorage NotifyingStorage) Update(key string, value metrics.MetricValue) error {
+	err := notifyingStorage.MetricStorage.Update(key, value)
+	if err != nil {
+		return err
+	}
+
+	notifyingStorage.publish([]metrics.Metric{{ID: key, MetricValue: value}})
+	return nil
+}
+
+func (notifyingStorage NotifyingStorage) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	err := notifyingStorage.MetricStorage.UpdateManySliceMetric(MetricBatch)
+	if err != nil {
+		return err
+	}
+
+	notifyingStorage.publish(MetricBatch)
+	return nil
+}
+
+func (notifyingStorage NotifyingStorage) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
+	err := notifyingStorage.MetricStorage.UpdateMany(DBSchema)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]metrics.Metric, 0, len(DBSchema))
+	for key, value := range DBSchema {
+		batch = append(batch, metrics.Metric{ID: key, MetricValue: value})
+	}
+	notifyingStorage.publish(batch)
+	return nil
+}
+
+func (notifyingStorage NotifyingStorage) Delete(key string, metricType string) error {
+	err := notifyingStorage.MetricStorage.Delete(key, metricType)
+	if err != nil {
+		return err
+	}
+
+	notifyingStorage.publish([]metrics.Metric{{ID: key, MetricValue: metrics.MetricValue{MType: metricType}}})
+	return nil
+}
+
+// Invalidator - локальное состояние, сбрасываемое по уведомлениям (например, storage.CachedRepo).
+type Invalidator interface {
+	Invalidate(metricType string, key string)
+	InvalidateAll()
+}
+
+// InvalidateHandler - обработчик уведомлений, сбрасывающий измененные значения.
+func InvalidateHandler(invalidator Invalidator) func(Notification) {
+	return func(notification Notification) {
+		if notification.Resync {
+			invalidator.InvalidateAll()
+			return
+		}
+
+		for _, change := range notification.Changes {
+			invalidator.Invalidate(change.MType, change.ID)
+		}
+	}
+}
+
+// Publisher - рассылка принятых обновлений подписчикам (например, watch.Hub).
+type Publisher interface {
+	Publish(batch []metrics.Metric)
+}
+
+// PublishHandler - обработчик уведомлений, рассылающий обновления других экземпляров через publisher.
+// Удаления и Resync не рассылаются: значений в них нет.
+func PublishHandler(publisher Publisher) func(Notification) {
+	return func(notification Notification) {
+		batch := make([]metrics.Metric, 0, len(notification.Changes))
+		for _, change := range notification.Changes {
+			if change.Delta == nil && change.Value == nil {
+				continue
+			}
+			batch = append(batch, metrics.Metric{
+				ID:          change.ID,
+				MetricValue: metrics.MetricValue{MType: change.MType, Delta: change.Delta, Value: change.Value},
+			})
+		}
+
+		if len(batch) != 0 {
+			publisher.Publish(batch)
+		}
+	}
+}
+
+// Handlers - обработчик, передающий уведомление каждому из handlers по порядку.
+func Handlers(handlers ...func(Notification)) func(Notification) {
+	return func(notification Notification) {
+		for _, handler := range handlers {
+			handler(notification)
+		}
+	}
+}
@@ -1,25 +1,158 @@
 package config
 
 import (
-	"encoding/json"
+	"devops-tpl/internal/configloader"
+	"devops-tpl/internal/logging"
+	handlerRSA "devops-tpl/internal/rsa"
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/tenant"
 	"flag"
-	"log"
+	"fmt"
+	"net"
 	"os"
+	"regexp"
+	"strings"
 	"time"
-
-	"github.com/caarlos0/env/v6"
 )
 
 // StoreConfig используется для хранения конфигурации агента, связанной с хранилищами.
 type StoreConfig struct {
 	// Interval - интервал выгрузки на диск (flag: i; default: 300s)
 	Interval time.Duration `env:"STORE_INTERVAL" json:"store_interval,omitempty"`
-	// DatabaseDSN - DSN БД (flag: d)
-	DatabaseDSN string `env:"DATABASE_DSN" json:"database_dsn,omitempty"`
+	// DatabaseDSN - DSN БД, для SQLite - sqlite://<путь до файла> (flag: d)
+	DatabaseDSN string `env:"DATABASE_DSN" json:"database_dsn,omitempty" secret:"true"`
 	// File - файл для выгрузки (flag: f; default: /tmp/devops-metrics-db.json)
 	File string `env:"STORE_FILE"  json:"store_file,omitempty"`
 	// Restore - чтение значений с диска при запуске (flag: r; default: false)
 	Restore bool `env:"RESTORE" json:"restore,omitempty"`
+	// Generations - количество хранимых поколений файла выгрузки (file, file.1, ...), при восстановлении
+	// используется самое новое целое (flag: store-generations; default: 3)
+	Generations int `env:"STORE_GENERATIONS" json:"store_generations,omitempty"`
+	// WAL - журнал обновлений в <File>.wal для хранилища в памяти: обновления дописываются в журнал,
+	// снимок выгружается по интервалу, восстановление - снимок и журнал (flag: wal; default: false)
+	WAL bool `env:"STORE_WAL" json:"store_wal,omitempty"`
+	// WALFsync - сброс журнала на диск после каждой записи (flag: wal-fsync; default: false)
+	WALFsync bool `env:"STORE_WAL_FSYNC" json:"store_wal_fsync,omitempty"`
+	// Cache - кэш значений в памяти перед БД, запись сквозь кэш (flag: cache; default: false)
+	Cache bool `env:"STORE_CACHE" json:"store_cache,omitempty"`
+	// CacheStaleness - окно, после которого значение в кэше перечитывается из БД, 0 - без устаревания.
+	// Для нескольких серверов над одной БД (flag: cache-staleness; default: 0)
+	CacheStaleness time.Duration `env:"STORE_CACHE_STALENESS" json:"store_cache_staleness,omitempty"`
+	// CacheReloadInterval - интервал полной перезагрузки кэша из БД, 0 - без перезагрузки (flag: cache-reload-interval; default: 0)
+	CacheReloadInterval time.Duration `env:"STORE_CACHE_RELOAD_INTERVAL" json:"store_cache_reload_interval,omitempty"`
+}
+
+// InfluxConfig используется для хранения конфигурации приема метрик в формате InfluxDB line protocol.
+type InfluxConfig struct {
+	// IntegerAsCounter - целочисленные поля (суффикс i и u) сохраняются как counter, иначе как gauge (flag: influx-int-counter; default: false)
+	IntegerAsCounter bool `env:"INFLUX_INTEGER_AS_COUNTER" json:"influx_integer_as_counter,omitempty"`
+}
+
+// GraphiteConfig используется для хранения конфигурации приема метрик по Graphite plaintext протоколу.
+type GraphiteConfig struct {
+	// Addr - TCP адрес приемника, не запускается если пустое значение (flag: graphite-addr)
+	Addr string `env:"GRAPHITE_ADDRESS" json:"graphite_address,omitempty"`
+	// Templates - шаблоны извлечения меток из пути, "[filter] template" (example: servers.* .host.measurement*)
+	Templates []string `env:"GRAPHITE_TEMPLATES" envSeparator:";" json:"graphite_templates,omitempty"`
+}
+
+// ClusterConfig используется для хранения конфигурации работы нескольких экземпляров сервера над одной БД Postgres.
+type ClusterConfig struct {
+	// Enabled - рассылка изменений через LISTEN/NOTIFY и выбор ведущего экземпляра (flag: cluster; default: false)
+	Enabled bool `env:"CLUSTER" json:"cluster,omitempty"`
+	// Channel - канал уведомлений Postgres (default: devops_metrics)
+	Channel string `env:"CLUSTER_CHANNEL" json:"cluster_channel,omitempty"`
+	// InstanceID - идентификатор экземпляра, по умолчанию имя хоста и PID
+	InstanceID string `env:"CLUSTER_INSTANCE_ID" json:"cluster_instance_id,omitempty"`
+	// LeaderInterval - интервал попыток стать ведущим и проверки соединения ведущего (default: 5s)
+	LeaderInterval time.Duration `env:"CLUSTER_LEADER_INTERVAL" json:"cluster_leader_interval,omitempty"`
+}
+
+// ForwardConfig используется для хранения конфигурации пересылки метрик на вышестоящие серверы.
+type ForwardConfig struct {
+	// Upstreams - адреса вышестоящих серверов (host:port), пересылка выключена если пусто (flag: forward-upstreams)
+	Upstreams []string `env:"FORWARD_UPSTREAMS" envSeparator:"," json:"forward_upstreams,omitempty"`
+	// Mode - relay (все принятые обновления) или snapshot (периодический срез хранилища) (default: relay)
+	Mode string `env:"FORWARD_MODE" json:"forward_mode,omitempty"`
+	// Interval - интервал отправки накопленных обновлений или среза (default: 10s)
+	Interval time.Duration `env:"FORWARD_INTERVAL" json:"forward_interval,omitempty"`
+	// Origin - имя сервера-источника, добавляется к метрикам (default: имя хоста)
+	Origin string `env:"FORWARD_ORIGIN" json:"forward_origin,omitempty"`
+	// OriginLabel - метка с именем источника, если пусто - имя источника добавляется префиксом "origin." (default: origin)
+	OriginLabel string `env:"FORWARD_ORIGIN_LABEL" json:"forward_origin_label,omitempty"`
+	// SignKey - ключ подписи метрик для вышестоящих серверов
+	SignKey string `env:"FORWARD_KEY" json:"forward_sign_key,omitempty" secret:"true"`
+	// Token - API токен для вышестоящих серверов с аутентификацией
+	Token string `env:"FORWARD_TOKEN" json:"forward_token,omitempty" secret:"true"`
+	// PublicKeyRSA - публичный RSA ключ вышестоящих серверов
+	PublicKeyRSA string `env:"FORWARD_CRYPTO_KEY" json:"forward_crypto_key,omitempty"`
+	// RetryCount - количество повторов отправки (default: 2)
+	RetryCount int `env:"FORWARD_RETRY_COUNT" json:"forward_retry_count,omitempty"`
+	// RetryWaitTime - время ожидания между повторами (default: 10s)
+	RetryWaitTime time.Duration `env:"FORWARD_RETRY_WAIT_TIME" json:"forward_retry_wait_time,omitempty"`
+	// RetryMaxWaitTime - макс. время ожидания между повторами (default: 90s)
+	RetryMaxWaitTime time.Duration `env:"FORWARD_RETRY_MAX_WAIT_TIME" json:"forward_retry_max_wait_time,omitempty"`
+}
+
+// AuthConfig используется для хранения конфигурации аутентификации по API ключам.
+type AuthConfig struct {
+	// KeysFile - JSON файл API ключей (имя, SHA-256 хэш токена или CommonName сертификата, арендатор, области доступа),
+	// перечитывается при перезагрузке конфигурации. Без файла аутентификация выключена (flag: auth-keys)
+	KeysFile string `env:"AUTH_KEYS_FILE" json:"auth_keys_file,omitempty"`
+	// ClientCAFile - PEM файл CA клиентских сертификатов HTTPS, сертификат выбирает ключ по CommonName (flag: auth-client-ca)
+	ClientCAFile string `env:"AUTH_CLIENT_CA" json:"auth_client_ca,omitempty"`
+}
+
+// TenantsConfig используется для хранения квот арендаторов.
+type TenantsConfig struct {
+	// MaxMetrics - квота количества метрик каждого арендатора, 0 - без ограничения (flag: tenant-max-metrics)
+	MaxMetrics int `env:"TENANT_MAX_METRICS" json:"tenant_max_metrics,omitempty"`
+	// QuotasFile - JSON файл квот отдельных арендаторов вместо MaxMetrics: {"team-a": {"max_metrics": 1000}},
+	// перечитывается при перезагрузке конфигурации (flag: tenant-quotas)
+	QuotasFile string `env:"TENANT_QUOTAS_FILE" json:"tenant_quotas_file,omitempty"`
+}
+
+// LimitsConfig используется для хранения ограничений приема метрик от клиентов (имя API ключа, без аутентификации - IP адрес).
+type LimitsConfig struct {
+	// RequestRate - запросов записи в секунду от клиента, 0 - без ограничения (flag: limit-request-rate)
+	RequestRate float64 `env:"LIMIT_REQUEST_RATE" json:"limit_request_rate,omitempty"`
+	// RequestBurst - запросов записи сверх RequestRate подряд, 0 - равно RequestRate (flag: limit-request-burst)
+	RequestBurst int `env:"LIMIT_REQUEST_BURST" json:"limit_request_burst,omitempty"`
+	// MetricRate - метрик в секунду от клиента, 0 - без ограничения (flag: limit-metric-rate)
+	MetricRate float64 `env:"LIMIT_METRIC_RATE" json:"limit_metric_rate,omitempty"`
+	// MetricBurst - метрик сверх MetricRate подряд и наибольший пакет, 0 - равно MetricRate (flag: limit-metric-burst)
+	MetricBurst int `env:"LIMIT_METRIC_BURST" json:"limit_metric_burst,omitempty"`
+	// MaxClientSeries - рядов (метрик), созданных одним клиентом, 0 - без ограничения (flag: limit-client-series)
+	MaxClientSeries int `env:"LIMIT_MAX_CLIENT_SERIES" json:"limit_max_client_series,omitempty"`
+	// MaxSeries - рядов всего на сервере, 0 - без ограничения (flag: limit-series)
+	MaxSeries int `env:"LIMIT_MAX_SERIES" json:"limit_max_series,omitempty"`
+	// MaxNameLength - длина ID метрики с метками, 0 - без ограничения (flag: limit-name-length; default: 256)
+	MaxNameLength int `env:"LIMIT_MAX_NAME_LENGTH" json:"limit_max_name_length,omitempty"`
+	// NamePattern - регулярное выражение имени метрики без меток, пусто - без проверки
+	// (flag: limit-name-pattern; default: ^[a-zA-Z0-9_.:-]+$)
+	NamePattern string `env:"LIMIT_NAME_PATTERN" json:"limit_name_pattern,omitempty"`
+}
+
+// AgentsConfig используется для хранения настроек статуса агентов в реестре.
+type AgentsConfig struct {
+	// LateAfter - агент опаздывает (late) без heartbeat дольше LateAfter своих интервалов отправки (flag: agents-late-after; default: 2)
+	LateAfter float64 `env:"AGENTS_LATE_AFTER" json:"agents_late_after,omitempty"`
+	// DownAfter - агент недоступен (down) без heartbeat дольше DownAfter своих интервалов отправки (flag: agents-down-after; default: 5)
+	DownAfter float64 `env:"AGENTS_DOWN_AFTER" json:"agents_down_after,omitempty"`
+	// Expire - агент удаляется из реестра без heartbeat дольше Expire, 0 - не удаляется (flag: agents-expire; default: 24h)
+	Expire time.Duration `env:"AGENTS_EXPIRE" json:"agents_expire,omitempty"`
+	// ProfilesFile - JSON файл профилей конфигурации агентов, перечитывается при перезагрузке конфигурации,
+	// пустое значение - агенты работают с локальной конфигурацией (flag: agents-profiles)
+	ProfilesFile string `env:"AGENTS_PROFILES_FILE" json:"agents_profiles_file,omitempty"`
+}
+
+// SelfMetricsConfig используется для хранения настроек метрик работы самого сервера.
+type SelfMetricsConfig struct {
+	// Interval - интервал записи метрик сервера в хранилище арендатора Tenant, 0 - только GET /api/server/metrics
+	// (flag: self-metrics-interval; default: 10s)
+	Interval time.Duration `env:"SELF_METRICS_INTERVAL" json:"self_metrics_interval,omitempty"`
+	// Tenant - арендатор, в хранилище которого записываются метрики сервера (flag: self-metrics-tenant; default: _server)
+	Tenant string `env:"SELF_METRICS_TENANT" json:"self_metrics_tenant,omitempty"`
 }
 
 // Config используется для хранения конфигурации сервера.
@@ -35,12 +168,29 @@ type Config struct {
 	// PrivateKeyRSA - приватный RSA ключ (flag: crypto-key)
 	PrivateKeyRSA string `env:"CRYPTO_KEY" json:"crypto_key,omitempty"`
 	// SignKey - ключ для подписи сообщений (flag: k)
-	SignKey string `env:"KEY"  json:"sign_key,omitempty"`
+	SignKey string `env:"KEY"  json:"sign_key,omitempty" secret:"true"`
 	// ServerGRPCAddr - адрес gRPC сервера (default: 127.0.0.1:50051)
 	ServerGRPCAddr string `env:"ADDRESS_GRPC" json:"address_grpc,omitempty"`
-	// DebugMode - debug мод (flag: debug; default: false)
+	// DebugMode - debug мод: журнал с уровнем debug, меняется без перезапуска (flag: debug; default: false)
 	DebugMode bool `env:"DEBUG"  json:"debug,omitempty"`
-	Store     StoreConfig
+	// LogFormat - формат журнала: text или json (flag: log-format; default: text)
+	LogFormat string `env:"LOG_FORMAT" json:"log_format,omitempty"`
+	// ConfigPath - путь до JSON файла конфигурации, перечитывается по SIGHUP и при изменении (flag: c, config; env: CONFIG)
+	ConfigPath string `json:"-"`
+	// args - аргументы командной строки, с которыми загружена конфигурация, для Reload
+	args []string
+	// ReloadInterval - интервал проверки изменения файла конфигурации, 0 - только по SIGHUP (flag: config-reload-interval; default: 5s)
+	ReloadInterval time.Duration `env:"CONFIG_RELOAD_INTERVAL" json:"config_reload_interval,omitempty"`
+	Store          StoreConfig
+	Influx         InfluxConfig
+	Graphite       GraphiteConfig
+	Cluster        ClusterConfig
+	Forward        ForwardConfig
+	Auth           AuthConfig
+	Tenants        TenantsConfig
+	Limits         LimitsConfig
+	Agents         AgentsConfig
+	SelfMetrics    SelfMetricsConfig
 }
 
 func newConfig() *Config {
@@ -50,82 +200,204 @@ func newConfig() *Config {
 	return &config
 }
 
-func (config *Config) parseConfig(flagConfigPath, flagConfigPathAlias *string) {
-	var configPath string
-	if *flagConfigPath != "" {
-		configPath = *flagConfigPath
+// initDefaultValues - значения конфига по умолчанию.
+func (config *Config) initDefaultValues() {
+	config.ServerAddr = "127.0.0.1:8080"
+	config.ProfilingAddr = "127.0.0.1:8090"
+	config.ServerGRPCAddr = "127.0.0.1:50051"
+	config.TemplatesAbsPath = "./templates"
+	config.Store = StoreConfig{
+		Interval:    time.Duration(300) * time.Second,
+		File:        "/tmp/devops-metrics-db.json",
+		Restore:     true,
+		Generations: 3,
+	}
+	config.Cluster = ClusterConfig{
+		Channel:        "devops_metrics",
+		LeaderInterval: 5 * time.Second,
+	}
+	config.Forward = ForwardConfig{
+		Mode:             "relay",
+		Interval:         10 * time.Second,
+		OriginLabel:      "origin",
+		RetryCount:       2,
+		RetryWaitTime:    10 * time.Second,
+		RetryMaxWaitTime: 90 * time.Second,
+	}
+	config.Limits = LimitsConfig{
+		MaxNameLength: 256,
+		NamePattern:   "^[a-zA-Z0-9_.:-]+$",
+	}
+	config.Agents = AgentsConfig{
+		LateAfter: 2,
+		DownAfter: 5,
+		Expire:    24 * time.Hour,
+	}
+	config.SelfMetrics = SelfMetricsConfig{
+		Interval: 10 * time.Second,
+		Tenant:   "_server",
 	}
+	config.ReloadInterval = 5 * time.Second
+	config.DebugMode = false
+	config.LogFormat = logging.FormatText
+}
+
+func (config *Config) bindFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&config.ServerAddr, "a", config.ServerAddr, "server address (host:port)")
+	flagSet.StringVar(&config.PrivateKeyRSA, "crypto-key", config.PrivateKeyRSA, "RSA private key")
+	flagSet.StringVar(&config.TrustedSubNet, "t", config.TrustedSubNet, "trusted subnet")
+	flagSet.StringVar(&config.SignKey, "k", config.SignKey, "sign key")
+	flagSet.BoolVar(&config.DebugMode, "debug", config.DebugMode, "debug mode")
+	flagSet.StringVar(&config.LogFormat, "log-format", config.LogFormat, "log format: text or json")
+	flagSet.DurationVar(&config.ReloadInterval, "config-reload-interval", config.ReloadInterval, "config file change check interval, 0 - reload on SIGHUP only (example: 5s)")
+	flagSet.BoolVar(&config.Store.Restore, "r", config.Store.Restore, "restoring metrics from file")
+	flagSet.StringVar(&config.Store.DatabaseDSN, "d", config.Store.DatabaseDSN, "Database DSN")
+	flagSet.DurationVar(&config.Store.Interval, "i", config.Store.Interval, "store interval (example: 10s)")
+	flagSet.StringVar(&config.Store.File, "f", config.Store.File, "path to file for storage metrics")
+	flagSet.IntVar(&config.Store.Generations, "store-generations", config.Store.Generations, "number of storage file generations to keep")
+	flagSet.BoolVar(&config.Store.WAL, "wal", config.Store.WAL, "append updates to write-ahead log next to storage file")
+	flagSet.BoolVar(&config.Store.WALFsync, "wal-fsync", config.Store.WALFsync, "fsync write-ahead log after every update")
+	flagSet.BoolVar(&config.Store.Cache, "cache", config.Store.Cache, "cache database values in memory")
+	flagSet.DurationVar(&config.Store.CacheStaleness, "cache-staleness", config.Store.CacheStaleness, "re-read cached values older than this (example: 5s)")
+	flagSet.DurationVar(&config.Store.CacheReloadInterval, "cache-reload-interval", config.Store.CacheReloadInterval, "full cache reload interval (example: 1m)")
+	flagSet.BoolVar(&config.Cluster.Enabled, "cluster", config.Cluster.Enabled, "coordinate several servers over postgres (LISTEN/NOTIFY, leader election)")
+	flagSet.Func("forward-upstreams", "comma separated upstream servers to forward metrics to (host:port)", func(value string) error {
+		config.Forward.Upstreams = strings.Split(value, ",")
+		return nil
+	})
+	flagSet.StringVar(&config.Forward.Mode, "forward-mode", config.Forward.Mode, "forward mode: relay or snapshot")
+	flagSet.StringVar(&config.Forward.Origin, "forward-origin", config.Forward.Origin, "origin server name added to forwarded metrics")
+	flagSet.StringVar(&config.Graphite.Addr, "graphite-addr", config.Graphite.Addr, "graphite plaintext listener address (host:port)")
+	flagSet.StringVar(&config.Auth.KeysFile, "auth-keys", config.Auth.KeysFile, "API keys file, enables token authentication")
+	flagSet.StringVar(&config.Auth.ClientCAFile, "auth-client-ca", config.Auth.ClientCAFile, "client certificates CA file (PEM)")
+	flagSet.IntVar(&config.Tenants.MaxMetrics, "tenant-max-metrics", config.Tenants.MaxMetrics, "max metrics per tenant, 0 - unlimited")
+	flagSet.StringVar(&config.Tenants.QuotasFile, "tenant-quotas", config.Tenants.QuotasFile, "per tenant quotas file")
+	flagSet.Float64Var(&config.Limits.RequestRate, "limit-request-rate", config.Limits.RequestRate, "write requests per second per client, 0 - unlimited")
+	flagSet.IntVar(&config.Limits.RequestBurst, "limit-request-burst", config.Limits.RequestBurst, "write requests burst per client, 0 - equal to rate")
+	flagSet.Float64Var(&config.Limits.MetricRate, "limit-metric-rate", config.Limits.MetricRate, "metrics per second per client, 0 - unlimited")
+	flagSet.IntVar(&config.Limits.MetricBurst, "limit-metric-burst", config.Limits.MetricBurst, "metrics burst (and max batch) per client, 0 - equal to rate")
+	flagSet.IntVar(&config.Limits.MaxClientSeries, "limit-client-series", config.Limits.MaxClientSeries, "max series created by one client, 0 - unlimited")
+	flagSet.IntVar(&config.Limits.MaxSeries, "limit-series", config.Limits.MaxSeries, "max series on the server, 0 - unlimited")
+	flagSet.IntVar(&config.Limits.MaxNameLength, "limit-name-length", config.Limits.MaxNameLength, "max metric ID length with labels, 0 - unlimited")
+	flagSet.StringVar(&config.Limits.NamePattern, "limit-name-pattern", config.Limits.NamePattern, "metric name regular expression, empty - any name")
+	flagSet.Float64Var(&config.Agents.LateAfter, "agents-late-after", config.Agents.LateAfter, "agent is late after this many report intervals without heartbeat")
+	flagSet.Float64Var(&config.Agents.DownAfter, "agents-down-after", config.Agents.DownAfter, "agent is down after this many report intervals without heartbeat")
+	flagSet.DurationVar(&config.Agents.Expire, "agents-expire", config.Agents.Expire, "remove agents without heartbeat for this long, 0 - keep (example: 24h)")
+	flagSet.StringVar(&config.Agents.ProfilesFile, "agents-profiles", config.Agents.ProfilesFile, "path to agent config profiles file (json)")
+	flagSet.DurationVar(&config.SelfMetrics.Interval, "self-metrics-interval", config.SelfMetrics.Interval, "server metrics store interval, 0 - endpoint only (example: 10s)")
+	flagSet.StringVar(&config.SelfMetrics.Tenant, "self-metrics-tenant", config.SelfMetrics.Tenant, "tenant to store server metrics in")
+	flagSet.BoolVar(&config.Influx.IntegerAsCounter, "influx-int-counter", config.Influx.IntegerAsCounter, "store influx integer fields as counters")
+}
 
-	if *flagConfigPathAlias != "" {
-		configPath = *flagConfigPathAlias
+// Load - загрузка конфигурации из аргументов командной строки args по слоям: значения по умолчанию,
+// файл JSON или YAML (flag: c, config; env: CONFIG), переменные окружения, флаги - с проверкой результата.
+func Load(args []string) (Config, configloader.Result, error) {
+	config := newConfig()
+	result, err := configloader.Load("server", os.Stderr, config, (*Config).bindFlags, args)
+	if err != nil {
+		return *config, result, err
 	}
+	config.ConfigPath = result.Path
+	config.args = args
+
+	return *config, result, config.Validate()
+}
 
-	if path, ok := os.LookupEnv("CONFIG"); ok {
-		configPath = path
+// Reload - повторная загрузка с аргументами командной строки конфигурации config.
+func (config Config) Reload() (Config, error) {
+	next, _, err := Load(config.args)
+	return next, err
+}
+
+// Validate - проверка значений, которые иначе приводят к ошибке при применении. Возвращает configloader.Errors
+// со всеми ошибками полей.
+func (config Config) Validate() error {
+	var errs configloader.Errors
+
+	errs.Check(isAddr(config.ServerAddr), "ServerAddr", "expected host:port")
+	errs.Check(config.ServerGRPCAddr == "" || isAddr(config.ServerGRPCAddr), "ServerGRPCAddr", "expected host:port")
+	errs.Check(config.ProfilingAddr == "" || isAddr(config.ProfilingAddr), "ProfilingAddr", "expected host:port")
+	errs.Check(config.Graphite.Addr == "" || isAddr(config.Graphite.Addr), "Graphite.Addr", "expected host:port")
+	errs.Check(config.ReloadInterval >= 0, "ReloadInterval", "must not be negative")
+	errs.Check(logging.IsFormat(config.LogFormat), "LogFormat", "expected text or json")
+
+	if config.TrustedSubNet != "" {
+		_, _, err := net.ParseCIDR(config.TrustedSubNet)
+		if err != nil {
+			errs.Add("TrustedSubNet", err)
+		}
 	}
 
-	if configPath == "" {
-		return
+	if config.PrivateKeyRSA != "" {
+		_, err := handlerRSA.ParsePrivateKeyRSA(config.PrivateKeyRSA)
+		if err != nil {
+			errs.Add("PrivateKeyRSA", err)
+		}
 	}
 
-	file, err := os.OpenFile(configPath, os.O_RDONLY|os.O_CREATE, 0777)
-	if err != nil {
-		log.Fatal(err)
+	if config.Auth.KeysFile != "" {
+		_, err := auth.LoadKeySet(config.Auth.KeysFile)
+		if err != nil {
+			errs.Add("Auth.KeysFile", err)
+		}
 	}
-	err = file.Close()
-	if err != nil {
-		log.Println(err)
+	if config.Auth.ClientCAFile != "" {
+		_, err := auth.LoadCertPool(config.Auth.ClientCAFile)
+		if err != nil {
+			errs.Add("Auth.ClientCAFile", err)
+		}
 	}
 
-	err = json.NewDecoder(file).Decode(&config)
-	if err != nil {
-		log.Fatal(err)
+	errs.Check(config.Tenants.MaxMetrics >= 0, "Tenants.MaxMetrics", "must not be negative")
+	if config.Tenants.QuotasFile != "" {
+		_, err := tenant.LoadQuotas(config.Tenants.QuotasFile)
+		if err != nil {
+			errs.Add("Tenants.QuotasFile", err)
+		}
 	}
-}
 
-// initDefaultValues - значения конфига по умолчанию.
-func (config *Config) initDefaultValues() {
-	config.ServerAddr = "127.0.0.1:8080"
-	config.ProfilingAddr = "127.0.0.1:8090"
-	config.ServerGRPCAddr = "127.0.0.1:50051"
-	config.TemplatesAbsPath = "./templates"
-	config.Store = StoreConfig{
-		Interval: time.Duration(300) * time.Second,
-		File:     "/tmp/devops-metrics-db.json",
-		Restore:  true,
+	errs.Check(config.Limits.RequestRate >= 0, "Limits.RequestRate", "must not be negative")
+	errs.Check(config.Limits.RequestBurst >= 0, "Limits.RequestBurst", "must not be negative")
+	errs.Check(config.Limits.MetricRate >= 0, "Limits.MetricRate", "must not be negative")
+	errs.Check(config.Limits.MetricBurst >= 0, "Limits.MetricBurst", "must not be negative")
+	errs.Check(config.Limits.MaxClientSeries >= 0, "Limits.MaxClientSeries", "must not be negative")
+	errs.Check(config.Limits.MaxSeries >= 0, "Limits.MaxSeries", "must not be negative")
+	errs.Check(config.Limits.MaxNameLength >= 0, "Limits.MaxNameLength", "must not be negative")
+	if config.Limits.NamePattern != "" {
+		_, err := regexp.Compile(config.Limits.NamePattern)
+		if err != nil {
+			errs.Add("Limits.NamePattern", err)
+		}
 	}
-	config.DebugMode = false
-}
 
-func (config *Config) parseEnv() error {
-	return env.Parse(config)
-}
+	errs.Check(config.Agents.LateAfter > 0, "Agents.LateAfter", "must be positive")
+	errs.Check(config.Agents.DownAfter >= config.Agents.LateAfter, "Agents.DownAfter", "must not be less than Agents.LateAfter")
+	errs.Check(config.Agents.Expire >= 0, "Agents.Expire", "must not be negative")
 
-func (config *Config) parseFlags() {
-	flag.StringVar(&config.ServerAddr, "a", config.ServerAddr, "server address (host:port)")
-	flag.StringVar(&config.PrivateKeyRSA, "crypto-key", config.PrivateKeyRSA, "RSA private key")
-	flag.StringVar(&config.TrustedSubNet, "t", config.TrustedSubNet, "trusted subnet")
-	flag.StringVar(&config.SignKey, "k", config.SignKey, "sign key")
-	flag.BoolVar(&config.DebugMode, "debug", config.DebugMode, "debug mode")
-	flag.BoolVar(&config.Store.Restore, "r", config.Store.Restore, "restoring metrics from file")
-	flag.StringVar(&config.Store.DatabaseDSN, "d", config.Store.DatabaseDSN, "Database DSN")
-	flag.DurationVar(&config.Store.Interval, "i", config.Store.Interval, "store interval (example: 10s)")
-	flag.StringVar(&config.Store.File, "f", config.Store.File, "path to file for storage metrics")
-	flag.Parse()
-}
+	errs.Check(config.SelfMetrics.Interval >= 0, "SelfMetrics.Interval", "must not be negative")
+	errs.Check(tenant.IsValid(config.SelfMetrics.Tenant), "SelfMetrics.Tenant", "expected tenant name")
 
-func LoadConfig() Config {
-	config := newConfig()
+	errs.Check(config.Store.Interval >= 0, "Store.Interval", "must not be negative")
+	errs.Check(config.Store.Generations >= 1, "Store.Generations", "must be at least 1")
+	errs.Check(!config.Store.WAL || config.Store.File != "", "Store.WAL", "requires Store.File")
+	errs.Check(config.Store.CacheStaleness >= 0, "Store.CacheStaleness", "must not be negative")
+	errs.Check(config.Store.CacheReloadInterval >= 0, "Store.CacheReloadInterval", "must not be negative")
 
-	flagConfigPath := flag.String("c", "", "path to json config")
-	flagConfigPathAlias := flag.String("config", "", "path to json config")
+	errs.Check(!config.Cluster.Enabled || config.Cluster.LeaderInterval > 0, "Cluster.LeaderInterval", "must be positive")
 
-	config.parseFlags()
-	config.parseConfig(flagConfigPath, flagConfigPathAlias)
-	err := config.parseEnv()
-	if err != nil {
-		log.Fatal(err)
+	if len(config.Forward.Upstreams) != 0 {
+		errs.Check(config.Forward.Mode == "relay" || config.Forward.Mode == "snapshot", "Forward.Mode", "expected relay or snapshot")
+		errs.Check(config.Forward.Interval > 0, "Forward.Interval", "must be positive")
+		for _, upstream := range config.Forward.Upstreams {
+			errs.Check(isAddr(upstream), "Forward.Upstreams", fmt.Sprintf("expected host:port, got %q", upstream))
+		}
 	}
 
-	return *config
+	return errs.Err()
+}
+
+// isAddr - адрес в формате host:port, host может быть пустым (все интерфейсы).
+func isAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port != ""
 }
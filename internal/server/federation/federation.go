@@ -0,0 +1,330 @@
+// Package federation - пересылка метрик сервера на вышестоящие серверы (например, из датацентра в центральный).
+//
+// В режиме relay пересылаются все принятые обновления, в режиме snapshot - периодический срез ReadAll
+// (в режиме кластера - только с ведущего экземпляра).
+// Обновления копятся по каждому вышестоящему серверу отдельно и отправляются пакетом раз в интервал:
+// повторы ID схлопываются (для counter приращения суммируются), при ошибке отправки пакет остается в очереди.
+package federation
+
+import (
+	"context"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// TenantLabel - метка арендатора пересылаемых метрик.
+const TenantLabel = "tenant"
+
+const (
+	ModeRelay    = "relay"
+	ModeSnapshot = "snapshot"
+)
+
+var ErrUnknownMode = errors.New("unknown forward mode, expected relay or snapshot")
+
+// Uploader - отправка пакета метрик на вышестоящий сервер (metricsuploader.MetricsUplader).
+type Uploader interface {
+	UploadMetrics(metrics []metrics.Metric) error
+}
+
+// Upstream - вышестоящий сервер.
+type Upstream struct {
+	Addr     string
+	Uploader Uploader
+}
+
+type upstreamQueue struct {
+	Upstream
+	pending *pendingBatch
+}
+
+// Forwarder - пересылка метрик на вышестоящие серверы с пометкой сервера-источника.
+type Forwarder struct {
+	config    config.ForwardConfig
+	upstreams []upstreamQueue
+
+	// lastCounters - значения counter при предыдущем срезе, на вышестоящие серверы отправляется приращение.
+	// Пока baselined не установлен, срез только запоминает значения: накопленное до запуска или смены
+	// ведущего экземпляра уже отправлено
+	lastCounters map[string]int64
+	baselined    bool
+}
+
+func NewForwarder(forwardConfig config.ForwardConfig, upstreams []Upstream) (*Forwarder, error) {
+	if forwardConfig.Mode != ModeRelay && forwardConfig.Mode != ModeSnapshot {
+		return nil, ErrUnknownMode
+	}
+
+	forwarder := &Forwarder{
+		config:       forwardConfig,
+		lastCounters: map[string]int64{},
+	}
+	for _, upstream := range upstreams {
+		forwarder.upstreams = append(forwarder.upstreams, upstreamQueue{
+			Upstream: upstream,
+			pending:  newPendingBatch(),
+		})
+	}
+
+	return forwarder, nil
+}
+
+func (forwarder *Forwarder) Mode() string {
+	return forwarder.config.Mode
+}
+
+// OriginID - ID метрики с пометкой сервера-источника: префиксом "origin." или меткой.
+// Префикс арендатора ключа (team-a::cpu) становится меткой tenant: вышестоящий сервер записывает метрики
+// арендатору ключа пересылки.
+func (forwarder *Forwarder) OriginID(key string) string {
+	metricTenant, metricID := tenant.SplitKey(key)
+	if forwarder.config.Origin != "" && forwarder.config.OriginLabel == "" {
+		metricID = forwarder.config.Origin + "." + metricID
+	}
+
+	labels := map[string]string{}
+	if forwarder.config.Origin != "" && forwarder.config.OriginLabel != "" {
+		labels[forwarder.config.OriginLabel] = forwarder.config.Origin
+	}
+	if metricTenant != "" {
+		labels[TenantLabel] = metricTenant
+	}
+	if len(labels) == 0 {
+		return metricID
+	}
+
+	name, metricLabels, err := metrics.ParseMetricID(metricID)
+	if err != nil {
+		// ID с фигурными скобками не в формате меток - метки добавляются к ID целиком
+		name, metricLabels = metricID, nil
+	}
+	if metricLabels == nil {
+		metricLabels = map[string]string{}
+	}
+	for labelName, labelValue := range labels {
+		metricLabels[labelName] = labelValue
+	}
+
+	return metrics.MetricIDWithLabels(name, metricLabels)
+}
+
+// Enqueue - постановка принятых обновлений в очередь каждого вышестоящего сервера.
+func (forwarder *Forwarder) Enqueue(batch []metrics.Metric) {
+	originMetrics := make([]metrics.Metric, 0, len(batch))
+	for _, metric := range batch {
+		metric.ID = forwarder.OriginID(metric.ID)
+		originMetrics = append(originMetrics, metric)
+	}
+
+	for _, upstream := range forwarder.upstreams {
+		upstream.pending.add(originMetrics)
+	}
+}
+
+// EnqueueSnapshot - постановка в очередь среза хранилища: gauge как есть, counter - приращение с предыдущего среза.
+// Первый срез после запуска Run - базовый, counter из него не отправляются. Counter, появившийся позже,
+// отправляется целиком, уменьшение значения считается сбросом.
+func (forwarder *Forwarder) EnqueueSnapshot(allMetrics map[string]storage.MetricMap) {
+	var batch []metrics.Metric
+
+	for metricID, metricValue := range allMetrics[metrics.MeticTypeGauge] {
+		if metricValue.Value == nil {
+			continue
+		}
+		batch = append(batch, metrics.Metric{ID: metricID, MetricValue: metricValue})
+	}
+
+	for metricID, metricValue := range allMetrics[metrics.MeticTypeCounter] {
+		if metricValue.Delta == nil {
+			continue
+		}
+
+		delta := *metricValue.Delta
+		lastValue, ok := forwarder.lastCounters[metricID]
+		if ok && delta >= lastValue {
+			delta -= lastValue
+		}
+		forwarder.lastCounters[metricID] = *metricValue.Delta
+		if !forwarder.baselined || delta == 0 && ok {
+			continue
+		}
+
+		batch = append(batch, metrics.Metric{
+			ID:          metricID,
+			MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta},
+		})
+	}
+
+	forwarder.baselined = true
+	forwarder.Enqueue(batch)
+}
+
+// Flush - отправка очередей. Ошибка одного сервера не мешает отправке на остальные, возвращается последняя ошибка.
+func (forwarder *Forwarder) Flush() error {
+	var flushErr error
+
+	for _, upstream := range forwarder.upstreams {
+		metrics := upstream.pending.take()
+		if len(metrics) == 0 {
+			continue
+		}
+
+		err := upstream.Uploader.UploadMetrics(metrics)
+		if err != nil {
+			slog.Warn("Forward failed", slog.String("upstream", upstream.Addr), logging.Err(err))
+			// Более новые значения, пришедшие во время отправки, не перезаписываются
+			upstream.pending.restore(metrics)
+			flushErr = err
+		}
+	}
+
+	return flushErr
+}
+
+// Run - отправка по интервалу до отмены ctx, в режиме snapshot перед отправкой снимается срез хранилища.
+func (forwarder *Forwarder) Run(ctx context.Context, metricStorage storage.MetricStorage) {
+	// В кластере Run запускается заново при получении лидерства: значения предыдущего срока устарели
+	forwarder.lastCounters = map[string]int64{}
+	forwarder.baselined = false
+
+	ticker := time.NewTicker(forwarder.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			forwarder.Flush()
+			return
+		case <-ticker.C:
+			if forwarder.config.Mode == ModeSnapshot {
+				forwarder.EnqueueSnapshot(metricStorage.ReadAll())
+			}
+			forwarder.Flush()
+		}
+	}
+}
+
+// pendingBatch - очередь обновлений одного вышестоящего сервера.
+type pendingBatch struct {
+	mutex    *sync.Mutex
+	gauges   map[string]float64
+	counters map[string]int64
+}
+
+func newPendingBatch() *pendingBatch {
+	return &pendingBatch{
+		mutex:    &sync.Mutex{},
+		gauges:   map[string]float64{},
+		counters: map[string]int64{},
+	}
+}
+
+func (batch *pendingBatch) add(added []metrics.Metric) {
+	batch.mutex.Lock()
+	defer batch.mutex.Unlock()
+
+	for _, metric := range added {
+		switch {
+		case metric.MType == metrics.MeticTypeGauge && metric.Value != nil:
+			batch.gauges[metric.ID] = *metric.Value
+		case metric.MType == metrics.MeticTypeCounter && metric.Delta != nil:
+			batch.counters[metric.ID] += *metric.Delta
+		}
+	}
+}
+
+// restore - возврат неотправленного пакета: counter суммируются, gauge возвращаются, только если не обновились.
+func (batch *pendingBatch) restore(failed []metrics.Metric) {
+	batch.mutex.Lock()
+	defer batch.mutex.Unlock()
+
+	for _, metric := range failed {
+		if metric.MType == metrics.MeticTypeCounter {
+			batch.counters[metric.ID] += *metric.Delta
+			continue
+		}
+		if _, ok := batch.gauges[metric.ID]; !ok {
+			batch.gauges[metric.ID] = *metric.Value
+		}
+	}
+}
+
+func (batch *pendingBatch) take() []metrics.Metric {
+	batch.mutex.Lock()
+	defer batch.mutex.Unlock()
+
+	taken := make([]metrics.Metric, 0, len(batch.gauges)+len(batch.counters))
+	for metricID, value := range batch.gauges {
+		value := value
+		taken = append(taken, metrics.Metric{
+			ID:          metricID,
+			MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value},
+		})
+	}
+	for metricID, delta := range batch.counters {
+		delta := delta
+		taken = append(taken, metrics.Metric{
+			ID:          metricID,
+			MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta},
+		})
+	}
+
+	batch.gauges = map[string]float64{}
+	batch.counters = map[string]int64{}
+
+	return taken
+}
+
+// ForwardingStorage - хранилище, ставящее принятые обновления в очередь пересылки (режим relay).
+type ForwardingStorage struct {
+	storage.MetricStorage
+	forwarder *Forwarder
+}
+
+func NewForwardingStorage(metricStorage storage.MetricStorage, forwarder *Forwarder) ForwardingStorage {
+	return ForwardingStorage{
+		MetricStorage: metricStorage,
+		forwarder:     forwarder,
+	}
+}
+
+func (forwardingStorage ForwardingStorage) Update(key string, value metrics.MetricValue) error {
+	err := forwardingStorage.MetricStorage.Update(key, value)
+	if err != nil {
+		return err
+	}
+
+	forwardingStorage.forwarder.Enqueue([]metrics.Metric{{ID: key, MetricValue: value}})
+	return nil
+}
+
+func (forwardingStorage ForwardingStorage) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	err := forwardingStorage.MetricStorage.UpdateManySliceMetric(MetricBatch)
+	if err != nil {
+		return err
+	}
+
+	forwardingStorage.forwarder.Enqueue(MetricBatch)
+	return nil
+}
+
+func (forwardingStorage ForwardingStorage) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
+	err := forwardingStorage.MetricStorage.UpdateMany(DBSchema)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]metrics.Metric, 0, len(DBSchema))
+	for key, value := range DBSchema {
+		batch = append(batch, metrics.Metric{ID: key, MetricValue: value})
+	}
+	forwardingStorage.forwarder.Enqueue(batch)
+	return nil
+}
@@ -0,0 +1,176 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+type uploaderMock struct {
+	mutex   sync.Mutex
+	err     error
+	batches [][]metrics.Metric
+}
+
+func (mock *uploaderMock) UploadMetrics(metrics []metrics.Metric) error {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	if mock.err != nil {
+		return mock.err
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].ID < metrics[j].ID })
+	mock.batches = append(mock.batches, metrics)
+	return nil
+}
+
+func testForwardConfig(mode string) config.ForwardConfig {
+	return config.ForwardConfig{
+		Mode:        mode,
+		Origin:      "dc1",
+		OriginLabel: "origin",
+	}
+}
+
+func counterMetric(metricID string, delta int64) metrics.Metric {
+	return metrics.Metric{ID: metricID, MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}}
+}
+
+func gaugeMetric(metricID string, value float64) metrics.Metric {
+	return metrics.Metric{ID: metricID, MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}}
+}
+
+func TestForwarder_OriginID(t *testing.T) {
+	forwarder, err := NewForwarder(testForwardConfig(ModeRelay), nil)
+	require.NoError(t, err)
+	require.Equal(t, `Alloc{origin="dc1"}`, forwarder.OriginID("Alloc"))
+	require.Equal(t, `up{instance="host:9100",origin="dc1"}`, forwarder.OriginID(`up{instance="host:9100"}`))
+	require.Equal(t, `Alloc{origin="dc1",tenant="team-a"}`, forwarder.OriginID("team-a::Alloc"))
+
+	prefixConfig := testForwardConfig(ModeRelay)
+	prefixConfig.OriginLabel = ""
+	forwarder, err = NewForwarder(prefixConfig, nil)
+	require.NoError(t, err)
+	require.Equal(t, "dc1.Alloc", forwarder.OriginID("Alloc"))
+	require.Equal(t, `dc1.Alloc{tenant="team-a"}`, forwarder.OriginID("team-a::Alloc"))
+
+	_, err = NewForwarder(config.ForwardConfig{Mode: "broadcast"}, nil)
+	require.ErrorIs(t, err, ErrUnknownMode)
+}
+
+func TestForwarder_Relay(t *testing.T) {
+	upstream1 := &uploaderMock{}
+	upstream2 := &uploaderMock{err: errors.New("connection refused")}
+	forwarder, err := NewForwarder(testForwardConfig(ModeRelay), []Upstream{
+		{Addr: "central-1:8080", Uploader: upstream1},
+		{Addr: "central-2:8080", Uploader: upstream2},
+	})
+	require.NoError(t, err)
+
+	forwardingStorage := NewForwardingStorage(storage.NewMetricsMemoryRepo(config.StoreConfig{}), forwarder)
+	require.NoError(t, forwardingStorage.UpdateManySliceMetric([]metrics.Metric{
+		counterMetric("PollCount", 2),
+		counterMetric("PollCount", 3),
+		gaugeMetric("Alloc", 1.5),
+	}))
+	require.NoError(t, forwardingStorage.Update("Alloc", gaugeMetric("Alloc", 2.5).MetricValue))
+	// Отклоненное обновление не пересылается
+	require.Error(t, forwardingStorage.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge}))
+
+	require.Error(t, forwarder.Flush())
+
+	require.Len(t, upstream1.batches, 1)
+	require.Equal(t, `Alloc{origin="dc1"}`, upstream1.batches[0][0].ID)
+	require.EqualValues(t, 2.5, *upstream1.batches[0][0].Value)
+	require.Equal(t, `PollCount{origin="dc1"}`, upstream1.batches[0][1].ID)
+	require.EqualValues(t, 5, *upstream1.batches[0][1].Delta)
+
+	// Недоступный сервер получает накопленное после восстановления
+	require.NoError(t, forwardingStorage.Update("PollCount", counterMetric("PollCount", 1).MetricValue))
+	upstream2.err = nil
+	require.NoError(t, forwarder.Flush())
+
+	require.Len(t, upstream2.batches, 1)
+	require.EqualValues(t, 6, *upstream2.batches[0][1].Delta)
+	require.Len(t, upstream1.batches, 2)
+	require.Len(t, upstream1.batches[1], 1)
+	require.EqualValues(t, 1, *upstream1.batches[1][0].Delta)
+
+	require.NoError(t, forwarder.Flush())
+	require.Len(t, upstream1.batches, 2)
+}
+
+func TestForwarder_Snapshot(t *testing.T) {
+	upstream := &uploaderMock{}
+	forwarder, err := NewForwarder(testForwardConfig(ModeSnapshot), []Upstream{{Addr: "central:8080", Uploader: upstream}})
+	require.NoError(t, err)
+
+	repository := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	require.NoError(t, repository.UpdateManySliceMetric([]metrics.Metric{counterMetric("PollCount", 10), gaugeMetric("Alloc", 1.5)}))
+
+	// Первый срез - базовый: накопленное значение counter не отправляется
+	forwarder.EnqueueSnapshot(repository.ReadAll())
+	require.NoError(t, forwarder.Flush())
+	require.Len(t, upstream.batches[0], 1)
+	require.EqualValues(t, 1.5, *upstream.batches[0][0].Value)
+
+	// Следующий срез - только приращение counter
+	require.NoError(t, repository.Update("PollCount", counterMetric("PollCount", 4).MetricValue))
+	forwarder.EnqueueSnapshot(repository.ReadAll())
+	require.NoError(t, forwarder.Flush())
+	require.Len(t, upstream.batches, 2)
+	require.Equal(t, `PollCount{origin="dc1"}`, upstream.batches[1][1].ID)
+	require.EqualValues(t, 4, *upstream.batches[1][1].Delta)
+	require.EqualValues(t, 1.5, *upstream.batches[1][0].Value)
+
+	// Без изменений counter не отправляется
+	forwarder.EnqueueSnapshot(repository.ReadAll())
+	require.NoError(t, forwarder.Flush())
+	require.Len(t, upstream.batches[2], 1)
+}
+
+func TestForwarder_SnapshotReset(t *testing.T) {
+	upstream := &uploaderMock{}
+	forwardConfig := testForwardConfig(ModeSnapshot)
+	forwardConfig.Interval = time.Hour
+	forwarder, err := NewForwarder(forwardConfig, []Upstream{{Addr: "central:8080", Uploader: upstream}})
+	require.NoError(t, err)
+
+	repository := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	require.NoError(t, repository.UpdateManySliceMetric([]metrics.Metric{counterMetric("PollCount", 10)}))
+	forwarder.EnqueueSnapshot(repository.ReadAll())
+
+	// Значение меньше предыдущего - counter сброшен, отправляется целиком
+	require.NoError(t, repository.Delete("PollCount", metrics.MeticTypeCounter))
+	require.NoError(t, repository.Update("PollCount", counterMetric("PollCount", 3).MetricValue))
+	forwarder.EnqueueSnapshot(repository.ReadAll())
+	require.NoError(t, forwarder.Flush())
+	require.Len(t, upstream.batches, 1)
+	require.EqualValues(t, 3, *upstream.batches[0][0].Delta)
+
+	// Counter, появившийся после базового среза, отправляется целиком
+	require.NoError(t, repository.Update("Requests", counterMetric("Requests", 5).MetricValue))
+	forwarder.EnqueueSnapshot(repository.ReadAll())
+	require.NoError(t, forwarder.Flush())
+	require.Len(t, upstream.batches[1], 1)
+	require.Equal(t, `Requests{origin="dc1"}`, upstream.batches[1][0].ID)
+	require.EqualValues(t, 5, *upstream.batches[1][0].Delta)
+
+	// После смены ведущего экземпляра Run начинает с нового базового среза
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	forwarder.Run(ctx, repository)
+	require.NoError(t, repository.Update("Requests", counterMetric("Requests", 2).MetricValue))
+	forwarder.EnqueueSnapshot(repository.ReadAll())
+	require.NoError(t, forwarder.Flush())
+	require.Len(t, upstream.batches, 2)
+}
@@ -0,0 +1,215 @@
+// Package graphite - прием метрик по Graphite plaintext протоколу (path value timestamp).
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/storage"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBatchSize - максимальное количество метрик, записываемых в хранилище за раз.
+const maxBatchSize = 500
+
+var ErrInvalidLine = errors.New("invalid graphite line")
+
+// Listener - TCP сервер Graphite plaintext протокола, значения сохраняются как gauge.
+type Listener struct {
+	// storage - хранилище метрик соединения с адресом remoteAddr
+	storage   func(remoteAddr net.Addr) storage.MetricStorage
+	templates []Template
+	listener  net.Listener
+
+	connMutex *sync.Mutex
+	conns     map[net.Conn]struct{}
+	connWG    *sync.WaitGroup
+	closed    bool
+}
+
+func NewListener(storage func(remoteAddr net.Addr) storage.MetricStorage, templates []Template) *Listener {
+	return &Listener{
+		storage:   storage,
+		templates: templates,
+		connMutex: &sync.Mutex{},
+		conns:     map[net.Conn]struct{}{},
+		connWG:    &sync.WaitGroup{},
+	}
+}
+
+// ListenAndServe - запуск приема соединений в отдельной горутине.
+func (listener *Listener) ListenAndServe(addr string) error {
+	var err error
+	listener.listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go listener.serve()
+
+	return nil
+}
+
+func (listener *Listener) serve() {
+	for {
+		conn, err := listener.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("Graphite accept error", logging.Err(err))
+			continue
+		}
+
+		listener.connMutex.Lock()
+		if listener.closed {
+			listener.connMutex.Unlock()
+			conn.Close()
+			return
+		}
+		listener.conns[conn] = struct{}{}
+		listener.connWG.Add(1)
+		listener.connMutex.Unlock()
+
+		go listener.handleConn(conn)
+	}
+}
+
+// Shutdown - остановка приема соединений, прерывание чтения открытых соединений
+// и ожидание записи уже принятых метрик в хранилище.
+func (listener *Listener) Shutdown(ctx context.Context) error {
+	if listener.listener == nil {
+		return nil
+	}
+
+	err := listener.listener.Close()
+	if err != nil {
+		return err
+	}
+
+	listener.connMutex.Lock()
+	listener.closed = true
+	for conn := range listener.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	listener.connMutex.Unlock()
+
+	connsClosed := make(chan struct{})
+	go func() {
+		listener.connWG.Wait()
+		close(connsClosed)
+	}()
+
+	select {
+	case <-connsClosed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (listener *Listener) handleConn(conn net.Conn) {
+	defer func() {
+		listener.connMutex.Lock()
+		delete(listener.conns, conn)
+		listener.connMutex.Unlock()
+
+		conn.Close()
+		listener.connWG.Done()
+	}()
+
+	metricStorage := listener.storage(conn.RemoteAddr())
+	var batch []metrics.Metric
+	reader := bufio.NewReader(conn)
+	for {
+		line, readErr := reader.ReadString('\n')
+
+		line = strings.TrimSpace(line)
+		if line != "" {
+			metric, err := listener.ParseLine(line)
+			if err != nil {
+				slog.Warn("Graphite parse error", slog.String("remote", conn.RemoteAddr().String()), logging.Err(err))
+			} else {
+				batch = append(batch, metric)
+			}
+		}
+
+		// Запись накопленных метрик, когда в буфере больше нет данных или соединение закрыто
+		if len(batch) >= maxBatchSize || (len(batch) != 0 && (reader.Buffered() == 0 || readErr != nil)) {
+			err := metricStorage.UpdateManySliceMetric(batch)
+			if err != nil {
+				slog.Warn("Graphite storage error", slog.String("remote", conn.RemoteAddr().String()), logging.Err(err))
+			}
+			batch = batch[:0]
+		}
+
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) && !errors.Is(readErr, net.ErrClosed) && !isTimeout(readErr) {
+				slog.Warn("Graphite read error", slog.String("remote", conn.RemoteAddr().String()), logging.Err(readErr))
+			}
+			return
+		}
+	}
+}
+
+// ParseLine - разбор строки "path value [timestamp]" в gauge метрику.
+// Временная метка проверяется, но не сохраняется.
+func (listener *Listener) ParseLine(line string) (metrics.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return metrics.Metric{}, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return metrics.Metric{}, fmt.Errorf("%w: invalid value %q", ErrInvalidLine, fields[1])
+	}
+
+	if len(fields) == 3 && fields[2] != "-1" && fields[2] != "N" {
+		_, err = strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return metrics.Metric{}, fmt.Errorf("%w: invalid timestamp %q", ErrInvalidLine, fields[2])
+		}
+	}
+
+	return metrics.Metric{
+		ID: listener.metricID(fields[0]),
+		MetricValue: metrics.MetricValue{
+			MType: metrics.MeticTypeGauge,
+			Value: &value,
+		},
+	}, nil
+}
+
+// metricID - ID метрики по первому подходящему шаблону, без шаблона используется путь целиком.
+func (listener *Listener) metricID(path string) string {
+	pathParts := strings.Split(path, ".")
+	for _, template := range listener.templates {
+		if !template.Match(pathParts) {
+			continue
+		}
+
+		measurement, labels := template.Apply(pathParts)
+		if measurement == "" {
+			break
+		}
+		return metrics.MetricIDWithLabels(measurement, labels)
+	}
+
+	return path
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,81 @@
+package graphite
+
+import (
+	"context"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	templates, err := ParseTemplates([]string{
+		"servers.* .host.measurement*",
+		"prod.* env.measurement.region",
+	})
+	require.NoError(t, err)
+	listener := NewListener(nil, templates)
+
+	metric, err := listener.ParseLine("servers.web01.cpu.load 1.5 1700000000")
+	require.NoError(t, err)
+	require.Equal(t, `cpu.load{host="web01"}`, metric.ID)
+	require.Equal(t, metrics.MeticTypeGauge, metric.MType)
+	require.Equal(t, 1.5, *metric.Value)
+
+	metric, err = listener.ParseLine("prod.requests.eu 10")
+	require.NoError(t, err)
+	require.Equal(t, `requests{env="prod",region="eu"}`, metric.ID)
+
+	metric, err = listener.ParseLine("cron.backup.duration 42 -1")
+	require.NoError(t, err)
+	require.Equal(t, "cron.backup.duration", metric.ID)
+
+	for _, line := range []string{
+		"only.path",
+		"path.value abc 1",
+		"path.value NaN 1",
+		"path.value 1 yesterday",
+		"path.value 1 2 3",
+	} {
+		_, err = listener.ParseLine(line)
+		require.ErrorIs(t, err, ErrInvalidLine, line)
+	}
+}
+
+func TestParseTemplateInvalid(t *testing.T) {
+	_, err := ParseTemplate("host.region")
+	require.ErrorIs(t, err, ErrInvalidTemplate)
+
+	_, err = ParseTemplate("a b c")
+	require.ErrorIs(t, err, ErrInvalidTemplate)
+}
+
+func TestListener(t *testing.T) {
+	metricsRepo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	listener := NewListener(func(net.Addr) storage.MetricStorage { return metricsRepo }, nil)
+	require.NoError(t, listener.ListenAndServe("127.0.0.1:0"))
+
+	conn, err := net.Dial("tcp", listener.listener.Addr().String())
+	require.NoError(t, err)
+	_, err = fmt.Fprint(conn, "cron.jobs.done 3 1700000000\ninvalid line here now\ncron.jobs.failed 1 1700000000\n")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, err := metricsRepo.Read("cron.jobs.failed", metrics.MeticTypeGauge)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	metricValue, err := metricsRepo.Read("cron.jobs.done", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, 3.0, *metricValue.Value)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, listener.Shutdown(ctx))
+	require.NoError(t, conn.Close())
+}
@@ -0,0 +1,107 @@
+package graphite
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	templateMeasurement     = "measurement"
+	templateMeasurementTail = "measurement*"
+)
+
+var ErrInvalidTemplate = errors.New("invalid graphite template")
+
+// Template - шаблон извлечения имени метрики и меток из пути Graphite.
+//
+// Формат: "[filter] template", например "servers.* .host.measurement*".
+// Части шаблона соответствуют частям пути через точку: measurement - часть имени метрики,
+// measurement* - имя метрики из всех оставшихся частей, пустая часть - пропуск,
+// любое другое значение - имя метки.
+type Template struct {
+	filter []string
+	parts  []string
+}
+
+func ParseTemplate(rawTemplate string) (Template, error) {
+	var template Template
+
+	fields := strings.Fields(rawTemplate)
+	switch len(fields) {
+	case 1:
+		template.parts = strings.Split(fields[0], ".")
+	case 2:
+		template.filter = strings.Split(fields[0], ".")
+		template.parts = strings.Split(fields[1], ".")
+	default:
+		return template, ErrInvalidTemplate
+	}
+
+	hasMeasurement := false
+	for _, part := range template.parts {
+		if part == templateMeasurement || part == templateMeasurementTail {
+			hasMeasurement = true
+		}
+	}
+	if !hasMeasurement {
+		return template, ErrInvalidTemplate
+	}
+
+	return template, nil
+}
+
+func ParseTemplates(rawTemplates []string) ([]Template, error) {
+	templates := make([]Template, 0, len(rawTemplates))
+	for _, rawTemplate := range rawTemplates {
+		if strings.TrimSpace(rawTemplate) == "" {
+			continue
+		}
+
+		template, err := ParseTemplate(rawTemplate)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+
+	return templates, nil
+}
+
+// Match - проверка пути фильтром шаблона (* - любая часть пути).
+func (template Template) Match(pathParts []string) bool {
+	if len(template.filter) > len(pathParts) {
+		return false
+	}
+
+	for i, filterPart := range template.filter {
+		if filterPart != "*" && filterPart != pathParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Apply - получение имени метрики и меток из частей пути.
+func (template Template) Apply(pathParts []string) (string, map[string]string) {
+	var measurement []string
+	labels := map[string]string{}
+
+	for i, part := range template.parts {
+		if i >= len(pathParts) {
+			break
+		}
+
+		switch part {
+		case "":
+		case templateMeasurement:
+			measurement = append(measurement, pathParts[i])
+		case templateMeasurementTail:
+			measurement = append(measurement, pathParts[i:]...)
+		default:
+			labels[part] = pathParts[i]
+		}
+	}
+
+	return strings.Join(measurement, "."), labels
+}
@@ -0,0 +1,142 @@
+package grpc
+
+import (
+	"context"
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/server/agents"
+	"devops-tpl/internal/server/tenant"
+	pb "devops-tpl/proto"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// agentConfigCheckInterval - интервал проверки конфигурации агента в потоке WatchAgentConfig: изменения
+// профилей и меток агента доходят до агента не позже этого интервала.
+const agentConfigCheckInterval = 5 * time.Second
+
+// peerAddress - адрес клиента вызова.
+func peerAddress(ctx context.Context) string {
+	if clientPeer, ok := peer.FromContext(ctx); ok {
+		return clientPeer.Addr.String()
+	}
+
+	return ""
+}
+
+// agentError - статус ошибки реестра агентов: незарегистрированный агент - NotFound, неверные сведения - InvalidArgument.
+func agentError(err error) error {
+	switch {
+	case errors.Is(err, agents.ErrUnknownAgent):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, agentapi.ErrInvalidAgent):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (s *MetricsService) RegisterAgent(ctx context.Context, in *pb.AgentInfo) (*pb.Empty, error) {
+	info := agentapi.Info{
+		ID:       in.Id,
+		Hostname: in.Hostname,
+		Version:  in.Version,
+		Config:   in.Config,
+		Labels:   in.Labels,
+	}
+
+	err := s.registry.Register(tenant.FromContext(ctx), info, peerAddress(ctx))
+	if err != nil {
+		return nil, agentError(err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (s *MetricsService) AgentHeartbeat(ctx context.Context, in *pb.AgentHeartbeatRequest) (*pb.Empty, error) {
+	err := s.registry.Heartbeat(tenant.FromContext(ctx), in.Id, peerAddress(ctx))
+	if err != nil {
+		return nil, agentError(err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (s *MetricsService) ListAgents(ctx context.Context, _ *pb.Empty) (*pb.ListAgentsResponse, error) {
+	list := s.registry.List(tenant.FromContext(ctx))
+
+	response := &pb.ListAgentsResponse{Agents: make([]*pb.AgentStatus, 0, len(list))}
+	for _, agent := range list {
+		response.Agents = append(response.Agents, &pb.AgentStatus{
+			Info: &pb.AgentInfo{
+				Id:       agent.ID,
+				Hostname: agent.Hostname,
+				Version:  agent.Version,
+				Config:   agent.Config,
+				Labels:   agent.Labels,
+			},
+			Tenant:       agent.Tenant,
+			Address:      agent.Address,
+			RegisteredAt: agent.RegisteredAt.UnixMilli(),
+			LastSeen:     agent.LastSeen.UnixMilli(),
+			Status:       agent.Status,
+		})
+	}
+
+	return response, nil
+}
+
+// toProtoAssignment - конфигурация агента в сообщение gRPC.
+func toProtoAssignment(assignment agentapi.Assignment) *pb.AgentConfigAssignment {
+	return &pb.AgentConfigAssignment{
+		Profile: assignment.Profile,
+		Version: assignment.Version,
+		Config: &pb.AgentRemoteConfig{
+			PollInterval:   assignment.Config.PollInterval,
+			ReportInterval: assignment.Config.ReportInterval,
+			RateLimit:      int64(assignment.Config.RateLimit),
+			Collectors:     assignment.Config.Collectors,
+			Include:        assignment.Config.Include,
+			Exclude:        assignment.Config.Exclude,
+			Labels:         assignment.Config.Labels,
+		},
+	}
+}
+
+// WatchAgentConfig - поток конфигурации агента: текущая конфигурация, если ее версия отличается от версии
+// агента, затем каждое изменение. Незарегистрированный агент - NotFound, поток завершается и в случае
+// удаления агента из реестра.
+func (s *MetricsService) WatchAgentConfig(in *pb.AgentConfigRequest, stream pb.Metrics_WatchAgentConfigServer) error {
+	tenantName := tenant.FromContext(stream.Context())
+	version := in.Version
+
+	ticker := time.NewTicker(agentConfigCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		agent, err := s.registry.Get(tenantName, in.Id)
+		if err != nil {
+			return agentError(err)
+		}
+
+		assignment := s.profiles().Select(agent.Labels)
+		if assignment.Version != version {
+			err = stream.Send(toProtoAssignment(assignment))
+			if err != nil {
+				return err
+			}
+			version = assignment.Version
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.registry.Done():
+			return status.Errorf(codes.Unavailable, "server is stopping")
+		case <-ticker.C:
+		}
+	}
+}
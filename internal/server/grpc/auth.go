@@ -0,0 +1,128 @@
+package grpc
+
+import (
+	"context"
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/selfmetrics"
+	"devops-tpl/internal/server/tenant"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// methodScopes - область доступа методов gRPC, методы без области доступны без токена.
+// Неизвестные методы требуют ScopeAdmin.
+var methodScopes = map[string]string{
+	"/metrics.Metrics/UpdateMetrics":                                  auth.ScopeWrite,
+	"/metrics.Metrics/ListMetrics":                                    auth.ScopeRead,
+	"/metrics.Metrics/GetMetric":                                      auth.ScopeRead,
+	"/metrics.Metrics/WatchMetrics":                                   auth.ScopeRead,
+	"/metrics.Metrics/DeleteMetric":                                   auth.ScopeAdmin,
+	"/metrics.Metrics/Ping":                                           "",
+	"/metrics.Metrics/RegisterAgent":                                  auth.ScopeWrite,
+	"/metrics.Metrics/AgentHeartbeat":                                 auth.ScopeWrite,
+	"/metrics.Metrics/ListAgents":                                     auth.ScopeRead,
+	"/metrics.Metrics/WatchAgentConfig":                               auth.ScopeWrite,
+	"/opentelemetry.proto.collector.metrics.v1.MetricsService/Export": auth.ScopeWrite,
+}
+
+// tenantMetadataKey - ключ метаданных выбора арендатора (заголовок X-Tenant HTTP).
+var tenantMetadataKey = strings.ToLower(auth.TenantHeader)
+
+// AuthInterceptor - проверка API токена вызовов gRPC по текущему набору ключей, без набора (nil) проверки нет.
+// Ключ и арендатор вызова передаются обработчикам в контексте (auth.KeyFromContext, tenant.FromContext).
+type AuthInterceptor struct {
+	keySet func() *auth.KeySet
+}
+
+func NewAuthInterceptor(keySet func() *auth.KeySet) *AuthInterceptor {
+	return &AuthInterceptor{keySet: keySet}
+}
+
+// authorize - контекст вызова с арендатором или ошибка Unauthenticated, PermissionDenied, InvalidArgument.
+func (interceptor *AuthInterceptor) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	scope, ok := methodScopes[fullMethod]
+	if !ok {
+		scope = auth.ScopeAdmin
+	}
+
+	var token, requestedTenant string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) != 0 {
+			token = auth.BearerToken(values[0])
+		}
+		if values := md.Get(tenantMetadataKey); len(values) != 0 {
+			requestedTenant = values[0]
+		}
+	}
+
+	key := auth.Anonymous
+	var err error
+	if keySet := interceptor.keySet(); keySet != nil && scope != "" {
+		key, err = keySet.Check(token, scope)
+	}
+	var tenantName string
+	if err == nil {
+		tenantName, err = auth.RequestTenant(key, requestedTenant)
+	}
+	if err == nil {
+		return tenant.WithTenant(auth.WithKey(ctx, key), tenantName), nil
+	}
+
+	var remote string
+	if clientPeer, ok := peer.FromContext(ctx); ok {
+		remote = clientPeer.Addr.String()
+	}
+	selfmetrics.Reject(ctx, selfmetrics.RejectAuth)
+	auth.Audit(ctx, auth.Rejection{
+		Protocol: "grpc",
+		Method:   fullMethod,
+		Remote:   remote,
+		Tenant:   requestedTenant,
+		Key:      key.Name,
+		Scope:    scope,
+		Err:      err,
+	})
+
+	switch {
+	case errors.Is(err, auth.ErrInvalidTenant):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+}
+
+func (interceptor *AuthInterceptor) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := interceptor.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (interceptor *AuthInterceptor) Stream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := interceptor.authorize(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, tenantStream{ServerStream: stream, ctx: ctx})
+}
+
+// tenantStream - поток вызова с контекстом, содержащим арендатора (и отметки selfmetrics).
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream tenantStream) Context() context.Context {
+	return stream.ctx
+}
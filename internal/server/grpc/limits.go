@@ -0,0 +1,41 @@
+package grpc
+
+import (
+	"context"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/limits"
+	"devops-tpl/internal/server/selfmetrics"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LimitInterceptor - проверка частоты вызовов записи клиента (ключ из AuthInterceptor или IP адрес),
+// клиент передается обработчикам в контексте (limits.ClientFromContext). Отклоненные вызовы - ResourceExhausted.
+type LimitInterceptor struct {
+	limiter *limits.Limiter
+}
+
+func NewLimitInterceptor(limiter *limits.Limiter) *LimitInterceptor {
+	return &LimitInterceptor{limiter: limiter}
+}
+
+func (interceptor *LimitInterceptor) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if methodScopes[info.FullMethod] != auth.ScopeWrite {
+		return handler(ctx, req)
+	}
+
+	client := limits.ClientID(auth.KeyFromContext(ctx), peerAddress(ctx))
+
+	err := interceptor.limiter.AllowRequest(client)
+	if err != nil {
+		slog.Warn("Limits rejected", slog.String("method", info.FullMethod), logging.Err(err))
+		selfmetrics.Reject(ctx, selfmetrics.RejectLimit)
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	return handler(limits.WithClient(ctx, client), req)
+}
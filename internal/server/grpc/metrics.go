@@ -2,26 +2,77 @@ package grpc
 
 import (
 	"context"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/agents"
+	"devops-tpl/internal/server/limits"
 	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
+	"devops-tpl/internal/server/watch"
 	pb "devops-tpl/proto"
+	"errors"
 	"github.com/asaskevich/govalidator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// MetricsService - сервис metrics.Metrics, вызовы работают с хранилищем арендатора из контекста (AuthInterceptor)
+// с ограничениями клиента (LimitInterceptor).
 type MetricsService struct {
-	storage storage.MetricStorage
+	tenants  *storage.Tenants
+	limiter  *limits.Limiter
+	registry *agents.Registry
+	// profiles - текущие профили конфигурации агентов
+	profiles func() *agents.Profiles
+	hub      *watch.Hub
 	pb.UnimplementedMetricsServer
 }
 
-func NewMetricsService(storage storage.MetricStorage) *MetricsService {
+func NewMetricsService(tenants *storage.Tenants, limiter *limits.Limiter, registry *agents.Registry,
+	profiles func() *agents.Profiles, hub *watch.Hub) *MetricsService {
 	return &MetricsService{
-		storage: storage,
+		tenants:  tenants,
+		limiter:  limiter,
+		registry: registry,
+		profiles: profiles,
+		hub:      hub,
 	}
 }
 
+// storage - хранилище арендатора вызова.
+func (s *MetricsService) storage(ctx context.Context) storage.MetricStorage {
+	return tenantStorage(ctx, s.tenants, s.limiter)
+}
+
+// tenantStorage - хранилище арендатора вызова с проверкой ограничений записи клиента.
+func tenantStorage(ctx context.Context, tenants *storage.Tenants, limiter *limits.Limiter) storage.MetricStorage {
+	tenantName := tenant.FromContext(ctx)
+	return limiter.For(limits.ClientFromContext(ctx), tenantName, tenants.For(tenantName))
+}
+
+// updateError - статус ошибки записи: превышение квоты или ограничения клиента - ResourceExhausted,
+// ID с префиксом арендатора - InvalidArgument.
+func updateError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrQuotaExceeded), errors.Is(err, limits.ErrLimitExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, storage.ErrTenantPrefix):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// toProtoMetric - метрика хранилища в сообщение gRPC.
+func toProtoMetric(metric metrics.Metric) *pb.Metric {
+	if metric.MType == metrics.MeticTypeCounter {
+		return &pb.Metric{Metric: &pb.Metric_Counter{Counter: &pb.MetricCounter{Id: metric.ID, Delta: *metric.Delta}}}
+	}
+
+	return &pb.Metric{Metric: &pb.Metric_Gauge{Gauge: &pb.MetricGauge{Id: metric.ID, Value: *metric.Value}}}
+}
+
 func (s *MetricsService) UpdateMetrics(ctx context.Context, in *pb.UpdateMetricsRequest) (*pb.Empty, error) {
-	var MetricBatch []storage.Metric
+	var MetricBatch []metrics.Metric
 
 	if len(in.Metrics) == 0 {
 		return nil, status.Errorf(codes.OutOfRange, "empty metric list")
@@ -30,18 +81,18 @@ func (s *MetricsService) UpdateMetrics(ctx context.Context, in *pb.UpdateMetrics
 	for _, metric := range in.Metrics {
 		switch metricOne := metric.Metric.(type) {
 		case *pb.Metric_Gauge:
-			MetricBatch = append(MetricBatch, storage.Metric{
+			MetricBatch = append(MetricBatch, metrics.Metric{
 				ID: metricOne.Gauge.Id,
-				MetricValue: storage.MetricValue{
-					MType: storage.MeticTypeGauge,
+				MetricValue: metrics.MetricValue{
+					MType: metrics.MeticTypeGauge,
 					Value: &metricOne.Gauge.Value,
 				},
 			})
 		case *pb.Metric_Counter:
-			MetricBatch = append(MetricBatch, storage.Metric{
+			MetricBatch = append(MetricBatch, metrics.Metric{
 				ID: metricOne.Counter.Id,
-				MetricValue: storage.MetricValue{
-					MType: storage.MeticTypeCounter,
+				MetricValue: metrics.MetricValue{
+					MType: metrics.MeticTypeCounter,
 					Delta: &metricOne.Counter.Delta,
 				},
 			})
@@ -59,9 +110,84 @@ func (s *MetricsService) UpdateMetrics(ctx context.Context, in *pb.UpdateMetrics
 		}
 	}
 
-	err = s.storage.UpdateManySliceMetric(MetricBatch)
+	err = s.storage(ctx).UpdateManySliceMetric(MetricBatch)
+	if err != nil {
+		return nil, updateError(err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (s *MetricsService) ListMetrics(ctx context.Context, in *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	metrics := storage.SortedMetrics(s.storage(ctx).ReadAll(), in.Search)
+
+	response := &pb.ListMetricsResponse{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for _, metric := range metrics {
+		response.Metrics = append(response.Metrics, toProtoMetric(metric))
+	}
+
+	return response, nil
+}
+
+func (s *MetricsService) GetMetric(ctx context.Context, in *pb.MetricRequest) (*pb.Metric, error) {
+	if in.Type != metrics.MeticTypeGauge && in.Type != metrics.MeticTypeCounter {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metric type")
+	}
+
+	metricValue, err := s.storage(ctx).Read(in.Id, in.Type)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "unknown metric %s", in.Id)
+	}
+	metricValue.MType = in.Type
+
+	return toProtoMetric(metrics.Metric{ID: in.Id, MetricValue: metricValue}), nil
+}
+
+func (s *MetricsService) DeleteMetric(ctx context.Context, in *pb.MetricRequest) (*pb.Empty, error) {
+	if in.Type != metrics.MeticTypeGauge && in.Type != metrics.MeticTypeCounter {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metric type")
+	}
+
+	err := s.storage(ctx).Delete(in.Id, in.Type)
+	if errors.Is(err, storage.ErrMetricNotFound) {
+		return nil, status.Errorf(codes.NotFound, "unknown metric %s", in.Id)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.Empty{}, nil
+}
+
+// WatchMetrics - поток принятых обновлений до отключения клиента или остановки сервера.
+func (s *MetricsService) WatchMetrics(in *pb.ListMetricsRequest, stream pb.Metrics_WatchMetricsServer) error {
+	if s.hub == nil {
+		return status.Errorf(codes.Unimplemented, "watch is not enabled")
+	}
+
+	subscription := s.hub.Subscribe(tenant.FromContext(stream.Context()), in.Search)
+	defer subscription.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case metric, ok := <-subscription.Updates():
+			if !ok {
+				return status.Errorf(codes.Unavailable, "server is stopping")
+			}
+			err := stream.Send(toProtoMetric(metric))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *MetricsService) Ping(ctx context.Context, in *pb.Empty) (*pb.Empty, error) {
+	err := s.storage(ctx).Ping()
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, status.Errorf(codes.Unavailable, err.Error())
 	}
 
 	return &pb.Empty{}, nil
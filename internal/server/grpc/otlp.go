@@ -0,0 +1,36 @@
+package grpc
+
+import (
+	"context"
+	"devops-tpl/internal/server/limits"
+	"devops-tpl/internal/server/otlp"
+	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+)
+
+// OTLPMetricsService - OTLP/gRPC приемник метрик, метрики записываются арендатору вызова.
+type OTLPMetricsService struct {
+	receivers *otlp.Receivers
+	tenants   *storage.Tenants
+	limiter   *limits.Limiter
+	colmetricspb.UnimplementedMetricsServiceServer
+}
+
+func NewOTLPMetricsService(receivers *otlp.Receivers, tenants *storage.Tenants, limiter *limits.Limiter) *OTLPMetricsService {
+	return &OTLPMetricsService{
+		receivers: receivers,
+		tenants:   tenants,
+		limiter:   limiter,
+	}
+}
+
+func (s *OTLPMetricsService) Export(ctx context.Context, in *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	rejected, err := s.receivers.For(tenant.FromContext(ctx)).Consume(tenantStorage(ctx, s.tenants, s.limiter), in)
+	if err != nil {
+		return nil, updateError(err)
+	}
+
+	return otlp.Response(rejected), nil
+}
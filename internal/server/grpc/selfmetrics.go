@@ -0,0 +1,50 @@
+package grpc
+
+import (
+	"context"
+	"devops-tpl/internal/server/selfmetrics"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// SelfMetricsInterceptor - учет вызовов gRPC в метриках сервера по методу и коду ответа, а также вызовов,
+// отклоненных следующими перехватчиками (selfmetrics.Reject). Должен быть первым в цепочке.
+type SelfMetricsInterceptor struct {
+	registry *selfmetrics.Registry
+}
+
+func NewSelfMetricsInterceptor(registry *selfmetrics.Registry) *SelfMetricsInterceptor {
+	return &SelfMetricsInterceptor{registry: registry}
+}
+
+func (interceptor *SelfMetricsInterceptor) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx, rejected := selfmetrics.NewRequest(ctx)
+
+	resp, err := handler(ctx, req)
+	interceptor.observe(info.FullMethod, start, err, rejected())
+
+	return resp, err
+}
+
+func (interceptor *SelfMetricsInterceptor) Stream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, rejected := selfmetrics.NewRequest(stream.Context())
+
+	err := handler(srv, tenantStream{ServerStream: stream, ctx: ctx})
+	interceptor.observe(info.FullMethod, start, err, rejected())
+
+	return err
+}
+
+// observe - учет вызова method, начатого в start и завершенного с ошибкой err.
+func (interceptor *SelfMetricsInterceptor) observe(method string, start time.Time, err error, rejected string) {
+	registry := interceptor.registry
+	registry.Add(selfmetrics.GRPCRequests, map[string]string{"method": method, "code": status.Code(err).String()}, 1)
+	registry.Add(selfmetrics.GRPCRequestDuration, map[string]string{"method": method}, selfmetrics.DurationMicroseconds(start))
+	if rejected != "" {
+		registry.Add(selfmetrics.GRPCRejected, map[string]string{"reason": rejected}, 1)
+	}
+}
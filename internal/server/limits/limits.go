@@ -0,0 +1,412 @@
+// Package limits - ограничения приема метрик от клиентов: частота запросов записи и метрик (token bucket),
+// количество рядов клиента и всего сервера, длина и символы имени метрики.
+//
+// Клиент - имя API ключа, без аутентификации - IP адрес (ClientID). Ряд - метрика одного типа с полным ключом
+// хранилища (с арендатором и метками). Существующие метрики хранилища входят в общее количество рядов
+// при первой записи с включенным ограничением, но не принадлежат клиентам: ряды клиентов учитываются
+// с запуска сервера. Записи других экземпляров сервера над той же БД не учитываются.
+package limits
+
+import (
+	"context"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// clientIdleTimeout - время без запросов, после которого состояние клиента без рядов удаляется.
+const clientIdleTimeout = 10 * time.Minute
+
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Error - нарушение ограничения с объяснением, RetryAfter - время до повтора для ограничений частоты.
+type Error struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (err *Error) Error() string {
+	if err.RetryAfter > 0 {
+		return fmt.Sprintf("%v: %s, retry after %v", ErrLimitExceeded, err.Reason, err.RetryAfter.Round(time.Millisecond))
+	}
+
+	return fmt.Sprintf("%v: %s", ErrLimitExceeded, err.Reason)
+}
+
+func (err *Error) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// RetryAfter - время до повтора запроса, отклоненного ограничением частоты, 0 - повтор не поможет.
+func RetryAfter(err error) time.Duration {
+	var limitErr *Error
+	if errors.As(err, &limitErr) {
+		return limitErr.RetryAfter
+	}
+
+	return 0
+}
+
+// ClientID - клиент запроса: имя API ключа key, для анонимных запросов - IP адрес remoteAddr (host:port).
+func ClientID(key auth.Key, remoteAddr string) string {
+	if key.Name != "" && key.Name != auth.Anonymous.Name {
+		return "key:" + key.Name
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	return "ip:" + host
+}
+
+type clientContextKey struct{}
+
+// WithClient - контекст запроса клиента client.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, client)
+}
+
+// ClientFromContext - клиент запроса, пустая строка, если не задан.
+func ClientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(clientContextKey{}).(string)
+	return client
+}
+
+// bucket - token bucket: запас пополняется со скоростью rate до burst.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take - списание n токенов. Если запаса нет - время до его пополнения, -1 - n больше burst.
+func (bucket *bucket) take(n int, rate float64, burst int, now time.Time) (time.Duration, bool) {
+	if rate <= 0 {
+		return 0, true
+	}
+	burst = burstSize(rate, burst)
+	if n > burst {
+		return -1, false
+	}
+
+	if bucket.last.IsZero() {
+		bucket.tokens = float64(burst)
+	} else {
+		bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	}
+	bucket.last = now
+
+	if bucket.tokens < float64(n) {
+		return time.Duration((float64(n) - bucket.tokens) / rate * float64(time.Second)), false
+	}
+	bucket.tokens -= float64(n)
+
+	return 0, true
+}
+
+// client - состояние клиента.
+type client struct {
+	requests bucket
+	metrics  bucket
+	series   int
+	lastSeen time.Time
+}
+
+// series - ряд в учете.
+type series struct {
+	mType string
+	key   string
+}
+
+// Limiter - проверка ограничений приема, настройки читаются при каждой проверке и меняются без перезапуска.
+type Limiter struct {
+	config  func() config.LimitsConfig
+	storage storage.MetricStorage
+	now     func() time.Time
+
+	mutex     *sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+	// series - ряды с клиентом, создавшим ряд (пустая строка - ряд загружен из хранилища), nil - ряды не учитываются
+	series map[series]string
+
+	namePattern string
+	nameRegexp  *regexp.Regexp
+}
+
+func NewLimiter(config func() config.LimitsConfig) *Limiter {
+	return &Limiter{
+		config:  config,
+		now:     time.Now,
+		mutex:   &sync.Mutex{},
+		clients: map[string]*client{},
+	}
+}
+
+// SetStorage - общее хранилище, из которого загружаются существующие ряды, задается до приема метрик.
+func (limiter *Limiter) SetStorage(storage storage.MetricStorage) {
+	limiter.storage = storage
+}
+
+// client - состояние клиента name, заодно удаляет состояния давно неактивных клиентов без рядов.
+func (limiter *Limiter) client(name string, now time.Time) *client {
+	if now.Sub(limiter.lastSweep) > clientIdleTimeout {
+		for clientName, state := range limiter.clients {
+			if state.series == 0 && now.Sub(state.lastSeen) > clientIdleTimeout {
+				delete(limiter.clients, clientName)
+			}
+		}
+		limiter.lastSweep = now
+	}
+
+	state, ok := limiter.clients[name]
+	if !ok {
+		state = &client{}
+		limiter.clients[name] = state
+	}
+	state.lastSeen = now
+
+	return state
+}
+
+// AllowRequest - проверка частоты запросов записи клиента.
+func (limiter *Limiter) AllowRequest(clientName string) error {
+	limits := limiter.config()
+	if limits.RequestRate <= 0 {
+		return nil
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	retryAfter, ok := limiter.client(clientName, now).requests.take(1, limits.RequestRate, limits.RequestBurst, now)
+	if !ok {
+		return &Error{
+			Reason:     fmt.Sprintf("client %s is limited to %g write requests per second", clientName, limits.RequestRate),
+			RetryAfter: retryAfter,
+		}
+	}
+
+	return nil
+}
+
+// checkName - проверка длины ID метрики и символов имени без меток.
+func (limiter *Limiter) checkName(limits config.LimitsConfig, metricID string) error {
+	if limits.MaxNameLength > 0 && len(metricID) > limits.MaxNameLength {
+		return &Error{Reason: fmt.Sprintf("metric id %.32q... is %d bytes long, limit is %d", metricID, len(metricID), limits.MaxNameLength)}
+	}
+
+	if limits.NamePattern == "" {
+		return nil
+	}
+	if limits.NamePattern != limiter.namePattern {
+		nameRegexp, err := regexp.Compile(limits.NamePattern)
+		if err != nil {
+			return err
+		}
+		limiter.namePattern, limiter.nameRegexp = limits.NamePattern, nameRegexp
+	}
+
+	name, _, err := metrics.ParseMetricID(metricID)
+	if err != nil {
+		name = metricID
+	}
+	if !limiter.nameRegexp.MatchString(name) {
+		return &Error{Reason: fmt.Sprintf("metric name %q does not match %s", name, limits.NamePattern)}
+	}
+
+	return nil
+}
+
+// loadSeries - ряды общего хранилища, загружаются один раз при первом включенном ограничении количества.
+func (limiter *Limiter) loadSeries() {
+	if limiter.series != nil {
+		return
+	}
+
+	limiter.series = map[series]string{}
+	if limiter.storage == nil {
+		return
+	}
+	for metricType, metricMap := range limiter.storage.ReadAll() {
+		for key := range metricMap {
+			limiter.series[series{mType: metricType, key: key}] = ""
+		}
+	}
+}
+
+// admit - проверка пакета метрик клиента с полными ключами хранилища и учет новых рядов.
+// Возвращает новые ряды, которые нужно вернуть (release), если запись не удалась.
+func (limiter *Limiter) admit(clientName string, batch []metrics.Metric, keys []string) ([]series, error) {
+	limits := limiter.config()
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	for _, metric := range batch {
+		err := limiter.checkName(limits, metric.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := limiter.now()
+	state := limiter.client(clientName, now)
+
+	var newSeries []series
+	if limits.MaxSeries > 0 || limits.MaxClientSeries > 0 || limiter.series != nil {
+		limiter.loadSeries()
+
+		batchSeries := map[series]struct{}{}
+		for i, metric := range batch {
+			metricSeries := series{mType: metric.MType, key: keys[i]}
+			if _, ok := limiter.series[metricSeries]; ok {
+				continue
+			}
+			if _, ok := batchSeries[metricSeries]; !ok {
+				batchSeries[metricSeries] = struct{}{}
+				newSeries = append(newSeries, metricSeries)
+			}
+		}
+
+		if len(newSeries) != 0 && limits.MaxClientSeries > 0 && state.series+len(newSeries) > limits.MaxClientSeries {
+			return nil, &Error{Reason: fmt.Sprintf("client %s is limited to %d series, created %d, new in request %d",
+				clientName, limits.MaxClientSeries, state.series, len(newSeries))}
+		}
+		if len(newSeries) != 0 && limits.MaxSeries > 0 && len(limiter.series)+len(newSeries) > limits.MaxSeries {
+			return nil, &Error{Reason: fmt.Sprintf("server is limited to %d series, stored %d, new in request %d",
+				limits.MaxSeries, len(limiter.series), len(newSeries))}
+		}
+	}
+
+	retryAfter, ok := state.metrics.take(len(batch), limits.MetricRate, limits.MetricBurst, now)
+	if !ok {
+		if retryAfter < 0 {
+			return nil, &Error{Reason: fmt.Sprintf("request has %d metrics, client %s is limited to %d metrics at once",
+				len(batch), clientName, burstSize(limits.MetricRate, limits.MetricBurst))}
+		}
+		return nil, &Error{
+			Reason:     fmt.Sprintf("client %s is limited to %g metrics per second", clientName, limits.MetricRate),
+			RetryAfter: retryAfter,
+		}
+	}
+
+	for _, metricSeries := range newSeries {
+		limiter.series[metricSeries] = clientName
+	}
+	state.series += len(newSeries)
+
+	return newSeries, nil
+}
+
+// release - удаление рядов из учета (метрика удалена или не записана).
+func (limiter *Limiter) release(releasedSeries ...series) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	for _, metricSeries := range releasedSeries {
+		clientName, ok := limiter.series[metricSeries]
+		if !ok {
+			continue
+		}
+		delete(limiter.series, metricSeries)
+
+		if state, ok := limiter.clients[clientName]; ok && clientName != "" {
+			state.series--
+		}
+	}
+}
+
+// burstSize - запас token bucket: burst или, если не задан, rate.
+func burstSize(rate float64, burst int) int {
+	if burst <= 0 {
+		return int(math.Max(1, math.Ceil(rate)))
+	}
+
+	return burst
+}
+
+// For - хранилище repository арендатора tenantName (storage.Tenants.For) с проверкой ограничений записи клиента.
+func (limiter *Limiter) For(clientName string, tenantName string, repository storage.MetricStorage) storage.MetricStorage {
+	return Repo{
+		MetricStorage: repository,
+		limiter:       limiter,
+		client:        clientName,
+		tenant:        tenantName,
+	}
+}
+
+// Repo - хранилище с проверкой ограничений записи клиента.
+type Repo struct {
+	storage.MetricStorage
+	limiter *Limiter
+	client  string
+	tenant  string
+}
+
+// key - полный ключ хранилища для ID метрики арендатора.
+func (repository Repo) key(metricID string) string {
+	if repository.tenant == tenant.All {
+		return metricID
+	}
+
+	return tenant.Key(repository.tenant, metricID)
+}
+
+func (repository Repo) Update(key string, value metrics.MetricValue) error {
+	return repository.UpdateManySliceMetric([]metrics.Metric{{ID: key, MetricValue: value}})
+}
+
+func (repository Repo) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	keys := make([]string, 0, len(MetricBatch))
+	for _, metric := range MetricBatch {
+		keys = append(keys, repository.key(metric.ID))
+	}
+
+	newSeries, err := repository.limiter.admit(repository.client, MetricBatch, keys)
+	if err != nil {
+		return err
+	}
+
+	if len(MetricBatch) == 1 {
+		err = repository.MetricStorage.Update(MetricBatch[0].ID, MetricBatch[0].MetricValue)
+	} else {
+		err = repository.MetricStorage.UpdateManySliceMetric(MetricBatch)
+	}
+	if err != nil {
+		repository.limiter.release(newSeries...)
+		return err
+	}
+
+	return nil
+}
+
+func (repository Repo) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
+	MetricBatch := make([]metrics.Metric, 0, len(DBSchema))
+	for metricID, metricValue := range DBSchema {
+		MetricBatch = append(MetricBatch, metrics.Metric{ID: metricID, MetricValue: metricValue})
+	}
+
+	return repository.UpdateManySliceMetric(MetricBatch)
+}
+
+func (repository Repo) Delete(key string, metricType string) error {
+	err := repository.MetricStorage.Delete(key, metricType)
+	if err != nil {
+		return err
+	}
+	repository.limiter.release(series{mType: metricType, key: repository.key(key)})
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package limits
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func gaugeMetric(id string) metrics.Metric {
+	value := 1.0
+	return metrics.Metric{ID: id, MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}}
+}
+
+// newTestLimiter - ограничения limits над хранилищем в памяти с управляемым временем.
+func newTestLimiter(limits config.LimitsConfig) (*Limiter, storage.MetricStorage, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	metricsRepo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+
+	limiter := NewLimiter(func() config.LimitsConfig { return limits })
+	limiter.SetStorage(metricsRepo)
+	limiter.now = func() time.Time { return now }
+
+	return limiter, metricsRepo, &now
+}
+
+func TestLimiter_RequestRate(t *testing.T) {
+	limiter, _, now := newTestLimiter(config.LimitsConfig{RequestRate: 2, RequestBurst: 3})
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.AllowRequest("key:agent"))
+	}
+	err := limiter.AllowRequest("key:agent")
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	require.Equal(t, 500*time.Millisecond, RetryAfter(err))
+
+	// Запас других клиентов не расходуется
+	require.NoError(t, limiter.AllowRequest("key:other"))
+
+	*now = now.Add(time.Second)
+	require.NoError(t, limiter.AllowRequest("key:agent"))
+	require.NoError(t, limiter.AllowRequest("key:agent"))
+	require.ErrorIs(t, limiter.AllowRequest("key:agent"), ErrLimitExceeded)
+}
+
+func TestLimiter_MetricRate(t *testing.T) {
+	limiter, _, now := newTestLimiter(config.LimitsConfig{MetricRate: 10})
+	repository := limiter.For("key:agent", "", storage.NewMetricsMemoryRepo(config.StoreConfig{}))
+
+	batch := make([]metrics.Metric, 0, 11)
+	for i := 0; i < 11; i++ {
+		batch = append(batch, gaugeMetric("cpu"))
+	}
+
+	// Пакет больше запаса не пройдет никогда
+	err := repository.UpdateManySliceMetric(batch)
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	require.Zero(t, RetryAfter(err))
+
+	require.NoError(t, repository.UpdateManySliceMetric(batch[:8]))
+	err = repository.UpdateManySliceMetric(batch[:4])
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	require.Equal(t, 200*time.Millisecond, RetryAfter(err))
+
+	*now = now.Add(200 * time.Millisecond)
+	require.NoError(t, repository.UpdateManySliceMetric(batch[:4]))
+}
+
+func TestLimiter_Series(t *testing.T) {
+	limiter, metricsRepo, _ := newTestLimiter(config.LimitsConfig{MaxClientSeries: 2, MaxSeries: 4})
+	require.NoError(t, metricsRepo.Update("stored", gaugeMetric("").MetricValue))
+
+	agent := limiter.For("key:agent", "", metricsRepo)
+	other := limiter.For("key:other", "team-a", metricsRepo)
+
+	// Повторы в пакете и существующие метрики не считаются новыми рядами
+	require.NoError(t, agent.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("a"), gaugeMetric("a"), gaugeMetric("stored")}))
+	require.NoError(t, agent.Update("b", gaugeMetric("").MetricValue))
+	err := agent.Update("c", gaugeMetric("").MetricValue)
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	require.Contains(t, err.Error(), "client key:agent is limited to 2 series")
+
+	// Обновление существующих рядов при исчерпанном ограничении
+	require.NoError(t, agent.Update("a", gaugeMetric("").MetricValue))
+
+	// Ряды арендатора - другие ключи хранилища
+	require.NoError(t, other.Update("a", gaugeMetric("").MetricValue))
+	err = other.Update("b", gaugeMetric("").MetricValue)
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	require.Contains(t, err.Error(), "server is limited to 4 series")
+
+	// Удаление освобождает ряд клиента и сервера
+	require.NoError(t, agent.Delete("a", metrics.MeticTypeGauge))
+	require.NoError(t, agent.Update("c", gaugeMetric("").MetricValue))
+}
+
+// failingStorage - хранилище, отклоняющее запись.
+type failingStorage struct {
+	storage.MetricStorage
+}
+
+func (failingStorage) UpdateManySliceMetric([]metrics.Metric) error {
+	return errors.New("storage is down")
+}
+
+func TestLimiter_ReleaseOnFailedWrite(t *testing.T) {
+	limiter, metricsRepo, _ := newTestLimiter(config.LimitsConfig{MaxClientSeries: 2})
+
+	failing := limiter.For("key:agent", "", failingStorage{MetricStorage: metricsRepo})
+	require.Error(t, failing.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("a"), gaugeMetric("b")}))
+
+	agent := limiter.For("key:agent", "", metricsRepo)
+	require.NoError(t, agent.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("c"), gaugeMetric("d")}))
+}
+
+func TestLimiter_Names(t *testing.T) {
+	limiter, metricsRepo, _ := newTestLimiter(config.LimitsConfig{MaxNameLength: 24, NamePattern: "^[a-zA-Z0-9_.:-]+$"})
+	repository := limiter.For("key:agent", "", metricsRepo)
+
+	require.NoError(t, repository.Update("cpu.load_1", gaugeMetric("").MetricValue))
+	require.NoError(t, repository.Update(`cpu{host="a b"}`, gaugeMetric("").MetricValue))
+
+	for _, metricID := range []string{"cpu load", "cpu/load", "", `cpu{host="a-very-long-host-name"}`} {
+		err := repository.Update(metricID, gaugeMetric("").MetricValue)
+		require.ErrorIs(t, err, ErrLimitExceeded, metricID)
+	}
+
+	_, err := metricsRepo.Read("cpu load", metrics.MeticTypeGauge)
+	require.Error(t, err)
+}
+
+func TestClientID(t *testing.T) {
+	require.Equal(t, "key:agent", ClientID(auth.Key{Name: "agent"}, "10.0.0.1:5000"))
+	require.Equal(t, "ip:10.0.0.1", ClientID(auth.Anonymous, "10.0.0.1:5000"))
+	require.Equal(t, "ip:::1", ClientID(auth.Key{}, "[::1]:5000"))
+}
@@ -0,0 +1,264 @@
+// Package lineprotocol - разбор InfluxDB line protocol.
+//
+// Формат строки: measurement[,tag=value...] field=value[,field=value...] [timestamp]
+package lineprotocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType - тип значения поля.
+type FieldType int
+
+const (
+	FieldFloat FieldType = iota
+	FieldInteger
+	FieldUnsigned
+	FieldString
+	FieldBoolean
+)
+
+var (
+	ErrMissingFields    = errors.New("missing fields")
+	ErrMissingTagValue  = errors.New("missing tag value")
+	ErrMissingFieldName = errors.New("missing field name")
+	ErrInvalidField     = errors.New("invalid field value")
+	ErrUnknownPrecision = errors.New("unknown precision")
+	// ErrTimestampRange - временная метка вне диапазона time.Time в наносекундах (1677-2262 годы)
+	ErrTimestampRange = errors.New("timestamp out of range")
+	// ErrFieldRange - беззнаковое значение поля больше MaxInt64: значения метрик хранятся в int64
+	ErrFieldRange = errors.New("field value out of range")
+)
+
+// Field - одно поле точки.
+type Field struct {
+	Key   string
+	Type  FieldType
+	Float float64
+	Int   int64
+	Uint  uint64
+	Str   string
+	Bool  bool
+}
+
+// Point - одна разобранная строка.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      []Field
+	Time        time.Time
+}
+
+// LineError - ошибка разбора строки с ее номером (нумерация с 1).
+type LineError struct {
+	Line int    `json:"line"`
+	Err  string `json:"error"`
+}
+
+func (lineError LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", lineError.Line, lineError.Err)
+}
+
+// PrecisionMultiplier - множитель для перевода временной метки в наносекунды.
+// Поддерживаются значения параметра precision из API InfluxDB v1 и v2.
+func PrecisionMultiplier(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, ErrUnknownPrecision
+	}
+}
+
+// Parse - разбор всех строк. Ошибочные строки не прерывают разбор и возвращаются списком LineError.
+// Точки без временной метки получают время now.
+func Parse(reader io.Reader, precision time.Duration, now time.Time) ([]Point, []LineError) {
+	var points []Point
+	var lineErrors []LineError
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		point, err := ParseLine(line, precision, now)
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: lineNumber, Err: err.Error()})
+			continue
+		}
+		points = append(points, point)
+	}
+
+	if err := scanner.Err(); err != nil {
+		lineErrors = append(lineErrors, LineError{Line: lineNumber + 1, Err: err.Error()})
+	}
+
+	return points, lineErrors
+}
+
+// ParseLine - разбор одной строки.
+func ParseLine(line string, precision time.Duration, now time.Time) (Point, error) {
+	point := Point{
+		Tags: map[string]string{},
+		Time: now,
+	}
+
+	seriesKey, rest := splitUnescaped(line, ' ', false)
+	if rest == "" {
+		return point, ErrMissingFields
+	}
+
+	measurement, tagSet := splitUnescaped(seriesKey, ',', false)
+	point.Measurement = unescape(measurement, ", ")
+	if point.Measurement == "" {
+		return point, errors.New("missing measurement")
+	}
+
+	for tagSet != "" {
+		var tag string
+		tag, tagSet = splitUnescaped(tagSet, ',', false)
+
+		tagKey, tagValue := splitUnescaped(tag, '=', false)
+		if tagKey == "" || tagValue == "" {
+			return point, ErrMissingTagValue
+		}
+		point.Tags[unescape(tagKey, ",= ")] = unescape(tagValue, ",= ")
+	}
+
+	fieldSet, timestamp := splitUnescaped(strings.TrimLeft(rest, " "), ' ', true)
+	if fieldSet == "" {
+		return point, ErrMissingFields
+	}
+
+	for fieldSet != "" {
+		var rawField string
+		rawField, fieldSet = splitUnescaped(fieldSet, ',', true)
+
+		fieldKey, fieldValue := splitUnescaped(rawField, '=', true)
+		if fieldKey == "" {
+			return point, ErrMissingFieldName
+		}
+
+		field, err := parseFieldValue(fieldValue)
+		if err != nil {
+			return point, fmt.Errorf("field %s: %w", fieldKey, err)
+		}
+		field.Key = unescape(fieldKey, ",= ")
+		point.Fields = append(point.Fields, field)
+	}
+
+	timestamp = strings.TrimSpace(timestamp)
+	if timestamp != "" {
+		timestampValue, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return point, fmt.Errorf("invalid timestamp: %w", err)
+		}
+		if timestampValue > math.MaxInt64/int64(precision) || timestampValue < math.MinInt64/int64(precision) {
+			return point, fmt.Errorf("%w: %s", ErrTimestampRange, timestamp)
+		}
+		point.Time = time.Unix(0, timestampValue*int64(precision))
+	}
+
+	return point, nil
+}
+
+func parseFieldValue(value string) (Field, error) {
+	var field Field
+	var err error
+
+	if value == "" {
+		return field, ErrInvalidField
+	}
+
+	switch {
+	case value[0] == '"':
+		if len(value) < 2 || value[len(value)-1] != '"' {
+			return field, ErrInvalidField
+		}
+		field.Type = FieldString
+		field.Str = unescape(value[1:len(value)-1], `"\`)
+	case value == "t" || value == "T" || value == "true" || value == "True" || value == "TRUE":
+		field.Type = FieldBoolean
+		field.Bool = true
+	case value == "f" || value == "F" || value == "false" || value == "False" || value == "FALSE":
+		field.Type = FieldBoolean
+	case strings.HasSuffix(value, "i"):
+		field.Type = FieldInteger
+		field.Int, err = strconv.ParseInt(value[:len(value)-1], 10, 64)
+	case strings.HasSuffix(value, "u"):
+		field.Type = FieldUnsigned
+		field.Uint, err = strconv.ParseUint(value[:len(value)-1], 10, 64)
+		if err == nil && field.Uint > math.MaxInt64 {
+			return field, fmt.Errorf("%w: %s", ErrFieldRange, value)
+		}
+	default:
+		field.Type = FieldFloat
+		field.Float, err = strconv.ParseFloat(value, 64)
+		// NaN и Inf не кодируются в JSON и не являются числом в line protocol
+		if err == nil && (math.IsNaN(field.Float) || math.IsInf(field.Float, 0)) {
+			err = ErrInvalidField
+		}
+	}
+	if err != nil {
+		return field, ErrInvalidField
+	}
+
+	return field, nil
+}
+
+// splitUnescaped - разделение строки по первому неэкранированному символу sep.
+// При quoted=true символы внутри двойных кавычек не учитываются.
+func splitUnescaped(line string, sep byte, quoted bool) (string, string) {
+	inQuotes := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++
+		case quoted && line[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && line[i] == sep:
+			return line[:i], line[i+1:]
+		}
+	}
+
+	return line, ""
+}
+
+// unescape - удаление обратного слеша перед символами из chars.
+func unescape(value string, chars string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && strings.IndexByte(chars, value[i+1]) >= 0 {
+			i++
+		}
+		builder.WriteByte(value[i])
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,115 @@
+package lineprotocol
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	now := time.Unix(100, 0)
+
+	point, err := ParseLine(`cpu,host=server\ 01,region=eu usage_idle=92.5,cores=8i,ok=t,name="a \"b\"",bytes=10u 1465839830`, time.Second, now)
+	require.NoError(t, err)
+
+	require.Equal(t, "cpu", point.Measurement)
+	require.Equal(t, map[string]string{"host": "server 01", "region": "eu"}, point.Tags)
+	require.Equal(t, time.Unix(1465839830, 0), point.Time)
+	require.Len(t, point.Fields, 5)
+
+	require.Equal(t, Field{Key: "usage_idle", Type: FieldFloat, Float: 92.5}, point.Fields[0])
+	require.Equal(t, Field{Key: "cores", Type: FieldInteger, Int: 8}, point.Fields[1])
+	require.Equal(t, Field{Key: "ok", Type: FieldBoolean, Bool: true}, point.Fields[2])
+	require.Equal(t, Field{Key: "name", Type: FieldString, Str: `a "b"`}, point.Fields[3])
+	require.Equal(t, Field{Key: "bytes", Type: FieldUnsigned, Uint: 10}, point.Fields[4])
+}
+
+func TestParseLineWithoutTimestamp(t *testing.T) {
+	now := time.Unix(100, 0)
+
+	point, err := ParseLine(`mem free=1024i`, time.Nanosecond, now)
+	require.NoError(t, err)
+	require.Equal(t, "mem", point.Measurement)
+	require.Empty(t, point.Tags)
+	require.Equal(t, now, point.Time)
+}
+
+func TestParseLineStringWithSpaces(t *testing.T) {
+	point, err := ParseLine(`event message="disk full, retry later",code=5i 10`, time.Millisecond, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, point.Fields, 2)
+	require.Equal(t, "disk full, retry later", point.Fields[0].Str)
+	require.Equal(t, time.Unix(0, 10*int64(time.Millisecond)), point.Time)
+}
+
+func TestParseLineInvalid(t *testing.T) {
+	for _, line := range []string{
+		`cpu`,
+		`cpu,host usage=1`,
+		`cpu usage=abc`,
+		`cpu usage=1i2`,
+		`cpu =1`,
+		`cpu usage="unterminated`,
+		`cpu usage=1 notatimestamp`,
+		`cpu usage=NaN`,
+		`cpu usage=+Inf`,
+		`cpu usage=-inf`,
+	} {
+		_, err := ParseLine(line, time.Nanosecond, time.Time{})
+		require.Error(t, err, line)
+	}
+}
+
+func TestParseLineTimestampRange(t *testing.T) {
+	point, err := ParseLine(`cpu usage=1 9223372036`, time.Second, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(9223372036, 0), point.Time)
+
+	_, err = ParseLine(`cpu usage=1 9223372037`, time.Second, time.Time{})
+	require.ErrorIs(t, err, ErrTimestampRange)
+
+	_, err = ParseLine(`cpu usage=1 -9223372037`, time.Second, time.Time{})
+	require.ErrorIs(t, err, ErrTimestampRange)
+}
+
+func TestParseLineFieldRange(t *testing.T) {
+	point, err := ParseLine(`disk used=9223372036854775807u`, time.Nanosecond, time.Time{})
+	require.NoError(t, err)
+	require.EqualValues(t, math.MaxInt64, point.Fields[0].Uint)
+
+	_, err = ParseLine(`disk used=9223372036854775808u`, time.Nanosecond, time.Time{})
+	require.ErrorIs(t, err, ErrFieldRange)
+
+	// Строки со значениями вне диапазона отклоняются по отдельности
+	points, lineErrors := Parse(strings.NewReader("disk used=18446744073709551615u\ncpu usage=NaN\nmem free=2i\n"),
+		time.Nanosecond, time.Time{})
+	require.Len(t, points, 1)
+	require.Len(t, lineErrors, 2)
+	require.Equal(t, 1, lineErrors[0].Line)
+	require.Equal(t, 2, lineErrors[1].Line)
+}
+
+func TestParse(t *testing.T) {
+	body := "# comment\ncpu usage=1\n\ncpu usage=abc\nmem free=2i\n"
+
+	points, lineErrors := Parse(strings.NewReader(body), time.Nanosecond, time.Time{})
+	require.Len(t, points, 2)
+	require.Len(t, lineErrors, 1)
+	require.Equal(t, 4, lineErrors[0].Line)
+}
+
+func TestPrecisionMultiplier(t *testing.T) {
+	multiplier, err := PrecisionMultiplier("ms")
+	require.NoError(t, err)
+	require.Equal(t, time.Millisecond, multiplier)
+
+	multiplier, err = PrecisionMultiplier("")
+	require.NoError(t, err)
+	require.Equal(t, time.Nanosecond, multiplier)
+
+	_, err = PrecisionMultiplier("days")
+	require.ErrorIs(t, err, ErrUnknownPrecision)
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/selfmetrics"
+	"devops-tpl/internal/server/tenant"
+	"errors"
+	"net/http"
+)
+
+// NewAuthHandle - проверка API токена или клиентского сертификата запроса по текущему набору ключей keySet:
+// ключу нужна область scope. Арендатор запроса - арендатор ключа или выбранный ключом admin заголовком X-Tenant
+// (параметром tenant), ключ и арендатор передаются обработчикам в контексте (auth.KeyFromContext, tenant.FromContext).
+// Без набора ключей (nil) проверки нет, арендатор выбирается так же, как ключом admin.
+// Отклоненные запросы записываются в журнал аудита.
+func NewAuthHandle(keySet func() *auth.KeySet, scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestedTenant := r.Header.Get(auth.TenantHeader)
+			if requestedTenant == "" {
+				requestedTenant = r.URL.Query().Get("tenant")
+			}
+
+			key, err := authenticate(r, keySet(), scope)
+			var tenantName string
+			if err == nil {
+				tenantName, err = auth.RequestTenant(key, requestedTenant)
+			}
+			if err == nil {
+				ctx := auth.WithKey(r.Context(), key)
+				next.ServeHTTP(w, r.WithContext(tenant.WithTenant(ctx, tenantName)))
+				return
+			}
+
+			selfmetrics.Reject(r.Context(), selfmetrics.RejectAuth)
+			auth.Audit(r.Context(), auth.Rejection{
+				Protocol: "http",
+				Method:   r.Method + " " + r.URL.Path,
+				Remote:   r.RemoteAddr,
+				Tenant:   requestedTenant,
+				Key:      key.Name,
+				Scope:    scope,
+				Err:      err,
+			})
+
+			status := http.StatusUnauthorized
+			switch {
+			case errors.Is(err, auth.ErrInvalidTenant):
+				status = http.StatusBadRequest
+			case errors.Is(err, auth.ErrForbidden):
+				status = http.StatusForbidden
+			default:
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			response := metrics.NewUpdateMetricResponse()
+			http.Error(w, response.SetStatusError(err).GetJSONString(), status)
+		})
+	}
+}
+
+// authenticate - ключ запроса: по токену из заголовка Authorization, а без токена - по проверенному
+// клиентскому сертификату HTTPS.
+func authenticate(r *http.Request, keySet *auth.KeySet, scope string) (auth.Key, error) {
+	if keySet == nil {
+		return auth.Anonymous, nil
+	}
+
+	token := auth.BearerToken(r.Header.Get("Authorization"))
+	if token == "" && r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+		return keySet.CheckSubject(r.TLS.VerifiedChains[0][0].Subject.CommonName, scope)
+	}
+
+	return keySet.Check(token, scope)
+}
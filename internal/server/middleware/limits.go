@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/limits"
+	"devops-tpl/internal/server/selfmetrics"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// NewLimitHandle - проверка частоты запросов записи клиента (ключ из NewAuthHandle или IP адрес).
+// Клиент передается обработчикам в контексте (limits.ClientFromContext) для проверки ограничений метрик.
+// Отклоненные запросы получают 429 с объяснением и заголовком Retry-After.
+func NewLimitHandle(limiter *limits.Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := limits.ClientID(auth.KeyFromContext(r.Context()), r.RemoteAddr)
+
+			err := limiter.AllowRequest(client)
+			if err != nil {
+				logging.FromContext(r.Context()).Warn("Limits rejected", slog.String("method", r.Method), slog.String("path", r.URL.Path), logging.Err(err))
+				selfmetrics.Reject(r.Context(), selfmetrics.RejectLimit)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limits.RetryAfter(err).Seconds()))))
+				response := metrics.NewUpdateMetricResponse()
+				http.Error(w, response.SetStatusError(err).GetJSONString(), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(limits.WithClient(r.Context(), client)))
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"devops-tpl/internal/logging"
+	"log/slog"
+	"net/http"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/middleware"
+)
+
+// RequestLogHandle - журнал запросов после chimiddleware.RequestID: идентификатор запроса (X-Request-Id клиента
+// или новый) возвращается в ответе и передается обработчикам в журнале запроса (logging.FromContext).
+// После ответа записываются метод, путь, статус, размер и длительность ответа.
+func RequestLogHandle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := chimiddleware.GetReqID(r.Context())
+		logger := slog.Default().With(logging.RequestIDKey, requestID)
+		w.Header().Set(chimiddleware.RequestIDHeader, requestID)
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(logging.WithLogger(r.Context(), logger)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		logger.Info("HTTP request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		)
+	})
+}
@@ -9,16 +9,24 @@ import (
 	handlerRSA "devops-tpl/internal/rsa"
 )
 
-func NewRSAHandle(privateKey *rsa.PrivateKey) func(next http.Handler) http.Handler {
+// NewRSAHandle - расшифровка тела запроса текущим ключом privateKey, без ключа (nil) запрос передается как есть.
+func NewRSAHandle(privateKey func() *rsa.PrivateKey) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			currentKey := privateKey()
+			if currentKey == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			bodyBytes, err := io.ReadAll(r.Body)
-			if err != nil {
+			// Запросы без тела (GET, DELETE) не шифруются
+			if err != nil || len(bodyBytes) == 0 {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			decryptedBody := handlerRSA.DecryptWithPrivateKey(bodyBytes, privateKey)
+			decryptedBody := handlerRSA.DecryptWithPrivateKey(bodyBytes, currentKey)
 			r.Body = io.NopCloser(bytes.NewReader(decryptedBody))
 
 			next.ServeHTTP(w, r)
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"devops-tpl/internal/server/selfmetrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	chimiddleware "github.com/go-chi/chi/middleware"
+)
+
+// unroutedRoute - маршрут запросов, не дошедших до маршрута: не совпавших ни с одним маршрутом
+// или отклоненных middleware до выбора маршрута.
+const unroutedRoute = "unrouted"
+
+// NewSelfMetricsHandle - учет запросов в метриках сервера по методу, шаблону маршрута и статусу ответа,
+// а также запросов, отклоненных следующими middleware (selfmetrics.Reject).
+func NewSelfMetricsHandle(registry *selfmetrics.Registry) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx, rejected := selfmetrics.NewRequest(r.Context())
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			route := unroutedRoute
+			if routeContext := chi.RouteContext(r.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+				route = routeContext.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			registry.Add(selfmetrics.HTTPRequests, map[string]string{"method": r.Method, "route": route, "code": strconv.Itoa(status)}, 1)
+			registry.Add(selfmetrics.HTTPRequestDuration, map[string]string{"method": r.Method, "route": route}, selfmetrics.DurationMicroseconds(start))
+			if reason := rejected(); reason != "" {
+				registry.Add(selfmetrics.HTTPRejected, map[string]string{"reason": reason}, 1)
+			}
+		})
+	}
+}
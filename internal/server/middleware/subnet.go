@@ -1,25 +1,35 @@
 package middleware
 
 import (
-	"devops-tpl/internal/server/responses"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/selfmetrics"
 	"errors"
 	"net"
 	"net/http"
 )
 
-func NewSubNetHandle(trustedSubNet *net.IPNet) func(next http.Handler) http.Handler {
+// NewSubNetHandle - проверка адреса клиента по текущей доверенной сети trustedSubNet, без сети (nil) проверки нет.
+func NewSubNetHandle(trustedSubNet func() *net.IPNet) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			currentSubNet := trustedSubNet()
+			if currentSubNet == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			ipStr := r.Header.Get("X-Real-IP")
-			response := responses.NewUpdateMetricResponse()
+			response := metrics.NewUpdateMetricResponse()
 
 			clientIP := net.ParseIP(ipStr)
 			if clientIP == nil {
+				selfmetrics.Reject(r.Context(), selfmetrics.RejectSubNet)
 				http.Error(w, response.SetStatusError(errors.New("unknown client IP")).GetJSONString(), http.StatusForbidden)
 				return
 			}
 
-			if !trustedSubNet.Contains(clientIP) {
+			if !currentSubNet.Contains(clientIP) {
+				selfmetrics.Reject(r.Context(), selfmetrics.RejectSubNet)
 				http.Error(w, response.SetStatusError(errors.New("client IP is not in trusted subnet")).GetJSONString(), http.StatusForbidden)
 				return
 			}
@@ -0,0 +1,57 @@
+package otlp
+
+import (
+	"errors"
+	"mime"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeJSON     = "application/json"
+)
+
+var ErrUnsupportedContentType = errors.New("unsupported content type, expected application/x-protobuf or application/json")
+
+// MediaType - тип содержимого OTLP/HTTP запроса без параметров.
+func MediaType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", ErrUnsupportedContentType
+	}
+
+	if mediaType != ContentTypeProtobuf && mediaType != ContentTypeJSON {
+		return "", ErrUnsupportedContentType
+	}
+
+	return mediaType, nil
+}
+
+// Unmarshal - разбор тела OTLP/HTTP запроса.
+func Unmarshal(mediaType string, body []byte) (*colmetricspb.ExportMetricsServiceRequest, error) {
+	request := &colmetricspb.ExportMetricsServiceRequest{}
+
+	var err error
+	switch mediaType {
+	case ContentTypeProtobuf:
+		err = proto.Unmarshal(body, request)
+	case ContentTypeJSON:
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, request)
+	default:
+		err = ErrUnsupportedContentType
+	}
+
+	return request, err
+}
+
+// Marshal - кодирование ответа (ExportMetricsServiceResponse или google.rpc.Status) в формате запроса.
+func Marshal(mediaType string, message proto.Message) ([]byte, error) {
+	if mediaType == ContentTypeJSON {
+		return protojson.Marshal(message)
+	}
+
+	return proto.Marshal(message)
+}
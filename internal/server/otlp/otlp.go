@@ -0,0 +1,297 @@
+// Package otlp - прием метрик OpenTelemetry (OTLP) и преобразование в метрики хранилища.
+//
+// Sum с IsMonotonic сохраняется как counter, остальные Sum и Gauge - как gauge.
+// Histogram раскладывается на name_count (counter), name_sum (gauge) и name_bucket{le="..."} (counter).
+// Атрибуты ресурса и точки становятся метками в ID метрики.
+package otlp
+
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/storage"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// cumulativeExpiry - срок хранения последнего значения cumulative счетчика без новых точек.
+// Вернувшийся после этого ряд считается новым, как после сброса счетчика.
+const cumulativeExpiry = time.Hour
+
+// cumulativePoint - последнее значение cumulative счетчика и время его получения.
+type cumulativePoint struct {
+	value int64
+	seen  time.Time
+}
+
+// Receiver - преобразование OTLP запросов и запись в хранилище.
+type Receiver struct {
+	// cumulativeMutex защищает cumulativeLast - последние значения cumulative счетчиков,
+	// нужные для перевода их в приращения (counter в хранилище накапливает delta),
+	// и lastExpire - время последнего удаления устаревших значений.
+	cumulativeMutex *sync.Mutex
+	cumulativeLast  map[string]cumulativePoint
+	lastExpire      time.Time
+	now             func() time.Time
+}
+
+func NewReceiver() *Receiver {
+	return &Receiver{
+		cumulativeMutex: &sync.Mutex{},
+		cumulativeLast:  map[string]cumulativePoint{},
+		lastExpire:      time.Now(),
+		now:             time.Now,
+	}
+}
+
+// Receivers - приемники арендаторов: у каждого арендатора свои последние значения cumulative счетчиков.
+type Receivers struct {
+	mutex     *sync.Mutex
+	receivers map[string]*Receiver
+}
+
+func NewReceivers() *Receivers {
+	return &Receivers{
+		mutex:     &sync.Mutex{},
+		receivers: map[string]*Receiver{},
+	}
+}
+
+// For - приемник арендатора tenantName, создается при первом обращении.
+func (receivers *Receivers) For(tenantName string) *Receiver {
+	receivers.mutex.Lock()
+	defer receivers.mutex.Unlock()
+
+	receiver, ok := receivers.receivers[tenantName]
+	if !ok {
+		receiver = NewReceiver()
+		receivers.receivers[tenantName] = receiver
+	}
+
+	return receiver
+}
+
+// Consume - запись метрик из запроса в хранилище metricStorage (хранилище арендатора приемника).
+// Возвращает количество отклоненных точек (неподдерживаемые типы и некорректные значения).
+func (receiver *Receiver) Consume(metricStorage storage.MetricStorage, request *colmetricspb.ExportMetricsServiceRequest) (int64, error) {
+	batch, rejected := receiver.Convert(request)
+	if len(batch) == 0 {
+		return rejected, nil
+	}
+
+	return rejected, metricStorage.UpdateManySliceMetric(batch)
+}
+
+// Response - ответ на экспорт с информацией о частичном приеме.
+func Response(rejected int64) *colmetricspb.ExportMetricsServiceResponse {
+	response := &colmetricspb.ExportMetricsServiceResponse{}
+	if rejected != 0 {
+		response.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected,
+			ErrorMessage:       "unsupported metric types or non-finite values were rejected",
+		}
+	}
+
+	return response
+}
+
+// Convert - преобразование запроса в метрики хранилища.
+func (receiver *Receiver) Convert(request *colmetricspb.ExportMetricsServiceRequest) ([]metrics.Metric, int64) {
+	var batch []metrics.Metric
+	var rejected int64
+
+	for _, resourceMetrics := range request.GetResourceMetrics() {
+		resourceLabels := attributesToLabels(resourceMetrics.GetResource().GetAttributes(), nil)
+
+		for _, scopeMetrics := range resourceMetrics.GetScopeMetrics() {
+			for _, metric := range scopeMetrics.GetMetrics() {
+				var converted []metrics.Metric
+				var convertRejected int64
+
+				switch data := metric.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					converted, convertRejected = receiver.convertNumbers(metric.GetName(), resourceLabels, data.Gauge.GetDataPoints(), false, 0)
+				case *metricspb.Metric_Sum:
+					converted, convertRejected = receiver.convertNumbers(metric.GetName(), resourceLabels, data.Sum.GetDataPoints(),
+						data.Sum.GetIsMonotonic(), data.Sum.GetAggregationTemporality())
+				case *metricspb.Metric_Histogram:
+					converted, convertRejected = receiver.convertHistogram(metric.GetName(), resourceLabels, data.Histogram)
+				case *metricspb.Metric_ExponentialHistogram:
+					convertRejected = int64(len(data.ExponentialHistogram.GetDataPoints()))
+				case *metricspb.Metric_Summary:
+					convertRejected = int64(len(data.Summary.GetDataPoints()))
+				}
+
+				batch = append(batch, converted...)
+				rejected += convertRejected
+			}
+		}
+	}
+
+	return batch, rejected
+}
+
+func (receiver *Receiver) convertNumbers(name string, resourceLabels map[string]string, dataPoints []*metricspb.NumberDataPoint,
+	isCounter bool, temporality metricspb.AggregationTemporality) ([]metrics.Metric, int64) {
+	var batch []metrics.Metric
+	var rejected int64
+
+	for _, dataPoint := range dataPoints {
+		var value float64
+		switch pointValue := dataPoint.GetValue().(type) {
+		case *metricspb.NumberDataPoint_AsDouble:
+			value = pointValue.AsDouble
+		case *metricspb.NumberDataPoint_AsInt:
+			value = float64(pointValue.AsInt)
+		default:
+			rejected++
+			continue
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			rejected++
+			continue
+		}
+
+		metricID := metrics.MetricIDWithLabels(name, attributesToLabels(dataPoint.GetAttributes(), resourceLabels))
+		if isCounter {
+			batch = append(batch, receiver.counterMetric(metricID, int64(math.Round(value)), temporality))
+			continue
+		}
+		batch = append(batch, gaugeMetric(metricID, value))
+	}
+
+	return batch, rejected
+}
+
+func (receiver *Receiver) convertHistogram(name string, resourceLabels map[string]string, histogram *metricspb.Histogram) ([]metrics.Metric, int64) {
+	var batch []metrics.Metric
+	var rejected int64
+	temporality := histogram.GetAggregationTemporality()
+
+	for _, dataPoint := range histogram.GetDataPoints() {
+		bucketCounts := dataPoint.GetBucketCounts()
+		explicitBounds := dataPoint.GetExplicitBounds()
+		if len(bucketCounts) != 0 && len(bucketCounts) != len(explicitBounds)+1 {
+			rejected++
+			continue
+		}
+
+		labels := attributesToLabels(dataPoint.GetAttributes(), resourceLabels)
+		batch = append(batch,
+			receiver.counterMetric(metrics.MetricIDWithLabels(name+"_count", labels), int64(dataPoint.GetCount()), temporality))
+		if dataPoint.Sum != nil {
+			batch = append(batch, gaugeMetric(metrics.MetricIDWithLabels(name+"_sum", labels), dataPoint.GetSum()))
+		}
+
+		// В OTLP количество указано для каждого интервала отдельно, метрика le накопительная
+		var cumulativeCount uint64
+		for i, bucketCount := range bucketCounts {
+			cumulativeCount += bucketCount
+
+			bucketLabels := make(map[string]string, len(labels)+1)
+			for labelName, labelValue := range labels {
+				bucketLabels[labelName] = labelValue
+			}
+			bucketLabels["le"] = "+Inf"
+			if i < len(explicitBounds) {
+				bucketLabels["le"] = strconv.FormatFloat(explicitBounds[i], 'g', -1, 64)
+			}
+
+			batch = append(batch,
+				receiver.counterMetric(metrics.MetricIDWithLabels(name+"_bucket", bucketLabels), int64(cumulativeCount), temporality))
+		}
+	}
+
+	return batch, rejected
+}
+
+// expireCumulative - удаление значений cumulative счетчиков, не обновлявшихся дольше cumulativeExpiry.
+// Проверка выполняется не чаще раза в cumulativeExpiry, вызывается под cumulativeMutex.
+func (receiver *Receiver) expireCumulative(now time.Time) {
+	if now.Sub(receiver.lastExpire) < cumulativeExpiry {
+		return
+	}
+	receiver.lastExpire = now
+
+	for metricID, last := range receiver.cumulativeLast {
+		if now.Sub(last.seen) >= cumulativeExpiry {
+			delete(receiver.cumulativeLast, metricID)
+		}
+	}
+}
+
+// counterMetric - counter метрика с приращением. Для cumulative значений приращение считается
+// от предыдущего полученного значения, при сбросе счетчика (значение уменьшилось) берется значение целиком.
+func (receiver *Receiver) counterMetric(metricID string, value int64, temporality metricspb.AggregationTemporality) metrics.Metric {
+	delta := value
+	if temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		receiver.cumulativeMutex.Lock()
+		now := receiver.now()
+		receiver.expireCumulative(now)
+		last, ok := receiver.cumulativeLast[metricID]
+		if ok && value >= last.value {
+			delta = value - last.value
+		}
+		receiver.cumulativeLast[metricID] = cumulativePoint{value: value, seen: now}
+		receiver.cumulativeMutex.Unlock()
+	}
+
+	return metrics.Metric{
+		ID: metricID,
+		MetricValue: metrics.MetricValue{
+			MType: metrics.MeticTypeCounter,
+			Delta: &delta,
+		},
+	}
+}
+
+func gaugeMetric(metricID string, value float64) metrics.Metric {
+	return metrics.Metric{
+		ID: metricID,
+		MetricValue: metrics.MetricValue{
+			MType: metrics.MeticTypeGauge,
+			Value: &value,
+		},
+	}
+}
+
+// attributesToLabels - метки из атрибутов поверх базовых меток.
+func attributesToLabels(attributes []*commonpb.KeyValue, baseLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(baseLabels)+len(attributes))
+	for labelName, labelValue := range baseLabels {
+		labels[labelName] = labelValue
+	}
+
+	for _, attribute := range attributes {
+		labels[attribute.GetKey()] = anyValueString(attribute.GetValue())
+	}
+
+	return labels
+}
+
+func anyValueString(value *commonpb.AnyValue) string {
+	switch typedValue := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return typedValue.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(typedValue.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(typedValue.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(typedValue.DoubleValue, 'g', -1, 64)
+	case nil:
+		return ""
+	default:
+		// Массивы, словари и байты сохраняются в JSON представлении
+		jsonBytes, err := protojson.Marshal(value)
+		if err != nil {
+			return ""
+		}
+		return string(jsonBytes)
+	}
+}
@@ -0,0 +1,194 @@
+package otlp
+
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func newTestRequest(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{
+			{
+				Resource: &resourcepb.Resource{
+					Attributes: []*commonpb.KeyValue{stringAttribute("service.name", "checkout")},
+				},
+				ScopeMetrics: []*metricspb.ScopeMetrics{
+					{Metrics: metrics},
+				},
+			},
+		},
+	}
+}
+
+func newSum(name string, monotonic bool, temporality metricspb.AggregationTemporality, value int64) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: name,
+		Data: &metricspb.Metric_Sum{
+			Sum: &metricspb.Sum{
+				IsMonotonic:            monotonic,
+				AggregationTemporality: temporality,
+				DataPoints: []*metricspb.NumberDataPoint{
+					{
+						Attributes: []*commonpb.KeyValue{stringAttribute("method", "GET")},
+						Value:      &metricspb.NumberDataPoint_AsInt{AsInt: value},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestReceiverConsume(t *testing.T) {
+	metricsRepo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	receiver := NewReceiver()
+
+	sumSeriesID := `requests{method="GET",service.name="checkout"}`
+
+	for _, cumulativeValue := range []int64{10, 15, 3} {
+		rejected, err := receiver.Consume(metricsRepo, newTestRequest(
+			newSum("requests", true, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, cumulativeValue),
+		))
+		require.NoError(t, err)
+		require.Zero(t, rejected)
+	}
+
+	// 10 + (15 - 10) + 3 после сброса счетчика
+	counterValue, err := metricsRepo.Read(sumSeriesID, metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 18, *counterValue.Delta)
+
+	_, err = receiver.Consume(metricsRepo, newTestRequest(
+		newSum("inflight", false, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, 4),
+		&metricspb.Metric{
+			Name: "temperature",
+			Data: &metricspb.Metric_Gauge{
+				Gauge: &metricspb.Gauge{
+					DataPoints: []*metricspb.NumberDataPoint{
+						{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 21.5}},
+					},
+				},
+			},
+		},
+	))
+	require.NoError(t, err)
+
+	gaugeValue, err := metricsRepo.Read(`inflight{method="GET",service.name="checkout"}`, metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, *gaugeValue.Value)
+
+	gaugeValue, err = metricsRepo.Read(`temperature{service.name="checkout"}`, metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 21.5, *gaugeValue.Value)
+}
+
+func TestReceiverCumulativeExpiry(t *testing.T) {
+	metricsRepo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	receiver := NewReceiver()
+	now := time.Now()
+	receiver.now = func() time.Time { return now }
+
+	consume := func(name string, cumulativeValue int64) {
+		_, err := receiver.Consume(metricsRepo, newTestRequest(
+			newSum(name, true, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, cumulativeValue),
+		))
+		require.NoError(t, err)
+	}
+
+	consume("requests", 10)
+	consume("errors", 1)
+	require.Len(t, receiver.cumulativeLast, 2)
+
+	now = now.Add(cumulativeExpiry / 2)
+	consume("requests", 15)
+
+	// errors не обновлялся дольше cumulativeExpiry и удаляется, requests остается
+	now = now.Add(cumulativeExpiry * 3 / 4)
+	consume("requests", 20)
+	require.Len(t, receiver.cumulativeLast, 1)
+
+	counterValue, err := metricsRepo.Read(`requests{method="GET",service.name="checkout"}`, metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 20, *counterValue.Delta)
+}
+
+func TestReceiverHistogram(t *testing.T) {
+	receiver := NewReceiver()
+	sum := 12.5
+
+	batch, rejected := receiver.Convert(newTestRequest(
+		&metricspb.Metric{
+			Name: "latency",
+			Data: &metricspb.Metric_Histogram{
+				Histogram: &metricspb.Histogram{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					DataPoints: []*metricspb.HistogramDataPoint{
+						{
+							Count:          6,
+							Sum:            &sum,
+							BucketCounts:   []uint64{1, 2, 3},
+							ExplicitBounds: []float64{0.1, 0.5},
+						},
+						{
+							BucketCounts:   []uint64{1},
+							ExplicitBounds: []float64{0.1, 0.5},
+						},
+					},
+				},
+			},
+		},
+		&metricspb.Metric{
+			Name: "summary",
+			Data: &metricspb.Metric_Summary{
+				Summary: &metricspb.Summary{DataPoints: []*metricspb.SummaryDataPoint{{}}},
+			},
+		},
+	))
+	require.EqualValues(t, 2, rejected)
+
+	values := map[string]metrics.MetricValue{}
+	for _, metric := range batch {
+		values[metric.ID] = metric.MetricValue
+	}
+	require.Len(t, values, 5)
+
+	require.EqualValues(t, 6, *values[`latency_count{service.name="checkout"}`].Delta)
+	require.EqualValues(t, 12.5, *values[`latency_sum{service.name="checkout"}`].Value)
+	require.EqualValues(t, 1, *values[`latency_bucket{le="0.1",service.name="checkout"}`].Delta)
+	require.EqualValues(t, 3, *values[`latency_bucket{le="0.5",service.name="checkout"}`].Delta)
+	require.EqualValues(t, 6, *values[`latency_bucket{le="+Inf",service.name="checkout"}`].Delta)
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	body := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"up","gauge":{"dataPoints":[{"asInt":"1"}]}}]}]}]}`
+
+	mediaType, err := MediaType("application/json; charset=utf-8")
+	require.NoError(t, err)
+
+	request, err := Unmarshal(mediaType, []byte(body))
+	require.NoError(t, err)
+
+	metrics, rejected := NewReceiver().Convert(request)
+	require.Zero(t, rejected)
+	require.Len(t, metrics, 1)
+	require.Equal(t, "up", metrics[0].ID)
+	require.EqualValues(t, 1, *metrics[0].Value)
+
+	_, err = MediaType("text/plain")
+	require.ErrorIs(t, err, ErrUnsupportedContentType)
+}
@@ -0,0 +1,42 @@
+package responses
+
+import (
+	"encoding/json"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/lineprotocol"
+)
+
+// WriteResponse - ответ на запись в формате line protocol со списком ошибочных строк.
+type WriteResponse struct {
+	metrics.DefaultResponse
+	Written int                      `json:"written"`
+	Lines   []lineprotocol.LineError `json:"lines,omitempty"`
+}
+
+func NewWriteResponse() WriteResponse {
+	response := WriteResponse{}
+	response.Status = metrics.StatusOk
+
+	return response
+}
+
+func (response *WriteResponse) SetLineErrors(lineErrors []lineprotocol.LineError) *WriteResponse {
+	if len(lineErrors) == 0 {
+		return response
+	}
+
+	response.Status = metrics.StatusError
+	response.Error = "partial write: some lines could not be parsed"
+	response.Lines = lineErrors
+	return response
+}
+
+func (response WriteResponse) GetJSONBytes() []byte {
+	jsonBytes, _ := json.Marshal(response)
+	return jsonBytes
+}
+
+func (response WriteResponse) GetJSONString() string {
+	return string(response.GetJSONBytes())
+}
@@ -0,0 +1,175 @@
+// Package selfmetrics - метрики работы самого сервера: запросы HTTP и gRPC, операции хранилища, запись снимков
+// и запросы, отклоненные middleware. Метрики доступны по GET /api/server/metrics и периодически записываются
+// в хранилище арендатора сервера (config.SelfMetricsConfig).
+package selfmetrics
+
+import (
+	"context"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/storage"
+	"sync"
+	"time"
+)
+
+// Метрики сервера. Длительности накапливаются в микросекундах: средняя длительность - отношение
+// *_duration_us_total к количеству.
+const (
+	HTTPRequests        = "http_requests_total"
+	HTTPRequestDuration = "http_request_duration_us_total"
+	HTTPRejected        = "http_rejected_total"
+	GRPCRequests        = "grpc_requests_total"
+	GRPCRequestDuration = "grpc_request_duration_us_total"
+	GRPCRejected        = "grpc_rejected_total"
+	StorageOperations   = "storage_operations_total"
+	StorageDuration     = "storage_operation_duration_us_total"
+	StorageBatchMetrics = "storage_batch_metrics_total"
+	SnapshotDuration    = "storage_snapshot_duration_seconds"
+	Snapshots           = "storage_snapshots_total"
+)
+
+// Результат операции в метке result.
+const (
+	resultOK    = "ok"
+	resultError = "error"
+)
+
+// Причины отклонения запросов middleware (Reject).
+const (
+	RejectAuth   = "auth"
+	RejectLimit  = "limit"
+	RejectSubNet = "subnet"
+)
+
+// Registry - счетчики и gauge метрики сервера по ID с метками (metrics.MetricIDWithLabels).
+type Registry struct {
+	mutex    *sync.Mutex
+	counters map[string]int64
+	gauges   map[string]float64
+	// flushed - значения счетчиков, уже записанные в хранилище (Flush): хранилище суммирует приращения
+	flushed map[string]int64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		mutex:    &sync.Mutex{},
+		counters: map[string]int64{},
+		gauges:   map[string]float64{},
+		flushed:  map[string]int64{},
+	}
+}
+
+// Add - увеличение счетчика name с метками labels на delta.
+func (registry *Registry) Add(name string, labels map[string]string, delta int64) {
+	metricID := metrics.MetricIDWithLabels(name, labels)
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.counters[metricID] += delta
+}
+
+// Set - значение gauge name с метками labels.
+func (registry *Registry) Set(name string, labels map[string]string, value float64) {
+	metricID := metrics.MetricIDWithLabels(name, labels)
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.gauges[metricID] = value
+}
+
+// ObserveSnapshot - учет записи снимка хранилища в файл.
+func (registry *Registry) ObserveSnapshot(duration time.Duration, err error) {
+	registry.Add(Snapshots, map[string]string{"result": result(err)}, 1)
+	registry.Set(SnapshotDuration, nil, duration.Seconds())
+}
+
+// Metrics - текущие значения метрик, упорядоченные по типу и ID.
+func (registry *Registry) Metrics() []metrics.Metric {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	return storage.SortedMetrics(registry.metricMaps(registry.counters), "")
+}
+
+// Flush - запись метрик в хранилище metricStorage: приращения счетчиков с прошлой записи и значения gauge.
+// При ошибке приращения будут записаны следующим вызовом.
+func (registry *Registry) Flush(metricStorage storage.MetricStorage) error {
+	registry.mutex.Lock()
+	deltas := make(map[string]int64, len(registry.counters))
+	for metricID, value := range registry.counters {
+		if delta := value - registry.flushed[metricID]; delta != 0 {
+			deltas[metricID] = delta
+		}
+	}
+	metrics := storage.SortedMetrics(registry.metricMaps(deltas), "")
+	registry.mutex.Unlock()
+
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	err := metricStorage.UpdateManySliceMetric(metrics)
+	if err != nil {
+		return err
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	for metricID, delta := range deltas {
+		registry.flushed[metricID] += delta
+	}
+
+	return nil
+}
+
+// metricMaps - счетчики counters и gauge метрики в формате storage.MetricStorage.ReadAll.
+func (registry *Registry) metricMaps(counters map[string]int64) map[string]storage.MetricMap {
+	counterMap := make(storage.MetricMap, len(counters))
+	for metricID, value := range counters {
+		delta := value
+		counterMap[metricID] = metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}
+	}
+
+	gaugeMap := make(storage.MetricMap, len(registry.gauges))
+	for metricID, value := range registry.gauges {
+		gaugeValue := value
+		gaugeMap[metricID] = metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &gaugeValue}
+	}
+
+	return map[string]storage.MetricMap{metrics.MeticTypeCounter: counterMap, metrics.MeticTypeGauge: gaugeMap}
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultError
+	}
+
+	return resultOK
+}
+
+// request - отметки middleware о запросе, передаются в контексте от NewRequest.
+type request struct {
+	rejected string
+}
+
+type contextKey struct{}
+
+// NewRequest - контекст запроса для отметок middleware (Reject). Возвращает функцию, возвращающую причину
+// отклонения запроса, пустую строку - запрос не отклонен.
+func NewRequest(ctx context.Context) (context.Context, func() string) {
+	state := &request{}
+	return context.WithValue(ctx, contextKey{}, state), func() string { return state.rejected }
+}
+
+// Reject - отметка отклонения запроса middleware по причине reason. Без контекста NewRequest не действует.
+func Reject(ctx context.Context, reason string) {
+	if state, ok := ctx.Value(contextKey{}).(*request); ok {
+		state.rejected = reason
+	}
+}
+
+// DurationMicroseconds - длительность с момента start в микросекундах для метрик *_duration_us_total.
+func DurationMicroseconds(start time.Time) int64 {
+	return time.Since(start).Microseconds()
+}
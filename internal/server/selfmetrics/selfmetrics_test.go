@@ -0,0 +1,114 @@
+package selfmetrics
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// failingStorage - хранилище, отклоняющее запись.
+type failingStorage struct {
+	storage.MetricStorage
+}
+
+func (failingStorage) UpdateManySliceMetric([]metrics.Metric) error {
+	return errors.New("storage unavailable")
+}
+
+func TestRegistry_Flush(t *testing.T) {
+	registry := NewRegistry()
+	registry.Add(HTTPRequests, map[string]string{"code": "200", "route": "/update/"}, 2)
+	registry.Set(SnapshotDuration, nil, 0.5)
+
+	metricStorage := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	require.NoError(t, registry.Flush(metricStorage))
+
+	// Хранилище суммирует приращения: повторная запись добавляет только новые запросы
+	registry.Add(HTTPRequests, map[string]string{"route": "/update/", "code": "200"}, 1)
+	require.NoError(t, registry.Flush(metricStorage))
+
+	value, err := metricStorage.Read(`http_requests_total{code="200",route="/update/"}`, metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, *value.Delta)
+	value, err = metricStorage.Read(SnapshotDuration, metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, 0.5, *value.Value)
+
+	// Приращения, не записанные из-за ошибки, записываются следующим вызовом
+	registry.Add(HTTPRequests, map[string]string{"route": "/update/", "code": "200"}, 4)
+	require.Error(t, registry.Flush(failingStorage{metricStorage}))
+	require.NoError(t, registry.Flush(metricStorage))
+	value, err = metricStorage.Read(`http_requests_total{code="200",route="/update/"}`, metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 7, *value.Delta)
+
+	// Metrics возвращает полные значения счетчиков
+	batch := registry.Metrics()
+	require.Len(t, batch, 2)
+	require.Equal(t, metrics.MeticTypeCounter, batch[0].MType)
+	require.EqualValues(t, 7, *batch[0].Delta)
+}
+
+func TestInstrumentedStorage(t *testing.T) {
+	registry := NewRegistry()
+	instrumentedStorage := NewInstrumentedStorage(storage.NewMetricsMemoryRepo(config.StoreConfig{}), registry)
+
+	value := 1.5
+	require.NoError(t, instrumentedStorage.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}))
+	require.Error(t, instrumentedStorage.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge}))
+	require.NoError(t, instrumentedStorage.UpdateManySliceMetric([]metrics.Metric{
+		{ID: "Alloc", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}},
+		{ID: "Sys", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}},
+	}))
+	require.NoError(t, instrumentedStorage.Save())
+
+	counters := map[string]int64{}
+	for _, metric := range registry.Metrics() {
+		if metric.MType == metrics.MeticTypeCounter {
+			counters[metric.ID] = *metric.Delta
+		}
+	}
+	require.EqualValues(t, 1, counters[`storage_operations_total{operation="Update",result="ok"}`])
+	require.EqualValues(t, 1, counters[`storage_operations_total{operation="Update",result="error"}`])
+	require.EqualValues(t, 1, counters[`storage_operations_total{operation="UpdateManySliceMetric",result="ok"}`])
+	require.EqualValues(t, 1, counters[`storage_operations_total{operation="Save",result="ok"}`])
+	require.EqualValues(t, 2, counters[StorageBatchMetrics])
+	require.Contains(t, counters, `storage_operation_duration_us_total{operation="Update"}`)
+}
+
+func TestObserveSnapshot(t *testing.T) {
+	registry := NewRegistry()
+	repository := storage.NewMetricsMemoryRepo(config.StoreConfig{
+		File:        filepath.Join(t.TempDir(), "metrics.json"),
+		Interval:    time.Hour,
+		Generations: 1,
+	})
+	repository.ObserveSnapshots(registry.ObserveSnapshot)
+
+	require.NoError(t, repository.Save())
+
+	metrics := registry.Metrics()
+	require.Len(t, metrics, 2)
+	require.Equal(t, `storage_snapshots_total{result="ok"}`, metrics[0].ID)
+	require.EqualValues(t, 1, *metrics[0].Delta)
+	require.Equal(t, SnapshotDuration, metrics[1].ID)
+	require.Greater(t, *metrics[1].Value, 0.0)
+}
+
+func TestReject(t *testing.T) {
+	// Без контекста NewRequest отметка не действует
+	Reject(context.Background(), RejectAuth)
+
+	ctx, rejected := NewRequest(context.Background())
+	require.Empty(t, rejected())
+	Reject(ctx, RejectLimit)
+	require.Equal(t, RejectLimit, rejected())
+}
@@ -0,0 +1,62 @@
+package selfmetrics
+
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/storage"
+	"time"
+)
+
+// InstrumentedStorage - хранилище с учетом количества, ошибок и длительности операций записи и сохранения,
+// а также количества метрик в пакетах.
+type InstrumentedStorage struct {
+	storage.MetricStorage
+	registry *Registry
+}
+
+func NewInstrumentedStorage(metricStorage storage.MetricStorage, registry *Registry) InstrumentedStorage {
+	return InstrumentedStorage{
+		MetricStorage: metricStorage,
+		registry:      registry,
+	}
+}
+
+func (instrumentedStorage InstrumentedStorage) Update(key string, value metrics.MetricValue) error {
+	start := time.Now()
+	err := instrumentedStorage.MetricStorage.Update(key, value)
+	instrumentedStorage.observe("Update", start, err)
+
+	return err
+}
+
+func (instrumentedStorage InstrumentedStorage) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	start := time.Now()
+	err := instrumentedStorage.MetricStorage.UpdateManySliceMetric(MetricBatch)
+	instrumentedStorage.observe("UpdateManySliceMetric", start, err)
+	instrumentedStorage.registry.Add(StorageBatchMetrics, nil, int64(len(MetricBatch)))
+
+	return err
+}
+
+func (instrumentedStorage InstrumentedStorage) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
+	start := time.Now()
+	err := instrumentedStorage.MetricStorage.UpdateMany(DBSchema)
+	instrumentedStorage.observe("UpdateMany", start, err)
+	instrumentedStorage.registry.Add(StorageBatchMetrics, nil, int64(len(DBSchema)))
+
+	return err
+}
+
+func (instrumentedStorage InstrumentedStorage) Save() error {
+	start := time.Now()
+	err := instrumentedStorage.MetricStorage.Save()
+	instrumentedStorage.observe("Save", start, err)
+
+	return err
+}
+
+// observe - учет операции operation, начатой в start.
+func (instrumentedStorage InstrumentedStorage) observe(operation string, start time.Time, err error) {
+	registry := instrumentedStorage.registry
+	registry.Add(StorageOperations, map[string]string{"operation": operation, "result": result(err)}, 1)
+	registry.Add(StorageDuration, map[string]string{"operation": operation}, DurationMicroseconds(start))
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// sseKeepAliveInterval - интервал пустых сообщений потока, чтобы прокси не закрывали простаивающее соединение.
+const sseKeepAliveInterval = 15 * time.Second
+
+// signedMetric - метрика с подписью ключом сервера.
+type signedMetric struct {
+	metrics.Metric
+	Hash string `json:"hash,omitempty"`
+}
+
+func (server Server) signMetric(metric metrics.Metric) signedMetric {
+	answer := signedMetric{Metric: metric}
+	if signKey := server.live.SignKey(); signKey != "" {
+		answer.Hash = hex.EncodeToString(metric.GetHash(metric.ID, signKey))
+	}
+
+	return answer
+}
+
+// ListMetricsGetJSON
+// @Tags Admin
+// @Summary Metric list JSON
+// @ID listMetricsGetJSON
+// @Produce json
+// @Param search query string false "Подстрока ID метрики"
+// @Success 200
+// @Router /api/metrics/ [get]
+func (server Server) ListMetricsGetJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	metrics := storage.SortedMetrics(server.tenantStorage(request).ReadAll(), request.URL.Query().Get("search"))
+	answer := make([]signedMetric, 0, len(metrics))
+	for _, metric := range metrics {
+		answer = append(answer, server.signMetric(metric))
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(answer)
+}
+
+// DeleteMetric
+// @Tags Admin
+// @Summary Delete metric
+// @ID deleteMetric
+// @Produce json
+// @Success 200
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /api/metrics/{statType}/{statName} [delete]
+func (server Server) DeleteMetric(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	statType := chi.URLParam(request, "statType")
+	statName := chi.URLParam(request, "statName")
+	response := metrics.NewDefaultResponse()
+
+	if statType != metrics.MeticTypeGauge && statType != metrics.MeticTypeCounter {
+		http.Error(rw, response.SetStatusError(errors.New("unknown statType")).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	err := server.tenantStorage(request).Delete(statName, statType)
+	if errors.Is(err, storage.ErrMetricNotFound) {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(response.GetJSONBytes())
+}
+
+// WatchMetricsSSE
+// @Tags Admin
+// @Summary Stream of accepted metric updates (Server-Sent Events)
+// @ID watchMetricsSSE
+// @Produce text/event-stream
+// @Param search query string false "Подстрока ID метрики"
+// @Success 200
+// @Failure 500
+// @Router /api/metrics/stream [get]
+func (server Server) WatchMetricsSSE(rw http.ResponseWriter, request *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok || server.watchHub == nil {
+		http.Error(rw, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	subscription := server.watchHub.Subscribe(tenant.FromContext(request.Context()), request.URL.Query().Get("search"))
+	defer subscription.Close()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	var reportedDropped int64
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(rw, ": keep-alive\n\n")
+		case metric, ok := <-subscription.Updates():
+			if !ok {
+				return
+			}
+
+			if dropped := subscription.Dropped(); dropped != reportedDropped {
+				reportedDropped = dropped
+				fmt.Fprintf(rw, "event: dropped\ndata: %d\n\n", dropped)
+			}
+
+			data, err := json.Marshal(server.signMetric(metric))
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(rw, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"devops-tpl/internal/agentapi"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/agents"
+	"devops-tpl/internal/server/tenant"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// agentsUpMetric - метрика количества агентов со статусом up в хранилище арендатора.
+const agentsUpMetric = "agents_up"
+
+// agentsUpInterval - интервал обновления метрики agentsUpMetric.
+const agentsUpInterval = 5 * time.Second
+
+// RegisterAgentPostJSON
+// @Tags Agents
+// @Summary Register agent
+// @ID registerAgentPostJSON
+// @Accept json
+// @Produce json
+// @Success 200
+// @Failure 400
+// @Router /api/agents [post]
+func (server Server) RegisterAgentPostJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := metrics.NewDefaultResponse()
+
+	info := agentapi.Info{}
+	err := json.NewDecoder(request.Body).Decode(&info)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	err = server.agents.Register(tenant.FromContext(request.Context()), info, request.RemoteAddr)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(response.GetJSONBytes())
+}
+
+// AgentHeartbeatPost
+// @Tags Agents
+// @Summary Agent heartbeat
+// @ID agentHeartbeatPost
+// @Produce json
+// @Success 200
+// @Failure 404
+// @Router /api/agents/{agentID}/heartbeat [post]
+func (server Server) AgentHeartbeatPost(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := metrics.NewDefaultResponse()
+
+	err := server.agents.Heartbeat(tenant.FromContext(request.Context()), chi.URLParam(request, "agentID"), request.RemoteAddr)
+	if errors.Is(err, agents.ErrUnknownAgent) {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(response.GetJSONBytes())
+}
+
+// ListAgentsGetJSON
+// @Tags Agents
+// @Summary Agent list JSON
+// @ID listAgentsGetJSON
+// @Produce json
+// @Success 200
+// @Router /api/agents [get]
+func (server Server) ListAgentsGetJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(server.agents.List(tenant.FromContext(request.Context())))
+}
+
+// AgentConfigGetJSON
+// @Tags Agents
+// @Summary Agent configuration from the profile selected by agent labels
+// @ID agentConfigGetJSON
+// @Produce json
+// @Param version query string false "Версия конфигурации агента"
+// @Success 200
+// @Success 304
+// @Failure 404
+// @Router /api/agents/{agentID}/config [get]
+func (server Server) AgentConfigGetJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := metrics.NewDefaultResponse()
+
+	agent, err := server.agents.Get(tenant.FromContext(request.Context()), chi.URLParam(request, "agentID"))
+	if errors.Is(err, agents.ErrUnknownAgent) {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusInternalServerError)
+		return
+	}
+
+	assignment := server.live.AgentProfiles().Select(agent.Labels)
+	if assignment.Version == request.URL.Query().Get("version") {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(assignment)
+}
+
+// runAgentsUp - периодическая запись количества агентов со статусом up в хранилище каждого арендатора с агентами.
+// Реестр агентов хранится в памяти экземпляра, поэтому в кластере задачу выполняет только ведущий экземпляр,
+// и метрика учитывает лишь агентов, зарегистрированных на нем.
+func (server *Server) runAgentsUp(ctx context.Context) {
+	ticker := time.NewTicker(agentsUpInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for tenantName, up := range server.agents.Up() {
+				value := float64(up)
+				err := server.tenants.For(tenantName).Update(agentsUpMetric, metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value})
+				if err != nil {
+					slog.Error("Agents status update error", slog.String("metric", agentsUpMetric), logging.Err(err))
+				}
+			}
+		}
+	}
+}
@@ -4,11 +4,12 @@
 package server
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 
-	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
 
 	"github.com/go-chi/chi"
 )
@@ -35,18 +36,21 @@ func (server Server) UpdateGaugePost(rw http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	err = server.storage.Update(statName, storage.MetricValue{
-		MType: storage.MeticTypeGauge,
+	err = server.tenantStorage(request).Update(statName, metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
 		Value: &statValueFloat,
 	})
 	if err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
-		rw.Write([]byte("Server error"))
+		status := updateErrorStatus(err, http.StatusInternalServerError)
+		rw.WriteHeader(status)
+		if status == http.StatusInternalServerError {
+			rw.Write([]byte("Server error"))
+		} else {
+			rw.Write([]byte(err.Error()))
+		}
 		return
 	}
 
-	log.Println("Update gauge:")
-	log.Printf("%v: %v\n", statName, statValue)
 	rw.WriteHeader(http.StatusOK)
 	rw.Write([]byte("Ok"))
 }
@@ -72,18 +76,16 @@ func (server Server) UpdateCounterPost(rw http.ResponseWriter, request *http.Req
 		return
 	}
 
-	err = server.storage.Update(statName, storage.MetricValue{
-		MType: storage.MeticTypeCounter,
+	err = server.tenantStorage(request).Update(statName, metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 		Delta: &statValueInt,
 	})
 	if err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
+		rw.WriteHeader(updateErrorStatus(err, http.StatusInternalServerError))
 		rw.Write([]byte(err.Error()))
 		return
 	}
 
-	log.Println("Inc counter:")
-	log.Printf("%v: %v\n", statName, statValue)
 	rw.WriteHeader(http.StatusOK)
 	rw.Write([]byte("Ok"))
 }
@@ -98,8 +100,8 @@ func (server Server) UpdateCounterPost(rw http.ResponseWriter, request *http.Req
 // @Param statValue query string false "Значение"
 // @Failure 501
 // @Router /update/{statType}/{statName}/{statValue} [post]
-func (server Server) UpdateNotImplementedPost(rw http.ResponseWriter, _ *http.Request) {
-	log.Println("Update not implemented statType")
+func (server Server) UpdateNotImplementedPost(rw http.ResponseWriter, request *http.Request) {
+	logging.FromContext(request.Context()).Debug("Update not implemented statType", slog.String("type", chi.URLParam(request, "statType")))
 
 	rw.WriteHeader(http.StatusNotImplemented)
 	rw.Write([]byte("Not implemented"))
@@ -119,7 +121,7 @@ func (server Server) PrintMetricGet(rw http.ResponseWriter, request *http.Reques
 	statType := chi.URLParam(request, "statType")
 	statName := chi.URLParam(request, "statName")
 
-	metric, err := server.storage.Read(statName, statType)
+	metric, err := server.tenantStorage(request).Read(statName, statType)
 	if err != nil {
 		rw.WriteHeader(http.StatusNotFound)
 		rw.Write([]byte("Unknown statName"))
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/lineprotocol"
+	"devops-tpl/internal/server/responses"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// WriteLineProtocol
+// @Tags Update
+// @Summary Update metrics using InfluxDB line protocol
+// @ID writeLineProtocol
+// @Accept plain
+// @Produce json
+// @Param precision query string false "Точность временных меток" Enums(ns, us, ms, s, m, h) default(ns)
+// @Success 204
+// @Failure 400
+// @Failure 413
+// @Failure 500
+// @Router /write [post]
+func (server Server) WriteLineProtocol(rw http.ResponseWriter, request *http.Request) {
+	response := responses.NewWriteResponse()
+
+	precision, err := lineprotocol.PrecisionMultiplier(request.URL.Query().Get("precision"))
+	if err != nil {
+		rw.Header().Set("Content-Type", "application/json")
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := readRequestBody(rw, request)
+	if err != nil {
+		rw.Header().Set("Content-Type", "application/json")
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), bodyErrorStatus(err))
+		return
+	}
+
+	points, lineErrors := lineprotocol.Parse(bytes.NewReader(body), precision, time.Now())
+	batch := server.lineProtocolMetrics(points)
+
+	if len(batch) != 0 {
+		err = server.tenantStorage(request).UpdateManySliceMetric(batch)
+		if err != nil {
+			rw.Header().Set("Content-Type", "application/json")
+			http.Error(rw, response.SetStatusError(err).GetJSONString(), updateErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+
+	if len(lineErrors) != 0 {
+		response.Written = len(batch)
+		rw.Header().Set("Content-Type", "application/json")
+		http.Error(rw, response.SetLineErrors(lineErrors).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// lineProtocolMetrics - преобразование точек в метрики в порядке временных меток: при нескольких точках
+// одной gauge метрики сохраняется значение с последней меткой, а не последней строки запроса.
+// ID метрики: measurement_field{tag="value",...}; строковые поля пропускаются,
+// boolean сохраняются как gauge 1/0, целочисленные - как counter или gauge в зависимости от конфигурации.
+func (server Server) lineProtocolMetrics(points []lineprotocol.Point) []metrics.Metric {
+	var batch []metrics.Metric
+
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+
+	for _, point := range points {
+		for _, field := range point.Fields {
+			metricID := metrics.MetricIDWithLabels(point.Measurement+"_"+field.Key, point.Tags)
+
+			var metricValue metrics.MetricValue
+			switch field.Type {
+			case lineprotocol.FieldFloat:
+				metricValue = newGaugeValue(field.Float)
+			case lineprotocol.FieldBoolean:
+				if field.Bool {
+					metricValue = newGaugeValue(1)
+				} else {
+					metricValue = newGaugeValue(0)
+				}
+			case lineprotocol.FieldInteger, lineprotocol.FieldUnsigned:
+				intValue := field.Int
+				if field.Type == lineprotocol.FieldUnsigned {
+					// Значения больше MaxInt64 отклоняются при разборе (ErrFieldRange)
+					intValue = int64(field.Uint)
+				}
+
+				if server.config.Influx.IntegerAsCounter {
+					metricValue = metrics.MetricValue{
+						MType: metrics.MeticTypeCounter,
+						Delta: &intValue,
+					}
+				} else {
+					metricValue = newGaugeValue(float64(intValue))
+				}
+			default:
+				continue
+			}
+
+			batch = append(batch, metrics.Metric{
+				ID:          metricID,
+				MetricValue: metricValue,
+			})
+		}
+	}
+
+	return batch
+}
+
+func newGaugeValue(value float64) metrics.MetricValue {
+	return metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
+		Value: &value,
+	}
+}
@@ -2,13 +2,11 @@ package server
 
 import (
 	"crypto/hmac"
-	"devops-tpl/internal/server/responses"
-	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/metrics"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"github.com/asaskevich/govalidator"
-	"log"
 	"net/http"
 )
 
@@ -24,10 +22,10 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 	rw.Header().Set("Content-Type", "application/json")
 
 	inputJSON := struct {
-		storage.Metric
+		metrics.Metric
 		Hash string `json:"hash,omitempty"`
 	}{}
-	response := responses.NewUpdateMetricResponse()
+	response := metrics.NewUpdateMetricResponse()
 
 	//JSON decoding
 	err := json.NewDecoder(request.Body).Decode(&inputJSON)
@@ -43,7 +41,7 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 		return
 	}
 
-	newMetricValue := storage.MetricValue{
+	newMetricValue := metrics.MetricValue{
 		MType: inputJSON.MType,
 		Value: inputJSON.Value,
 		Delta: inputJSON.Delta,
@@ -51,7 +49,7 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 
 	//Check sign
 	var metricHash []byte
-	if server.config.SignKey != "" {
+	if signKey := server.live.SignKey(); signKey != "" {
 		var requestMetricHash []byte
 		requestMetricHash, err = hex.DecodeString(inputJSON.Hash)
 		if err != nil {
@@ -59,7 +57,7 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 			return
 		}
 
-		metricHash = newMetricValue.GetHash(inputJSON.ID, server.config.SignKey)
+		metricHash = newMetricValue.GetHash(inputJSON.ID, signKey)
 		if !hmac.Equal(requestMetricHash, metricHash) {
 			http.Error(rw, response.SetStatusError(errors.New("invalid hash")).GetJSONString(), http.StatusBadRequest)
 			return
@@ -67,9 +65,9 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 	}
 
 	//Update value
-	err = server.storage.Update(inputJSON.ID, newMetricValue)
+	err = server.tenantStorage(request).Update(inputJSON.ID, newMetricValue)
 	if err != nil {
-		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), updateErrorStatus(err, http.StatusBadRequest))
 		return
 	}
 
@@ -82,26 +80,25 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 // @Summary Update metric value using batch JSON
 // @ID updateMetricBatchJSON
 // @Produce json
-// @Param JSON body []storage.Metric true "JSON"
+// @Param JSON body []metrics.Metric true "JSON"
 // @Success 200
 // @Failure 400
 // @Router /updates/ [post]
 func (server Server) UpdateMetricBatchJSON(rw http.ResponseWriter, request *http.Request) {
 	rw.Header().Set("Content-Type", "application/json")
 
-	var metrics []storage.Metric
-	response := responses.NewUpdateMetricResponse()
+	var batch []metrics.Metric
+	response := metrics.NewUpdateMetricResponse()
 
 	//JSON decoding
-	log.Println(request.Body)
-	err := json.NewDecoder(request.Body).Decode(&metrics)
+	err := json.NewDecoder(request.Body).Decode(&batch)
 	if err != nil {
 		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
 		return
 	}
 
 	//Validation
-	for _, OneMetric := range metrics {
+	for _, OneMetric := range batch {
 		_, err = govalidator.ValidateStruct(OneMetric)
 		if err != nil {
 			http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
@@ -109,14 +106,14 @@ func (server Server) UpdateMetricBatchJSON(rw http.ResponseWriter, request *http
 		}
 	}
 
-	err = server.storage.UpdateManySliceMetric(metrics)
+	err = server.tenantStorage(request).UpdateManySliceMetric(batch)
 	if err != nil {
-		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), updateErrorStatus(err, http.StatusBadRequest))
 		return
 	}
 
 	rw.WriteHeader(http.StatusOK)
-	jsonBytes, _ := json.Marshal(&metrics)
+	jsonBytes, _ := json.Marshal(&batch)
 	rw.Write(jsonBytes)
 }
 
@@ -148,19 +145,19 @@ func (server Server) MetricValuePostJSON(rw http.ResponseWriter, request *http.R
 		return
 	}
 
-	statValue, err := server.storage.Read(inputMetricsJSON.ID, inputMetricsJSON.MType)
+	statValue, err := server.tenantStorage(request).Read(inputMetricsJSON.ID, inputMetricsJSON.MType)
 	if err != nil {
 		http.Error(rw, "Unknown statName", http.StatusNotFound)
 		return
 	}
 
 	answerJSON := struct {
-		storage.Metric
+		metrics.Metric
 		Hash string `json:"hash"`
 	}{
-		Metric: storage.Metric{
+		Metric: metrics.Metric{
 			ID: inputMetricsJSON.ID,
-			MetricValue: storage.MetricValue{
+			MetricValue: metrics.MetricValue{
 				MType: statValue.MType,
 				Delta: statValue.Delta,
 				Value: statValue.Value,
@@ -168,8 +165,8 @@ func (server Server) MetricValuePostJSON(rw http.ResponseWriter, request *http.R
 		},
 	}
 
-	if server.config.SignKey != "" {
-		answerJSON.Hash = hex.EncodeToString(answerJSON.GetHash(inputMetricsJSON.ID, server.config.SignKey))
+	if signKey := server.live.SignKey(); signKey != "" {
+		answerJSON.Hash = hex.EncodeToString(answerJSON.GetHash(inputMetricsJSON.ID, signKey))
 	}
 
 	rw.WriteHeader(http.StatusOK)
@@ -189,7 +186,7 @@ func (server Server) MetricValuePostJSON(rw http.ResponseWriter, request *http.R
 // @Router /ping [get]
 func (server Server) PingGetJSON(rw http.ResponseWriter, _ *http.Request) {
 	rw.Header().Set("Content-Type", "application/json")
-	response := responses.NewDefaultResponse()
+	response := metrics.NewDefaultResponse()
 	pingError := server.storage.Ping()
 
 	if pingError != nil {
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/server/limits"
+	"devops-tpl/internal/server/otlp"
+	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExportOTLPMetrics
+// @Tags Update
+// @Summary Update metrics using OTLP/HTTP
+// @ID exportOTLPMetrics
+// @Accept json
+// @Produce json
+// @Success 200
+// @Failure 400
+// @Failure 413
+// @Failure 415
+// @Failure 500
+// @Router /v1/metrics [post]
+func (server Server) ExportOTLPMetrics(rw http.ResponseWriter, request *http.Request) {
+	mediaType, err := otlp.MediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	bodyBytes, err := readRequestBody(rw, request)
+	if err != nil {
+		writeOTLPResponse(rw, mediaType, bodyErrorStatus(err), status.New(codes.InvalidArgument, err.Error()).Proto())
+		return
+	}
+
+	exportRequest, err := otlp.Unmarshal(mediaType, bodyBytes)
+	if err != nil {
+		writeOTLPResponse(rw, mediaType, http.StatusBadRequest, status.New(codes.InvalidArgument, err.Error()).Proto())
+		return
+	}
+
+	rejected, err := server.otlpReceivers.For(tenant.FromContext(request.Context())).Consume(server.tenantStorage(request), exportRequest)
+	if err != nil {
+		code := codes.Internal
+		switch {
+		case errors.Is(err, storage.ErrQuotaExceeded), errors.Is(err, limits.ErrLimitExceeded):
+			code = codes.ResourceExhausted
+		case errors.Is(err, storage.ErrTenantPrefix):
+			code = codes.InvalidArgument
+		}
+		writeOTLPResponse(rw, mediaType, updateErrorStatus(err, http.StatusInternalServerError), status.New(code, err.Error()).Proto())
+		return
+	}
+
+	writeOTLPResponse(rw, mediaType, http.StatusOK, otlp.Response(rejected))
+}
+
+func writeOTLPResponse(rw http.ResponseWriter, mediaType string, statusCode int, message proto.Message) {
+	responseBytes, err := otlp.Marshal(mediaType, message)
+	if err != nil {
+		slog.Error("OTLP response marshal error", logging.Err(err))
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", mediaType)
+	rw.WriteHeader(statusCode)
+	rw.Write(responseBytes)
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"crypto/rsa"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/reload"
+	handlerRSA "devops-tpl/internal/rsa"
+	"devops-tpl/internal/server/agents"
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/tenant"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+)
+
+// liveConfig - настройки, которые меняются без перезапуска сервера. Обработчики и middleware читают их
+// при каждом запросе, поэтому новая конфигурация действует сразу после Reload.
+type liveConfig struct {
+	mutex         *sync.RWMutex
+	config        config.Config
+	trustedSubNet *net.IPNet
+	privateKeyRSA *rsa.PrivateKey
+	// keySet - API ключи, nil - аутентификация выключена
+	keySet *auth.KeySet
+	// tenantQuotas - квоты отдельных арендаторов из файла квот
+	tenantQuotas map[string]tenant.Quota
+	// agentProfiles - профили конфигурации агентов, nil - без профилей
+	agentProfiles *agents.Profiles
+}
+
+// liveFiles - разобранные значения настроек и файлов конфигурации, применяемые вместе с ней (liveConfig.apply).
+type liveFiles struct {
+	trustedSubNet *net.IPNet
+	privateKeyRSA *rsa.PrivateKey
+	keySet        *auth.KeySet
+	tenantQuotas  map[string]tenant.Quota
+	agentProfiles *agents.Profiles
+}
+
+func newLiveConfig(config config.Config) (*liveConfig, error) {
+	files, err := loadLiveFiles(config)
+	if err != nil {
+		return nil, err
+	}
+
+	live := &liveConfig{mutex: &sync.RWMutex{}}
+	live.apply(config, files)
+
+	return live, nil
+}
+
+// loadLiveFiles - разбор настроек и чтение файлов конфигурации. Ошибка любого из них не меняет действующую
+// конфигурацию: применение (apply) выполняется только после успешной загрузки всех.
+func loadLiveFiles(config config.Config) (liveFiles, error) {
+	var files liveFiles
+	var err error
+
+	if config.TrustedSubNet != "" {
+		_, files.trustedSubNet, err = net.ParseCIDR(config.TrustedSubNet)
+		if err != nil {
+			return liveFiles{}, err
+		}
+	}
+
+	if config.PrivateKeyRSA != "" {
+		files.privateKeyRSA, err = handlerRSA.ParsePrivateKeyRSA(config.PrivateKeyRSA)
+		if err != nil {
+			return liveFiles{}, err
+		}
+	}
+
+	if config.Auth.KeysFile != "" {
+		files.keySet, err = auth.LoadKeySet(config.Auth.KeysFile)
+		if err != nil {
+			return liveFiles{}, err
+		}
+	}
+
+	if config.Tenants.QuotasFile != "" {
+		files.tenantQuotas, err = tenant.LoadQuotas(config.Tenants.QuotasFile)
+		if err != nil {
+			return liveFiles{}, err
+		}
+	}
+
+	if config.Agents.ProfilesFile != "" {
+		files.agentProfiles, err = agents.LoadProfiles(config.Agents.ProfilesFile)
+		if err != nil {
+			return liveFiles{}, err
+		}
+	}
+
+	return files, nil
+}
+
+func (live *liveConfig) apply(config config.Config, files liveFiles) {
+	live.mutex.Lock()
+	defer live.mutex.Unlock()
+	live.config = config
+	live.trustedSubNet = files.trustedSubNet
+	live.privateKeyRSA = files.privateKeyRSA
+	live.keySet = files.keySet
+	live.tenantQuotas = files.tenantQuotas
+	live.agentProfiles = files.agentProfiles
+}
+
+func (live *liveConfig) Config() config.Config {
+	live.mutex.RLock()
+	defer live.mutex.RUnlock()
+
+	return live.config
+}
+
+func (live *liveConfig) SignKey() string {
+	live.mutex.RLock()
+	defer live.mutex.RUnlock()
+
+	return live.config.SignKey
+}
+
+func (live *liveConfig) TrustedSubNet() *net.IPNet {
+	live.mutex.RLock()
+	defer live.mutex.RUnlock()
+
+	return live.trustedSubNet
+}
+
+func (live *liveConfig) PrivateKeyRSA() *rsa.PrivateKey {
+	live.mutex.RLock()
+	defer live.mutex.RUnlock()
+
+	return live.privateKeyRSA
+}
+
+func (live *liveConfig) KeySet() *auth.KeySet {
+	live.mutex.RLock()
+	defer live.mutex.RUnlock()
+
+	return live.keySet
+}
+
+// Limits - ограничения приема метрик от клиентов.
+func (live *liveConfig) Limits() config.LimitsConfig {
+	live.mutex.RLock()
+	defer live.mutex.RUnlock()
+
+	return live.config.Limits
+}
+
+// Agents - настройки статуса агентов.
+func (live *liveConfig) Agents() config.AgentsConfig {
+	live.mutex.RLock()
+	defer live.mutex.RUnlock()
+
+	return live.config.Agents
+}
+
+// AgentProfiles - профили конфигурации агентов.
+func (live *liveConfig) AgentProfiles() *agents.Profiles {
+	live.mutex.RLock()
+	defer live.mutex.RUnlock()
+
+	return live.agentProfiles
+}
+
+// TenantMaxMetrics - квота количества метрик арендатора: из файла квот, иначе общая, 0 - без ограничения.
+func (live *liveConfig) TenantMaxMetrics(tenantName string) int {
+	live.mutex.RLock()
+	defer live.mutex.RUnlock()
+
+	if quota, ok := live.tenantQuotas[tenantName]; ok {
+		return quota.MaxMetrics
+	}
+
+	return live.config.Tenants.MaxMetrics
+}
+
+// Reload - применение новой конфигурации без перезапуска: ключ подписи, доверенная сеть, RSA ключ,
+// API ключи, квоты арендаторов и профили агентов (файлы перечитываются), ограничения клиентов, статус агентов,
+// уровень журнала (DebugMode) и настройки хранилища, поддерживающего Reconfigure. Возвращает измененные поля,
+// для применения которых нужен перезапуск, - они остаются прежними. При ошибке в любой из настроек или файлов
+// не меняется ничего, в том числе настройки хранилища.
+func (server *Server) Reload(next config.Config) ([]string, error) {
+	err := next.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	server.reloadMutex.Lock()
+	defer server.reloadMutex.Unlock()
+
+	current := server.live.Config()
+	applied := current
+	applied.SignKey = next.SignKey
+	applied.TrustedSubNet = next.TrustedSubNet
+	applied.PrivateKeyRSA = next.PrivateKeyRSA
+	applied.Auth.KeysFile = next.Auth.KeysFile
+	applied.Tenants = next.Tenants
+	applied.Limits = next.Limits
+	applied.Agents = next.Agents
+	applied.DebugMode = next.DebugMode
+
+	files, err := loadLiveFiles(applied)
+	if err != nil {
+		return nil, err
+	}
+
+	if server.reconfigurable != nil {
+		applied.Store = server.reconfigurable.Reconfigure(current.Store, next.Store)
+	}
+	server.live.apply(applied, files)
+	logging.SetDebug(applied.DebugMode)
+
+	if changed := reload.Changed(current, applied); len(changed) != 0 {
+		slog.Info("Config reloaded", slog.String("applied", strings.Join(changed, ", ")))
+	}
+
+	return reload.Changed(applied, next), nil
+}
+
+// reloadConfig - повторное чтение конфигурации запуска (файл и переменные окружения) и применение.
+func (server *Server) reloadConfig() {
+	next, err := server.config.Reload()
+	if err != nil {
+		slog.Error("Config reload failed, keeping current config", logging.Err(err))
+		return
+	}
+
+	restartRequired, err := server.Reload(next)
+	if err != nil {
+		slog.Error("Config reload failed, keeping current config", logging.Err(err))
+		return
+	}
+	if len(restartRequired) != 0 {
+		slog.Warn("Config reload: restart required", slog.String("fields", strings.Join(restartRequired, ", ")))
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingStorage - хранилище, запоминающее вызовы Reconfigure.
+type recordingStorage struct {
+	calls int
+}
+
+func (recording *recordingStorage) Reconfigure(current config.StoreConfig, next config.StoreConfig) config.StoreConfig {
+	recording.calls++
+	return next
+}
+
+func TestReloadBrokenFileKeepsConfig(t *testing.T) {
+	dir := t.TempDir()
+	keysFile := filepath.Join(dir, "keys.json")
+	keys := `[{"name":"agent","hash":"` + auth.HashToken("token") + `","scopes":["write"]}]`
+	require.NoError(t, os.WriteFile(keysFile, []byte(keys), 0600))
+	brokenFile := filepath.Join(dir, "broken.json")
+	require.NoError(t, os.WriteFile(brokenFile, []byte("{"), 0600))
+
+	current, _, err := config.Load([]string{"-a", "127.0.0.1:0"})
+	require.NoError(t, err)
+	current.Auth.KeysFile = keysFile
+	current.Store.Interval = time.Minute
+
+	for name, breakConfig := range map[string]func(next *config.Config){
+		// Файл ключей проверяется и при Validate, профили агентов - только при загрузке
+		"keys file":           func(next *config.Config) { next.Auth.KeysFile = brokenFile },
+		"agent profiles file": func(next *config.Config) { next.Agents.ProfilesFile = brokenFile },
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := NewServer(current)
+			recording := &recordingStorage{}
+			server.reconfigurable = recording
+			keySet := server.live.KeySet()
+
+			next := current
+			next.SignKey = "new-key"
+			next.Store.Interval = time.Hour
+			breakConfig(&next)
+
+			_, err := server.Reload(next)
+			require.Error(t, err)
+			require.Zero(t, recording.calls)
+			require.Equal(t, current, server.live.Config())
+			require.Same(t, keySet, server.live.KeySet())
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"devops-tpl/internal/logging"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ServerMetricsGetJSON
+// @Tags Metrics
+// @Summary Server self-observability metrics JSON
+// @ID serverMetricsGetJSON
+// @Produce json
+// @Success 200
+// @Router /api/server/metrics [get]
+func (server Server) ServerMetricsGetJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(server.selfMetrics.Metrics())
+}
+
+// runSelfMetrics - периодическая запись метрик сервера в хранилище арендатора SelfMetrics.Tenant,
+// при SelfMetrics.Interval 0 метрики доступны только по GET /api/server/metrics.
+func (server *Server) runSelfMetrics(ctx context.Context) {
+	selfMetricsConfig := server.config.SelfMetrics
+	if selfMetricsConfig.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(selfMetricsConfig.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := server.selfMetrics.Flush(server.tenants.For(selfMetricsConfig.Tenant))
+			if err != nil {
+				slog.Error("Self metrics store error", logging.Err(err))
+			}
+		}
+	}
+}
@@ -1,20 +1,35 @@
 package server
 
 import (
+	"compress/gzip"
 	"context"
-	"crypto/rsa"
-	handlerRSA "devops-tpl/internal/rsa"
+	"crypto/tls"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/reload"
+	"devops-tpl/internal/server/agents"
+	"devops-tpl/internal/server/auth"
+	"devops-tpl/internal/server/cluster"
 	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/federation"
+	"devops-tpl/internal/server/graphite"
 	grpcServices "devops-tpl/internal/server/grpc"
+	"devops-tpl/internal/server/limits"
 	"devops-tpl/internal/server/middleware"
+	"devops-tpl/internal/server/otlp"
+	"devops-tpl/internal/server/selfmetrics"
 	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
+	"devops-tpl/internal/server/watch"
 	pb "devops-tpl/proto"
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi"
 	chimiddleware "github.com/go-chi/chi/middleware"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"google.golang.org/grpc"
+	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
@@ -23,93 +38,302 @@ import (
 )
 
 type Server struct {
-	storage       storage.MetricStorage
-	chiRouter     chi.Router
-	config        config.Config
-	privateKeyRSA *rsa.PrivateKey
-	startTime     time.Time
-	serverGRPC    *grpc.Server
+	storage storage.MetricStorage
+	// tenants - хранилища арендаторов над storage, обработчики работают с хранилищем арендатора запроса
+	tenants *storage.Tenants
+	// limiter - ограничения приема метрик от клиентов, проверяются в хранилище запроса (tenantStorage)
+	limiter   *limits.Limiter
+	chiRouter chi.Router
+	// config - конфигурация запуска, live - действующие настройки, изменяемые без перезапуска (Reload)
+	config           config.Config
+	live             *liveConfig
+	reloadMutex      *sync.Mutex
+	reconfigurable   storage.Reconfigurable
+	startTime        time.Time
+	serverGRPC       *grpc.Server
+	graphiteListener *graphite.Listener
+	otlpReceivers    *otlp.Receivers
+	// notifier, invalidator и elector заданы в режиме кластера (несколько серверов над одной БД)
+	notifier      *cluster.Notifier
+	invalidator   cluster.Invalidator
+	elector       *cluster.Elector
+	singletonJobs []cluster.Job
+	forwarder     *federation.Forwarder
+	// watchHub - рассылка принятых обновлений для просмотра в реальном времени (metricsctl tail)
+	watchHub *watch.Hub
+	// agents - реестр агентов арендаторов со статусом по heartbeat
+	agents *agents.Registry
+	// selfMetrics - метрики работы самого сервера: запросы, операции хранилища, отклоненные запросы
+	selfMetrics *selfmetrics.Registry
 }
 
 func NewServer(config config.Config) (server *Server) {
 	var err error
 	server = &Server{
-		config:     config,
-		serverGRPC: grpc.NewServer(),
+		config:      config,
+		reloadMutex: &sync.Mutex{},
 	}
-	log.Println(server.config)
 
-	if config.PrivateKeyRSA != "" {
-		server.privateKeyRSA, err = handlerRSA.ParsePrivateKeyRSA(config.PrivateKeyRSA)
-	}
+	server.live, err = newLiveConfig(config)
 	if err != nil {
-		log.Fatal("Parsing RSA key error ", err)
+		logging.Fatal("Parsing config error", logging.Err(err))
 	}
+
+	server.limiter = limits.NewLimiter(server.live.Limits)
+	server.agents = agents.NewRegistry(server.live.Agents)
+	server.selfMetrics = selfmetrics.NewRegistry()
+
+	selfMetricsInterceptor := grpcServices.NewSelfMetricsInterceptor(server.selfMetrics)
+	authInterceptor := grpcServices.NewAuthInterceptor(server.live.KeySet)
+	limitInterceptor := grpcServices.NewLimitInterceptor(server.limiter)
+	server.serverGRPC = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(selfMetricsInterceptor.Unary, authInterceptor.Unary, limitInterceptor.Unary),
+		grpc.ChainStreamInterceptor(selfMetricsInterceptor.Stream, authInterceptor.Stream),
+	)
 	return
 }
 
-func (server *Server) selectStorage() storage.MetricStorage {
+func (server *Server) selectStorage() (storage.MetricStorage, error) {
+	storageConfig := server.config.Store
+
+	repository, err := server.selectRepository()
+	if err != nil {
+		return nil, err
+	}
+
+	dbRepo, clustered := repository.(storage.DBRepo)
+	if server.config.Cluster.Enabled && !clustered {
+		slog.Warn("Cluster mode requires postgres storage, disabled")
+	}
+	clustered = clustered && server.config.Cluster.Enabled
+
+	metricStorage := repository
+	if storageConfig.Cache && storageConfig.DatabaseDSN != "" {
+		slog.Info("Storage cache enabled")
+		reloadInterval := storageConfig.CacheReloadInterval
+		if clustered {
+			// Кэш перезагружает только ведущий экземпляр, остальные получают изменения уведомлениями
+			reloadInterval = 0
+		}
+		cachedRepo := storage.NewCachedRepo(repository, storageConfig.CacheStaleness, reloadInterval)
+		server.invalidator = cachedRepo
+		metricStorage = cachedRepo
+
+		if clustered && storageConfig.CacheReloadInterval > 0 {
+			server.singletonJobs = append(server.singletonJobs, func(ctx context.Context) {
+				cachedRepo.RunReload(ctx, storageConfig.CacheReloadInterval)
+			})
+		}
+	}
+	server.reconfigurable, _ = metricStorage.(storage.Reconfigurable)
+	if observable, ok := repository.(storage.SnapshotObservable); ok {
+		observable.ObserveSnapshots(server.selfMetrics.ObserveSnapshot)
+	}
+
+	if clustered {
+		instanceID := server.config.Cluster.InstanceID
+		if instanceID == "" {
+			instanceID = cluster.DefaultInstanceID()
+		}
+		slog.Info("Cluster mode", slog.String("instance", instanceID))
+
+		server.notifier = cluster.NewNotifier(dbRepo.DB(), server.config.Cluster.Channel, instanceID)
+		server.elector = cluster.NewElector(dbRepo.DB(), cluster.LeaderLockKey, server.config.Cluster.LeaderInterval)
+		metricStorage = cluster.NewNotifyingStorage(metricStorage, server.notifier)
+	}
+
+	return metricStorage, nil
+}
+
+// runCluster - прием уведомлений других экземпляров и выбор ведущего для единичных фоновых задач.
+func (server *Server) runCluster(ctx context.Context) {
+	if server.notifier != nil {
+		// Кэш сбрасывается до рассылки подписчикам, чтобы они читали уже новые значения
+		var handlers []func(cluster.Notification)
+		if server.invalidator != nil {
+			handlers = append(handlers, cluster.InvalidateHandler(server.invalidator))
+		}
+		handlers = append(handlers, cluster.PublishHandler(server.watchHub))
+		go server.notifier.Listen(ctx, cluster.Handlers(handlers...))
+	}
+
+	if server.elector != nil {
+		go server.elector.Run(ctx, server.singletonJobs...)
+	}
+}
+
+// selectRepository - хранилище по конфигурации: SQLite, Postgres или память.
+// Ошибка подключения или миграции БД останавливает запуск сервера.
+func (server *Server) selectRepository() (storage.MetricStorage, error) {
 	storageConfig := server.config.Store
 
+	if storage.IsSQLiteDSN(storageConfig.DatabaseDSN) {
+		slog.Info("SQLite Storage")
+		repository, err := storage.NewSQLiteRepo(storageConfig)
+		if err != nil {
+			return nil, fmt.Errorf("SQLite storage: %w", err)
+		}
+
+		return repository, nil
+	}
+
 	if storageConfig.DatabaseDSN != "" {
-		log.Println("DB Storage")
+		slog.Info("DB Storage")
 		repository, err := storage.NewDBRepo(storageConfig)
 		if err != nil {
-			log.Println(err)
+			return nil, fmt.Errorf("DB storage: %w", err)
 		}
 
-		return repository
+		return repository, nil
 	}
 
-	log.Println("Memory Storage")
+	slog.Info("Memory Storage")
 	repository := storage.NewMetricsMemoryRepo(storageConfig)
 
-	return repository
+	return repository, nil
 }
 
-func (server *Server) initStorage() {
-	metricsMemoryRepo := server.selectStorage()
-	server.storage = metricsMemoryRepo
+// SetForwarder - пересылка метрик на вышестоящие серверы, задается до Run.
+func (server *Server) SetForwarder(forwarder *federation.Forwarder) {
+	server.forwarder = forwarder
+}
+
+func (server *Server) initStorage() error {
+	metricsMemoryRepo, err := server.selectStorage()
+	if err != nil {
+		return err
+	}
+	server.storage = selfmetrics.NewInstrumentedStorage(metricsMemoryRepo, server.selfMetrics)
 
 	if server.config.Store.Restore {
 		server.storage.InitFromFile()
 	}
+
+	if server.forwarder != nil && server.forwarder.Mode() == federation.ModeRelay {
+		server.storage = federation.NewForwardingStorage(server.storage, server.forwarder)
+	}
+	server.watchHub = watch.NewHub()
+	server.storage = watch.NewWatchingStorage(server.storage, server.watchHub)
+	server.tenants = storage.NewTenants(server.storage, server.live.TenantMaxMetrics)
+	server.limiter.SetStorage(server.storage)
+	server.otlpReceivers = otlp.NewReceivers()
+
+	return nil
+}
+
+// tenantStorage - хранилище арендатора запроса (middleware.NewAuthHandle) с проверкой ограничений
+// записи клиента (middleware.NewLimitHandle) и записью изменений в журнал запроса.
+func (server Server) tenantStorage(request *http.Request) storage.MetricStorage {
+	tenantName := tenant.FromContext(request.Context())
+	tenantStorage := server.limiter.For(limits.ClientFromContext(request.Context()), tenantName, server.tenants.For(tenantName))
+	return storage.NewLoggingRepo(tenantStorage, logging.FromContext(request.Context()))
+}
+
+// updateErrorStatus - HTTP статус ошибки записи: превышение квоты арендатора или ограничения клиента - 429,
+// ID с префиксом арендатора - 400, остальные ошибки - defaultStatus.
+func updateErrorStatus(err error, defaultStatus int) int {
+	switch {
+	case errors.Is(err, storage.ErrQuotaExceeded), errors.Is(err, limits.ErrLimitExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, storage.ErrTenantPrefix):
+		return http.StatusBadRequest
+	default:
+		return defaultStatus
+	}
+}
+
+// shutdownTimeout - время на завершение обработки запросов и соединений при остановке сервера.
+const shutdownTimeout = 10 * time.Second
+
+// maxRequestBodySize - ограничение размера тела запроса приема метрик, в том числе после распаковки gzip.
+const maxRequestBodySize = 32 << 20
+
+// readRequestBody - чтение тела запроса приема метрик с распаковкой gzip (Content-Encoding: gzip).
+// Тело больше maxRequestBodySize возвращает ошибку *http.MaxBytesError.
+func readRequestBody(rw http.ResponseWriter, request *http.Request) ([]byte, error) {
+	var body io.ReadCloser = http.MaxBytesReader(rw, request.Body, maxRequestBodySize)
+	if request.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		body = http.MaxBytesReader(rw, gzipReader, maxRequestBodySize)
+	}
+
+	return io.ReadAll(body)
+}
+
+// bodyErrorStatus - код ответа на ошибку чтения тела запроса.
+func bodyErrorStatus(err error) int {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
 }
 
 func (server *Server) initRouter() {
 	router := chi.NewRouter()
 
-	router.Use(chimiddleware.Logger)
+	router.Use(chimiddleware.RequestID)
+	router.Use(middleware.RequestLogHandle)
+	// До Recoverer, чтобы учитывать ответы 500 после паники обработчика
+	router.Use(middleware.NewSelfMetricsHandle(server.selfMetrics))
 	router.Use(chimiddleware.Recoverer)
 	router.Use(middleware.GzipHandle)
 
-	if server.privateKeyRSA != nil {
-		RSAHandle := middleware.NewRSAHandle(server.privateKeyRSA)
-		router.Use(RSAHandle)
-	}
+	// Доверенная сеть и RSA ключ читаются при каждом запросе и меняются без перезапуска
+	router.Use(middleware.NewSubNetHandle(server.live.TrustedSubNet))
 
-	if server.config.TrustedSubNet != "" {
-		_, trustedSubNet, err := net.ParseCIDR(server.config.TrustedSubNet)
-		if err != nil {
-			log.Fatal("net.ParseCIDR error : ", err)
-		}
-		SubNetHandle := middleware.NewSubNetHandle(trustedSubNet)
-		router.Use(SubNetHandle)
-	}
+	// API ключи читаются при каждом запросе, без файла ключей проверки нет
+	writeAuth := middleware.NewAuthHandle(server.live.KeySet, auth.ScopeWrite)
+	readAuth := middleware.NewAuthHandle(server.live.KeySet, auth.ScopeRead)
+	adminAuth := middleware.NewAuthHandle(server.live.KeySet, auth.ScopeAdmin)
+	// Ограничения клиента записи, после аутентификации: клиент - API ключ
+	writeLimit := middleware.NewLimitHandle(server.limiter)
+
+	// Сторонние клиенты (Telegraf) не шифруют тело запроса
+	router.With(writeAuth, writeLimit).Post("/write", server.WriteLineProtocol)
+	router.With(writeAuth, writeLimit).Post("/v1/metrics", server.ExportOTLPMetrics)
+
+	router.Group(func(router chi.Router) {
+		router.Use(middleware.NewRSAHandle(server.live.PrivateKeyRSA))
+
+		router.Get("/ping", server.PingGetJSON)
+
+		router.Group(func(router chi.Router) {
+			router.Use(readAuth)
+
+			router.Get("/", server.PrintAllMetricStatic)
+			router.Get("/value/{statType}/{statName}", server.PrintMetricGet)
+			router.Post("/value/", server.MetricValuePostJSON)
+
+			router.Get("/api/metrics", server.ListMetricsGetJSON)
+			router.Get("/api/metrics/stream", server.WatchMetricsSSE)
+			router.Get("/api/agents", server.ListAgentsGetJSON)
+		})
+
+		router.With(adminAuth).Delete("/api/metrics/{statType}/{statName}", server.DeleteMetric)
+		router.With(adminAuth).Get("/api/server/metrics", server.ServerMetricsGetJSON)
 
-	router.Get("/", server.PrintAllMetricStatic)
-	router.Get("/ping", server.PingGetJSON)
-	router.Get("/value/{statType}/{statName}", server.PrintMetricGet)
+		router.Group(func(router chi.Router) {
+			router.Use(writeAuth)
+			router.Use(writeLimit)
 
-	router.Post("/value/", server.MetricValuePostJSON)
-	router.Post("/updates/", server.UpdateMetricBatchJSON)
+			router.Post("/api/agents", server.RegisterAgentPostJSON)
+			router.Post("/api/agents/{agentID}/heartbeat", server.AgentHeartbeatPost)
+			router.Get("/api/agents/{agentID}/config", server.AgentConfigGetJSON)
 
-	router.Route("/update/", func(router chi.Router) {
-		router.Post("/", server.UpdateMetricPostJSON)
+			router.Post("/updates/", server.UpdateMetricBatchJSON)
+			router.Route("/update/", func(router chi.Router) {
+				router.Post("/", server.UpdateMetricPostJSON)
 
-		router.Post("/gauge/{statName}/{statValue}", server.UpdateGaugePost)
-		router.Post("/counter/{statName}/{statValue}", server.UpdateCounterPost)
-		router.Post("/{statType}/{statName}/{statValue}", server.UpdateNotImplementedPost)
+				router.Post("/gauge/{statName}/{statValue}", server.UpdateGaugePost)
+				router.Post("/counter/{statName}/{statValue}", server.UpdateCounterPost)
+				router.Post("/{statType}/{statName}/{statValue}", server.UpdateNotImplementedPost)
+			})
+		})
 	})
 
 	server.chiRouter = router
@@ -118,50 +342,121 @@ func (server *Server) initRouter() {
 func (server *Server) RunServerGRPC() (err error) {
 	lis, err := net.Listen("tcp", server.config.ServerGRPCAddr)
 	if err != nil {
-		log.Println("net.Listen tcp error", err)
+		slog.Error("gRPC listen error", logging.Err(err))
 		return err
 	}
 
-	pb.RegisterMetricsServer(server.serverGRPC, grpcServices.NewMetricsService(server.storage))
+	pb.RegisterMetricsServer(server.serverGRPC, grpcServices.NewMetricsService(server.tenants, server.limiter, server.agents,
+		server.live.AgentProfiles, server.watchHub))
+	colmetricspb.RegisterMetricsServiceServer(server.serverGRPC,
+		grpcServices.NewOTLPMetricsService(server.otlpReceivers, server.tenants, server.limiter))
 
 	go func() {
 		err = server.serverGRPC.Serve(lis)
 		if err != nil {
-			log.Println("serverGRPC.Serve : ", err)
+			slog.Error("gRPC serve error", logging.Err(err))
 		}
 	}()
 
 	if err != nil {
-		log.Println("RunServerGRPC error : ", err)
+		slog.Error("RunServerGRPC error", logging.Err(err))
 		return err
 	}
 
 	return nil
 }
 
+func (server *Server) RunGraphite() error {
+	templates, err := graphite.ParseTemplates(server.config.Graphite.Templates)
+	if err != nil {
+		return err
+	}
+
+	// Graphite без аутентификации, метрики записываются арендатору по умолчанию, клиент - IP адрес соединения
+	server.graphiteListener = graphite.NewListener(func(remoteAddr net.Addr) storage.MetricStorage {
+		return server.limiter.For(limits.ClientID(auth.Anonymous, remoteAddr.String()), "", server.tenants.For(""))
+	}, templates)
+	return server.graphiteListener.ListenAndServe(server.config.Graphite.Addr)
+}
+
 func (server *Server) Run(ctx context.Context) {
-	server.initStorage()
+	err := server.initStorage()
+	if err != nil {
+		logging.Fatal("Storage error", logging.Err(err))
+	}
 	defer server.storage.Close()
 
+	go reload.Watch(ctx, server.config.ConfigPath, server.config.ReloadInterval, server.reloadConfig)
+
+	if server.elector != nil {
+		// Реестр агентов не общий для кластера: agents_up записывает только ведущий экземпляр,
+		// иначе экземпляры перезаписывают метрику своими частичными значениями
+		server.singletonJobs = append(server.singletonJobs, server.runAgentsUp)
+	} else {
+		go server.runAgentsUp(ctx)
+	}
+	go server.runSelfMetrics(ctx)
+
+	forwarderStopped := sync.WaitGroup{}
+	if server.forwarder != nil && server.elector != nil && server.forwarder.Mode() == federation.ModeSnapshot {
+		// Снимок общего хранилища пересылает только ведущий экземпляр, иначе вышестоящий сервер получает его
+		// от каждого экземпляра
+		server.singletonJobs = append(server.singletonJobs, func(ctx context.Context) {
+			server.forwarder.Run(ctx, server.storage)
+		})
+	} else if server.forwarder != nil {
+		forwarderCtx, cancelForwarder := context.WithCancel(context.Background())
+		forwarderStopped.Add(1)
+		go func() {
+			defer forwarderStopped.Done()
+			server.forwarder.Run(forwarderCtx, server.storage)
+		}()
+		// Пересылка останавливается после остановки приема, чтобы отправить последние обновления
+		defer func() {
+			cancelForwarder()
+			forwarderStopped.Wait()
+		}()
+	}
+	server.runCluster(ctx)
+
 	server.initRouter()
 	serverHTTP := &http.Server{
 		Addr:    server.config.ServerAddr,
 		Handler: server.chiRouter,
 	}
+	if server.config.Auth.ClientCAFile != "" {
+		clientCAs, err := auth.LoadCertPool(server.config.Auth.ClientCAFile)
+		if err != nil {
+			logging.Fatal("Client CA error", logging.Err(err))
+		}
+		// Сертификат необязателен: клиенты без сертификата аутентифицируются токеном
+		serverHTTP.TLSConfig = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
+	// Потоки обновлений (SSE, gRPC) завершаются в начале остановки, иначе Shutdown ждет их бесконечно
+	serverHTTP.RegisterOnShutdown(server.watchHub.Close)
+	serverHTTP.RegisterOnShutdown(server.agents.Close)
 
 	eventServerStopped := sync.WaitGroup{}
 	eventServerStopped.Add(1)
 	go func() {
 		<-ctx.Done()
 		defer eventServerStopped.Done()
-		if err := serverHTTP.Shutdown(context.Background()); err != nil {
-			log.Printf("HTTP server shutdown error: %v", err)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := serverHTTP.Shutdown(shutdownCtx); err != nil {
+			slog.Error("HTTP server shutdown error", logging.Err(err))
 		}
 		server.serverGRPC.GracefulStop()
-		if server.config.Store.Interval != storage.SyncUploadSymbol {
+		if server.graphiteListener != nil {
+			if err := server.graphiteListener.Shutdown(shutdownCtx); err != nil {
+				slog.Error("Graphite listener shutdown error", logging.Err(err))
+			}
+		}
+		// С журналом снимок при остановке сокращает воспроизведение при следующем запуске
+		if server.config.Store.Interval != storage.SyncUploadSymbol || server.config.Store.WAL {
 			err := server.storage.Save()
 			if err != nil {
-				log.Println(err)
+				slog.Error("Storage save error", logging.Err(err))
 			}
 		}
 	}()
@@ -169,19 +464,26 @@ func (server *Server) Run(ctx context.Context) {
 	if server.config.ServerGRPCAddr != "" {
 		err := server.RunServerGRPC()
 		if err != nil {
-			log.Fatal(err)
+			logging.Fatal("gRPC server error", logging.Err(err))
+		}
+	}
+
+	if server.config.Graphite.Addr != "" {
+		err := server.RunGraphite()
+		if err != nil {
+			logging.Fatal("Graphite listener error", logging.Err(err))
 		}
 	}
 
-	err := serverHTTP.ListenAndServeTLS("./keysSSL/server.crt", "./keysSSL/server.key")
+	err = serverHTTP.ListenAndServeTLS("./keysSSL/server.crt", "./keysSSL/server.key")
 	if errors.Is(err, fs.ErrNotExist) {
-		log.Println("SSL keys not found, using HTTP")
+		slog.Info("SSL keys not found, using HTTP")
 		err = serverHTTP.ListenAndServe()
 	}
 	if errors.Is(err, http.ErrServerClosed) {
-		log.Println("Server stopping...")
+		slog.Info("Server stopping...")
 		eventServerStopped.Wait()
-		log.Println("Server stopped successfully")
+		slog.Info("Server stopped successfully")
 	}
 }
 
@@ -1,8 +1,11 @@
 package server
 
 import (
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/server/agents"
+	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
 	"html/template"
-	"log"
 	"net/http"
 )
 
@@ -13,17 +16,24 @@ import (
 // @Produce html
 // @Success 200
 // @Router / [get]
-func (server Server) PrintAllMetricStatic(rw http.ResponseWriter, _ *http.Request) {
+func (server Server) PrintAllMetricStatic(rw http.ResponseWriter, request *http.Request) {
 	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
 	t, err := template.ParseFiles(server.config.TemplatesAbsPath + "/index.html")
 	if err != nil {
-		log.Println("Cant parse template ", err)
+		logging.FromContext(request.Context()).Error("Cant parse template", logging.Err(err))
 		return
 	}
 
-	err = t.Execute(rw, server.storage.ReadAll())
+	data := struct {
+		Metrics map[string]storage.MetricMap
+		Agents  []agents.Agent
+	}{
+		Metrics: server.tenantStorage(request).ReadAll(),
+		Agents:  server.agents.List(tenant.FromContext(request.Context())),
+	}
+	err = t.Execute(rw, data)
 	if err != nil {
-		log.Println("Cant render template ", err)
+		logging.FromContext(request.Context()).Error("Cant render template", logging.Err(err))
 		return
 	}
 }
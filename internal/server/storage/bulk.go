@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/tenant"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+const (
+	dialectPostgres = "postgres"
+	dialectSQLite   = "sqlite"
+)
+
+const (
+	// bulkUpsertRows - строк в одном многострочном INSERT (3 параметра на строку, лимит Postgres - 65535 параметров).
+	bulkUpsertRows = 1000
+	// bulkCopyMinRows - с какого размера пакет загружается в Postgres через COPY во временную таблицу.
+	bulkCopyMinRows = 256
+)
+
+// aggregateBatch - проверка пакета и схлопывание повторяющихся ID: для gauge остается последнее значение,
+// для counter приращения суммируются. Результат отсортирован по ID, чтобы параллельные транзакции
+// блокировали строки в одном порядке и не взаимоблокировались.
+func aggregateBatch(metricBatch []metrics.Metric) (gauges []metrics.Metric, counters []metrics.Metric, err error) {
+	gaugeValues := map[string]float64{}
+	counterValues := map[string]int64{}
+
+	for _, metric := range metricBatch {
+		switch metric.MType {
+		case metrics.MeticTypeGauge:
+			if metric.Value == nil {
+				return nil, nil, errors.New("metric Value is empty")
+			}
+			gaugeValues[metric.ID] = *metric.Value
+		case metrics.MeticTypeCounter:
+			if metric.Delta == nil {
+				return nil, nil, errors.New("metric Delta is empty")
+			}
+			counterValues[metric.ID] += *metric.Delta
+		default:
+			return nil, nil, errors.New("metric type is not defined")
+		}
+	}
+
+	gauges = make([]metrics.Metric, 0, len(gaugeValues))
+	for metricID, value := range gaugeValues {
+		value := value
+		gauges = append(gauges, metrics.Metric{ID: metricID, MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}})
+	}
+	counters = make([]metrics.Metric, 0, len(counterValues))
+	for metricID, delta := range counterValues {
+		delta := delta
+		counters = append(counters, metrics.Metric{ID: metricID, MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}})
+	}
+
+	sort.Slice(gauges, func(i, j int) bool { return gauges[i].ID < gauges[j].ID })
+	sort.Slice(counters, func(i, j int) bool { return counters[i].ID < counters[j].ID })
+
+	return gauges, counters, nil
+}
+
+// upsertQuery - многострочный upsert на rows строк. Для SQLite используются позиционные параметры "?":
+// поиск нумерованных "$N" в драйвере растет квадратично с количеством параметров.
+func upsertQuery(dialect string, table string, rows int) string {
+	var query strings.Builder
+	query.WriteString("INSERT INTO ")
+	query.WriteString(table)
+	query.WriteString(" (tenant, name, value) VALUES ")
+	for row := 0; row < rows; row++ {
+		if row != 0 {
+			query.WriteString(", ")
+		}
+		if dialect == dialectSQLite {
+			query.WriteString("(?, ?, ?)")
+			continue
+		}
+		fmt.Fprintf(&query, "($%d, $%d, $%d)", row*3+1, row*3+2, row*3+3)
+	}
+
+	query.WriteString(" ON CONFLICT (tenant, name) DO UPDATE SET value = ")
+	query.WriteString(upsertValueExpression(table))
+
+	return query.String()
+}
+
+func upsertValueExpression(table string) string {
+	if table == metrics.MeticTypeCounter {
+		return "counter.value + excluded.value"
+	}
+
+	return "excluded.value"
+}
+
+func metricArg(metric metrics.Metric) any {
+	if metric.MType == metrics.MeticTypeCounter {
+		return *metric.Delta
+	}
+
+	return *metric.Value
+}
+
+// upsertMany - запись метрик одной таблицы многострочными upsert по bulkUpsertRows строк.
+func upsertMany(ctx context.Context, tx *sql.Tx, dialect string, table string, metrics []metrics.Metric) error {
+	for start := 0; start < len(metrics); start += bulkUpsertRows {
+		end := start + bulkUpsertRows
+		if end > len(metrics) {
+			end = len(metrics)
+		}
+
+		args := make([]any, 0, (end-start)*3)
+		for _, metric := range metrics[start:end] {
+			tenantName, name := tenant.SplitKey(metric.ID)
+			args = append(args, tenantName, name, metricArg(metric))
+		}
+
+		_, err := tx.ExecContext(ctx, upsertQuery(dialect, table, end-start), args...)
+		if err != nil {
+			return fmt.Errorf("%s upsert error: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// updateManyUpsert - запись пакета многострочными upsert в одной транзакции.
+func (repository DBRepo) updateManyUpsert(ctx context.Context, gauges []metrics.Metric, counters []metrics.Metric) error {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = upsertMany(ctx, tx, repository.dialect, metrics.MeticTypeGauge, gauges)
+	if err != nil {
+		return err
+	}
+	err = upsertMany(ctx, tx, repository.dialect, metrics.MeticTypeCounter, counters)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateManyCopy - запись пакета через нативное соединение pgx: COPY во временные таблицы
+// и перенос в основные одним upsert на таблицу.
+func (repository DBRepo) updateManyCopy(ctx context.Context, gauges []metrics.Metric, counters []metrics.Metric) error {
+	conn, err := repository.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+
+		tx, err := stdlibConn.Conn().Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		err = copyToTable(ctx, tx, metrics.MeticTypeGauge, "DOUBLE PRECISION", gauges)
+		if err != nil {
+			return err
+		}
+		err = copyToTable(ctx, tx, metrics.MeticTypeCounter, "BIGINT", counters)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	})
+}
+
+func copyToTable(ctx context.Context, tx pgx.Tx, table string, valueType string, metrics []metrics.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	stagingTable := table + "_staging"
+	_, err := tx.Exec(ctx, fmt.Sprintf("CREATE TEMP TABLE IF NOT EXISTS %s (tenant TEXT NOT NULL, name TEXT NOT NULL, value %s NOT NULL) ON COMMIT DELETE ROWS",
+		stagingTable, valueType))
+	if err != nil {
+		return fmt.Errorf("%s staging table error: %w", table, err)
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{stagingTable}, []string{"tenant", "name", "value"},
+		pgx.CopyFromSlice(len(metrics), func(i int) ([]any, error) {
+			tenantName, name := tenant.SplitKey(metrics[i].ID)
+			return []any{tenantName, name, metricArg(metrics[i])}, nil
+		}))
+	if err != nil {
+		return fmt.Errorf("%s copy error: %w", table, err)
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf("INSERT INTO %s (tenant, name, value) SELECT tenant, name, value FROM %s ORDER BY tenant, name ON CONFLICT (tenant, name) DO UPDATE SET value = %s",
+		table, stagingTable, upsertValueExpression(table)))
+	if err != nil {
+		return fmt.Errorf("%s upsert error: %w", table, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+// updateManySliceStmt - запись пакета подготовленным запросом на каждую метрику,
+// используется для сравнения в бенчмарках.
+func (repository DBRepo) updateManySliceStmt(MetricBatch []metrics.Metric) error {
+	ctx := context.Background()
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmtUpdateGauge, err := tx.Prepare("INSERT INTO gauge (tenant, name, value) VALUES ($1, $2, $3) ON CONFLICT (tenant, name) DO UPDATE set value = $3")
+	if err != nil {
+		return err
+	}
+	defer stmtUpdateGauge.Close()
+
+	stmtCounterGauge, err := tx.Prepare("INSERT INTO counter (tenant, name, value) VALUES ($1, $2, $3) ON CONFLICT (tenant, name) DO UPDATE SET value = counter.value + $3")
+	if err != nil {
+		return err
+	}
+	defer stmtCounterGauge.Close()
+
+	for _, metricValue := range MetricBatch {
+		var stmtMetric *sql.Stmt
+		if metricValue.MType == metrics.MeticTypeGauge {
+			stmtMetric = stmtUpdateGauge
+		} else {
+			stmtMetric = stmtCounterGauge
+		}
+
+		err = repository.UpdateTX(metricValue.ID, metricValue.MetricValue, stmtMetric)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// testMetricBatch - пакет из size метрик поровну gauge и counter, каждый ID повторяется repeats раз.
+// Значение gauge - номер повтора, приращение counter - 1.
+func testMetricBatch(size int, repeats int) []metrics.Metric {
+	metricBatch := make([]metrics.Metric, 0, size*repeats)
+	for repeat := 0; repeat < repeats; repeat++ {
+		for i := 0; i < size/2; i++ {
+			var delta int64 = 1
+			var value = float64(repeat)
+			metricBatch = append(metricBatch,
+				metrics.Metric{ID: fmt.Sprintf("counter_%d", i), MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}},
+				metrics.Metric{ID: fmt.Sprintf("gauge_%d", i), MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}},
+			)
+		}
+	}
+
+	return metricBatch
+}
+
+func TestAggregateBatch(t *testing.T) {
+	var delta1, delta2 int64 = 3, 4
+	var value1, value2 = 1.5, 2.5
+
+	gauges, counters, err := aggregateBatch([]metrics.Metric{
+		{ID: "b", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta1}},
+		{ID: "g", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value1}},
+		{ID: "a", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta1}},
+		{ID: "b", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta2}},
+		{ID: "g", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value2}},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, counters, 2)
+	require.Equal(t, "a", counters[0].ID)
+	require.EqualValues(t, 3, *counters[0].Delta)
+	require.Equal(t, "b", counters[1].ID)
+	require.EqualValues(t, 7, *counters[1].Delta)
+
+	require.Len(t, gauges, 1)
+	require.EqualValues(t, value2, *gauges[0].Value)
+
+	_, _, err = aggregateBatch([]metrics.Metric{{ID: "g", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge}}})
+	require.Error(t, err)
+
+	_, _, err = aggregateBatch([]metrics.Metric{{ID: "h", MetricValue: metrics.MetricValue{MType: "histogram"}}})
+	require.Error(t, err)
+}
+
+func TestUpsertQuery(t *testing.T) {
+	require.Equal(t,
+		"INSERT INTO counter (tenant, name, value) VALUES ($1, $2, $3), ($4, $5, $6) ON CONFLICT (tenant, name) DO UPDATE SET value = counter.value + excluded.value",
+		upsertQuery(dialectPostgres, metrics.MeticTypeCounter, 2))
+	require.Equal(t,
+		"INSERT INTO gauge (tenant, name, value) VALUES ($1, $2, $3) ON CONFLICT (tenant, name) DO UPDATE SET value = excluded.value",
+		upsertQuery(dialectPostgres, metrics.MeticTypeGauge, 1))
+	require.Equal(t,
+		"INSERT INTO gauge (tenant, name, value) VALUES (?, ?, ?), (?, ?, ?) ON CONFLICT (tenant, name) DO UPDATE SET value = excluded.value",
+		upsertQuery(dialectSQLite, metrics.MeticTypeGauge, 2))
+}
+
+// benchmarkUpdateMany - сравнение записи пакета по одному запросу на метрику и текущей реализации.
+func benchmarkUpdateMany(b *testing.B, repository DBRepo) {
+	for _, batchSize := range []int{100, 1000, 5000} {
+		metricBatch := testMetricBatch(batchSize, 1)
+
+		b.Run(fmt.Sprintf("stmt/%d", batchSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, repository.updateManySliceStmt(metricBatch))
+			}
+		})
+		b.Run(fmt.Sprintf("bulk/%d", batchSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, repository.UpdateManySliceMetric(metricBatch))
+			}
+		})
+	}
+}
+
+func BenchmarkSQLiteRepo_UpdateManySliceMetric(b *testing.B) {
+	repository, err := NewSQLiteRepo(config.StoreConfig{
+		DatabaseDSN: SQLiteDSNScheme + filepath.Join(b.TempDir(), "metrics.db"),
+	})
+	require.NoError(b, err)
+	defer repository.Close()
+
+	benchmarkUpdateMany(b, repository.DBRepo)
+}
+
+// BenchmarkDBRepo_UpdateManySliceMetric - требует Postgres, DSN задается в TEST_DATABASE_DSN.
+func BenchmarkDBRepo_UpdateManySliceMetric(b *testing.B) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	repository, err := NewDBRepo(config.StoreConfig{DatabaseDSN: dsn})
+	require.NoError(b, err)
+	defer repository.Close()
+
+	benchmarkUpdateMany(b, repository)
+}
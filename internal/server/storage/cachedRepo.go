@@ -0,0 +1,377 @@
+package storage
+
+import (
+	"context"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cachedMetric - значение в кэше и время, когда оно было получено из хранилища.
+type cachedMetric struct {
+	value     metrics.MetricValue
+	fetchedAt time.Time
+}
+
+// CachedRepo - кэш последних значений метрик перед хранилищем (обычно БД).
+//
+// Запись выполняется сквозь кэш: сначала в хранилище, затем в кэш. Чтение обращается к хранилищу,
+// только если значения нет в кэше или оно старше окна устаревания (staleness), поэтому при нескольких
+// экземплярах сервера над одной БД значения, записанные другими экземплярами, видны с задержкой не больше окна.
+// Нулевое окно - значения не устаревают (один экземпляр сервера).
+type CachedRepo struct {
+	backend MetricStorage
+	// staleness - окно устаревания в наносекундах, меняется без перезапуска (Reconfigure)
+	staleness *atomic.Int64
+	stop      chan struct{}
+
+	mutex   *sync.Mutex
+	metrics map[string]map[string]cachedMetric
+	// complete - в кэше все метрики хранилища на момент loadedAt, ReadAll можно отдавать из кэша
+	complete bool
+	loadedAt time.Time
+	// generation растет при начале и окончании каждой записи, changedAt - поколение последнего изменения ID.
+	// Значения, прочитанные из хранилища до изменения, не попадают в кэш поверх более новых.
+	generation uint64
+	changedAt  map[string]uint64
+	// resetAt - поколение последней полной инвалидации, более ранние чтения не попадают в кэш
+	resetAt uint64
+}
+
+func NewCachedRepo(backend MetricStorage, staleness time.Duration, reloadInterval time.Duration) *CachedRepo {
+	cachedRepo := &CachedRepo{
+		backend:   backend,
+		staleness: &atomic.Int64{},
+		stop:      make(chan struct{}),
+		mutex:     &sync.Mutex{},
+		changedAt: map[string]uint64{},
+	}
+	cachedRepo.staleness.Store(int64(staleness))
+	cachedRepo.resetMetrics()
+	cachedRepo.Reload()
+
+	if reloadInterval > 0 {
+		go cachedRepo.RunReload(context.Background(), reloadInterval)
+	}
+
+	return cachedRepo
+}
+
+func (cachedRepo *CachedRepo) resetMetrics() {
+	cachedRepo.metrics = map[string]map[string]cachedMetric{
+		metrics.MeticTypeGauge:   {},
+		metrics.MeticTypeCounter: {},
+	}
+}
+
+// RunReload - полная перезагрузка кэша каждые interval до отмены ctx или закрытия хранилища (Close).
+// При нескольких экземплярах сервера запускается только на ведущем (cluster.Job).
+func (cachedRepo *CachedRepo) RunReload(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cachedRepo.stop:
+			return
+		case <-ticker.C:
+			cachedRepo.Reload()
+		}
+	}
+}
+
+func changeKey(metricType string, key string) string {
+	return metricType + ":" + key
+}
+
+func (cachedRepo *CachedRepo) isFresh(fetchedAt time.Time) bool {
+	staleness := time.Duration(cachedRepo.staleness.Load())
+	return staleness <= 0 || time.Since(fetchedAt) <= staleness
+}
+
+// Reconfigure - изменение окна устаревания и настроек хранилища за кэшем.
+func (cachedRepo *CachedRepo) Reconfigure(current config.StoreConfig, next config.StoreConfig) config.StoreConfig {
+	applied := current
+	if backend, ok := cachedRepo.backend.(Reconfigurable); ok {
+		applied = backend.Reconfigure(current, next)
+	}
+
+	cachedRepo.staleness.Store(int64(next.CacheStaleness))
+	applied.CacheStaleness = next.CacheStaleness
+
+	return applied
+}
+
+// Reload - полная перезагрузка кэша из хранилища.
+func (cachedRepo *CachedRepo) Reload() map[string]MetricMap {
+	cachedRepo.mutex.Lock()
+	startGeneration := cachedRepo.generation
+	cachedRepo.mutex.Unlock()
+
+	fetchedAt := time.Now()
+	allMetrics := cachedRepo.backend.ReadAll()
+
+	cachedRepo.mutex.Lock()
+	defer cachedRepo.mutex.Unlock()
+
+	// Кэш очищен во время чтения - прочитанные значения могут быть устаревшими
+	if cachedRepo.resetAt > startGeneration {
+		cachedRepo.complete = false
+		return allMetrics
+	}
+
+	complete := true
+	previousMetrics := cachedRepo.metrics
+	cachedRepo.resetMetrics()
+	for metricType, metricMap := range allMetrics {
+		if _, ok := cachedRepo.metrics[metricType]; !ok {
+			continue
+		}
+
+		for key, metricValue := range metricMap {
+			if cachedRepo.changedAt[changeKey(metricType, key)] > startGeneration {
+				// Изменено во время чтения - остается значение из кэша, если оно есть
+				previous, ok := previousMetrics[metricType][key]
+				if !ok {
+					complete = false
+					continue
+				}
+				cachedRepo.metrics[metricType][key] = previous
+				continue
+			}
+
+			cachedRepo.metrics[metricType][key] = cachedMetric{
+				value:     metricValue,
+				fetchedAt: fetchedAt,
+			}
+		}
+	}
+
+	// Хранилище не возвращает ошибку ReadAll: тип без значений (nil) означает неудачное чтение
+	for metricType := range cachedRepo.metrics {
+		if allMetrics[metricType] == nil {
+			complete = false
+		}
+	}
+
+	// Метрики, впервые записанные во время чтения
+	for metricType, metricMap := range previousMetrics {
+		for key, previous := range metricMap {
+			if _, ok := cachedRepo.metrics[metricType][key]; !ok && cachedRepo.changedAt[changeKey(metricType, key)] > startGeneration {
+				cachedRepo.metrics[metricType][key] = previous
+			}
+		}
+	}
+
+	cachedRepo.complete = complete
+	cachedRepo.loadedAt = fetchedAt
+
+	return allMetrics
+}
+
+// beginWrite - отметка начала записи, возвращает поколение записи для каждого ID.
+func (cachedRepo *CachedRepo) beginWrite(metrics []metrics.Metric) []uint64 {
+	cachedRepo.mutex.Lock()
+	defer cachedRepo.mutex.Unlock()
+
+	generations := make([]uint64, len(metrics))
+	for i, metric := range metrics {
+		cachedRepo.generation++
+		cachedRepo.changedAt[changeKey(metric.MType, metric.ID)] = cachedRepo.generation
+		generations[i] = cachedRepo.generation
+	}
+
+	return generations
+}
+
+// endWrite - применение записанных значений к кэшу. Если ID за время записи изменялся параллельно
+// или запись не удалась, значение удаляется из кэша и будет перечитано из хранилища.
+func (cachedRepo *CachedRepo) endWrite(batch []metrics.Metric, generations []uint64, writeErr error) {
+	cachedRepo.mutex.Lock()
+	defer cachedRepo.mutex.Unlock()
+
+	now := time.Now()
+	for i, metric := range batch {
+		metricKey := changeKey(metric.MType, metric.ID)
+		metricCache, ok := cachedRepo.metrics[metric.MType]
+		if !ok {
+			continue
+		}
+
+		cached, isCached := metricCache[metric.ID]
+		switch {
+		case writeErr != nil || cachedRepo.changedAt[metricKey] != generations[i]:
+			delete(metricCache, metric.ID)
+			cachedRepo.complete = false
+		case metric.MType == metrics.MeticTypeGauge:
+			metricCache[metric.ID] = cachedMetric{value: metric.MetricValue, fetchedAt: now}
+		case isCached:
+			// Значение counter в хранилище накапливается, время получения не меняется:
+			// приращения других экземпляров сервера могут быть не учтены
+			delta := *cached.value.Delta + *metric.Delta
+			cached.value.Delta = &delta
+			metricCache[metric.ID] = cached
+		default:
+			// Итоговое значение counter неизвестно без чтения из хранилища
+			cachedRepo.complete = false
+		}
+
+		cachedRepo.generation++
+		cachedRepo.changedAt[metricKey] = cachedRepo.generation
+	}
+}
+
+func (cachedRepo *CachedRepo) write(metrics []metrics.Metric, writeFunc func() error) error {
+	// Повторы ID в пакете схлопываются, значения копируются и не зависят от указателей вызывающего
+	gauges, counters, err := aggregateBatch(metrics)
+	if err == nil {
+		metrics = append(gauges, counters...)
+	}
+
+	generations := cachedRepo.beginWrite(metrics)
+	err = writeFunc()
+	cachedRepo.endWrite(metrics, generations, err)
+
+	return err
+}
+
+// Invalidate - удаление значения из кэша, например, после изменения другим экземпляром сервера.
+func (cachedRepo *CachedRepo) Invalidate(metricType string, key string) {
+	cachedRepo.mutex.Lock()
+	defer cachedRepo.mutex.Unlock()
+
+	if metricCache, ok := cachedRepo.metrics[metricType]; ok {
+		delete(metricCache, key)
+	}
+	cachedRepo.complete = false
+	cachedRepo.generation++
+	cachedRepo.changedAt[changeKey(metricType, key)] = cachedRepo.generation
+}
+
+// InvalidateAll - очистка кэша, например, после пропуска уведомлений об изменениях.
+func (cachedRepo *CachedRepo) InvalidateAll() {
+	cachedRepo.mutex.Lock()
+	defer cachedRepo.mutex.Unlock()
+
+	cachedRepo.resetMetrics()
+	cachedRepo.complete = false
+	cachedRepo.generation++
+	cachedRepo.resetAt = cachedRepo.generation
+}
+
+func (cachedRepo *CachedRepo) Update(key string, value metrics.MetricValue) error {
+	return cachedRepo.write([]metrics.Metric{{ID: key, MetricValue: value}}, func() error {
+		return cachedRepo.backend.Update(key, value)
+	})
+}
+
+func (cachedRepo *CachedRepo) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	return cachedRepo.write(MetricBatch, func() error {
+		return cachedRepo.backend.UpdateManySliceMetric(MetricBatch)
+	})
+}
+
+func (cachedRepo *CachedRepo) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
+	batch := make([]metrics.Metric, 0, len(DBSchema))
+	for key, value := range DBSchema {
+		batch = append(batch, metrics.Metric{ID: key, MetricValue: value})
+	}
+
+	return cachedRepo.write(batch, func() error {
+		return cachedRepo.backend.UpdateMany(DBSchema)
+	})
+}
+
+// Delete - удаление из хранилища и кэша. Чтения, начатые до удаления, не возвращают значение в кэш.
+func (cachedRepo *CachedRepo) Delete(key string, metricType string) error {
+	err := cachedRepo.backend.Delete(key, metricType)
+	if err != nil && !errors.Is(err, ErrMetricNotFound) {
+		cachedRepo.Invalidate(metricType, key)
+		return err
+	}
+
+	cachedRepo.mutex.Lock()
+	defer cachedRepo.mutex.Unlock()
+
+	if metricCache, ok := cachedRepo.metrics[metricType]; ok {
+		delete(metricCache, key)
+	}
+	cachedRepo.generation++
+	cachedRepo.changedAt[changeKey(metricType, key)] = cachedRepo.generation
+
+	return err
+}
+
+func (cachedRepo *CachedRepo) Read(key string, metricType string) (metrics.MetricValue, error) {
+	cachedRepo.mutex.Lock()
+	cached, ok := cachedRepo.metrics[metricType][key]
+	startGeneration := cachedRepo.generation
+	cachedRepo.mutex.Unlock()
+
+	if ok && cachedRepo.isFresh(cached.fetchedAt) {
+		return cached.value, nil
+	}
+
+	fetchedAt := time.Now()
+	metricValue, err := cachedRepo.backend.Read(key, metricType)
+	if err != nil {
+		return metricValue, err
+	}
+
+	cachedRepo.mutex.Lock()
+	metricCache, isKnownType := cachedRepo.metrics[metricType]
+	if isKnownType && cachedRepo.resetAt <= startGeneration && cachedRepo.changedAt[changeKey(metricType, key)] <= startGeneration {
+		metricCache[key] = cachedMetric{value: metricValue, fetchedAt: fetchedAt}
+	}
+	cachedRepo.mutex.Unlock()
+
+	return metricValue, nil
+}
+
+func (cachedRepo *CachedRepo) ReadAll() map[string]MetricMap {
+	cachedRepo.mutex.Lock()
+	if !cachedRepo.complete || !cachedRepo.isFresh(cachedRepo.loadedAt) {
+		cachedRepo.mutex.Unlock()
+		return cachedRepo.Reload()
+	}
+	defer cachedRepo.mutex.Unlock()
+
+	allMetrics := make(map[string]MetricMap, len(cachedRepo.metrics))
+	for metricType, metricCache := range cachedRepo.metrics {
+		metricMap := make(MetricMap, len(metricCache))
+		for key, cached := range metricCache {
+			metricMap[key] = cached.value
+		}
+		allMetrics[metricType] = metricMap
+	}
+
+	return allMetrics
+}
+
+func (cachedRepo *CachedRepo) InitFromFile() {
+	cachedRepo.backend.InitFromFile()
+	cachedRepo.Reload()
+}
+
+func (cachedRepo *CachedRepo) Save() error {
+	return cachedRepo.backend.Save()
+}
+
+func (cachedRepo *CachedRepo) Close() error {
+	select {
+	case <-cachedRepo.stop:
+	default:
+		close(cachedRepo.stop)
+	}
+
+	return cachedRepo.backend.Close()
+}
+
+func (cachedRepo *CachedRepo) Ping() error {
+	return cachedRepo.backend.Ping()
+}
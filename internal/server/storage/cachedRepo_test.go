@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage - хранилище с подсчетом обращений на чтение.
+type countingStorage struct {
+	MetricStorage
+	reads    *atomic.Int64
+	readAlls *atomic.Int64
+}
+
+func newCountingStorage() countingStorage {
+	return countingStorage{
+		MetricStorage: NewMetricsMemoryRepo(config.StoreConfig{}),
+		reads:         &atomic.Int64{},
+		readAlls:      &atomic.Int64{},
+	}
+}
+
+func (storage countingStorage) Read(key string, metricType string) (metrics.MetricValue, error) {
+	storage.reads.Add(1)
+	return storage.MetricStorage.Read(key, metricType)
+}
+
+func (storage countingStorage) ReadAll() map[string]MetricMap {
+	storage.readAlls.Add(1)
+	return storage.MetricStorage.ReadAll()
+}
+
+func TestCachedRepo_WriteThrough(t *testing.T) {
+	backend := newCountingStorage()
+	var delta int64 = 5
+	require.NoError(t, backend.Update("PollCount", metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}))
+
+	cachedRepo := NewCachedRepo(backend, 0, 0)
+	defer cachedRepo.Close()
+	require.EqualValues(t, 1, backend.readAlls.Load())
+
+	// Значения загружены при создании
+	metricValue, err := cachedRepo.Read("PollCount", metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, *metricValue.Delta)
+	require.Zero(t, backend.reads.Load())
+
+	var value = 1.5
+	require.NoError(t, cachedRepo.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}))
+	require.NoError(t, cachedRepo.UpdateManySliceMetric([]metrics.Metric{
+		{ID: "PollCount", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}},
+		{ID: "PollCount", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}},
+	}))
+
+	metricValue, err = cachedRepo.Read("Alloc", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, value, *metricValue.Value)
+
+	metricValue, err = cachedRepo.Read("PollCount", metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 15, *metricValue.Delta)
+	require.Zero(t, backend.reads.Load())
+
+	allMetrics := cachedRepo.ReadAll()
+	require.EqualValues(t, 15, *allMetrics[metrics.MeticTypeCounter]["PollCount"].Delta)
+	require.EqualValues(t, value, *allMetrics[metrics.MeticTypeGauge]["Alloc"].Value)
+	require.EqualValues(t, 1, backend.readAlls.Load())
+
+	// Ошибка записи не меняет кэш
+	require.Error(t, cachedRepo.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge}))
+	metricValue, err = cachedRepo.Read("Alloc", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, value, *metricValue.Value)
+}
+
+func TestCachedRepo_Staleness(t *testing.T) {
+	backend := newCountingStorage()
+	cachedRepo := NewCachedRepo(backend, 50*time.Millisecond, 0)
+	defer cachedRepo.Close()
+
+	var value = 1.5
+	require.NoError(t, cachedRepo.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}))
+
+	// Запись другим экземпляром сервера напрямую в хранилище
+	var otherValue = 2.5
+	require.NoError(t, backend.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &otherValue}))
+
+	metricValue, err := cachedRepo.Read("Alloc", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, value, *metricValue.Value)
+
+	time.Sleep(60 * time.Millisecond)
+
+	metricValue, err = cachedRepo.Read("Alloc", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, otherValue, *metricValue.Value)
+	require.EqualValues(t, 1, backend.reads.Load())
+
+	readAllsBefore := backend.readAlls.Load()
+	cachedRepo.ReadAll()
+	require.EqualValues(t, readAllsBefore+1, backend.readAlls.Load())
+}
+
+func TestCachedRepo_Reload(t *testing.T) {
+	backend := newCountingStorage()
+	cachedRepo := NewCachedRepo(backend, 0, 20*time.Millisecond)
+	defer cachedRepo.Close()
+
+	var value = 2.5
+	require.NoError(t, backend.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}))
+
+	require.Eventually(t, func() bool {
+		return len(cachedRepo.ReadAll()[metrics.MeticTypeGauge]) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCachedRepo_ConcurrentCounter(t *testing.T) {
+	backend := newCountingStorage()
+	cachedRepo := NewCachedRepo(backend, 0, 0)
+	defer cachedRepo.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var delta int64 = 1
+			for j := 0; j < 50; j++ {
+				require.NoError(t, cachedRepo.Update("PollCount", metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}))
+				_, _ = cachedRepo.Read("PollCount", metrics.MeticTypeCounter)
+				cachedRepo.ReadAll()
+			}
+		}()
+	}
+	wg.Wait()
+
+	metricValue, err := cachedRepo.Read("PollCount", metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 1000, *metricValue.Delta)
+	require.EqualValues(t, 1000, *cachedRepo.ReadAll()[metrics.MeticTypeCounter]["PollCount"].Delta)
+}
+
+func TestCachedRepo_Invalidate(t *testing.T) {
+	backend := newCountingStorage()
+	cachedRepo := NewCachedRepo(backend, 0, 0)
+	defer cachedRepo.Close()
+
+	var value = 1.5
+	require.NoError(t, cachedRepo.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}))
+
+	// Изменение другим экземпляром сервера и уведомление о нем
+	var otherValue = 2.5
+	require.NoError(t, backend.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &otherValue}))
+	cachedRepo.Invalidate(metrics.MeticTypeGauge, "Alloc")
+
+	metricValue, err := cachedRepo.Read("Alloc", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, otherValue, *metricValue.Value)
+	require.EqualValues(t, 1, backend.reads.Load())
+
+	var delta int64 = 3
+	require.NoError(t, backend.Update("PollCount", metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}))
+	cachedRepo.InvalidateAll()
+
+	allMetrics := cachedRepo.ReadAll()
+	require.EqualValues(t, delta, *allMetrics[metrics.MeticTypeCounter]["PollCount"].Delta)
+	require.EqualValues(t, otherValue, *allMetrics[metrics.MeticTypeGauge]["Alloc"].Value)
+}
+
+func TestCachedRepo_Delete(t *testing.T) {
+	backend := newCountingStorage()
+	cachedRepo := NewCachedRepo(backend, 0, 0)
+	defer cachedRepo.Close()
+
+	var value = 1.5
+	require.NoError(t, cachedRepo.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}))
+	require.NoError(t, cachedRepo.Delete("Alloc", metrics.MeticTypeGauge))
+	require.ErrorIs(t, cachedRepo.Delete("Alloc", metrics.MeticTypeGauge), ErrMetricNotFound)
+
+	_, err := cachedRepo.Read("Alloc", metrics.MeticTypeGauge)
+	require.Error(t, err)
+	require.Empty(t, cachedRepo.ReadAll()[metrics.MeticTypeGauge])
+	_, err = backend.Read("Alloc", metrics.MeticTypeGauge)
+	require.Error(t, err)
+}
+
+func TestCachedRepo_Reconfigure(t *testing.T) {
+	backend := newCountingStorage()
+	var value = 1.5
+	require.NoError(t, backend.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}))
+
+	cachedRepo := NewCachedRepo(backend, 0, 0)
+	defer cachedRepo.Close()
+
+	_, err := cachedRepo.Read("Alloc", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.Zero(t, backend.reads.Load())
+
+	// Хранилище за кэшем не поддерживает изменение настроек, интервал выгрузки остается прежним
+	applied := cachedRepo.Reconfigure(config.StoreConfig{}, config.StoreConfig{CacheStaleness: time.Millisecond, Interval: time.Second})
+	require.Equal(t, config.StoreConfig{CacheStaleness: time.Millisecond}, applied)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = cachedRepo.Read("Alloc", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, backend.reads.Load())
+}
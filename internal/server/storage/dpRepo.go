@@ -3,26 +3,30 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
 	"devops-tpl/internal/server/config"
-	"encoding/json"
+	"devops-tpl/internal/server/tenant"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
-// DBRepo - хранилище метрик в SQL БД.
+// DBRepo - хранилище метрик в SQL БД. Префикс арендатора ключа (tenant.Key) хранится в столбце tenant.
 type DBRepo struct {
 	config config.StoreConfig
 	db     *sql.DB
+	// dialect - postgres или sqlite, для Postgres крупные пакеты загружаются через COPY
+	dialect string
 }
 
 func NewDBRepo(config config.StoreConfig) (DBRepo, error) {
 	var repository DBRepo
 	repository.config = config
+	repository.dialect = dialectPostgres
 
 	db, err := sql.Open("pgx",
 		repository.config.DatabaseDSN)
@@ -50,31 +54,34 @@ func (repository DBRepo) DB() *sql.DB {
 	return repository.db
 }
 
+// InitTables - приведение схемы БД к актуальной версии миграциями.
 func (repository DBRepo) InitTables() error {
-	ctx := context.Background()
-	_, err := repository.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS counter (id serial, name VARCHAR (128) UNIQUE NOT NULL, value BIGINT NOT NULL)")
+	migrator, err := newMigrator(repository.db, repository.dialect)
 	if err != nil {
-		return fmt.Errorf("failed to create counter table: %w", err)
+		return err
 	}
 
-	_, err = repository.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS gauge (id serial, name VARCHAR (128) UNIQUE NOT NULL, value DOUBLE PRECISION NOT NULL)")
+	appliedVersions, err := migrator.Up(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to create gauge table: %w", err)
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if len(appliedVersions) != 0 {
+		slog.Info("Applied migrations", slog.Any("versions", appliedVersions))
 	}
 
 	return nil
 }
 
-func (repository DBRepo) Update(key string, newMetricValue MetricValue) error {
+func (repository DBRepo) Update(key string, newMetricValue metrics.MetricValue) error {
 	switch newMetricValue.MType {
-	case MeticTypeGauge:
+	case metrics.MeticTypeGauge:
 		if newMetricValue.Value == nil {
 			return errors.New("metric Value is empty")
 		}
 		newMetricValue.Delta = nil
 
 		return repository.updateGauge(key, newMetricValue)
-	case MeticTypeCounter:
+	case metrics.MeticTypeCounter:
 		if newMetricValue.Delta == nil {
 			return errors.New("metric Delta is empty")
 		}
@@ -86,16 +93,16 @@ func (repository DBRepo) Update(key string, newMetricValue MetricValue) error {
 	}
 }
 
-func (repository DBRepo) UpdateTX(key string, newMetricValue MetricValue, stmt *sql.Stmt) error {
+func (repository DBRepo) UpdateTX(key string, newMetricValue metrics.MetricValue, stmt *sql.Stmt) error {
 	switch newMetricValue.MType {
-	case MeticTypeGauge:
+	case metrics.MeticTypeGauge:
 		if newMetricValue.Value == nil {
 			return errors.New("metric Value is empty")
 		}
 		newMetricValue.Delta = nil
 
 		return repository.updateGaugeTX(key, newMetricValue, stmt)
-	case MeticTypeCounter:
+	case metrics.MeticTypeCounter:
 		if newMetricValue.Delta == nil {
 			return errors.New("metric Delta is empty")
 		}
@@ -107,110 +114,97 @@ func (repository DBRepo) UpdateTX(key string, newMetricValue MetricValue, stmt *
 	}
 }
 
-func (repository DBRepo) updateGauge(key string, newMetricValue MetricValue) error {
+func (repository DBRepo) updateGauge(key string, newMetricValue metrics.MetricValue) error {
 	ctx := context.Background()
-	_, err := repository.db.ExecContext(ctx, "INSERT INTO gauge (name, value) VALUES ($1, $2) ON CONFLICT(name) DO UPDATE set value = $2", key, *newMetricValue.Value)
+	tenantName, name := tenant.SplitKey(key)
+	_, err := repository.db.ExecContext(ctx, "INSERT INTO gauge (tenant, name, value) VALUES ($1, $2, $3) ON CONFLICT (tenant, name) DO UPDATE set value = $3", tenantName, name, *newMetricValue.Value)
 	return err
 }
 
-func (repository DBRepo) updateGaugeTX(key string, newMetricValue MetricValue, stmt *sql.Stmt) error {
-	_, err := stmt.Exec(key, *newMetricValue.Value)
+func (repository DBRepo) updateGaugeTX(key string, newMetricValue metrics.MetricValue, stmt *sql.Stmt) error {
+	tenantName, name := tenant.SplitKey(key)
+	_, err := stmt.Exec(tenantName, name, *newMetricValue.Value)
 	return err
 }
 
-func (repository DBRepo) updateCounter(key string, newMetricValue MetricValue) error {
+func (repository DBRepo) updateCounter(key string, newMetricValue metrics.MetricValue) error {
 	ctx := context.Background()
-	_, err := repository.db.ExecContext(ctx, "INSERT INTO counter (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = counter.value + $2", key, *newMetricValue.Delta)
+	tenantName, name := tenant.SplitKey(key)
+	_, err := repository.db.ExecContext(ctx, "INSERT INTO counter (tenant, name, value) VALUES ($1, $2, $3) ON CONFLICT (tenant, name) DO UPDATE SET value = counter.value + $3", tenantName, name, *newMetricValue.Delta)
 	return err
 }
 
-func (repository DBRepo) updateCounterTX(key string, newMetricValue MetricValue, stmt *sql.Stmt) error {
-	_, err := stmt.Exec(key, *newMetricValue.Delta)
+func (repository DBRepo) updateCounterTX(key string, newMetricValue metrics.MetricValue, stmt *sql.Stmt) error {
+	tenantName, name := tenant.SplitKey(key)
+	_, err := stmt.Exec(tenantName, name, *newMetricValue.Delta)
 	return err
 }
 
-func (repository DBRepo) Read(key string, metricType string) (MetricValue, error) {
+func (repository DBRepo) Read(key string, metricType string) (metrics.MetricValue, error) {
 	switch metricType {
-	case MeticTypeGauge:
+	case metrics.MeticTypeGauge:
 		return repository.readGauge(key)
-	case MeticTypeCounter:
+	case metrics.MeticTypeCounter:
 		return repository.readCounter(key)
 	default:
-		return MetricValue{}, errors.New("metricType not found")
+		return metrics.MetricValue{}, errors.New("metricType not found")
 	}
 }
 
-func (repository DBRepo) readGauge(key string) (MetricValue, error) {
-	metricValue := MetricValue{
-		MType: MeticTypeGauge,
+func (repository DBRepo) readGauge(key string) (metrics.MetricValue, error) {
+	metricValue := metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
 	}
 
 	ctx := context.Background()
+	tenantName, name := tenant.SplitKey(key)
 
-	err := repository.db.QueryRowContext(ctx, "SELECT value FROM gauge WHERE name = $1", key).Scan(&metricValue.Value)
+	err := repository.db.QueryRowContext(ctx, "SELECT value FROM gauge WHERE tenant = $1 AND name = $2", tenantName, name).Scan(&metricValue.Value)
 	if err != nil {
 		return metricValue, fmt.Errorf("gauge select error : %w", err)
 	}
 	return metricValue, nil
 }
 
-func (repository DBRepo) readCounter(key string) (MetricValue, error) {
-	metricValue := MetricValue{
-		MType: MeticTypeCounter,
+func (repository DBRepo) readCounter(key string) (metrics.MetricValue, error) {
+	metricValue := metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 	}
 
 	ctx := context.Background()
+	tenantName, name := tenant.SplitKey(key)
 
-	err := repository.db.QueryRowContext(ctx, "SELECT value FROM counter WHERE name = $1", key).Scan(&metricValue.Delta)
+	err := repository.db.QueryRowContext(ctx, "SELECT value FROM counter WHERE tenant = $1 AND name = $2", tenantName, name).Scan(&metricValue.Delta)
 	if err != nil {
 		return metricValue, fmt.Errorf("counter select error : %w", err)
 	}
 	return metricValue, nil
 }
 
-func (repository DBRepo) UpdateManySliceMetric(MetricBatch []Metric) error {
-	ctx := context.Background()
-	tx, err := repository.db.BeginTx(ctx, nil)
+// UpdateManySliceMetric - запись пакета: повторяющиеся ID схлопываются, затем метрики пишутся
+// многострочными upsert, а крупные пакеты в Postgres - через COPY во временную таблицу.
+func (repository DBRepo) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	gauges, counters, err := aggregateBatch(MetricBatch)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-
-	stmtUpdateGauge, err := tx.Prepare("INSERT INTO gauge (name, value) VALUES ($1, $2) ON CONFLICT(name) DO UPDATE set value = $2")
-	if err != nil {
-		return err
-	}
-	defer stmtUpdateGauge.Close()
-
-	stmtCounterGauge, err := tx.Prepare("INSERT INTO counter (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = counter.value + $2")
-	if err != nil {
-		return err
+	if len(gauges)+len(counters) == 0 {
+		return nil
 	}
-	defer stmtCounterGauge.Close()
-
-	for _, metricValue := range MetricBatch {
-		var stmtMetric *sql.Stmt
-		if metricValue.MType == MeticTypeGauge {
-			stmtMetric = stmtUpdateGauge
-		} else {
-			stmtMetric = stmtCounterGauge
-		}
-
-		err = repository.UpdateTX(metricValue.ID, metricValue.MetricValue, stmtMetric)
 
-		if err != nil {
-			return err
-		}
+	ctx := context.Background()
+	if repository.dialect == dialectPostgres && len(gauges)+len(counters) >= bulkCopyMinRows {
+		return repository.updateManyCopy(ctx, gauges, counters)
 	}
 
-	return tx.Commit()
+	return repository.updateManyUpsert(ctx, gauges, counters)
 }
 
-func (repository DBRepo) UpdateMany(DBSchema map[string]MetricValue) error {
-	var MetricBatch []Metric
+func (repository DBRepo) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
+	var MetricBatch []metrics.Metric
 
 	for metricKey, metricValue := range DBSchema {
-		MetricBatch = append(MetricBatch, Metric{
+		MetricBatch = append(MetricBatch, metrics.Metric{
 			ID:          metricKey,
 			MetricValue: metricValue,
 		})
@@ -219,16 +213,44 @@ func (repository DBRepo) UpdateMany(DBSchema map[string]MetricValue) error {
 	return repository.UpdateManySliceMetric(MetricBatch)
 }
 
+func (repository DBRepo) Delete(key string, metricType string) error {
+	var query string
+	switch metricType {
+	case metrics.MeticTypeGauge:
+		query = "DELETE FROM gauge WHERE tenant = $1 AND name = $2"
+	case metrics.MeticTypeCounter:
+		query = "DELETE FROM counter WHERE tenant = $1 AND name = $2"
+	default:
+		return errors.New("metricType not found")
+	}
+
+	tenantName, name := tenant.SplitKey(key)
+	result, err := repository.db.ExecContext(context.Background(), query, tenantName, name)
+	if err != nil {
+		return fmt.Errorf("%s delete error : %w", metricType, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrMetricNotFound
+	}
+
+	return nil
+}
+
 func (repository DBRepo) ReadAll() map[string]MetricMap {
 	var err error
 	AllValues := map[string]MetricMap{}
 
-	AllValues[MeticTypeCounter], err = repository.readAllCounter()
+	AllValues[metrics.MeticTypeCounter], err = repository.readAllCounter()
 	if err != nil {
 		return AllValues
 	}
 
-	AllValues[MeticTypeGauge], err = repository.readAllGauge()
+	AllValues[metrics.MeticTypeGauge], err = repository.readAllGauge()
 	if err != nil {
 		return AllValues
 	}
@@ -252,29 +274,25 @@ func (repository DBRepo) Ping() error {
 }
 
 func (repository DBRepo) InitFromFile() {
-	file, err := os.OpenFile(repository.config.File, os.O_RDONLY|os.O_CREATE, 0777)
+	metricsDump, _, snapshotPath, err := readSnapshot(repository.config.File, repository.config.Generations)
 	if err != nil {
-		log.Println(err.Error())
-	}
-	defer file.Close()
-
-	var metricsDump map[string]MetricMap
-	err = json.NewDecoder(file).Decode(&metricsDump)
-	if err != nil {
-		log.Println(err)
+		slog.Warn("Metrics not restored", logging.Err(err))
+		return
 	}
+	slog.Info("Metrics restored", slog.String("snapshot", snapshotPath))
 
 	for _, metricList := range metricsDump {
 		err = repository.UpdateMany(metricList)
 	}
 	if err != nil {
-		log.Println(err)
+		slog.Error("Metrics restore error", logging.Err(err))
 	}
 }
-func (repository DBRepo) readAllCounter() (map[string]MetricValue, error) {
-	allValues := map[string]MetricValue{}
+
+func (repository DBRepo) readAllCounter() (map[string]metrics.MetricValue, error) {
+	allValues := map[string]metrics.MetricValue{}
 	ctx := context.Background()
-	rows, err := repository.db.QueryContext(ctx, "SELECT name, value from counter")
+	rows, err := repository.db.QueryContext(ctx, "SELECT tenant, name, value from counter")
 	if err != nil {
 		return nil, err
 	}
@@ -282,17 +300,17 @@ func (repository DBRepo) readAllCounter() (map[string]MetricValue, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var vKey string
-		v := MetricValue{
-			MType: MeticTypeCounter,
+		var tenantName, name string
+		v := metrics.MetricValue{
+			MType: metrics.MeticTypeCounter,
 		}
 
-		err = rows.Scan(&vKey, &v.Delta)
+		err = rows.Scan(&tenantName, &name, &v.Delta)
 		if err != nil {
 			return nil, err
 		}
 
-		allValues[vKey] = v
+		allValues[tenant.Key(tenantName, name)] = v
 	}
 
 	err = rows.Err()
@@ -303,10 +321,10 @@ func (repository DBRepo) readAllCounter() (map[string]MetricValue, error) {
 	return allValues, nil
 }
 
-func (repository DBRepo) readAllGauge() (map[string]MetricValue, error) {
-	allValues := map[string]MetricValue{}
+func (repository DBRepo) readAllGauge() (map[string]metrics.MetricValue, error) {
+	allValues := map[string]metrics.MetricValue{}
 	ctx := context.Background()
-	rows, err := repository.db.QueryContext(ctx, "SELECT name, value from gauge")
+	rows, err := repository.db.QueryContext(ctx, "SELECT tenant, name, value from gauge")
 	if err != nil {
 		return nil, err
 	}
@@ -314,17 +332,17 @@ func (repository DBRepo) readAllGauge() (map[string]MetricValue, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var vKey string
-		v := MetricValue{
-			MType: MeticTypeGauge,
+		var tenantName, name string
+		v := metrics.MetricValue{
+			MType: metrics.MeticTypeGauge,
 		}
 
-		err = rows.Scan(&vKey, &v.Value)
+		err = rows.Scan(&tenantName, &name, &v.Value)
 		if err != nil {
 			return nil, err
 		}
 
-		allValues[vKey] = v
+		allValues[tenant.Key(tenantName, name)] = v
 	}
 
 	err = rows.Err()
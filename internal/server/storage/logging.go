@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
+	"log/slog"
+)
+
+// LoggingRepo - хранилище с записью операций изменения в журнал logger: успешные операции - с уровнем debug,
+// ошибки - с уровнем warn. Журнал запроса содержит его идентификатор (logging.RequestIDKey).
+type LoggingRepo struct {
+	MetricStorage
+	logger *slog.Logger
+}
+
+func NewLoggingRepo(metricStorage MetricStorage, logger *slog.Logger) LoggingRepo {
+	return LoggingRepo{
+		MetricStorage: metricStorage,
+		logger:        logger,
+	}
+}
+
+func (repository LoggingRepo) Update(key string, value metrics.MetricValue) error {
+	err := repository.MetricStorage.Update(key, value)
+	repository.log("Update", err, slog.String("id", key), slog.String("type", value.MType))
+
+	return err
+}
+
+func (repository LoggingRepo) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	err := repository.MetricStorage.UpdateManySliceMetric(MetricBatch)
+	repository.log("UpdateManySliceMetric", err, slog.Int("metrics", len(MetricBatch)))
+
+	return err
+}
+
+func (repository LoggingRepo) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
+	err := repository.MetricStorage.UpdateMany(DBSchema)
+	repository.log("UpdateMany", err, slog.Int("metrics", len(DBSchema)))
+
+	return err
+}
+
+func (repository LoggingRepo) Delete(key string, metricType string) error {
+	err := repository.MetricStorage.Delete(key, metricType)
+	repository.log("Delete", err, slog.String("id", key), slog.String("type", metricType))
+
+	return err
+}
+
+// log - запись операции operation с атрибутами attrs.
+func (repository LoggingRepo) log(operation string, err error, attrs ...slog.Attr) {
+	args := []any{slog.String("operation", operation)}
+	for _, attr := range attrs {
+		args = append(args, attr)
+	}
+
+	if err != nil {
+		repository.logger.Warn("Storage operation failed", append(args, logging.Err(err))...)
+		return
+	}
+	repository.logger.Debug("Storage operation", args...)
+}
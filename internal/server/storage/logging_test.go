@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggingRepo(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug})).
+		With(logging.RequestIDKey, "req-1")
+	repository := NewLoggingRepo(NewMetricsMemoryRepo(config.StoreConfig{}), logger)
+
+	require.NoError(t, repository.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("cpu", 1), gaugeMetric("mem", 2)}))
+	require.ErrorIs(t, repository.Delete("disk", metrics.MeticTypeGauge), ErrMetricNotFound)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	require.Equal(t, "DEBUG", record["level"])
+	require.Equal(t, "UpdateManySliceMetric", record["operation"])
+	require.EqualValues(t, 2, record["metrics"])
+	require.Equal(t, "req-1", record[logging.RequestIDKey])
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	require.Equal(t, "WARN", record["level"])
+	require.Equal(t, "disk", record["id"])
+	require.Equal(t, ErrMetricNotFound.Error(), record["error"])
+}
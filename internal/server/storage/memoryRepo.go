@@ -1,19 +1,20 @@
 package storage
 
 import (
+	"devops-tpl/internal/metrics"
 	"errors"
 	"sync"
 )
 
 // MemoryRepo - потокобезопасное хранилище в ОП.
 type MemoryRepo struct {
-	db map[string]MetricValue
+	db map[string]metrics.MetricValue
 	*sync.RWMutex
 }
 
 func NewMemoryRepo() (*MemoryRepo, error) {
 	return &MemoryRepo{
-		db:      make(map[string]MetricValue),
+		db:      make(map[string]metrics.MetricValue),
 		RWMutex: &sync.RWMutex{},
 	}, nil
 }
@@ -24,14 +25,14 @@ func (m *MemoryRepo) Len() int {
 	return len(m.db)
 }
 
-func (m MemoryRepo) Write(key string, value MetricValue) error {
+func (m MemoryRepo) Write(key string, value metrics.MetricValue) error {
 	m.Lock()
 	defer m.Unlock()
 	m.db[key] = value
 	return nil
 }
 
-func (m *MemoryRepo) Delete(key string) (MetricValue, bool) {
+func (m *MemoryRepo) Delete(key string) (metrics.MetricValue, bool) {
 	m.Lock()
 	defer m.Unlock()
 	oldValue, ok := m.db[key]
@@ -41,18 +42,18 @@ func (m *MemoryRepo) Delete(key string) (MetricValue, bool) {
 	return oldValue, ok
 }
 
-func (m MemoryRepo) Read(key string) (MetricValue, error) {
+func (m MemoryRepo) Read(key string) (metrics.MetricValue, error) {
 	m.RLock()
 	defer m.RUnlock()
 	value, err := m.db[key]
 	if !err {
-		return MetricValue{}, errors.New("Значение по ключу не найдено, ключ: " + key)
+		return metrics.MetricValue{}, errors.New("Значение по ключу не найдено, ключ: " + key)
 	}
 
 	return value, nil
 }
 
-func (m MemoryRepo) GetSchemaDump() map[string]MetricValue {
+func (m MemoryRepo) GetSchemaDump() map[string]metrics.MetricValue {
 	m.RLock()
 	defer m.RUnlock()
 	return m.db
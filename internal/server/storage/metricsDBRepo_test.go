@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"devops-tpl/internal/metrics"
 	"devops-tpl/internal/server/config"
 	_ "github.com/lib/pq"
 	"github.com/ory/dockertest/v3"
@@ -130,10 +132,10 @@ func (suite *MetricsDBRepoSuite) TestDBRepo_ReadEmpty() {
 	err := suite.metricsRepo.Ping()
 	suite.NoError(err)
 
-	_, err = suite.metricsRepo.Read("PollCount", MeticTypeCounter)
+	_, err = suite.metricsRepo.Read("PollCount", metrics.MeticTypeCounter)
 	suite.Error(err)
 
-	_, err = suite.metricsRepo.Read("gauge", MeticTypeGauge)
+	_, err = suite.metricsRepo.Read("gauge", metrics.MeticTypeGauge)
 	suite.Error(err)
 }
 
@@ -142,24 +144,24 @@ func (suite *MetricsDBRepoSuite) TestDBRepo_ReadWrite() {
 	suite.NoError(err)
 
 	var metricValue1 int64 = 7
-	err = suite.metricsRepo.Update("PollCount", MetricValue{
-		MType: MeticTypeCounter,
+	err = suite.metricsRepo.Update("PollCount", metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 		Delta: &metricValue1,
 	})
 	suite.NoError(err)
 
 	var metricGauge1 = 27.1
-	err = suite.metricsRepo.Update("Gauge", MetricValue{
-		MType: MeticTypeGauge,
+	err = suite.metricsRepo.Update("Gauge", metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
 		Value: &metricGauge1,
 	})
 	suite.NoError(err)
 
-	metricValueCounter, err := suite.metricsRepo.Read("PollCount", MeticTypeCounter)
+	metricValueCounter, err := suite.metricsRepo.Read("PollCount", metrics.MeticTypeCounter)
 	suite.NoError(err)
 	suite.EqualValues(metricValue1, *metricValueCounter.Delta)
 
-	metricValueGauge, err := suite.metricsRepo.Read("Gauge", MeticTypeGauge)
+	metricValueGauge, err := suite.metricsRepo.Read("Gauge", metrics.MeticTypeGauge)
 	suite.NoError(err)
 	suite.EqualValues(metricGauge1, *metricValueGauge.Value)
 
@@ -167,7 +169,7 @@ func (suite *MetricsDBRepoSuite) TestDBRepo_ReadWrite() {
 	suite.NoError(err)
 	suite.EqualValues(metricValue1, *metricValueCounter.Delta)
 
-	metricValueGauge, err = suite.metricsRepo.Read("Gauge", MeticTypeGauge)
+	metricValueGauge, err = suite.metricsRepo.Read("Gauge", metrics.MeticTypeGauge)
 	suite.NoError(err)
 	suite.EqualValues(metricGauge1, *metricValueGauge.Value)
 }
@@ -177,14 +179,14 @@ func (suite *MetricsDBRepoSuite) TestDBRepo_ReadWriteMany() {
 	suite.NoError(err)
 
 	var metricValueRaw1 int64 = 27
-	metricValue1 := MetricValue{
-		MType: MeticTypeCounter,
+	metricValue1 := metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 		Delta: &metricValueRaw1,
 	}
 
 	var metricValueRaw2 = 29.2
-	metricGauge1 := MetricValue{
-		MType: MeticTypeGauge,
+	metricGauge1 := metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
 		Value: &metricValueRaw2,
 	}
 
@@ -201,8 +203,48 @@ func (suite *MetricsDBRepoSuite) TestDBRepo_ReadWriteMany() {
 	suite.EqualValues(MetricMap{"Gauge1": metricGauge1}, repoGaugeMap)
 
 	repoAllMetricsMap := suite.metricsRepo.ReadAll()
-	suite.EqualValues(MetricMap{"Counter1": metricValue1}, repoAllMetricsMap[MeticTypeCounter])
-	suite.EqualValues(MetricMap{"Gauge1": metricGauge1}, repoAllMetricsMap[MeticTypeGauge])
+	suite.EqualValues(MetricMap{"Counter1": metricValue1}, repoAllMetricsMap[metrics.MeticTypeCounter])
+	suite.EqualValues(MetricMap{"Gauge1": metricGauge1}, repoAllMetricsMap[metrics.MeticTypeGauge])
+}
+
+func (suite *MetricsDBRepoSuite) TestDBRepo_UpdateManySliceCopy() {
+	metricBatch := testMetricBatch(bulkCopyMinRows, 2)
+
+	err := suite.metricsRepo.UpdateManySliceMetric(metricBatch)
+	suite.NoError(err)
+
+	metricValueCounter, err := suite.metricsRepo.Read("counter_0", metrics.MeticTypeCounter)
+	suite.NoError(err)
+	suite.EqualValues(2, *metricValueCounter.Delta)
+
+	metricValueGauge, err := suite.metricsRepo.Read("gauge_0", metrics.MeticTypeGauge)
+	suite.NoError(err)
+	suite.EqualValues(1, *metricValueGauge.Value)
+}
+
+func (suite *MetricsDBRepoSuite) TestDBRepo_Migrations() {
+	migrator, err := NewMigrator(suite.db)
+	suite.NoError(err)
+
+	statusList, err := migrator.Status(context.Background())
+	suite.NoError(err)
+	for _, status := range statusList {
+		suite.True(status.Applied)
+	}
+
+	// Повторное применение ничего не делает
+	appliedVersions, err := migrator.Up(context.Background())
+	suite.NoError(err)
+	suite.Empty(appliedVersions)
+
+	lastVersion := statusList[len(statusList)-1].Version
+	revertedVersions, err := migrator.Down(context.Background(), 1)
+	suite.NoError(err)
+	suite.Equal([]int{lastVersion}, revertedVersions)
+
+	appliedVersions, err = migrator.Up(context.Background())
+	suite.NoError(err)
+	suite.Equal([]int{lastVersion}, appliedVersions)
 }
 
 func TestUploaderSuite(t *testing.T) {
@@ -1,68 +1,35 @@
 package storage
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
+	"devops-tpl/internal/logging"
+	"devops-tpl/internal/metrics"
 	"devops-tpl/internal/server/config"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const SyncUploadSymbol = time.Duration(0)
 
-type MetricValue struct {
-	MType string   `json:"type" valid:"required,in(counter|gauge)"`
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
-}
-
-type Metric struct {
-	ID string `json:"id" valid:"required"`
-	MetricValue
-}
-
-func (metric MetricValue) GetStringValue() string {
-	switch metric.MType {
-	case MeticTypeGauge:
-		return fmt.Sprintf("%v", *metric.Value)
-	case MeticTypeCounter:
-		return fmt.Sprintf("%v", *metric.Delta)
-	default:
-		return ""
-	}
-}
-
-func (metric MetricValue) GetHash(id, signKey string) []byte {
-	if signKey == "" {
-		return nil
-	}
-
-	var metricLabel string
-	switch metric.MType {
-	case MeticTypeGauge:
-		metricLabel = fmt.Sprintf("%s:gauge:%f", id, *metric.Value)
-	case MeticTypeCounter:
-		metricLabel = fmt.Sprintf("%s:counter:%d", id, *metric.Delta)
-	default:
-		return nil
-	}
-
-	signerHMAC := hmac.New(sha256.New, []byte(signKey))
-	signerHMAC.Write([]byte(metricLabel))
-	return signerHMAC.Sum(nil)
-}
-
 // MetricsMemoryRepo - репозиторий в оперативной памяти для приходящей статистики.
+//
+// При включенном журнале (StoreConfig.WAL) каждое обновление дописывается в файл журнала до применения,
+// снимок выгружается по интервалу или при разрастании журнала, после чего журнал очищается.
 type MetricsMemoryRepo struct {
 	uploadMutex    *sync.RWMutex
 	gaugeStorage   *MemoryRepo
 	counterStorage *MemoryRepo
+	wal            *writeAheadLog
 	config         config.StoreConfig
+	// intervalUpdates - новый интервал выгрузки для запущенной периодической выгрузки
+	intervalUpdates chan time.Duration
+	// stop - остановка периодической выгрузки при закрытии хранилища (Close)
+	stop chan struct{}
+	// snapshotObserver - наблюдатель записи снимков (ObserveSnapshots), func(time.Duration, error)
+	snapshotObserver *atomic.Value
 }
 
 func NewMetricsMemoryRepo(config config.StoreConfig) MetricsMemoryRepo {
@@ -71,6 +38,9 @@ func NewMetricsMemoryRepo(config config.StoreConfig) MetricsMemoryRepo {
 
 	mmr.config = config
 	mmr.uploadMutex = &sync.RWMutex{}
+	mmr.intervalUpdates = make(chan time.Duration, 1)
+	mmr.stop = make(chan struct{})
+	mmr.snapshotObserver = &atomic.Value{}
 	mmr.gaugeStorage, err = NewMemoryRepo()
 	if err != nil {
 		panic("gaugeMemoryRepo init error")
@@ -80,6 +50,18 @@ func NewMetricsMemoryRepo(config config.StoreConfig) MetricsMemoryRepo {
 		panic("counterMemoryRepo init error")
 	}
 
+	if mmr.config.WAL {
+		if mmr.config.File == "" {
+			panic("wal requires store file")
+		}
+		mmr.wal, err = openWAL(walPath(mmr.config.File), mmr.config.WALFsync)
+		if err != nil {
+			panic(fmt.Sprintf("wal init error: %v", err))
+		}
+		// Нумерация продолжается после записей, уже вошедших в снимки
+		mmr.wal.SetSeq(snapshotWALSeq(mmr.config.File, mmr.config.Generations))
+	}
+
 	if mmr.config.Interval != SyncUploadSymbol {
 		mmr.IterativeUploadToFile()
 	}
@@ -87,34 +69,38 @@ func NewMetricsMemoryRepo(config config.StoreConfig) MetricsMemoryRepo {
 	return mmr
 }
 
-func (mmr MetricsMemoryRepo) Update(key string, newMetricValue MetricValue) error {
+func (mmr MetricsMemoryRepo) Update(key string, newMetricValue metrics.MetricValue) error {
 	switch newMetricValue.MType {
-	case MeticTypeGauge:
+	case metrics.MeticTypeGauge:
 		if newMetricValue.Value == nil {
 			return errors.New("metric Value is empty")
 		}
 		newMetricValue.Delta = nil
-
-		return mmr.updateGaugeValue(key, newMetricValue)
-	case MeticTypeCounter:
+	case metrics.MeticTypeCounter:
 		if newMetricValue.Delta == nil {
 			return errors.New("metric Delta is empty")
 		}
 		newMetricValue.Value = nil
-
-		return mmr.updateCounterValue(key, newMetricValue)
 	default:
 		return errors.New("metric type is not defined")
 	}
-}
 
-func (mmr MetricsMemoryRepo) updateGaugeValue(key string, newMetricValue MetricValue) error {
 	mmr.uploadMutex.Lock()
-	err := mmr.gaugeStorage.Write(key, newMetricValue)
+	if mmr.wal != nil {
+		err := mmr.wal.Append(metrics.Metric{ID: key, MetricValue: newMetricValue})
+		if err != nil {
+			mmr.uploadMutex.Unlock()
+			return err
+		}
+	}
+	mmr.applyUpdate(key, newMetricValue)
 	mmr.uploadMutex.Unlock()
 
-	if err != nil {
-		return err
+	if mmr.wal != nil {
+		if mmr.wal.Size() >= walCompactSize {
+			return mmr.UploadToFile()
+		}
+		return nil
 	}
 
 	if mmr.config.Interval == SyncUploadSymbol {
@@ -124,38 +110,70 @@ func (mmr MetricsMemoryRepo) updateGaugeValue(key string, newMetricValue MetricV
 	return nil
 }
 
-func (mmr MetricsMemoryRepo) updateCounterValue(key string, newMetricValue MetricValue) error {
-	//Чтение старого значения
-	oldMetricValue, err := mmr.Read(key, MeticTypeCounter)
-	if err != nil {
-		var delta int64 = 0
-		oldMetricValue = MetricValue{
-			Delta: &delta,
-		}
+// applyUpdate - применение проверенного обновления в памяти, вызывается под uploadMutex.
+// Для counter значение накапливается.
+func (mmr MetricsMemoryRepo) applyUpdate(key string, newMetricValue metrics.MetricValue) {
+	if newMetricValue.MType == metrics.MeticTypeGauge {
+		mmr.gaugeStorage.Write(key, newMetricValue)
+		return
 	}
 
-	newValue := *oldMetricValue.Delta + *newMetricValue.Delta
+	newValue := *newMetricValue.Delta
+	oldMetricValue, err := mmr.counterStorage.Read(key)
+	if err == nil {
+		newValue += *oldMetricValue.Delta
+	}
 	newMetricValue.Delta = &newValue
 
-	mmr.uploadMutex.Lock()
 	mmr.counterStorage.Write(key, newMetricValue)
+}
+
+func (mmr MetricsMemoryRepo) Read(key string, metricType string) (metrics.MetricValue, error) {
+	switch metricType {
+	case metrics.MeticTypeGauge:
+		return mmr.gaugeStorage.Read(key)
+	case metrics.MeticTypeCounter:
+		return mmr.counterStorage.Read(key)
+	default:
+		return metrics.MetricValue{}, errors.New("metricType not found")
+	}
+}
+
+// Delete - удаление метрики, при включенном журнале удаление записывается в журнал.
+func (mmr MetricsMemoryRepo) Delete(key string, metricType string) error {
+	if metricType != metrics.MeticTypeGauge && metricType != metrics.MeticTypeCounter {
+		return errors.New("metricType not found")
+	}
+
+	mmr.uploadMutex.Lock()
+	if _, err := mmr.Read(key, metricType); err != nil {
+		mmr.uploadMutex.Unlock()
+		return ErrMetricNotFound
+	}
+	if mmr.wal != nil {
+		err := mmr.wal.AppendDelete(key, metricType)
+		if err != nil {
+			mmr.uploadMutex.Unlock()
+			return err
+		}
+	}
+	mmr.applyDelete(key, metricType)
 	mmr.uploadMutex.Unlock()
 
-	if mmr.config.Interval == SyncUploadSymbol {
+	if mmr.wal == nil && mmr.config.Interval == SyncUploadSymbol {
 		return mmr.UploadToFile()
 	}
 
 	return nil
 }
 
-func (mmr MetricsMemoryRepo) Read(key string, metricType string) (MetricValue, error) {
+// applyDelete - удаление в памяти, вызывается под uploadMutex.
+func (mmr MetricsMemoryRepo) applyDelete(key string, metricType string) {
 	switch metricType {
-	case MeticTypeGauge:
-		return mmr.gaugeStorage.Read(key)
-	case MeticTypeCounter:
-		return mmr.counterStorage.Read(key)
-	default:
-		return MetricValue{}, errors.New("metricType not found")
+	case metrics.MeticTypeGauge:
+		mmr.gaugeStorage.Delete(key)
+	case metrics.MeticTypeCounter:
+		mmr.counterStorage.Delete(key)
 	}
 }
 
@@ -166,24 +184,40 @@ func (mmr MetricsMemoryRepo) UploadToFile() error {
 		return nil
 	}
 
-	file, err := os.OpenFile(mmr.config.File, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
-	if err != nil {
-		return err
+	start := time.Now()
+	err := mmr.uploadSnapshot()
+	if observer, ok := mmr.snapshotObserver.Load().(func(time.Duration, error)); ok {
+		observer(time.Since(start), err)
+	}
+
+	return err
+}
+
+// uploadSnapshot - запись снимка хранилища и очистка вошедших в него записей журнала.
+func (mmr MetricsMemoryRepo) uploadSnapshot() error {
+	if mmr.wal == nil {
+		return writeSnapshot(mmr.config.File, mmr.config.Generations, 0, mmr.ReadAll())
 	}
-	defer file.Close()
-	allStates := mmr.ReadAll()
-	err = json.NewEncoder(file).Encode(allStates)
+
+	// Записи журнала до walSeq вошли в снимок и больше не нужны
+	err := writeSnapshot(mmr.config.File, mmr.config.Generations, mmr.wal.Seq(), mmr.ReadAll())
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return mmr.wal.Reset()
 }
 
 func (mmr MetricsMemoryRepo) Save() error {
 	return mmr.UploadToFile()
 }
 
+// ObserveSnapshots - observer вызывается после каждой записи снимка в файл с ее длительностью и ошибкой.
+func (mmr MetricsMemoryRepo) ObserveSnapshots(observer func(duration time.Duration, err error)) {
+	mmr.snapshotObserver.Store(observer)
+}
+
+// IterativeUploadToFile - запуск периодической выгрузки снимка в файл до закрытия хранилища (Close).
 func (mmr MetricsMemoryRepo) IterativeUploadToFile() {
 	interval := mmr.config.Interval
 	if interval == time.Duration(0) {
@@ -192,37 +226,107 @@ func (mmr MetricsMemoryRepo) IterativeUploadToFile() {
 	tickerUpload := time.NewTicker(mmr.config.Interval)
 
 	go func() {
-		for range tickerUpload.C {
-			err := mmr.UploadToFile()
-			if err != nil {
-				log.Println(err)
+		defer tickerUpload.Stop()
+
+		for {
+			select {
+			case <-mmr.stop:
+				return
+			case interval := <-mmr.intervalUpdates:
+				tickerUpload.Reset(interval)
+			case <-tickerUpload.C:
+				err := mmr.UploadToFile()
+				if err != nil {
+					slog.Error("Snapshot upload error", logging.Err(err))
+				}
 			}
 		}
 	}()
 }
 
+// Reconfigure - изменение интервала выгрузки. Переход между синхронной (интервал 0) и периодической
+// выгрузкой требует перезапуска.
+func (mmr MetricsMemoryRepo) Reconfigure(current config.StoreConfig, next config.StoreConfig) config.StoreConfig {
+	applied := current
+	if current.Interval == SyncUploadSymbol || next.Interval == SyncUploadSymbol || current.Interval == next.Interval {
+		return applied
+	}
+
+	applied.Interval = next.Interval
+	for {
+		select {
+		case mmr.intervalUpdates <- next.Interval:
+			return applied
+		case <-mmr.intervalUpdates:
+			// Еще не примененный интервал заменяется новым
+		}
+	}
+}
+
+// InitFromFile - восстановление из последнего целого снимка и записей журнала, не вошедших в снимок.
 func (mmr MetricsMemoryRepo) InitFromFile() {
-	file, err := os.OpenFile(mmr.config.File, os.O_RDONLY|os.O_CREATE, 0777)
+	mmr.uploadMutex.Lock()
+	defer mmr.uploadMutex.Unlock()
+
+	metricsDump, snapshotWALSeq, snapshotPath, err := readSnapshot(mmr.config.File, mmr.config.Generations)
 	if err != nil {
-		fmt.Println(err.Error())
+		slog.Warn("Metrics not restored", logging.Err(err))
+	} else {
+		for _, metricList := range metricsDump {
+			for metricKey, metricValue := range metricList {
+				if !isValidMetricValue(metricValue) {
+					slog.Warn("Skipped invalid metric from snapshot", slog.String("id", metricKey))
+					continue
+				}
+				mmr.applyUpdate(metricKey, metricValue)
+			}
+		}
+		slog.Info("Metrics restored", slog.String("snapshot", snapshotPath))
 	}
-	defer file.Close()
 
-	var metricsDump map[string]MetricMap
-	err = json.NewDecoder(file).Decode(&metricsDump)
+	if mmr.wal == nil {
+		return
+	}
+
+	records, err := readWAL(walPath(mmr.config.File))
 	if err != nil {
-		log.Println(err)
+		slog.Error("WAL read error", logging.Err(err))
+		return
 	}
 
-	for _, metricList := range metricsDump {
-		err = mmr.UpdateMany(metricList)
+	var replayed int
+	for _, record := range records {
+		if record.Seq <= snapshotWALSeq {
+			continue
+		}
+		if record.Deleted {
+			mmr.applyDelete(record.ID, record.MType)
+			replayed++
+			continue
+		}
+		if !isValidMetricValue(record.MetricValue) {
+			continue
+		}
+		mmr.applyUpdate(record.ID, record.MetricValue)
+		replayed++
 	}
-	if err != nil {
-		log.Println(err)
+	if replayed != 0 {
+		slog.Info("Replayed wal records", slog.Int("records", replayed))
 	}
 }
 
-func (mmr MetricsMemoryRepo) UpdateManySliceMetric(MetricBatch []Metric) error {
+func isValidMetricValue(metricValue metrics.MetricValue) bool {
+	switch metricValue.MType {
+	case metrics.MeticTypeGauge:
+		return metricValue.Value != nil
+	case metrics.MeticTypeCounter:
+		return metricValue.Delta != nil
+	default:
+		return false
+	}
+}
+
+func (mmr MetricsMemoryRepo) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
 	for _, metricValue := range MetricBatch {
 		err := mmr.Update(metricValue.ID, metricValue.MetricValue)
 		if err != nil {
@@ -232,7 +336,7 @@ func (mmr MetricsMemoryRepo) UpdateManySliceMetric(MetricBatch []Metric) error {
 	return nil
 }
 
-func (mmr MetricsMemoryRepo) UpdateMany(DBSchema map[string]MetricValue) error {
+func (mmr MetricsMemoryRepo) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
 	for metricKey, metricValue := range DBSchema {
 		err := mmr.Update(metricKey, metricValue)
 		if err != nil {
@@ -245,19 +349,32 @@ func (mmr MetricsMemoryRepo) UpdateMany(DBSchema map[string]MetricValue) error {
 
 func (mmr MetricsMemoryRepo) ReadAll() map[string]MetricMap {
 	return map[string]MetricMap{
-		MeticTypeGauge:   mmr.gaugeStorage.GetSchemaDump(),
-		MeticTypeCounter: mmr.counterStorage.GetSchemaDump(),
+		metrics.MeticTypeGauge:   mmr.gaugeStorage.GetSchemaDump(),
+		metrics.MeticTypeCounter: mmr.counterStorage.GetSchemaDump(),
 	}
 }
 
 func (mmr MetricsMemoryRepo) Close() error {
+	select {
+	case <-mmr.stop:
+	default:
+		close(mmr.stop)
+	}
+
 	err := mmr.gaugeStorage.Close()
 	if err != nil {
 		return err
 	}
 	err = mmr.counterStorage.Close()
+	if err != nil {
+		return err
+	}
 
-	return err
+	if mmr.wal != nil {
+		return mmr.wal.Close()
+	}
+
+	return nil
 }
 
 func (mmr MetricsMemoryRepo) Ping() error {
@@ -6,8 +6,11 @@ import (
 	"github.com/stretchr/testify/require"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"devops-tpl/internal/metrics"
 	"devops-tpl/internal/server/config"
 )
 
@@ -22,8 +25,8 @@ func ExampleMemoryRepo() {
 	err = memoryRepo.Ping()
 
 	var counterValueExpect int64 = 50
-	err = memoryRepo.Write("PollCount", MetricValue{
-		MType: MeticTypeCounter,
+	err = memoryRepo.Write("PollCount", metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 		Delta: &counterValueExpect,
 	})
 	if err != nil {
@@ -49,8 +52,8 @@ func TestMemoryRepoRWD(t *testing.T) {
 
 	var counterValueExpect int64 = 50
 
-	err = memoryRepo.Write("PollCount", MetricValue{
-		MType: MeticTypeCounter,
+	err = memoryRepo.Write("PollCount", metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 		Delta: &counterValueExpect,
 	})
 
@@ -97,29 +100,29 @@ func TestMemoryRepoUpdateValues(t *testing.T) {
 	var metricValue2 int64 = 22
 	var metricValue3 = 27.5
 
-	err = metricsMemoryRepo.Update("PollCount", MetricValue{
-		MType: MeticTypeCounter,
+	err = metricsMemoryRepo.Update("PollCount", metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 		Delta: &metricValue1,
 	})
 	require.NoError(t, err)
 
-	err = metricsMemoryRepo.Update("PollCount", MetricValue{
-		MType: MeticTypeCounter,
+	err = metricsMemoryRepo.Update("PollCount", metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 		Delta: &metricValue2,
 	})
 	require.NoError(t, err)
 
-	err = metricsMemoryRepo.Update("Gauge1", MetricValue{
-		MType: MeticTypeGauge,
+	err = metricsMemoryRepo.Update("Gauge1", metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
 		Value: &metricValue3,
 	})
 	require.NoError(t, err)
 
-	PollCount, err := metricsMemoryRepo.Read("PollCount", MeticTypeCounter)
+	PollCount, err := metricsMemoryRepo.Read("PollCount", metrics.MeticTypeCounter)
 	require.NoError(t, err)
 	require.EqualValues(t, 29, *PollCount.Delta)
 
-	Gauge1, err := metricsMemoryRepo.Read("Gauge1", MeticTypeGauge)
+	Gauge1, err := metricsMemoryRepo.Read("Gauge1", metrics.MeticTypeGauge)
 	require.NoError(t, err)
 	require.EqualValues(t, 27.5, *Gauge1.Value)
 
@@ -134,16 +137,16 @@ func TestMemoryRepoReadAll(t *testing.T) {
 	require.NoError(t, err)
 
 	var metricValueDelta1 int64 = 11
-	metricValue1 := MetricValue{
-		MType: MeticTypeCounter,
+	metricValue1 := metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 		Delta: &metricValueDelta1,
 	}
 	err = metricsMemoryRepo.Update("PollCount1", metricValue1)
 	require.NoError(t, err)
 
 	var metricValueDelta2 int64 = 22
-	metricValue2 := MetricValue{
-		MType: MeticTypeCounter,
+	metricValue2 := metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
 		Delta: &metricValueDelta2,
 	}
 	err = metricsMemoryRepo.Update("PollCount2", metricValue2)
@@ -153,15 +156,15 @@ func TestMemoryRepoReadAll(t *testing.T) {
 
 	repoMetricMap := MetricMap{"PollCount1": metricValue1, "PollCount2": metricValue2}
 	repoValuesExpected := map[string]MetricMap{
-		MeticTypeGauge:   {},
-		MeticTypeCounter: repoMetricMap,
+		metrics.MeticTypeGauge:   {},
+		metrics.MeticTypeCounter: repoMetricMap,
 	}
 	require.EqualValues(t, repoValues, repoValuesExpected)
 
-	actualMetricValue1, err := metricsMemoryRepo.Read("PollCount1", MeticTypeCounter)
+	actualMetricValue1, err := metricsMemoryRepo.Read("PollCount1", metrics.MeticTypeCounter)
 	require.NoError(t, err)
 
-	actualMetricValue2, err := metricsMemoryRepo.Read("PollCount2", MeticTypeCounter)
+	actualMetricValue2, err := metricsMemoryRepo.Read("PollCount2", metrics.MeticTypeCounter)
 	require.NoError(t, err)
 
 	require.Equal(t, "11", actualMetricValue1.GetStringValue())
@@ -201,6 +204,28 @@ func TestMemoryRepoFileIterativeWrite(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestMemoryRepoIterativeUploadStopsOnClose(t *testing.T) {
+	storeFile := filepath.Join(t.TempDir(), "metrics.json")
+	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{
+		File:     storeFile,
+		Interval: 10 * time.Millisecond,
+	})
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(storeFile)
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, metricsMemoryRepo.Close())
+	// Выгрузка, начатая до Close, успевает завершиться
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, os.Remove(storeFile))
+
+	time.Sleep(50 * time.Millisecond)
+	_, err := os.Stat(storeFile)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
 func TestMemoryRepoUpdateMany(t *testing.T) {
 	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
 
@@ -211,17 +236,17 @@ func TestMemoryRepoUpdateMany(t *testing.T) {
 	var metricValueDelta2 int64 = 22
 	var metricValueDelta3 = 27.5
 
-	metricValueList := map[string]MetricValue{
+	metricValueList := map[string]metrics.MetricValue{
 		"PollCount1": {
-			MType: MeticTypeCounter,
+			MType: metrics.MeticTypeCounter,
 			Delta: &metricValueDelta1,
 		},
 		"PollCount2": {
-			MType: MeticTypeCounter,
+			MType: metrics.MeticTypeCounter,
 			Delta: &metricValueDelta2,
 		},
 		"Gauge1": {
-			MType: MeticTypeGauge,
+			MType: metrics.MeticTypeGauge,
 			Value: &metricValueDelta3,
 		},
 	}
@@ -229,13 +254,13 @@ func TestMemoryRepoUpdateMany(t *testing.T) {
 	err = metricsMemoryRepo.UpdateMany(metricValueList)
 	require.NoError(t, err)
 
-	_, err = metricsMemoryRepo.Read("PollCount1", MeticTypeCounter)
+	_, err = metricsMemoryRepo.Read("PollCount1", metrics.MeticTypeCounter)
 	require.NoError(t, err)
 
-	_, err = metricsMemoryRepo.Read("PollCount2", MeticTypeCounter)
+	_, err = metricsMemoryRepo.Read("PollCount2", metrics.MeticTypeCounter)
 	require.NoError(t, err)
 
-	_, err = metricsMemoryRepo.Read("Gauge1", MeticTypeGauge)
+	_, err = metricsMemoryRepo.Read("Gauge1", metrics.MeticTypeGauge)
 	require.NoError(t, err)
 
 	err = metricsMemoryRepo.Close()
@@ -252,25 +277,25 @@ func TestMemoryRepoUpdateManySlice(t *testing.T) {
 	var metricValueDelta2 int64 = 22
 	var metricValueDelta3 = 27.5
 
-	metricValueList := []Metric{
+	metricValueList := []metrics.Metric{
 		{
 			ID: "PollCount1",
-			MetricValue: MetricValue{
-				MType: MeticTypeCounter,
+			MetricValue: metrics.MetricValue{
+				MType: metrics.MeticTypeCounter,
 				Delta: &metricValueDelta1,
 			},
 		},
 		{
 			ID: "PollCount2",
-			MetricValue: MetricValue{
-				MType: MeticTypeCounter,
+			MetricValue: metrics.MetricValue{
+				MType: metrics.MeticTypeCounter,
 				Delta: &metricValueDelta2,
 			},
 		},
 		{
 			ID: "Gauge1",
-			MetricValue: MetricValue{
-				MType: MeticTypeGauge,
+			MetricValue: metrics.MetricValue{
+				MType: metrics.MeticTypeGauge,
 				Value: &metricValueDelta3,
 			},
 		},
@@ -279,13 +304,13 @@ func TestMemoryRepoUpdateManySlice(t *testing.T) {
 	err = metricsMemoryRepo.UpdateManySliceMetric(metricValueList)
 	require.NoError(t, err)
 
-	_, err = metricsMemoryRepo.Read("PollCount1", MeticTypeCounter)
+	_, err = metricsMemoryRepo.Read("PollCount1", metrics.MeticTypeCounter)
 	require.NoError(t, err)
 
-	_, err = metricsMemoryRepo.Read("PollCount2", MeticTypeCounter)
+	_, err = metricsMemoryRepo.Read("PollCount2", metrics.MeticTypeCounter)
 	require.NoError(t, err)
 
-	_, err = metricsMemoryRepo.Read("Gauge1", MeticTypeGauge)
+	_, err = metricsMemoryRepo.Read("Gauge1", metrics.MeticTypeGauge)
 	require.NoError(t, err)
 
 	err = metricsMemoryRepo.Close()
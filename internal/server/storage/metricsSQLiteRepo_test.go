@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsSQLiteRepoSuite struct {
+	suite.Suite
+	metricsRepo *SQLiteRepo
+	tempDir     string
+}
+
+func (suite *MetricsSQLiteRepoSuite) SetupSuite() {
+	var err error
+
+	suite.tempDir, err = os.MkdirTemp("", "sqlite-repo")
+	suite.Require().NoError(err)
+
+	metricsRepo, err := NewSQLiteRepo(config.StoreConfig{
+		File:        filepath.Join(suite.tempDir, "dump.json"),
+		DatabaseDSN: SQLiteDSNScheme + filepath.Join(suite.tempDir, "metrics.db"),
+	})
+	suite.Require().NoError(err)
+	suite.metricsRepo = &metricsRepo
+
+	suite.metricsRepo.InitFromFile()
+}
+
+func (suite *MetricsSQLiteRepoSuite) TearDownSuite() {
+	err := suite.metricsRepo.Save()
+	suite.NoError(err)
+
+	err = suite.metricsRepo.Close()
+	suite.NoError(err)
+
+	err = os.RemoveAll(suite.tempDir)
+	suite.NoError(err)
+}
+
+func (suite *MetricsSQLiteRepoSuite) TearDownTest() {
+	_, err := suite.metricsRepo.DB().Exec("DELETE FROM counter")
+	suite.NoError(err)
+	_, err = suite.metricsRepo.DB().Exec("DELETE FROM gauge")
+	suite.NoError(err)
+}
+
+func (suite *MetricsSQLiteRepoSuite) TestSQLiteRepo_Ping() {
+	err := suite.metricsRepo.Ping()
+	suite.NoError(err)
+}
+
+func (suite *MetricsSQLiteRepoSuite) TestSQLiteRepo_ReadEmpty() {
+	_, err := suite.metricsRepo.Read("PollCount", metrics.MeticTypeCounter)
+	suite.Error(err)
+
+	_, err = suite.metricsRepo.Read("gauge", metrics.MeticTypeGauge)
+	suite.Error(err)
+
+	_, err = suite.metricsRepo.Read("gauge", "histogram")
+	suite.Error(err)
+}
+
+func (suite *MetricsSQLiteRepoSuite) TestSQLiteRepo_ReadWrite() {
+	var metricValue1 int64 = 7
+	var metricValue2 int64 = 22
+	err := suite.metricsRepo.Update("PollCount", metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
+		Delta: &metricValue1,
+	})
+	suite.NoError(err)
+
+	err = suite.metricsRepo.Update("PollCount", metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
+		Delta: &metricValue2,
+	})
+	suite.NoError(err)
+
+	var metricGauge1 = 27.1
+	var metricGauge2 = 28.3
+	err = suite.metricsRepo.Update("Gauge", metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
+		Value: &metricGauge1,
+	})
+	suite.NoError(err)
+
+	err = suite.metricsRepo.Update("Gauge", metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
+		Value: &metricGauge2,
+	})
+	suite.NoError(err)
+
+	err = suite.metricsRepo.Update("Gauge", metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
+	})
+	suite.Error(err)
+
+	metricValueCounter, err := suite.metricsRepo.Read("PollCount", metrics.MeticTypeCounter)
+	suite.NoError(err)
+	suite.EqualValues(29, *metricValueCounter.Delta)
+
+	metricValueGauge, err := suite.metricsRepo.Read("Gauge", metrics.MeticTypeGauge)
+	suite.NoError(err)
+	suite.EqualValues(metricGauge2, *metricValueGauge.Value)
+}
+
+func (suite *MetricsSQLiteRepoSuite) TestSQLiteRepo_Delete() {
+	var metricValue int64 = 7
+	err := suite.metricsRepo.Update("PollCount", metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
+		Delta: &metricValue,
+	})
+	suite.NoError(err)
+
+	err = suite.metricsRepo.Delete("PollCount", metrics.MeticTypeGauge)
+	suite.ErrorIs(err, ErrMetricNotFound)
+
+	err = suite.metricsRepo.Delete("PollCount", metrics.MeticTypeCounter)
+	suite.NoError(err)
+
+	_, err = suite.metricsRepo.Read("PollCount", metrics.MeticTypeCounter)
+	suite.Error(err)
+
+	err = suite.metricsRepo.Delete("PollCount", metrics.MeticTypeCounter)
+	suite.ErrorIs(err, ErrMetricNotFound)
+
+	err = suite.metricsRepo.Delete("PollCount", "histogram")
+	suite.Error(err)
+}
+
+func (suite *MetricsSQLiteRepoSuite) TestSQLiteRepo_ReadWriteMany() {
+	var metricValueRaw1 int64 = 27
+	metricValue1 := metrics.MetricValue{
+		MType: metrics.MeticTypeCounter,
+		Delta: &metricValueRaw1,
+	}
+
+	var metricValueRaw2 = 29.2
+	metricGauge1 := metrics.MetricValue{
+		MType: metrics.MeticTypeGauge,
+		Value: &metricValueRaw2,
+	}
+
+	repoMetricMap := MetricMap{"Counter1": metricValue1, "Gauge1": metricGauge1}
+	err := suite.metricsRepo.UpdateMany(repoMetricMap)
+	suite.NoError(err)
+
+	repoCounterMap, err := suite.metricsRepo.readAllCounter()
+	suite.NoError(err)
+	suite.EqualValues(MetricMap{"Counter1": metricValue1}, repoCounterMap)
+
+	repoGaugeMap, err := suite.metricsRepo.readAllGauge()
+	suite.NoError(err)
+	suite.EqualValues(MetricMap{"Gauge1": metricGauge1}, repoGaugeMap)
+
+	repoAllMetricsMap := suite.metricsRepo.ReadAll()
+	suite.EqualValues(MetricMap{"Counter1": metricValue1}, repoAllMetricsMap[metrics.MeticTypeCounter])
+	suite.EqualValues(MetricMap{"Gauge1": metricGauge1}, repoAllMetricsMap[metrics.MeticTypeGauge])
+}
+
+func (suite *MetricsSQLiteRepoSuite) TestSQLiteRepo_UpdateManySliceCounterAccumulation() {
+	var delta int64 = 3
+	metricBatch := []metrics.Metric{
+		{ID: "Counter1", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}},
+		{ID: "Counter1", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}},
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			suite.NoError(suite.metricsRepo.UpdateManySliceMetric(metricBatch))
+		}()
+	}
+	wg.Wait()
+
+	metricValueCounter, err := suite.metricsRepo.Read("Counter1", metrics.MeticTypeCounter)
+	suite.NoError(err)
+	suite.EqualValues(30, *metricValueCounter.Delta)
+}
+
+func (suite *MetricsSQLiteRepoSuite) TestSQLiteRepo_UpdateManySliceLargeBatch() {
+	// Пакет больше одного многострочного запроса, каждая метрика повторяется дважды
+	metricBatch := testMetricBatch(bulkUpsertRows+10, 2)
+
+	err := suite.metricsRepo.UpdateManySliceMetric(metricBatch)
+	suite.NoError(err)
+
+	repoAllMetricsMap := suite.metricsRepo.ReadAll()
+	suite.Len(repoAllMetricsMap[metrics.MeticTypeCounter], (bulkUpsertRows+10)/2)
+	suite.Len(repoAllMetricsMap[metrics.MeticTypeGauge], (bulkUpsertRows+10)/2)
+	suite.EqualValues(2, *repoAllMetricsMap[metrics.MeticTypeCounter]["counter_7"].Delta)
+	// Для gauge остается последнее значение в пакете
+	suite.EqualValues(1, *repoAllMetricsMap[metrics.MeticTypeGauge]["gauge_7"].Value)
+}
+
+func TestSQLiteRepoSuite(t *testing.T) {
+	suite.Run(t, new(MetricsSQLiteRepoSuite))
+}
+
+func TestSQLiteRepoMemory(t *testing.T) {
+	metricsRepo, err := NewSQLiteRepo(config.StoreConfig{
+		DatabaseDSN: SQLiteDSNScheme + ":memory:",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metricsRepo.Close()
+
+	var value = 1.5
+	err = metricsRepo.Update("Gauge", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metricValue, err := metricsRepo.Read("Gauge", metrics.MeticTypeGauge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *metricValue.Value != value {
+		t.Fatalf("expected %v, got %v", value, *metricValue.Value)
+	}
+}
+
+func TestSQLiteRepoMigrations(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		DatabaseDSN: SQLiteDSNScheme + filepath.Join(t.TempDir(), "metrics.db"),
+	}
+
+	metricsRepo, err := NewSQLiteRepo(storeConfig)
+	require.NoError(t, err)
+	metricsRepo.Close()
+
+	// Повторное открытие не применяет миграции заново
+	metricsRepo, err = NewSQLiteRepo(storeConfig)
+	require.NoError(t, err)
+	defer metricsRepo.Close()
+
+	migrator, err := newMigrator(metricsRepo.DB(), dialectSQLite)
+	require.NoError(t, err)
+
+	statusList, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	require.NotEmpty(t, statusList)
+	for _, status := range statusList {
+		require.True(t, status.Applied, status.Name)
+		require.False(t, status.AppliedAt.IsZero(), status.Name)
+	}
+}
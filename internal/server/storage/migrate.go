@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationsFS embed.FS
+
+// migrationLockKey - ключ advisory блокировки Postgres, под которой выполняются миграции,
+// чтобы несколько одновременно запускаемых серверов не применяли их параллельно.
+const migrationLockKey int64 = 7_305_150_512
+
+var (
+	ErrMigrationFileName = errors.New("invalid migration file name, expected <version>_<name>.<up|down>.sql")
+	ErrMigrationNoDown   = errors.New("migration has no down script")
+	ErrMigrationUnknown  = errors.New("database has applied migrations unknown to this build")
+)
+
+// Migration - одна версия схемы БД.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus - состояние миграции в БД.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator - применение и откат версионированных SQL миграций.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// NewMigrator - миграции БД Postgres.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	return newMigrator(db, dialectPostgres)
+}
+
+// OpenMigrator - подключение к БД по DSN и ее миграции: SQLite для DSN sqlite://, иначе Postgres.
+// Соединение с БД закрывает вызывающий.
+func OpenMigrator(dsn string) (*sql.DB, *Migrator, error) {
+	driver, driverDSN, dialect := "pgx", dsn, dialectPostgres
+	if IsSQLiteDSN(dsn) {
+		driver, driverDSN, dialect = "sqlite", sqliteDriverDSN(dsn), dialectSQLite
+	}
+
+	db, err := sql.Open(driver, driverDSN)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrator, err := newMigrator(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return db, migrator, nil
+}
+
+// newMigrator - миграции БД dialect из каталога migrations/<dialect>.
+func newMigrator(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS, path.Join("migrations", dialect))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// loadMigrations - чтение миграций вида 0001_name.up.sql / 0001_name.down.sql, отсортированных по версии.
+func loadMigrations(migrationsDir fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsDir, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		baseName := strings.TrimSuffix(fileName, ".sql")
+
+		var direction string
+		switch {
+		case strings.HasSuffix(baseName, ".up"):
+			direction = "up"
+		case strings.HasSuffix(baseName, ".down"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrMigrationFileName, fileName)
+		}
+		baseName = strings.TrimSuffix(baseName, "."+direction)
+
+		rawVersion, name, found := strings.Cut(baseName, "_")
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrMigrationFileName, fileName)
+		}
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrMigrationFileName, fileName)
+		}
+
+		script, err := fs.ReadFile(migrationsDir, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// withLock - выполнение fn на отдельном соединении под advisory блокировкой Postgres.
+// SQLite блокирует файл БД на время транзакции миграции сам, поэтому отдельная блокировка не нужна.
+func (migrator *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := migrator.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	schemaVersionQuery := "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())"
+	if migrator.dialect == dialectSQLite {
+		schemaVersionQuery = "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)"
+	} else {
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey)
+		if err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}
+
+	_, err = conn.ExecContext(ctx, schemaVersionQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// schemaVersionExists - наличие таблицы schema_version.
+func (migrator *Migrator) schemaVersionExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	query := "SELECT to_regclass('schema_version') IS NOT NULL"
+	if migrator.dialect == dialectSQLite {
+		query = "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'"
+	}
+
+	var exists bool
+	err := conn.QueryRowContext(ctx, query).Scan(&exists)
+	return exists, err
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// Up - применение всех неприменных миграций, каждая в своей транзакции. Возвращает примененные версии.
+func (migrator *Migrator) Up(ctx context.Context) ([]int, error) {
+	var appliedNow []int
+
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrator.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err = runMigration(ctx, conn, migration.Up,
+				"INSERT INTO schema_version (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			appliedNow = append(appliedNow, migration.Version)
+		}
+
+		return nil
+	})
+
+	return appliedNow, err
+}
+
+// Down - откат steps последних примененных миграций. Возвращает откаченные версии.
+func (migrator *Migrator) Down(ctx context.Context, steps int) ([]int, error) {
+	var revertedNow []int
+
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrator.migrations) - 1; i >= 0 && len(revertedNow) < steps; i-- {
+			migration := migrator.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, ErrMigrationNoDown)
+			}
+
+			err = runMigration(ctx, conn, migration.Down,
+				"DELETE FROM schema_version WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			revertedNow = append(revertedNow, migration.Version)
+		}
+
+		return nil
+	})
+
+	return revertedNow, err
+}
+
+// Status - состояние всех известных миграций. Только читает БД: без блокировки и без создания schema_version,
+// если таблицы нет, ни одна миграция не применена.
+// Если в БД есть версии, которых нет в сборке, возвращается ErrMigrationUnknown вместе со списком.
+func (migrator *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := migrator.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	applied := map[int]time.Time{}
+	exists, err := migrator.schemaVersionExists(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		applied, err = appliedVersions(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var statusList []MigrationStatus
+	known := map[int]bool{}
+	for _, migration := range migrator.migrations {
+		known[migration.Version] = true
+		appliedAt, ok := applied[migration.Version]
+		statusList = append(statusList, MigrationStatus{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	var unknownVersions []int
+	for version := range applied {
+		if !known[version] {
+			unknownVersions = append(unknownVersions, version)
+		}
+	}
+
+	if len(unknownVersions) != 0 {
+		sort.Ints(unknownVersions)
+		return statusList, fmt.Errorf("%w: %v", ErrMigrationUnknown, unknownVersions)
+	}
+
+	return statusList, nil
+}
+
+func runMigration(ctx context.Context, conn *sql.Conn, script string, versionQuery string, versionArgs ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, versionQuery, versionArgs...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
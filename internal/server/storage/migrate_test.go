@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dialect := range []string{dialectPostgres, dialectSQLite} {
+		migrations, err := loadMigrations(migrationsFS, path.Join("migrations", dialect))
+		require.NoError(t, err, dialect)
+		require.NotEmpty(t, migrations, dialect)
+
+		for i, migration := range migrations {
+			require.Equal(t, i+1, migration.Version)
+			require.NotEmpty(t, migration.Up)
+			require.NotEmpty(t, migration.Down)
+		}
+	}
+}
+
+func TestLoadMigrationsOrder(t *testing.T) {
+	migrationsDir := fstest.MapFS{
+		"m/0010_third.up.sql":   {Data: []byte("SELECT 10")},
+		"m/0002_second.up.sql":  {Data: []byte("SELECT 2")},
+		"m/0001_first.up.sql":   {Data: []byte("SELECT 1")},
+		"m/0001_first.down.sql": {Data: []byte("SELECT -1")},
+	}
+
+	migrations, err := loadMigrations(migrationsDir, "m")
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+
+	require.Equal(t, Migration{Version: 1, Name: "first", Up: "SELECT 1", Down: "SELECT -1"}, migrations[0])
+	require.Equal(t, 2, migrations[1].Version)
+	require.Equal(t, "third", migrations[2].Name)
+	require.Empty(t, migrations[2].Down)
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	for _, fileName := range []string{
+		"m/first.up.sql",
+		"m/0001_first.sql",
+		"m/abc_first.up.sql",
+	} {
+		_, err := loadMigrations(fstest.MapFS{fileName: {Data: []byte("SELECT 1")}}, "m")
+		require.ErrorIs(t, err, ErrMigrationFileName, fileName)
+	}
+
+	_, err := loadMigrations(fstest.MapFS{"m/0001_first.down.sql": {Data: []byte("SELECT 1")}}, "m")
+	require.Error(t, err)
+}
+
+func TestOpenMigrator_SQLite(t *testing.T) {
+	db, migrator, err := OpenMigrator(SQLiteDSNScheme + filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Состояние новой БД читается без создания schema_version
+	statusList, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statusList, 2)
+	require.False(t, statusList[0].Applied)
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_version'").Scan(&tables))
+	require.Zero(t, tables)
+
+	versions, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, versions)
+
+	statusList, err = migrator.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statusList, 2)
+	require.True(t, statusList[1].Applied)
+}
@@ -0,0 +1,2 @@
+CREATE TABLE IF NOT EXISTS counter (id serial, name VARCHAR (128) UNIQUE NOT NULL, value BIGINT NOT NULL);
+CREATE TABLE IF NOT EXISTS gauge (id serial, name VARCHAR (128) UNIQUE NOT NULL, value DOUBLE PRECISION NOT NULL);
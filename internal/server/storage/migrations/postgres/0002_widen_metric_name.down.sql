@@ -0,0 +1,2 @@
+ALTER TABLE gauge ALTER COLUMN name TYPE VARCHAR (128);
+ALTER TABLE counter ALTER COLUMN name TYPE VARCHAR (128);
@@ -0,0 +1,3 @@
+-- ID метрик с метками (name{label="value"}) длиннее 128 символов
+ALTER TABLE counter ALTER COLUMN name TYPE TEXT;
+ALTER TABLE gauge ALTER COLUMN name TYPE TEXT;
@@ -0,0 +1,9 @@
+-- Метрики арендаторов сохраняются с префиксом арендатора в имени (team-a::cpu)
+ALTER TABLE counter DROP CONSTRAINT counter_tenant_name_key;
+ALTER TABLE gauge DROP CONSTRAINT gauge_tenant_name_key;
+UPDATE counter SET name = tenant || '::' || name WHERE tenant <> '';
+UPDATE gauge SET name = tenant || '::' || name WHERE tenant <> '';
+ALTER TABLE counter ADD CONSTRAINT counter_name_key UNIQUE (name);
+ALTER TABLE gauge ADD CONSTRAINT gauge_name_key UNIQUE (name);
+ALTER TABLE counter DROP COLUMN tenant;
+ALTER TABLE gauge DROP COLUMN tenant;
@@ -0,0 +1,7 @@
+-- Метрики арендаторов: префикс арендатора ключа хранится отдельно, арендатор по умолчанию - пустая строка
+ALTER TABLE counter ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+ALTER TABLE gauge ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+ALTER TABLE counter DROP CONSTRAINT counter_name_key;
+ALTER TABLE gauge DROP CONSTRAINT gauge_name_key;
+ALTER TABLE counter ADD CONSTRAINT counter_tenant_name_key UNIQUE (tenant, name);
+ALTER TABLE gauge ADD CONSTRAINT gauge_tenant_name_key UNIQUE (tenant, name);
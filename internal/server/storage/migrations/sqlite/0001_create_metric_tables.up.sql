@@ -0,0 +1,2 @@
+CREATE TABLE IF NOT EXISTS counter (id INTEGER PRIMARY KEY, name VARCHAR (128) UNIQUE NOT NULL, value BIGINT NOT NULL);
+CREATE TABLE IF NOT EXISTS gauge (id INTEGER PRIMARY KEY, name VARCHAR (128) UNIQUE NOT NULL, value DOUBLE PRECISION NOT NULL);
@@ -0,0 +1,9 @@
+-- Метрики арендаторов сохраняются с префиксом арендатора в имени (team-a::cpu)
+ALTER TABLE counter RENAME TO counter_old;
+CREATE TABLE counter (id INTEGER PRIMARY KEY, name VARCHAR (128) UNIQUE NOT NULL, value BIGINT NOT NULL);
+INSERT INTO counter (id, name, value) SELECT id, CASE WHEN tenant <> '' THEN tenant || '::' || name ELSE name END, value FROM counter_old;
+DROP TABLE counter_old;
+ALTER TABLE gauge RENAME TO gauge_old;
+CREATE TABLE gauge (id INTEGER PRIMARY KEY, name VARCHAR (128) UNIQUE NOT NULL, value DOUBLE PRECISION NOT NULL);
+INSERT INTO gauge (id, name, value) SELECT id, CASE WHEN tenant <> '' THEN tenant || '::' || name ELSE name END, value FROM gauge_old;
+DROP TABLE gauge_old;
@@ -0,0 +1,10 @@
+-- Метрики арендаторов: префикс арендатора ключа хранится отдельно, арендатор по умолчанию - пустая строка.
+-- SQLite не позволяет изменить ограничение UNIQUE существующей таблицы, поэтому таблицы пересоздаются
+ALTER TABLE counter RENAME TO counter_old;
+CREATE TABLE counter (id INTEGER PRIMARY KEY, tenant TEXT NOT NULL DEFAULT '', name TEXT NOT NULL, value BIGINT NOT NULL, UNIQUE (tenant, name));
+INSERT INTO counter (id, name, value) SELECT id, name, value FROM counter_old;
+DROP TABLE counter_old;
+ALTER TABLE gauge RENAME TO gauge_old;
+CREATE TABLE gauge (id INTEGER PRIMARY KEY, tenant TEXT NOT NULL DEFAULT '', name TEXT NOT NULL, value DOUBLE PRECISION NOT NULL, UNIQUE (tenant, name));
+INSERT INTO gauge (id, name, value) SELECT id, name, value FROM gauge_old;
+DROP TABLE gauge_old;
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"devops-tpl/internal/logging"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// snapshotHeaderPrefix - первая строка файла снимка: префикс, SHA-256 содержимого после заголовка
+// и номер последней записи журнала, вошедшей в снимок ("sha256:<hex> wal-seq:<n>").
+const snapshotHeaderPrefix = "# devops-tpl snapshot v1 "
+
+var (
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+	ErrSnapshotNotFound = errors.New("no valid snapshot found")
+)
+
+// snapshotGenerationPath - путь до поколения снимка: 0 - актуальный файл, 1..N-1 - предыдущие (path.1, path.2, ...).
+func snapshotGenerationPath(path string, generation int) string {
+	if generation == 0 {
+		return path
+	}
+
+	return fmt.Sprintf("%s.%d", path, generation)
+}
+
+// writeSnapshot - атомарная запись снимка: временный файл в той же директории, fsync,
+// ротация предыдущих поколений и rename. При сбое на любом шаге на диске остается хотя бы одно целое поколение.
+func writeSnapshot(path string, generations int, walSeq uint64, value any) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(payload)
+
+	dir := filepath.Dir(path)
+	tempFile, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+
+	writer := bufio.NewWriter(tempFile)
+	_, err = fmt.Fprintf(writer, "%ssha256:%s wal-seq:%d\n", snapshotHeaderPrefix, hex.EncodeToString(checksum[:]), walSeq)
+	if err == nil {
+		_, err = writer.Write(payload)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = rotateSnapshots(path, generations)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// rotateSnapshots - сдвиг поколений path -> path.1 -> path.2 ..., самое старое удаляется.
+// Пустой актуальный файл (например, созданный O_CREATE) не ротируется.
+func rotateSnapshots(path string, generations int) error {
+	if generations <= 1 {
+		return nil
+	}
+
+	fileInfo, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && fileInfo.Size() == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for generation := generations - 1; generation > 0; generation-- {
+		err = os.Rename(snapshotGenerationPath(path, generation-1), snapshotGenerationPath(path, generation))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func syncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirFile.Close()
+
+	// Не все файловые системы поддерживают fsync директории
+	if err = dirFile.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+
+	return nil
+}
+
+// snapshotHeader - поля заголовка снимка.
+type snapshotHeader struct {
+	checksum string
+	walSeq   uint64
+}
+
+func parseSnapshotHeader(line string) (snapshotHeader, error) {
+	var header snapshotHeader
+	for _, field := range strings.Fields(strings.TrimPrefix(line, snapshotHeaderPrefix)) {
+		key, value, _ := strings.Cut(field, ":")
+		switch key {
+		case "sha256":
+			header.checksum = value
+		case "wal-seq":
+			walSeq, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return snapshotHeader{}, fmt.Errorf("invalid snapshot header: %w", err)
+			}
+			header.walSeq = walSeq
+		}
+	}
+
+	return header, nil
+}
+
+// readSnapshot - чтение самого нового целого поколения снимка.
+// Файлы без заголовка (формат до появления контрольной суммы) читаются как JSON без проверки.
+// Возвращает метрики, номер последней вошедшей в снимок записи журнала и путь до прочитанного поколения.
+func readSnapshot(path string, generations int) (map[string]MetricMap, uint64, string, error) {
+	if generations < 1 {
+		generations = 1
+	}
+
+	for generation := 0; generation < generations; generation++ {
+		generationPath := snapshotGenerationPath(path, generation)
+
+		var metricsDump map[string]MetricMap
+		walSeq, err := readSnapshotFile(generationPath, &metricsDump)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			slog.Warn("Snapshot is invalid", slog.String("snapshot", generationPath), logging.Err(err))
+			continue
+		}
+
+		return metricsDump, walSeq, generationPath, nil
+	}
+
+	return nil, 0, "", ErrSnapshotNotFound
+}
+
+// snapshotWALSeq - наибольший номер записи журнала среди заголовков всех поколений снимка.
+func snapshotWALSeq(path string, generations int) uint64 {
+	if generations < 1 {
+		generations = 1
+	}
+
+	var maxWALSeq uint64
+	for generation := 0; generation < generations; generation++ {
+		file, err := os.Open(snapshotGenerationPath(path, generation))
+		if err != nil {
+			continue
+		}
+		line, _ := bufio.NewReader(file).ReadString('\n')
+		file.Close()
+
+		if !strings.HasPrefix(line, snapshotHeaderPrefix) {
+			continue
+		}
+		header, err := parseSnapshotHeader(strings.TrimSuffix(line, "\n"))
+		if err == nil && header.walSeq > maxWALSeq {
+			maxWALSeq = header.walSeq
+		}
+	}
+
+	return maxWALSeq
+}
+
+func readSnapshotFile(path string, value any) (uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(content) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	var header snapshotHeader
+	payload := content
+	if bytes.HasPrefix(content, []byte(snapshotHeaderPrefix)) {
+		headerLine, body, found := bytes.Cut(content, []byte("\n"))
+		if !found {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		header, err = parseSnapshotHeader(string(headerLine))
+		if err != nil {
+			return 0, err
+		}
+		checksum := sha256.Sum256(body)
+		if hex.EncodeToString(checksum[:]) != header.checksum {
+			return 0, ErrSnapshotChecksum
+		}
+		payload = body
+	}
+
+	return header.walSeq, json.Unmarshal(payload, value)
+}
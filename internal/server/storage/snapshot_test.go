@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func snapshotWithCounter(delta int64) map[string]MetricMap {
+	return map[string]MetricMap{
+		metrics.MeticTypeCounter: {"PollCount": metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}},
+	}
+}
+
+func TestSnapshotRotationAndFallback(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "metrics.json")
+
+	for delta := int64(1); delta <= 4; delta++ {
+		require.NoError(t, writeSnapshot(snapshotPath, 3, 0, snapshotWithCounter(delta)))
+	}
+
+	// Хранятся 3 поколения: 4, 3, 2
+	_, err := os.Stat(snapshotGenerationPath(snapshotPath, 3))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	metricsDump, _, usedPath, err := readSnapshot(snapshotPath, 3)
+	require.NoError(t, err)
+	require.Equal(t, snapshotPath, usedPath)
+	require.EqualValues(t, 4, *metricsDump[metrics.MeticTypeCounter]["PollCount"].Delta)
+
+	// Повреждение актуального файла - восстановление из предыдущего поколения
+	content, err := os.ReadFile(snapshotPath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(snapshotPath, content[:len(content)-5], 0600))
+
+	metricsDump, _, usedPath, err = readSnapshot(snapshotPath, 3)
+	require.NoError(t, err)
+	require.Equal(t, snapshotGenerationPath(snapshotPath, 1), usedPath)
+	require.EqualValues(t, 3, *metricsDump[metrics.MeticTypeCounter]["PollCount"].Delta)
+
+	// Удаление всех поколений
+	for generation := 0; generation < 3; generation++ {
+		require.NoError(t, os.Remove(snapshotGenerationPath(snapshotPath, generation)))
+	}
+	_, _, _, err = readSnapshot(snapshotPath, 3)
+	require.ErrorIs(t, err, ErrSnapshotNotFound)
+}
+
+func TestSnapshotChecksum(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, writeSnapshot(snapshotPath, 1, 0, snapshotWithCounter(1)))
+
+	content, err := os.ReadFile(snapshotPath)
+	require.NoError(t, err)
+	content[len(content)-3] = '7'
+	require.NoError(t, os.WriteFile(snapshotPath, content, 0600))
+
+	var metricsDump map[string]MetricMap
+	_, err = readSnapshotFile(snapshotPath, &metricsDump)
+	require.ErrorIs(t, err, ErrSnapshotChecksum)
+}
+
+func TestSnapshotLegacyFormat(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(snapshotPath, []byte(`{"counter":{"PollCount":{"type":"counter","delta":5}}}`), 0600))
+
+	metricsRepo := NewMetricsMemoryRepo(config.StoreConfig{File: snapshotPath, Generations: 2})
+	metricsRepo.InitFromFile()
+
+	metricValue, err := metricsRepo.Read("PollCount", metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, *metricValue.Delta)
+
+	// Легаси файл становится предыдущим поколением
+	require.NoError(t, metricsRepo.Save())
+	_, err = os.Stat(snapshotGenerationPath(snapshotPath, 1))
+	require.NoError(t, err)
+
+	restoredRepo := NewMetricsMemoryRepo(config.StoreConfig{File: snapshotPath, Generations: 2})
+	restoredRepo.InitFromFile()
+	metricValue, err = restoredRepo.Read("PollCount", metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, *metricValue.Delta)
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"database/sql"
+	"devops-tpl/internal/server/config"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteDSNScheme - префикс DSN, по которому выбирается хранилище SQLite (example: sqlite:///var/lib/metrics.db).
+const SQLiteDSNScheme = "sqlite://"
+
+// SQLiteRepo - хранилище метрик во встроенной БД SQLite.
+//
+// Запросы DBRepo совместимы с SQLite (upsert с накоплением counter), поэтому переопределяется
+// только подключение, схема БД создается миграциями из migrations/sqlite.
+type SQLiteRepo struct {
+	DBRepo
+}
+
+// IsSQLiteDSN - проверка, что DSN указывает на SQLite.
+func IsSQLiteDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, SQLiteDSNScheme)
+}
+
+// sqliteDriverDSN - DSN драйвера из DSN конфигурации: путь до файла с ожиданием блокировки и журналом WAL.
+func sqliteDriverDSN(dsn string) string {
+	path := strings.TrimPrefix(dsn, SQLiteDSNScheme)
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	return "file:" + path + separator + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
+
+func NewSQLiteRepo(config config.StoreConfig) (SQLiteRepo, error) {
+	var repository SQLiteRepo
+	repository.config = config
+	repository.dialect = dialectSQLite
+
+	db, err := sql.Open("sqlite", sqliteDriverDSN(repository.config.DatabaseDSN))
+	if err != nil {
+		return SQLiteRepo{}, err
+	}
+	repository.db = db
+	repository.PrepareDB()
+	err = repository.InitTables()
+	if err != nil {
+		return SQLiteRepo{}, err
+	}
+
+	return repository, nil
+}
+
+// PrepareDB - SQLite допускает одного писателя, поэтому используется одно соединение без ограничения времени жизни
+// (иначе БД :memory: пропадает при переоткрытии соединения).
+func (repository SQLiteRepo) PrepareDB() {
+	repository.db.SetMaxOpenConns(1)
+	repository.db.SetMaxIdleConns(1)
+	repository.db.SetConnMaxIdleTime(0)
+	repository.db.SetConnMaxLifetime(0)
+}
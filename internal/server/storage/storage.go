@@ -1,21 +1,65 @@
 // Package storage - хранилища метрик.
 package storage
 
-const (
-	MeticTypeGauge   = "gauge"
-	MeticTypeCounter = "counter"
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"errors"
+	"sort"
+	"strings"
+	"time"
 )
 
-type MetricMap map[string]MetricValue
+var ErrMetricNotFound = errors.New("metric not found")
+
+type MetricMap map[string]metrics.MetricValue
 
 type MetricStorage interface {
 	InitFromFile()
 	Save() error
-	Update(key string, value MetricValue) error
-	UpdateManySliceMetric(MetricBatch []Metric) error
-	UpdateMany(DBSchema map[string]MetricValue) error
-	Read(key string, metricType string) (MetricValue, error)
+	Update(key string, value metrics.MetricValue) error
+	UpdateManySliceMetric(MetricBatch []metrics.Metric) error
+	UpdateMany(DBSchema map[string]metrics.MetricValue) error
+	Read(key string, metricType string) (metrics.MetricValue, error)
+	// Delete - удаление метрики, ErrMetricNotFound если метрики нет
+	Delete(key string, metricType string) error
 	ReadAll() map[string]MetricMap
 	Close() error
 	Ping() error
 }
+
+// Reconfigurable - хранилище, часть настроек которого меняется без перезапуска.
+type Reconfigurable interface {
+	// Reconfigure - применение настроек next вместо current, возвращает фактически действующие настройки:
+	// настройки, которые нельзя изменить без перезапуска, остаются из current.
+	Reconfigure(current config.StoreConfig, next config.StoreConfig) config.StoreConfig
+}
+
+// SnapshotObservable - хранилище со снимками в файле, сообщающее о записи снимков.
+type SnapshotObservable interface {
+	// ObserveSnapshots - observer вызывается после каждой записи снимка с ее длительностью и ошибкой.
+	ObserveSnapshots(observer func(duration time.Duration, err error))
+}
+
+// SortedMetrics - метрики с ID, содержащим search (пустая строка - все), упорядоченные по типу и ID.
+func SortedMetrics(allMetrics map[string]MetricMap, search string) []metrics.Metric {
+	var batch []metrics.Metric
+	for metricType, metricMap := range allMetrics {
+		for metricID, metricValue := range metricMap {
+			if !strings.Contains(metricID, search) {
+				continue
+			}
+			metricValue.MType = metricType
+			batch = append(batch, metrics.Metric{ID: metricID, MetricValue: metricValue})
+		}
+	}
+
+	sort.Slice(batch, func(i, j int) bool {
+		if batch[i].MType != batch[j].MType {
+			return batch[i].MType < batch[j].MType
+		}
+		return batch[i].ID < batch[j].ID
+	})
+
+	return batch
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/tenant"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("tenant quota exceeded")
+	ErrTenantPrefix  = errors.New("metric id must not start with a tenant prefix")
+)
+
+// tenantMetric - метрика в учете квот.
+type tenantMetric struct {
+	mType string
+	key   string
+}
+
+// Tenants - разделение хранилища между арендаторами: хранилища арендаторов (For) над общим хранилищем
+// и квота на количество метрик арендатора.
+//
+// Метрики арендатора с квотой загружаются из хранилища при первой записи и далее учитываются по записям
+// и удалениям через хранилища арендаторов. Записи других экземпляров сервера над той же БД не учитываются.
+type Tenants struct {
+	storage MetricStorage
+	// maxMetrics - квота арендатора, 0 - без ограничения; читается при каждой записи и меняется без перезапуска
+	maxMetrics func(tenantName string) int
+
+	mutex   *sync.Mutex
+	metrics map[string]map[tenantMetric]struct{}
+}
+
+func NewTenants(storage MetricStorage, maxMetrics func(tenantName string) int) *Tenants {
+	return &Tenants{
+		storage:    storage,
+		maxMetrics: maxMetrics,
+		mutex:      &sync.Mutex{},
+		metrics:    map[string]map[tenantMetric]struct{}{},
+	}
+}
+
+// For - хранилище арендатора tenantName, tenant.All - хранилище всех арендаторов с полными ключами.
+func (tenants *Tenants) For(tenantName string) MetricStorage {
+	return TenantRepo{
+		MetricStorage: tenants.storage,
+		tenants:       tenants,
+		tenant:        tenantName,
+	}
+}
+
+// Count - количество метрик арендатора в учете квот, false - метрики арендатора не учитываются.
+func (tenants *Tenants) Count(tenantName string) (int, bool) {
+	tenants.mutex.Lock()
+	defer tenants.mutex.Unlock()
+
+	metrics, ok := tenants.metrics[tenantName]
+	return len(metrics), ok
+}
+
+// tenantMetrics - учтенные метрики арендатора, при первом обращении загружаются из хранилища.
+func (tenants *Tenants) tenantMetrics(tenantName string) map[tenantMetric]struct{} {
+	metrics, ok := tenants.metrics[tenantName]
+	if ok {
+		return metrics
+	}
+
+	metrics = map[tenantMetric]struct{}{}
+	for metricType, metricMap := range tenants.storage.ReadAll() {
+		for key := range metricMap {
+			if keyTenant, _ := tenant.SplitKey(key); keyTenant == tenantName {
+				metrics[tenantMetric{mType: metricType, key: key}] = struct{}{}
+			}
+		}
+	}
+	tenants.metrics[tenantName] = metrics
+
+	return metrics
+}
+
+// reserve - учет новых метрик пакета с полными ключами. Если пакет превышает квоту арендатора,
+// пакет отклоняется целиком с ErrQuotaExceeded. Возвращает учтенные метрики, которые нужно вернуть
+// (release), если запись не удалась.
+func (tenants *Tenants) reserve(batch []metrics.Metric) ([]tenantMetric, error) {
+	byTenant := map[string][]tenantMetric{}
+	for _, metric := range batch {
+		metricTenant, _ := tenant.SplitKey(metric.ID)
+		byTenant[metricTenant] = append(byTenant[metricTenant], tenantMetric{mType: metric.MType, key: metric.ID})
+	}
+
+	tenants.mutex.Lock()
+	defer tenants.mutex.Unlock()
+
+	var reserved []tenantMetric
+	for tenantName, batchMetrics := range byTenant {
+		maxMetrics := tenants.maxMetrics(tenantName)
+		if _, tracked := tenants.metrics[tenantName]; maxMetrics <= 0 && !tracked {
+			continue
+		}
+
+		metrics := tenants.tenantMetrics(tenantName)
+		newMetrics := map[tenantMetric]struct{}{}
+		for _, metric := range batchMetrics {
+			if _, ok := metrics[metric]; !ok {
+				newMetrics[metric] = struct{}{}
+			}
+		}
+
+		if maxMetrics > 0 && len(newMetrics) != 0 && len(metrics)+len(newMetrics) > maxMetrics {
+			tenants.remove(reserved)
+			return nil, fmt.Errorf("%w: tenant %q is limited to %d metrics, stored %d, new in request %d",
+				ErrQuotaExceeded, tenantName, maxMetrics, len(metrics), len(newMetrics))
+		}
+		for metric := range newMetrics {
+			metrics[metric] = struct{}{}
+			reserved = append(reserved, metric)
+		}
+	}
+
+	return reserved, nil
+}
+
+// release - удаление метрик из учета (метрика удалена или не записана).
+func (tenants *Tenants) release(released ...tenantMetric) {
+	tenants.mutex.Lock()
+	defer tenants.mutex.Unlock()
+
+	tenants.remove(released)
+}
+
+func (tenants *Tenants) remove(removed []tenantMetric) {
+	for _, metric := range removed {
+		tenantName, _ := tenant.SplitKey(metric.key)
+		if metrics, ok := tenants.metrics[tenantName]; ok {
+			delete(metrics, metric)
+		}
+	}
+}
+
+// TenantRepo - хранилище одного арендатора над общим: ID метрик дополняются префиксом арендатора,
+// ReadAll возвращает только метрики арендатора без префикса.
+type TenantRepo struct {
+	MetricStorage
+	tenants *Tenants
+	tenant  string
+}
+
+// Tenant - имя арендатора хранилища.
+func (repository TenantRepo) Tenant() string {
+	return repository.tenant
+}
+
+// key - ключ общего хранилища для ID метрики арендатора.
+func (repository TenantRepo) key(metricID string) (string, error) {
+	if repository.tenant == tenant.All {
+		return metricID, nil
+	}
+
+	// ID с префиксом другого арендатора записал бы метрику в чужое пространство
+	if metricTenant, _ := tenant.SplitKey(metricID); metricTenant != "" {
+		return "", fmt.Errorf("%w: %q", ErrTenantPrefix, metricID)
+	}
+
+	return tenant.Key(repository.tenant, metricID), nil
+}
+
+func (repository TenantRepo) Update(key string, value metrics.MetricValue) error {
+	tenantKey, err := repository.key(key)
+	if err != nil {
+		return err
+	}
+
+	reserved, err := repository.tenants.reserve([]metrics.Metric{{ID: tenantKey, MetricValue: value}})
+	if err != nil {
+		return err
+	}
+
+	err = repository.MetricStorage.Update(tenantKey, value)
+	if err != nil {
+		repository.tenants.release(reserved...)
+		return err
+	}
+
+	return nil
+}
+
+func (repository TenantRepo) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	tenantBatch := make([]metrics.Metric, 0, len(MetricBatch))
+	for _, metric := range MetricBatch {
+		tenantKey, err := repository.key(metric.ID)
+		if err != nil {
+			return err
+		}
+		metric.ID = tenantKey
+		tenantBatch = append(tenantBatch, metric)
+	}
+
+	reserved, err := repository.tenants.reserve(tenantBatch)
+	if err != nil {
+		return err
+	}
+
+	err = repository.MetricStorage.UpdateManySliceMetric(tenantBatch)
+	if err != nil {
+		repository.tenants.release(reserved...)
+		return err
+	}
+
+	return nil
+}
+
+func (repository TenantRepo) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
+	MetricBatch := make([]metrics.Metric, 0, len(DBSchema))
+	for metricID, metricValue := range DBSchema {
+		MetricBatch = append(MetricBatch, metrics.Metric{ID: metricID, MetricValue: metricValue})
+	}
+
+	return repository.UpdateManySliceMetric(MetricBatch)
+}
+
+func (repository TenantRepo) Read(key string, metricType string) (metrics.MetricValue, error) {
+	tenantKey, err := repository.key(key)
+	if err != nil {
+		return metrics.MetricValue{}, err
+	}
+
+	return repository.MetricStorage.Read(tenantKey, metricType)
+}
+
+func (repository TenantRepo) Delete(key string, metricType string) error {
+	tenantKey, err := repository.key(key)
+	if err != nil {
+		return err
+	}
+
+	err = repository.MetricStorage.Delete(tenantKey, metricType)
+	if err != nil {
+		return err
+	}
+	repository.tenants.release(tenantMetric{mType: metricType, key: tenantKey})
+
+	return nil
+}
+
+func (repository TenantRepo) ReadAll() map[string]MetricMap {
+	allMetrics := repository.MetricStorage.ReadAll()
+	if repository.tenant == tenant.All {
+		return allMetrics
+	}
+
+	tenantMetrics := make(map[string]MetricMap, len(allMetrics))
+	for metricType, metricMap := range allMetrics {
+		tenantMap := MetricMap{}
+		for key, metricValue := range metricMap {
+			if metricTenant, metricID := tenant.SplitKey(key); metricTenant == repository.tenant {
+				tenantMap[metricID] = metricValue
+			}
+		}
+		tenantMetrics[metricType] = tenantMap
+	}
+
+	return tenantMetrics
+}
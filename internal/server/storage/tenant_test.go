@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/tenant"
+
+	"github.com/stretchr/testify/require"
+)
+
+func gaugeMetric(id string, value float64) metrics.Metric {
+	return metrics.Metric{ID: id, MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}}
+}
+
+func TestTenants_Isolation(t *testing.T) {
+	tenants := NewTenants(NewMetricsMemoryRepo(config.StoreConfig{}), func(string) int { return 0 })
+	teamA := tenants.For("team-a")
+	teamB := tenants.For("team-b")
+	defaultTenant := tenants.For("")
+
+	require.NoError(t, teamA.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("cpu", 1)}))
+	require.NoError(t, teamB.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("cpu", 2)}))
+	require.NoError(t, defaultTenant.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("cpu", 3)}))
+
+	metricValue, err := teamA.Read("cpu", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, *metricValue.Value)
+
+	require.Equal(t, []string{"cpu"}, metricIDs(teamB.ReadAll()[metrics.MeticTypeGauge]))
+	require.EqualValues(t, 2, *teamB.ReadAll()[metrics.MeticTypeGauge]["cpu"].Value)
+	require.Equal(t, []string{"cpu"}, metricIDs(defaultTenant.ReadAll()[metrics.MeticTypeGauge]))
+
+	// Все арендаторы с полными ключами
+	require.ElementsMatch(t, []string{"cpu", "team-a::cpu", "team-b::cpu"},
+		metricIDs(tenants.For(tenant.All).ReadAll()[metrics.MeticTypeGauge]))
+
+	// Префикс арендатора в ID отклоняется
+	err = teamA.Update("team-b::cpu", gaugeMetric("", 4).MetricValue)
+	require.ErrorIs(t, err, ErrTenantPrefix)
+	_, err = defaultTenant.Read("team-a::cpu", metrics.MeticTypeGauge)
+	require.ErrorIs(t, err, ErrTenantPrefix)
+
+	require.NoError(t, teamA.Delete("cpu", metrics.MeticTypeGauge))
+	_, err = teamA.Read("cpu", metrics.MeticTypeGauge)
+	require.Error(t, err)
+	_, err = teamB.Read("cpu", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+}
+
+func TestTenants_Quota(t *testing.T) {
+	backend := NewMetricsMemoryRepo(config.StoreConfig{})
+	require.NoError(t, backend.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("team-a::stored", 1)}))
+
+	quotas := map[string]int{"team-a": 3}
+	tenants := NewTenants(backend, func(tenantName string) int { return quotas[tenantName] })
+	teamA := tenants.For("team-a")
+
+	// Пакет сверх квоты отклоняется целиком
+	err := teamA.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("a", 1), gaugeMetric("b", 1), gaugeMetric("c", 1)})
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	require.Len(t, teamA.ReadAll()[metrics.MeticTypeGauge], 1)
+
+	require.NoError(t, teamA.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("a", 1), gaugeMetric("b", 1), gaugeMetric("a", 2)}))
+	count, tracked := tenants.Count("team-a")
+	require.True(t, tracked)
+	require.Equal(t, 3, count)
+
+	// Существующие метрики обновляются и при заполненной квоте
+	require.NoError(t, teamA.Update("b", gaugeMetric("", 5).MetricValue))
+	require.ErrorIs(t, teamA.Update("c", gaugeMetric("", 1).MetricValue), ErrQuotaExceeded)
+
+	require.NoError(t, teamA.Delete("a", metrics.MeticTypeGauge))
+	require.NoError(t, teamA.Update("c", gaugeMetric("", 1).MetricValue))
+
+	// Другие арендаторы без квоты не учитываются
+	require.NoError(t, tenants.For("team-b").UpdateManySliceMetric([]metrics.Metric{gaugeMetric("a", 1), gaugeMetric("b", 1),
+		gaugeMetric("c", 1), gaugeMetric("d", 1)}))
+	_, tracked = tenants.Count("team-b")
+	require.False(t, tracked)
+
+	// Квота меняется без перезапуска
+	quotas["team-a"] = 4
+	require.NoError(t, teamA.Update("d", gaugeMetric("", 1).MetricValue))
+}
+
+// failingStorage - хранилище, отклоняющее запись, пока установлен fail.
+type failingStorage struct {
+	MetricStorage
+	fail *atomic.Bool
+}
+
+func (storage failingStorage) Update(key string, value metrics.MetricValue) error {
+	if storage.fail.Load() {
+		return errors.New("storage is down")
+	}
+	return storage.MetricStorage.Update(key, value)
+}
+
+func (storage failingStorage) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	if storage.fail.Load() {
+		return errors.New("storage is down")
+	}
+	return storage.MetricStorage.UpdateManySliceMetric(MetricBatch)
+}
+
+func TestTenants_ReleaseOnFailedWrite(t *testing.T) {
+	backend := failingStorage{MetricStorage: NewMetricsMemoryRepo(config.StoreConfig{}), fail: &atomic.Bool{}}
+	tenants := NewTenants(backend, func(string) int { return 2 })
+	teamA := tenants.For("team-a")
+
+	// Незаписанные метрики не занимают квоту
+	backend.fail.Store(true)
+	require.Error(t, teamA.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("a", 1), gaugeMetric("b", 1)}))
+	require.Error(t, teamA.Update("c", gaugeMetric("", 1).MetricValue))
+	count, tracked := tenants.Count("team-a")
+	require.True(t, tracked)
+	require.Zero(t, count)
+
+	backend.fail.Store(false)
+	require.NoError(t, teamA.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("c", 1), gaugeMetric("d", 1)}))
+	count, _ = tenants.Count("team-a")
+	require.Equal(t, 2, count)
+}
+
+func TestSQLiteRepo_Tenants(t *testing.T) {
+	metricsRepo, err := NewSQLiteRepo(config.StoreConfig{DatabaseDSN: SQLiteDSNScheme + ":memory:"})
+	require.NoError(t, err)
+	defer metricsRepo.Close()
+
+	tenants := NewTenants(metricsRepo, func(string) int { return 0 })
+	var delta int64 = 2
+	counter := metrics.Metric{ID: "requests", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}}
+	require.NoError(t, tenants.For("team-a").UpdateManySliceMetric([]metrics.Metric{counter, gaugeMetric("cpu", 1)}))
+	require.NoError(t, tenants.For("").UpdateManySliceMetric([]metrics.Metric{counter, counter}))
+	require.NoError(t, tenants.For("team-a").Update("requests", counter.MetricValue))
+
+	metricValue, err := tenants.For("team-a").Read("requests", metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, *metricValue.Delta)
+
+	metricValue, err = metricsRepo.Read("requests", metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, *metricValue.Delta)
+
+	require.ElementsMatch(t, []string{"requests", "team-a::requests"}, metricIDs(metricsRepo.ReadAll()[metrics.MeticTypeCounter]))
+	require.Equal(t, []string{"cpu"}, metricIDs(tenants.For("team-a").ReadAll()[metrics.MeticTypeGauge]))
+}
+
+func TestSQLiteRepo_LegacyTables(t *testing.T) {
+	dsn := SQLiteDSNScheme + filepath.Join(t.TempDir(), "metrics.db")
+	db, err := sql.Open("sqlite", sqliteDriverDSN(dsn))
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE gauge (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE, value DOUBLE PRECISION NOT NULL)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO gauge (name, value) VALUES ('cpu', 1.5)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	metricsRepo, err := NewSQLiteRepo(config.StoreConfig{DatabaseDSN: dsn})
+	require.NoError(t, err)
+	defer metricsRepo.Close()
+
+	metricValue, err := metricsRepo.Read("cpu", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 1.5, *metricValue.Value)
+
+	require.NoError(t, metricsRepo.Update("team-a::cpu", gaugeMetric("", 2).MetricValue))
+	require.Len(t, metricsRepo.ReadAll()[metrics.MeticTypeGauge], 2)
+}
+
+func TestSQLiteRepo_TenantMigrationDown(t *testing.T) {
+	metricsRepo, err := NewSQLiteRepo(config.StoreConfig{DatabaseDSN: SQLiteDSNScheme + filepath.Join(t.TempDir(), "metrics.db")})
+	require.NoError(t, err)
+	defer metricsRepo.Close()
+	require.NoError(t, metricsRepo.UpdateManySliceMetric([]metrics.Metric{gaugeMetric("cpu", 1), gaugeMetric("team-a::cpu", 2)}))
+
+	// Откат миграции арендаторов сохраняет арендатора префиксом в имени
+	migrator, err := newMigrator(metricsRepo.db, dialectSQLite)
+	require.NoError(t, err)
+	reverted, err := migrator.Down(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, []int{2}, reverted)
+
+	rows, err := metricsRepo.db.Query("SELECT name FROM gauge ORDER BY name")
+	require.NoError(t, err)
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		names = append(names, name)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, []string{"cpu", "team-a::cpu"}, names)
+}
+
+func metricIDs(metricMap MetricMap) []string {
+	ids := make([]string, 0, len(metricMap))
+	for id := range metricMap {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
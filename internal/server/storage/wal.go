@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"devops-tpl/internal/metrics"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// walCompactSize - размер журнала, после которого выполняется внеочередная выгрузка снимка с очисткой журнала.
+const walCompactSize int64 = 16 << 20
+
+var ErrWALRecordCorrupted = errors.New("wal record is corrupted")
+
+// walRecord - запись журнала: исходное обновление (для counter - приращение) или удаление с порядковым номером.
+type walRecord struct {
+	Seq     uint64 `json:"seq"`
+	Deleted bool   `json:"deleted,omitempty"`
+	metrics.Metric
+}
+
+// writeAheadLog - журнал обновлений, дописываемый перед применением обновления в памяти.
+//
+// Каждая запись - строка "<crc32> <json>\n". Номер последней записи, вошедшей в снимок,
+// сохраняется в заголовке снимка, поэтому при восстановлении применяются только более новые записи.
+type writeAheadLog struct {
+	mutex *sync.Mutex
+	file  *os.File
+	fsync bool
+	seq   uint64
+	size  int64
+}
+
+// walPath - путь до журнала рядом с файлом выгрузки.
+func walPath(snapshotPath string) string {
+	return snapshotPath + ".wal"
+}
+
+// openWAL - открытие журнала на дозапись. Недописанный хвост (сбой во время записи) отрезается.
+func openWAL(path string, fsync bool) (*writeAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	records, validSize, err := readWALRecords(file)
+	if err != nil && !errors.Is(err, ErrWALRecordCorrupted) {
+		file.Close()
+		return nil, err
+	}
+
+	err = file.Truncate(validSize)
+	if err == nil {
+		_, err = file.Seek(validSize, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	wal := &writeAheadLog{
+		mutex: &sync.Mutex{},
+		file:  file,
+		fsync: fsync,
+		size:  validSize,
+	}
+	if len(records) != 0 {
+		wal.seq = records[len(records)-1].Seq
+	}
+
+	return wal, nil
+}
+
+// readWAL - чтение целых записей журнала. Отсутствующий журнал считается пустым.
+func readWAL(path string) ([]walRecord, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, _, err := readWALRecords(file)
+	if errors.Is(err, ErrWALRecordCorrupted) {
+		return records, nil
+	}
+
+	return records, err
+}
+
+// readWALRecords - чтение записей до первой поврежденной.
+// Возвращает записи и размер целой части журнала.
+func readWALRecords(reader io.Reader) ([]walRecord, int64, error) {
+	var records []walRecord
+	var validSize int64
+
+	bufReader := bufio.NewReader(reader)
+	for {
+		line, err := bufReader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) != 0 {
+				return records, validSize, ErrWALRecordCorrupted
+			}
+			return records, validSize, nil
+		}
+		if err != nil {
+			return records, validSize, err
+		}
+
+		record, err := decodeWALRecord(line)
+		if err != nil {
+			return records, validSize, err
+		}
+
+		records = append(records, record)
+		validSize += int64(len(line))
+	}
+}
+
+func encodeWALRecord(record walRecord) ([]byte, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)), nil
+}
+
+func decodeWALRecord(line []byte) (walRecord, error) {
+	rawChecksum, payload, found := bytes.Cut(bytes.TrimSuffix(line, []byte("\n")), []byte(" "))
+	if !found {
+		return walRecord{}, ErrWALRecordCorrupted
+	}
+
+	if fmt.Sprintf("%08x", crc32.ChecksumIEEE(payload)) != string(rawChecksum) {
+		return walRecord{}, ErrWALRecordCorrupted
+	}
+
+	var record walRecord
+	err := json.Unmarshal(payload, &record)
+	if err != nil {
+		return walRecord{}, ErrWALRecordCorrupted
+	}
+
+	return record, nil
+}
+
+// Append - дозапись обновления.
+func (wal *writeAheadLog) Append(metric metrics.Metric) error {
+	return wal.append(walRecord{Metric: metric})
+}
+
+// AppendDelete - дозапись удаления метрики.
+func (wal *writeAheadLog) AppendDelete(key string, metricType string) error {
+	return wal.append(walRecord{
+		Deleted: true,
+		Metric:  metrics.Metric{ID: key, MetricValue: metrics.MetricValue{MType: metricType}},
+	})
+}
+
+// append - дозапись одной операцией записи, при fsync - со сбросом на диск.
+func (wal *writeAheadLog) append(walRecord walRecord) error {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+
+	walRecord.Seq = wal.seq + 1
+	record, err := encodeWALRecord(walRecord)
+	if err != nil {
+		return err
+	}
+
+	_, err = wal.file.Write(record)
+	if err != nil {
+		return err
+	}
+	if wal.fsync {
+		err = wal.file.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	wal.seq++
+	wal.size += int64(len(record))
+
+	return nil
+}
+
+// Seq - номер последней записанной записи.
+func (wal *writeAheadLog) Seq() uint64 {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	return wal.seq
+}
+
+// SetSeq - продолжение нумерации не ниже seq (например, номера из заголовка снимка при пустом журнале).
+func (wal *writeAheadLog) SetSeq(seq uint64) {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	if seq > wal.seq {
+		wal.seq = seq
+	}
+}
+
+// Size - текущий размер журнала в байтах.
+func (wal *writeAheadLog) Size() int64 {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	return wal.size
+}
+
+// Reset - очистка журнала после записи снимка. Нумерация записей продолжается.
+func (wal *writeAheadLog) Reset() error {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+
+	err := wal.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = wal.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	wal.size = 0
+
+	return wal.file.Sync()
+}
+
+func (wal *writeAheadLog) Close() error {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	return wal.file.Close()
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func walStoreConfig(t *testing.T) config.StoreConfig {
+	return config.StoreConfig{
+		File:        filepath.Join(t.TempDir(), "metrics.json"),
+		Generations: 2,
+		WAL:         true,
+	}
+}
+
+func updateTestMetrics(t *testing.T, repository MetricsMemoryRepo, delta int64, value float64) {
+	require.NoError(t, repository.Update("PollCount", metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}))
+	require.NoError(t, repository.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}))
+}
+
+func requireTestMetrics(t *testing.T, repository MetricsMemoryRepo, delta int64, value float64) {
+	counterValue, err := repository.Read("PollCount", metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, delta, *counterValue.Delta)
+
+	gaugeValue, err := repository.Read("Alloc", metrics.MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, value, *gaugeValue.Value)
+}
+
+func TestWALRecoveryWithoutSnapshot(t *testing.T) {
+	storeConfig := walStoreConfig(t)
+
+	repository := NewMetricsMemoryRepo(storeConfig)
+	updateTestMetrics(t, repository, 5, 1.5)
+	updateTestMetrics(t, repository, 7, 2.5)
+	// Сбой: без выгрузки снимка
+	require.NoError(t, repository.Close())
+
+	_, err := os.Stat(storeConfig.File)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	restored := NewMetricsMemoryRepo(storeConfig)
+	defer restored.Close()
+	restored.InitFromFile()
+	requireTestMetrics(t, restored, 12, 2.5)
+}
+
+func TestWALCompaction(t *testing.T) {
+	storeConfig := walStoreConfig(t)
+
+	repository := NewMetricsMemoryRepo(storeConfig)
+	updateTestMetrics(t, repository, 5, 1.5)
+	require.NoError(t, repository.Save())
+
+	walInfo, err := os.Stat(walPath(storeConfig.File))
+	require.NoError(t, err)
+	require.Zero(t, walInfo.Size())
+
+	updateTestMetrics(t, repository, 3, 4.5)
+	require.NoError(t, repository.Close())
+
+	// Снимок и записи журнала после него, без повторного применения вошедших в снимок
+	restored := NewMetricsMemoryRepo(storeConfig)
+	restored.InitFromFile()
+	requireTestMetrics(t, restored, 8, 4.5)
+
+	updateTestMetrics(t, restored, 1, 5.5)
+	require.NoError(t, restored.Close())
+
+	restoredAgain := NewMetricsMemoryRepo(storeConfig)
+	defer restoredAgain.Close()
+	restoredAgain.InitFromFile()
+	requireTestMetrics(t, restoredAgain, 9, 5.5)
+}
+
+func TestWALSkipsRecordsInSnapshot(t *testing.T) {
+	storeConfig := walStoreConfig(t)
+
+	repository := NewMetricsMemoryRepo(storeConfig)
+	updateTestMetrics(t, repository, 5, 1.5)
+
+	// Сбой между записью снимка и очисткой журнала: записи уже есть в снимке
+	require.NoError(t, writeSnapshot(storeConfig.File, storeConfig.Generations, repository.wal.Seq(), repository.ReadAll()))
+	updateTestMetrics(t, repository, 2, 3.5)
+	require.NoError(t, repository.Close())
+
+	restored := NewMetricsMemoryRepo(storeConfig)
+	defer restored.Close()
+	restored.InitFromFile()
+	requireTestMetrics(t, restored, 7, 3.5)
+}
+
+func TestWALTornRecord(t *testing.T) {
+	storeConfig := walStoreConfig(t)
+
+	repository := NewMetricsMemoryRepo(storeConfig)
+	updateTestMetrics(t, repository, 5, 1.5)
+	require.NoError(t, repository.Close())
+
+	// Недописанная запись в конце журнала
+	walFile, err := os.OpenFile(walPath(storeConfig.File), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = walFile.WriteString(`0badc0de {"seq":3,"id":"PollCount","type":"coun`)
+	require.NoError(t, err)
+	require.NoError(t, walFile.Close())
+
+	records, err := readWAL(walPath(storeConfig.File))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	restored := NewMetricsMemoryRepo(storeConfig)
+	defer restored.Close()
+	restored.InitFromFile()
+	requireTestMetrics(t, restored, 5, 1.5)
+
+	// Поврежденный хвост отрезан при открытии, новые записи дописываются после целых
+	updateTestMetrics(t, restored, 1, 2.5)
+	records, err = readWAL(walPath(storeConfig.File))
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	require.EqualValues(t, 4, records[3].Seq)
+}
+
+func TestWALRecordChecksum(t *testing.T) {
+	var delta int64 = 1
+	line, err := encodeWALRecord(walRecord{Seq: 1, Metric: metrics.Metric{ID: "PollCount", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}}})
+	require.NoError(t, err)
+
+	record, err := decodeWALRecord(line)
+	require.NoError(t, err)
+	require.Equal(t, "PollCount", record.ID)
+
+	line[len(line)-3] = '7'
+	_, err = decodeWALRecord(line)
+	require.ErrorIs(t, err, ErrWALRecordCorrupted)
+}
+
+func TestWALDeleteReplay(t *testing.T) {
+	storeConfig := walStoreConfig(t)
+
+	repository := NewMetricsMemoryRepo(storeConfig)
+	updateTestMetrics(t, repository, 5, 1.5)
+	require.NoError(t, repository.Save())
+
+	require.NoError(t, repository.Delete("PollCount", metrics.MeticTypeCounter))
+	require.ErrorIs(t, repository.Delete("PollCount", metrics.MeticTypeCounter), ErrMetricNotFound)
+	// Метрика с тем же ID после удаления считается заново
+	var delta int64 = 2
+	require.NoError(t, repository.Update("PollCount", metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}))
+	require.NoError(t, repository.Delete("Alloc", metrics.MeticTypeGauge))
+	require.NoError(t, repository.Close())
+
+	restored := NewMetricsMemoryRepo(storeConfig)
+	defer restored.Close()
+	restored.InitFromFile()
+
+	counterValue, err := restored.Read("PollCount", metrics.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, *counterValue.Delta)
+	_, err = restored.Read("Alloc", metrics.MeticTypeGauge)
+	require.Error(t, err)
+}
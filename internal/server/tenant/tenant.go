@@ -0,0 +1,104 @@
+// Package tenant - арендаторы (tenant) сервера: команды, разделяющие один сервер без доступа к метрикам друг друга.
+//
+// Метрики арендатора хранятся в общем хранилище с префиксом арендатора в ключе (team-a::cpu),
+// метрики арендатора по умолчанию (пустое имя) - без префикса, как и до появления арендаторов.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// Separator - разделитель имени арендатора и ID метрики в ключе хранилища.
+	Separator = "::"
+	// All - выбор всех арендаторов (запросы администратора): ключи хранилища передаются как есть.
+	All = "*"
+	// maxNameLength - ограничение длины имени арендатора.
+	maxNameLength = 64
+)
+
+// IsValid - проверка имени арендатора: латинские буквы, цифры, "-" и "_", не длиннее 64 символов.
+func IsValid(name string) bool {
+	if name == "" || len(name) > maxNameLength {
+		return false
+	}
+
+	for _, symbol := range name {
+		isLetter := (symbol >= 'a' && symbol <= 'z') || (symbol >= 'A' && symbol <= 'Z')
+		isDigit := symbol >= '0' && symbol <= '9'
+		if !isLetter && !isDigit && symbol != '-' && symbol != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Key - ключ хранилища метрики metricID арендатора tenant.
+func Key(tenant string, metricID string) string {
+	if tenant == "" {
+		return metricID
+	}
+
+	return tenant + Separator + metricID
+}
+
+// SplitKey - разбор ключа хранилища на имя арендатора и ID метрики. Ключ без префикса с допустимым
+// именем арендатора относится к арендатору по умолчанию.
+func SplitKey(key string) (string, string) {
+	tenant, metricID, found := strings.Cut(key, Separator)
+	if !found || !IsValid(tenant) {
+		return "", key
+	}
+
+	return tenant, metricID
+}
+
+type contextKey struct{}
+
+// WithTenant - контекст запроса арендатора tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext - арендатор запроса, арендатор по умолчанию, если не задан.
+func FromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(contextKey{}).(string)
+	return tenant
+}
+
+// Quota - квота арендатора.
+type Quota struct {
+	// MaxMetrics - наибольшее количество метрик арендатора, 0 - без ограничения
+	MaxMetrics int `json:"max_metrics"`
+}
+
+// LoadQuotas - квоты арендаторов из JSON файла: объект {"team-a": {"max_metrics": 1000}},
+// ключ "" - арендатор по умолчанию.
+func LoadQuotas(path string) (map[string]Quota, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var quotas map[string]Quota
+	err = json.Unmarshal(data, &quotas)
+	if err != nil {
+		return nil, fmt.Errorf("quotas file %s: %w", path, err)
+	}
+
+	for name, quota := range quotas {
+		if name != "" && !IsValid(name) {
+			return nil, fmt.Errorf("quotas file %s: invalid tenant name %q", path, name)
+		}
+		if quota.MaxMetrics < 0 {
+			return nil, fmt.Errorf("quotas file %s: tenant %q: max_metrics must not be negative", path, name)
+		}
+	}
+
+	return quotas, nil
+}
@@ -0,0 +1,64 @@
+package tenant
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	require.Equal(t, "cpu", Key("", "cpu"))
+	require.Equal(t, "team-a::cpu", Key("team-a", "cpu"))
+
+	tests := []struct {
+		key      string
+		tenant   string
+		metricID string
+	}{
+		{key: "cpu", tenant: "", metricID: "cpu"},
+		{key: "team-a::cpu", tenant: "team-a", metricID: "cpu"},
+		{key: "team_b::up{job=\"a::b\"}", tenant: "team_b", metricID: "up{job=\"a::b\"}"},
+		// Префикс с недопустимым именем арендатора - часть ID метрики
+		{key: `up{job="a::b"}`, tenant: "", metricID: `up{job="a::b"}`},
+		{key: "::cpu", tenant: "", metricID: "::cpu"},
+	}
+	for _, tt := range tests {
+		tenant, metricID := SplitKey(tt.key)
+		require.Equal(t, tt.tenant, tenant, tt.key)
+		require.Equal(t, tt.metricID, metricID, tt.key)
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	require.True(t, IsValid("team-a"))
+	require.True(t, IsValid("Team_42"))
+	require.False(t, IsValid(""))
+	require.False(t, IsValid(All))
+	require.False(t, IsValid("team.a"))
+	require.False(t, IsValid(string(make([]byte, maxNameLength+1))))
+}
+
+func TestContext(t *testing.T) {
+	require.Equal(t, "", FromContext(context.Background()))
+	require.Equal(t, "team-a", FromContext(WithTenant(context.Background(), "team-a")))
+}
+
+func TestLoadQuotas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"team-a": {"max_metrics": 10}, "": {"max_metrics": 100}}`), 0600))
+
+	quotas, err := LoadQuotas(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]Quota{"team-a": {MaxMetrics: 10}, "": {MaxMetrics: 100}}, quotas)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"team.a": {"max_metrics": 10}}`), 0600))
+	_, err = LoadQuotas(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"team-a": {"max_metrics": -1}}`), 0600))
+	_, err = LoadQuotas(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"devops-tpl/internal/metrics"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxLineSize - ограничение длины строки ndjson.
+const maxLineSize = 1 << 20
+
+var csvHeader = []string{"id", "type", "value"}
+
+func writeJSON(writer io.Writer, batch []metrics.Metric) error {
+	if batch == nil {
+		batch = []metrics.Metric{}
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(batch)
+}
+
+func readJSON(reader io.Reader) ([]metrics.Metric, error) {
+	var metrics []metrics.Metric
+	err := json.NewDecoder(reader).Decode(&metrics)
+	if err != nil {
+		return nil, fmt.Errorf("json decode error: %w", err)
+	}
+
+	for i, metric := range metrics {
+		err = validateMetric(metric)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+
+	return metrics, nil
+}
+
+func writeNDJSON(writer io.Writer, metrics []metrics.Metric) error {
+	encoder := json.NewEncoder(writer)
+	for _, metric := range metrics {
+		err := encoder.Encode(metric)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readNDJSON(reader io.Reader) ([]metrics.Metric, error) {
+	var batch []metrics.Metric
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var metric metrics.Metric
+		err := json.Unmarshal(line, &metric)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		err = validateMetric(metric)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		batch = append(batch, metric)
+	}
+
+	return batch, scanner.Err()
+}
+
+func writeCSV(writer io.Writer, metrics []metrics.Metric) error {
+	csvWriter := csv.NewWriter(writer)
+	err := csvWriter.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, metric := range metrics {
+		err = csvWriter.Write([]string{metric.ID, metric.MType, formatValue(metric)})
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func readCSV(reader io.Reader) ([]metrics.Metric, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = len(csvHeader)
+
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("csv decode error: %w", err)
+	}
+	// Заголовок необязателен
+	if len(records) != 0 && records[0][0] == csvHeader[0] && records[0][1] == csvHeader[1] {
+		records = records[1:]
+	}
+
+	batch := make([]metrics.Metric, 0, len(records))
+	for i, record := range records {
+		metric := metrics.Metric{ID: record[0], MetricValue: metrics.MetricValue{MType: record[1]}}
+
+		switch metric.MType {
+		case metrics.MeticTypeCounter:
+			delta, err := strconv.ParseInt(record[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %w", i+1, err)
+			}
+			metric.Delta = &delta
+		case metrics.MeticTypeGauge:
+			value, err := strconv.ParseFloat(record[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %w", i+1, err)
+			}
+			metric.Value = &value
+		}
+
+		err = validateMetric(metric)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		batch = append(batch, metric)
+	}
+
+	return batch, nil
+}
@@ -0,0 +1,129 @@
+package transfer
+
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/storage"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Change - изменение одной метрики при загрузке.
+type Change struct {
+	// Old - текущее значение, nil для новой метрики
+	Old *metrics.MetricValue
+	// New - значение после загрузки
+	New metrics.Metric
+	// Update - обновление для хранилища: для counter хранилище принимает приращение
+	Update metrics.Metric
+}
+
+// Plan - изменения хранилища при загрузке.
+type Plan struct {
+	Changes   []Change
+	Unchanged int
+}
+
+// NewPlan - изменения, которые внесет загрузка metrics в хранилище с текущими значениями current.
+// Повторы ID в загружаемых данных: gauge - последнее значение, counter - последнее (overwrite) или сумма (merge).
+func NewPlan(current map[string]storage.MetricMap, batch []metrics.Metric, mode string) (Plan, error) {
+	if mode != ModeOverwrite && mode != ModeMerge {
+		return Plan{}, ErrUnknownMode
+	}
+
+	type metricKey struct{ mType, id string }
+	incoming := map[metricKey]metrics.Metric{}
+	for _, metric := range batch {
+		key := metricKey{metric.MType, metric.ID}
+		previous, ok := incoming[key]
+		if ok && mode == ModeMerge && metric.MType == metrics.MeticTypeCounter {
+			delta := *previous.Delta + *metric.Delta
+			metric.Delta = &delta
+		}
+		incoming[key] = metric
+	}
+
+	var plan Plan
+	for _, metric := range incoming {
+		var old *metrics.MetricValue
+		if oldValue, ok := current[metric.MType][metric.ID]; ok {
+			old = &oldValue
+		}
+
+		change, changed := planMetric(old, metric, mode)
+		if !changed {
+			plan.Unchanged++
+			continue
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		if plan.Changes[i].New.MType != plan.Changes[j].New.MType {
+			return plan.Changes[i].New.MType < plan.Changes[j].New.MType
+		}
+		return plan.Changes[i].New.ID < plan.Changes[j].New.ID
+	})
+
+	return plan, nil
+}
+
+func planMetric(old *metrics.MetricValue, metric metrics.Metric, mode string) (Change, bool) {
+	change := Change{Old: old, New: metric, Update: metric}
+
+	if metric.MType == metrics.MeticTypeGauge {
+		return change, old == nil || *old.Value != *metric.Value
+	}
+
+	if old == nil {
+		return change, true
+	}
+
+	if mode == ModeMerge {
+		newValue := *old.Delta + *metric.Delta
+		change.New.Delta = &newValue
+		return change, *metric.Delta != 0
+	}
+
+	delta := *metric.Delta - *old.Delta
+	change.Update.Delta = &delta
+	return change, delta != 0
+}
+
+// Updates - обновления для хранилища.
+func (plan Plan) Updates() []metrics.Metric {
+	updates := make([]metrics.Metric, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		updates = append(updates, change.Update)
+	}
+
+	return updates
+}
+
+// Apply - запись изменений в хранилище одним пакетом.
+// Для counter в режиме overwrite записывается разница с прочитанным значением: параллельные обновления
+// с момента чтения сохраняются.
+func (plan Plan) Apply(metricStorage storage.MetricStorage) error {
+	if len(plan.Changes) == 0 {
+		return nil
+	}
+
+	return metricStorage.UpdateManySliceMetric(plan.Updates())
+}
+
+// PrintDiff - вывод изменений: "+" новая метрика, "~" измененная.
+func (plan Plan) PrintDiff(writer io.Writer) {
+	var added int
+	for _, change := range plan.Changes {
+		if change.Old == nil {
+			added++
+			fmt.Fprintf(writer, "+ %s %s %s\n", change.New.MType, change.New.ID, formatValue(change.New))
+			continue
+		}
+
+		oldMetric := metrics.Metric{ID: change.New.ID, MetricValue: *change.Old}
+		fmt.Fprintf(writer, "~ %s %s %s -> %s\n", change.New.MType, change.New.ID, formatValue(oldMetric), formatValue(change.New))
+	}
+
+	fmt.Fprintf(writer, "%d to add, %d to change, %d unchanged\n", added, len(plan.Changes)-added, plan.Unchanged)
+}
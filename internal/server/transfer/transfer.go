@@ -0,0 +1,108 @@
+// Package transfer - выгрузка метрик из хранилища в файл и загрузка обратно (перенос между хранилищами,
+// наполнение тестового сервера).
+//
+// Форматы: json (массив в формате /updates/), ndjson (метрика на строку) и csv (id,type,value).
+// При загрузке gauge перезаписываются, для counter выбирается режим: overwrite - значение из файла
+// заменяет текущее, merge - значение из файла прибавляется к текущему.
+package transfer
+
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/storage"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+const (
+	ModeOverwrite = "overwrite"
+	ModeMerge     = "merge"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown format, expected json, ndjson or csv")
+	ErrUnknownMode   = errors.New("unknown import mode, expected overwrite or merge")
+)
+
+// FormatByPath - формат по расширению файла, json если расширение не распознано.
+func FormatByPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	case ".csv":
+		return FormatCSV
+	default:
+		return FormatJSON
+	}
+}
+
+// Flatten - метрики хранилища списком, упорядоченным по типу и ID.
+func Flatten(allMetrics map[string]storage.MetricMap) []metrics.Metric {
+	return storage.SortedMetrics(allMetrics, "")
+}
+
+// Export - запись метрик в writer в формате format.
+func Export(writer io.Writer, format string, metrics []metrics.Metric) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(writer, metrics)
+	case FormatNDJSON:
+		return writeNDJSON(writer, metrics)
+	case FormatCSV:
+		return writeCSV(writer, metrics)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// Import - чтение и проверка метрик из reader в формате format.
+func Import(reader io.Reader, format string) ([]metrics.Metric, error) {
+	switch format {
+	case FormatJSON:
+		return readJSON(reader)
+	case FormatNDJSON:
+		return readNDJSON(reader)
+	case FormatCSV:
+		return readCSV(reader)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+func validateMetric(metric metrics.Metric) error {
+	if metric.ID == "" {
+		return errors.New("metric id is empty")
+	}
+
+	switch metric.MType {
+	case metrics.MeticTypeGauge:
+		if metric.Value == nil {
+			return fmt.Errorf("gauge %s: value is empty", metric.ID)
+		}
+	case metrics.MeticTypeCounter:
+		if metric.Delta == nil {
+			return fmt.Errorf("counter %s: delta is empty", metric.ID)
+		}
+	default:
+		return fmt.Errorf("metric %s: unknown type %q", metric.ID, metric.MType)
+	}
+
+	return nil
+}
+
+func formatValue(metric metrics.Metric) string {
+	if metric.MType == metrics.MeticTypeCounter {
+		return strconv.FormatInt(*metric.Delta, 10)
+	}
+
+	return strconv.FormatFloat(*metric.Value, 'g', -1, 64)
+}
@@ -0,0 +1,123 @@
+package transfer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func counterMetric(metricID string, delta int64) metrics.Metric {
+	return metrics.Metric{ID: metricID, MetricValue: metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}}
+}
+
+func gaugeMetric(metricID string, value float64) metrics.Metric {
+	return metrics.Metric{ID: metricID, MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}}
+}
+
+func TestExportImport(t *testing.T) {
+	metrics := []metrics.Metric{
+		counterMetric("PollCount", 42),
+		gaugeMetric("Alloc", 0.1),
+		gaugeMetric(`cpu{host="a,b"}`, 1e-9),
+	}
+
+	for _, format := range []string{FormatJSON, FormatNDJSON, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			require.NoError(t, Export(buffer, format, metrics))
+
+			imported, err := Import(buffer, format)
+			require.NoError(t, err)
+			require.Equal(t, metrics, imported)
+		})
+	}
+
+	require.ErrorIs(t, Export(&bytes.Buffer{}, "xml", metrics), ErrUnknownFormat)
+	require.Equal(t, FormatCSV, FormatByPath("/tmp/metrics.CSV"))
+	require.Equal(t, FormatNDJSON, FormatByPath("metrics.jsonl"))
+	require.Equal(t, FormatJSON, FormatByPath(""))
+}
+
+func TestImport_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{"json without value", FormatJSON, `[{"id":"Alloc","type":"gauge"}]`},
+		{"json unknown type", FormatJSON, `[{"id":"Alloc","type":"histogram","value":1}]`},
+		{"ndjson broken line", FormatNDJSON, "{\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":1}\n{\"id\":"},
+		{"csv float counter", FormatCSV, "PollCount,counter,1.5\n"},
+		{"csv empty id", FormatCSV, ",gauge,1.5\n"},
+		{"csv missing column", FormatCSV, "Alloc,gauge\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Import(strings.NewReader(tt.input), tt.format)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	repository := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	require.NoError(t, repository.UpdateManySliceMetric([]metrics.Metric{
+		counterMetric("PollCount", 10),
+		counterMetric("Requests", 3),
+		gaugeMetric("Alloc", 1.5),
+	}))
+
+	batch := []metrics.Metric{
+		counterMetric("PollCount", 4),
+		counterMetric("PollCount", 6),
+		counterMetric("Requests", 0),
+		counterMetric("Errors", 2),
+		gaugeMetric("Alloc", 1.5),
+		gaugeMetric("Heap", 7),
+	}
+
+	_, err := NewPlan(repository.ReadAll(), batch, "replace")
+	require.ErrorIs(t, err, ErrUnknownMode)
+
+	// overwrite: PollCount 10 -> 6, Requests 3 -> 0
+	plan, err := NewPlan(repository.ReadAll(), batch, ModeOverwrite)
+	require.NoError(t, err)
+	require.Len(t, plan.Changes, 4)
+	require.Equal(t, 1, plan.Unchanged)
+
+	diff := &bytes.Buffer{}
+	plan.PrintDiff(diff)
+	require.Equal(t, `+ counter Errors 2
+~ counter PollCount 10 -> 6
+~ counter Requests 3 -> 0
++ gauge Heap 7
+2 to add, 2 to change, 1 unchanged
+`, diff.String())
+
+	// merge: PollCount 10 + 4 + 6, Requests без изменений
+	mergePlan, err := NewPlan(repository.ReadAll(), batch, ModeMerge)
+	require.NoError(t, err)
+	require.Len(t, mergePlan.Changes, 3)
+	require.Equal(t, 2, mergePlan.Unchanged)
+	require.EqualValues(t, 20, *mergePlan.Changes[1].New.Delta)
+	require.EqualValues(t, 10, *mergePlan.Changes[1].Update.Delta)
+
+	require.NoError(t, plan.Apply(repository))
+	allMetrics := repository.ReadAll()
+	require.EqualValues(t, 6, *allMetrics[metrics.MeticTypeCounter]["PollCount"].Delta)
+	require.EqualValues(t, 0, *allMetrics[metrics.MeticTypeCounter]["Requests"].Delta)
+	require.EqualValues(t, 2, *allMetrics[metrics.MeticTypeCounter]["Errors"].Delta)
+	require.EqualValues(t, 7, *allMetrics[metrics.MeticTypeGauge]["Heap"].Value)
+
+	// Повторная загрузка ничего не меняет
+	plan, err = NewPlan(repository.ReadAll(), batch, ModeOverwrite)
+	require.NoError(t, err)
+	require.Empty(t, plan.Changes)
+}
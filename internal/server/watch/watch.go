@@ -0,0 +1,198 @@
+// Package watch - рассылка принятых обновлений метрик подписчикам для просмотра в реальном времени
+// (metricsctl tail по HTTP SSE и gRPC).
+//
+// Подписчику отправляются обновления в том виде, в котором они приняты (для counter - приращение),
+// только метрики арендатора подписки и с ID без префикса арендатора.
+// Рассылка не блокирует запись: если подписчик не успевает читать, обновления для него пропускаются.
+package watch
+
+import (
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// subscriptionBuffer - количество обновлений, ожидающих чтения подписчиком.
+const subscriptionBuffer = 1024
+
+// Subscription - подписка на обновления метрик арендатора с ID, содержащим строку поиска.
+type Subscription struct {
+	hub *Hub
+	// tenant - арендатор подписки, tenant.All - все арендаторы с полными ключами хранилища
+	tenant  string
+	search  string
+	updates chan metrics.Metric
+	dropped *atomic.Int64
+}
+
+// Updates - канал обновлений, закрывается при отписке и остановке рассылки.
+func (subscription *Subscription) Updates() <-chan metrics.Metric {
+	return subscription.updates
+}
+
+// Dropped - количество пропущенных обновлений.
+func (subscription *Subscription) Dropped() int64 {
+	return subscription.dropped.Load()
+}
+
+// Close - отписка.
+func (subscription *Subscription) Close() {
+	subscription.hub.unsubscribe(subscription)
+}
+
+// Hub - рассылка обновлений подписчикам.
+type Hub struct {
+	mutex         *sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		mutex:         &sync.RWMutex{},
+		subscriptions: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe - подписка на обновления метрик арендатора tenantName с ID, содержащим search (пустая строка - все обновления).
+// После остановки рассылки возвращается подписка с закрытым каналом.
+func (hub *Hub) Subscribe(tenantName string, search string) *Subscription {
+	subscription := &Subscription{
+		hub:     hub,
+		tenant:  tenantName,
+		search:  search,
+		updates: make(chan metrics.Metric, subscriptionBuffer),
+		dropped: &atomic.Int64{},
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.closed {
+		close(subscription.updates)
+		return subscription
+	}
+	hub.subscriptions[subscription] = struct{}{}
+
+	return subscription
+}
+
+func (hub *Hub) unsubscribe(subscription *Subscription) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if _, ok := hub.subscriptions[subscription]; !ok {
+		return
+	}
+	delete(hub.subscriptions, subscription)
+	close(subscription.updates)
+}
+
+// Publish - рассылка обновлений подписчикам.
+func (hub *Hub) Publish(metrics []metrics.Metric) {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	if len(hub.subscriptions) == 0 {
+		return
+	}
+
+	for _, metric := range metrics {
+		metric = copyMetric(metric)
+		metricTenant, metricID := tenant.SplitKey(metric.ID)
+		for subscription := range hub.subscriptions {
+			update := metric
+			if subscription.tenant != tenant.All {
+				if metricTenant != subscription.tenant {
+					continue
+				}
+				update.ID = metricID
+			}
+			if !strings.Contains(update.ID, subscription.search) {
+				continue
+			}
+
+			select {
+			case subscription.updates <- update:
+			default:
+				subscription.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// Close - остановка рассылки: каналы всех подписок закрываются, чтобы завершить потоки при остановке сервера.
+func (hub *Hub) Close() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.closed = true
+	for subscription := range hub.subscriptions {
+		close(subscription.updates)
+	}
+	hub.subscriptions = map[*Subscription]struct{}{}
+}
+
+// copyMetric - копия значения, не зависящая от указателей отправителя.
+func copyMetric(metric metrics.Metric) metrics.Metric {
+	if metric.Delta != nil {
+		delta := *metric.Delta
+		metric.Delta = &delta
+	}
+	if metric.Value != nil {
+		value := *metric.Value
+		metric.Value = &value
+	}
+
+	return metric
+}
+
+// WatchingStorage - хранилище, рассылающее принятые обновления подписчикам.
+type WatchingStorage struct {
+	storage.MetricStorage
+	hub *Hub
+}
+
+func NewWatchingStorage(metricStorage storage.MetricStorage, hub *Hub) WatchingStorage {
+	return WatchingStorage{
+		MetricStorage: metricStorage,
+		hub:           hub,
+	}
+}
+
+func (watchingStorage WatchingStorage) Update(key string, value metrics.MetricValue) error {
+	err := watchingStorage.MetricStorage.Update(key, value)
+	if err != nil {
+		return err
+	}
+
+	watchingStorage.hub.Publish([]metrics.Metric{{ID: key, MetricValue: value}})
+	return nil
+}
+
+func (watchingStorage WatchingStorage) UpdateManySliceMetric(MetricBatch []metrics.Metric) error {
+	err := watchingStorage.MetricStorage.UpdateManySliceMetric(MetricBatch)
+	if err != nil {
+		return err
+	}
+
+	watchingStorage.hub.Publish(MetricBatch)
+	return nil
+}
+
+func (watchingStorage WatchingStorage) UpdateMany(DBSchema map[string]metrics.MetricValue) error {
+	err := watchingStorage.MetricStorage.UpdateMany(DBSchema)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]metrics.Metric, 0, len(DBSchema))
+	for key, value := range DBSchema {
+		batch = append(batch, metrics.Metric{ID: key, MetricValue: value})
+	}
+	watchingStorage.hub.Publish(batch)
+	return nil
+}
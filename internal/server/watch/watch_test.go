@@ -0,0 +1,101 @@
+package watch
+
+import (
+	"testing"
+
+	"devops-tpl/internal/metrics"
+	"devops-tpl/internal/server/config"
+	"devops-tpl/internal/server/storage"
+	"devops-tpl/internal/server/tenant"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	watchingStorage := NewWatchingStorage(storage.NewMetricsMemoryRepo(config.StoreConfig{}), hub)
+
+	all := hub.Subscribe("", "")
+	pollCount := hub.Subscribe("", "Poll")
+
+	var delta int64 = 5
+	require.NoError(t, watchingStorage.Update("PollCount", metrics.MetricValue{MType: metrics.MeticTypeCounter, Delta: &delta}))
+	// Значение отправлено копией
+	delta = 100
+	var value = 1.5
+	require.NoError(t, watchingStorage.UpdateManySliceMetric([]metrics.Metric{
+		{ID: "Alloc", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}},
+	}))
+	// Отклоненное обновление не рассылается
+	require.Error(t, watchingStorage.Update("Alloc", metrics.MetricValue{MType: metrics.MeticTypeGauge}))
+
+	update := <-all.Updates()
+	require.Equal(t, "PollCount", update.ID)
+	require.EqualValues(t, 5, *update.Delta)
+	update = <-all.Updates()
+	require.Equal(t, "Alloc", update.ID)
+	require.Empty(t, all.Updates())
+
+	update = <-pollCount.Updates()
+	require.Equal(t, "PollCount", update.ID)
+	require.Empty(t, pollCount.Updates())
+
+	pollCount.Close()
+	_, ok := <-pollCount.Updates()
+	require.False(t, ok)
+	// Повторная отписка допустима
+	pollCount.Close()
+
+	hub.Close()
+	_, ok = <-all.Updates()
+	require.False(t, ok)
+	_, ok = <-hub.Subscribe("", "").Updates()
+	require.False(t, ok)
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	subscription := hub.Subscribe("", "")
+	defer subscription.Close()
+
+	var value = 1.5
+	metric := metrics.Metric{ID: "Alloc", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}}
+	for i := 0; i < subscriptionBuffer+10; i++ {
+		hub.Publish([]metrics.Metric{metric})
+	}
+
+	require.Len(t, subscription.Updates(), subscriptionBuffer)
+	require.EqualValues(t, 10, subscription.Dropped())
+}
+
+func TestHub_Tenants(t *testing.T) {
+	hub := NewHub()
+	defaultTenant := hub.Subscribe("", "")
+	teamA := hub.Subscribe("team-a", "")
+	allTenants := hub.Subscribe(tenant.All, "")
+
+	var value = 1.5
+	hub.Publish([]metrics.Metric{
+		{ID: "Alloc", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}},
+		{ID: "team-a::Alloc", MetricValue: metrics.MetricValue{MType: metrics.MeticTypeGauge, Value: &value}},
+	})
+	hub.Close()
+
+	var ids []string
+	for update := range defaultTenant.Updates() {
+		ids = append(ids, update.ID)
+	}
+	require.Equal(t, []string{"Alloc"}, ids)
+
+	ids = nil
+	for update := range teamA.Updates() {
+		ids = append(ids, update.ID)
+	}
+	require.Equal(t, []string{"Alloc"}, ids)
+
+	ids = nil
+	for update := range allTenants.Updates() {
+		ids = append(ids, update.ID)
+	}
+	require.Equal(t, []string{"Alloc", "team-a::Alloc"}, ids)
+}
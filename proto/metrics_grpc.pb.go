@@ -23,6 +23,15 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type MetricsClient interface {
 	UpdateMetrics(ctx context.Context, in *UpdateMetricsRequest, opts ...grpc.CallOption) (*Empty, error)
+	ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error)
+	GetMetric(ctx context.Context, in *MetricRequest, opts ...grpc.CallOption) (*Metric, error)
+	DeleteMetric(ctx context.Context, in *MetricRequest, opts ...grpc.CallOption) (*Empty, error)
+	WatchMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (Metrics_WatchMetricsClient, error)
+	Ping(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+	RegisterAgent(ctx context.Context, in *AgentInfo, opts ...grpc.CallOption) (*Empty, error)
+	AgentHeartbeat(ctx context.Context, in *AgentHeartbeatRequest, opts ...grpc.CallOption) (*Empty, error)
+	ListAgents(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ListAgentsResponse, error)
+	WatchAgentConfig(ctx context.Context, in *AgentConfigRequest, opts ...grpc.CallOption) (Metrics_WatchAgentConfigClient, error)
 }
 
 type metricsClient struct {
@@ -42,11 +51,147 @@ func (c *metricsClient) UpdateMetrics(ctx context.Context, in *UpdateMetricsRequ
 	return out, nil
 }
 
+func (c *metricsClient) ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error) {
+	out := new(ListMetricsResponse)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/ListMetrics", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) GetMetric(ctx context.Context, in *MetricRequest, opts ...grpc.CallOption) (*Metric, error) {
+	out := new(Metric)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/GetMetric", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) DeleteMetric(ctx context.Context, in *MetricRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/DeleteMetric", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) WatchMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (Metrics_WatchMetricsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Metrics_ServiceDesc.Streams[0], "/metrics.Metrics/WatchMetrics", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsWatchMetricsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Metrics_WatchMetricsClient interface {
+	Recv() (*Metric, error)
+	grpc.ClientStream
+}
+
+type metricsWatchMetricsClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsWatchMetricsClient) Recv() (*Metric, error) {
+	m := new(Metric)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *metricsClient) Ping(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/Ping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) RegisterAgent(ctx context.Context, in *AgentInfo, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/RegisterAgent", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) AgentHeartbeat(ctx context.Context, in *AgentHeartbeatRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/AgentHeartbeat", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) ListAgents(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ListAgentsResponse, error) {
+	out := new(ListAgentsResponse)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/ListAgents", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) WatchAgentConfig(ctx context.Context, in *AgentConfigRequest, opts ...grpc.CallOption) (Metrics_WatchAgentConfigClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Metrics_ServiceDesc.Streams[1], "/metrics.Metrics/WatchAgentConfig", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsWatchAgentConfigClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Metrics_WatchAgentConfigClient interface {
+	Recv() (*AgentConfigAssignment, error)
+	grpc.ClientStream
+}
+
+type metricsWatchAgentConfigClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsWatchAgentConfigClient) Recv() (*AgentConfigAssignment, error) {
+	m := new(AgentConfigAssignment)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // MetricsServer is the server API for Metrics service.
 // All implementations must embed UnimplementedMetricsServer
 // for forward compatibility
 type MetricsServer interface {
 	UpdateMetrics(context.Context, *UpdateMetricsRequest) (*Empty, error)
+	ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error)
+	GetMetric(context.Context, *MetricRequest) (*Metric, error)
+	DeleteMetric(context.Context, *MetricRequest) (*Empty, error)
+	WatchMetrics(*ListMetricsRequest, Metrics_WatchMetricsServer) error
+	Ping(context.Context, *Empty) (*Empty, error)
+	RegisterAgent(context.Context, *AgentInfo) (*Empty, error)
+	AgentHeartbeat(context.Context, *AgentHeartbeatRequest) (*Empty, error)
+	ListAgents(context.Context, *Empty) (*ListAgentsResponse, error)
+	WatchAgentConfig(*AgentConfigRequest, Metrics_WatchAgentConfigServer) error
 	mustEmbedUnimplementedMetricsServer()
 }
 
@@ -57,6 +202,33 @@ type UnimplementedMetricsServer struct {
 func (UnimplementedMetricsServer) UpdateMetrics(context.Context, *UpdateMetricsRequest) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateMetrics not implemented")
 }
+func (UnimplementedMetricsServer) ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMetrics not implemented")
+}
+func (UnimplementedMetricsServer) GetMetric(context.Context, *MetricRequest) (*Metric, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetric not implemented")
+}
+func (UnimplementedMetricsServer) DeleteMetric(context.Context, *MetricRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMetric not implemented")
+}
+func (UnimplementedMetricsServer) WatchMetrics(*ListMetricsRequest, Metrics_WatchMetricsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchMetrics not implemented")
+}
+func (UnimplementedMetricsServer) Ping(context.Context, *Empty) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
+func (UnimplementedMetricsServer) RegisterAgent(context.Context, *AgentInfo) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterAgent not implemented")
+}
+func (UnimplementedMetricsServer) AgentHeartbeat(context.Context, *AgentHeartbeatRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AgentHeartbeat not implemented")
+}
+func (UnimplementedMetricsServer) ListAgents(context.Context, *Empty) (*ListAgentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAgents not implemented")
+}
+func (UnimplementedMetricsServer) WatchAgentConfig(*AgentConfigRequest, Metrics_WatchAgentConfigServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchAgentConfig not implemented")
+}
 func (UnimplementedMetricsServer) mustEmbedUnimplementedMetricsServer() {}
 
 // UnsafeMetricsServer may be embedded to opt out of forward compatibility for this service.
@@ -88,6 +260,174 @@ func _Metrics_UpdateMetrics_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Metrics_ListMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).ListMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/ListMetrics",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).ListMetrics(ctx, req.(*ListMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_GetMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).GetMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/GetMetric",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).GetMetric(ctx, req.(*MetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_DeleteMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).DeleteMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/DeleteMetric",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).DeleteMetric(ctx, req.(*MetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_WatchMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListMetricsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServer).WatchMetrics(m, &metricsWatchMetricsServer{stream})
+}
+
+type Metrics_WatchMetricsServer interface {
+	Send(*Metric) error
+	grpc.ServerStream
+}
+
+type metricsWatchMetricsServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsWatchMetricsServer) Send(m *Metric) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Metrics_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/Ping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).Ping(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_RegisterAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AgentInfo)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).RegisterAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/RegisterAgent",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).RegisterAgent(ctx, req.(*AgentInfo))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_AgentHeartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AgentHeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).AgentHeartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/AgentHeartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).AgentHeartbeat(ctx, req.(*AgentHeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_ListAgents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).ListAgents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/ListAgents",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).ListAgents(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_WatchAgentConfig_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AgentConfigRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServer).WatchAgentConfig(m, &metricsWatchAgentConfigServer{stream})
+}
+
+type Metrics_WatchAgentConfigServer interface {
+	Send(*AgentConfigAssignment) error
+	grpc.ServerStream
+}
+
+type metricsWatchAgentConfigServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsWatchAgentConfigServer) Send(m *AgentConfigAssignment) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Metrics_ServiceDesc is the grpc.ServiceDesc for Metrics service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -99,7 +439,46 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateMetrics",
 			Handler:    _Metrics_UpdateMetrics_Handler,
 		},
+		{
+			MethodName: "ListMetrics",
+			Handler:    _Metrics_ListMetrics_Handler,
+		},
+		{
+			MethodName: "GetMetric",
+			Handler:    _Metrics_GetMetric_Handler,
+		},
+		{
+			MethodName: "DeleteMetric",
+			Handler:    _Metrics_DeleteMetric_Handler,
+		},
+		{
+			MethodName: "Ping",
+			Handler:    _Metrics_Ping_Handler,
+		},
+		{
+			MethodName: "RegisterAgent",
+			Handler:    _Metrics_RegisterAgent_Handler,
+		},
+		{
+			MethodName: "AgentHeartbeat",
+			Handler:    _Metrics_AgentHeartbeat_Handler,
+		},
+		{
+			MethodName: "ListAgents",
+			Handler:    _Metrics_ListAgents_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchMetrics",
+			Handler:       _Metrics_WatchMetrics_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchAgentConfig",
+			Handler:       _Metrics_WatchAgentConfig_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/metrics.proto",
 }
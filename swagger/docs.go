@@ -205,7 +205,7 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/storage.Metric"
+                                "$ref": "#/definitions/metrics.Metric"
                             }
                         }
                     }
@@ -284,7 +284,7 @@ const docTemplate = `{
         }
     },
     "definitions": {
-        "storage.Metric": {
+        "metrics.Metric": {
             "type": "object",
             "properties": {
                 "delta": {